@@ -0,0 +1,210 @@
+package internal
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ttab/elephant-api/repository"
+)
+
+// ACLMapping rewrites the grantee URIs of replicated ACLs. Exact rewrites take
+// precedence over prefix rewrites, and the longest matching prefix wins.
+// Grantees that don't match any rewrite are given the default URI, or dropped
+// if no default has been set.
+//
+// A zero ACLMapping copies ACLs verbatim.
+type ACLMapping struct {
+	// Exact maps source grantee URIs to target grantee URIs.
+	Exact map[string]string
+	// Prefixes maps source URI prefixes to the target prefixes that they
+	// should be replaced with.
+	Prefixes map[string]string
+	// Default is the grantee URI used for grantees that don't match any
+	// rewrite.
+	Default string
+}
+
+// IsZero returns true if the mapping doesn't have any rewrites or default.
+func (m ACLMapping) IsZero() bool {
+	return len(m.Exact) == 0 && len(m.Prefixes) == 0 && m.Default == ""
+}
+
+// MapURI returns the target URI for a source grantee URI. Returns false if the
+// grantee should be dropped.
+func (m ACLMapping) MapURI(uri string) (string, bool) {
+	if m.IsZero() {
+		return uri, true
+	}
+
+	if target, ok := m.Exact[uri]; ok {
+		return target, true
+	}
+
+	var (
+		match       string
+		matchTarget string
+		found       bool
+	)
+
+	for prefix, target := range m.Prefixes {
+		if !strings.HasPrefix(uri, prefix) || (found && len(prefix) < len(match)) {
+			continue
+		}
+
+		match = prefix
+		matchTarget = target
+		found = true
+	}
+
+	if found {
+		return matchTarget + strings.TrimPrefix(uri, match), true
+	}
+
+	if m.Default != "" {
+		return m.Default, true
+	}
+
+	return "", false
+}
+
+// Apply returns the ACL with all grantees rewritten. Permissions are merged if
+// several grantees are mapped to the same URI.
+func (m ACLMapping) Apply(acl []*repository.ACLEntry) []*repository.ACLEntry {
+	if m.IsZero() {
+		return acl
+	}
+
+	var (
+		result []*repository.ACLEntry
+		byURI  = make(map[string]*repository.ACLEntry)
+	)
+
+	for _, entry := range acl {
+		uri, ok := m.MapURI(entry.Uri)
+		if !ok {
+			continue
+		}
+
+		existing, ok := byURI[uri]
+		if !ok {
+			existing = &repository.ACLEntry{Uri: uri}
+			byURI[uri] = existing
+
+			result = append(result, existing)
+		}
+
+		for _, p := range entry.Permissions {
+			if !slices.Contains(existing.Permissions, p) {
+				existing.Permissions = append(existing.Permissions, p)
+			}
+		}
+	}
+
+	for _, entry := range result {
+		slices.Sort(entry.Permissions)
+	}
+
+	return result
+}
+
+// ParseACLMapping parses ACL rewrites in the format "[source]=[target]". A
+// source ending with "*" is treated as a prefix that will be replaced with the
+// target, f.ex. "core://unit/*=core://unit/stage-".
+func ParseACLMapping(specs []string, defaultURI string) (ACLMapping, error) {
+	m := ACLMapping{
+		Exact:    make(map[string]string),
+		Prefixes: make(map[string]string),
+		Default:  defaultURI,
+	}
+
+	for _, s := range specs {
+		source, target, ok := strings.Cut(s, "=")
+		if !ok || source == "" || target == "" {
+			return ACLMapping{}, fmt.Errorf("invalid ACL mapping %q", s)
+		}
+
+		rules := m.Exact
+
+		prefix, isPrefix := strings.CutSuffix(source, "*")
+		if isPrefix {
+			rules = m.Prefixes
+			source = prefix
+		}
+
+		if _, exists := rules[source]; exists {
+			return ACLMapping{}, fmt.Errorf(
+				"duplicate ACL mapping for %q", source)
+		}
+
+		rules[source] = target
+	}
+
+	return m, nil
+}
+
+// ACLTemplate is a fixed ACL that all replicated documents are given instead
+// of their source ACL, f.ex. public read access for a public mirror. Source
+// ACL changes aren't replicated when a template is used. A zero ACLTemplate
+// replicates the source ACLs.
+type ACLTemplate []*repository.ACLEntry
+
+// IsZero returns true if the template doesn't have any entries.
+func (t ACLTemplate) IsZero() bool {
+	return len(t) == 0
+}
+
+// Entries returns a copy of the template entries, so that updates can't
+// modify the template.
+func (t ACLTemplate) Entries() []*repository.ACLEntry {
+	if t.IsZero() {
+		return nil
+	}
+
+	entries := make([]*repository.ACLEntry, len(t))
+
+	for i, entry := range t {
+		entries[i] = &repository.ACLEntry{
+			Uri:         entry.Uri,
+			Permissions: slices.Clone(entry.Permissions),
+		}
+	}
+
+	return entries
+}
+
+// ParseACLTemplate parses ACL template entries in the format
+// "[grantee]=[permissions]", where every letter of the permissions is a
+// permission, f.ex. "core://public=r".
+func ParseACLTemplate(specs []string) (ACLTemplate, error) {
+	var t ACLTemplate
+
+	seen := make(map[string]bool, len(specs))
+
+	for _, s := range specs {
+		uri, permissions, ok := strings.Cut(s, "=")
+		if !ok || uri == "" || permissions == "" {
+			return nil, fmt.Errorf("invalid ACL template entry %q", s)
+		}
+
+		if seen[uri] {
+			return nil, fmt.Errorf("duplicate ACL template entry for %q", uri)
+		}
+
+		seen[uri] = true
+
+		entry := repository.ACLEntry{Uri: uri}
+
+		for _, p := range strings.Split(permissions, "") {
+			if !slices.Contains(entry.Permissions, p) {
+				entry.Permissions = append(entry.Permissions, p)
+			}
+		}
+
+		slices.Sort(entry.Permissions)
+
+		t = append(t, &entry)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ttab/elephant-api/repository"
+)
+
+// ACLRule matches ACL entries that grant a permission to a grantee.
+type ACLRule struct {
+	// URI of the grantee, a URI ending with "*" matches all grantees with
+	// the prefix.
+	URI string
+	// Permission that the grantee must have, matches all permissions if
+	// empty.
+	Permission string
+}
+
+// Matches returns true if the ACL entry matches the rule.
+func (r ACLRule) Matches(entry *repository.ACLEntry) bool {
+	prefix, isPrefix := strings.CutSuffix(r.URI, "*")
+
+	switch {
+	case isPrefix && !strings.HasPrefix(entry.Uri, prefix):
+		return false
+	case !isPrefix && entry.Uri != r.URI:
+		return false
+	case r.Permission == "":
+		return true
+	}
+
+	for _, p := range entry.Permissions {
+		if p == r.Permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ACLRestriction prevents documents that are granted to restricted grantees
+// from being replicated. This is checked against the ACL of the source
+// document, before any ACL mapping is applied.
+//
+// A zero ACLRestriction doesn't restrict any documents.
+type ACLRestriction struct {
+	Rules []ACLRule
+}
+
+// IsZero returns true if there are no restriction rules.
+func (r ACLRestriction) IsZero() bool {
+	return len(r.Rules) == 0
+}
+
+// Restricted checks if an ACL grants the document to a restricted grantee, and
+// returns a description of the matching entry if it does.
+func (r ACLRestriction) Restricted(acl []*repository.ACLEntry) (bool, string) {
+	for _, entry := range acl {
+		for _, rule := range r.Rules {
+			if rule.Matches(entry) {
+				return true, fmt.Sprintf(
+					"granted to restricted grantee %q", entry.Uri)
+			}
+		}
+	}
+
+	return false, ""
+}
+
+// ParseACLRestriction parses restriction rules in the format
+// "[uri]=[permission]", or "[uri]" to match all permissions.
+func ParseACLRestriction(specs []string) (ACLRestriction, error) {
+	var r ACLRestriction
+
+	for _, s := range specs {
+		uri, permission, _ := strings.Cut(s, "=")
+		if uri == "" || uri == "*" {
+			return ACLRestriction{}, fmt.Errorf(
+				"invalid ACL restriction %q", s)
+		}
+
+		r.Rules = append(r.Rules, ACLRule{
+			URI:        uri,
+			Permission: permission,
+		})
+	}
+
+	return r, nil
+}
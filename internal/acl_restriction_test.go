@@ -0,0 +1,63 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/internal"
+)
+
+func TestACLRestriction(t *testing.T) {
+	r, err := internal.ParseACLRestriction([]string{
+		"core://unit/secret",
+		"core://unit/legal/*=w",
+	})
+	if err != nil {
+		t.Fatalf("parse restriction: %v", err)
+	}
+
+	cases := map[string]struct {
+		acl  []*repository.ACLEntry
+		want bool
+	}{
+		"exact grantee": {
+			acl: []*repository.ACLEntry{
+				{Uri: "core://unit/secret", Permissions: []string{"r"}},
+			},
+			want: true,
+		},
+		"prefix with permission": {
+			acl: []*repository.ACLEntry{
+				{Uri: "core://unit/legal/desk", Permissions: []string{"r", "w"}},
+			},
+			want: true,
+		},
+		"prefix without permission": {
+			acl: []*repository.ACLEntry{
+				{Uri: "core://unit/legal/desk", Permissions: []string{"r"}},
+			},
+		},
+		"unrestricted grantee": {
+			acl: []*repository.ACLEntry{
+				{Uri: "core://unit/secretariat", Permissions: []string{"r", "w"}},
+			},
+		},
+		"no ACL": {},
+	}
+
+	for name, c := range cases {
+		got, _ := r.Restricted(c.acl)
+		if got != c.want {
+			t.Errorf("%s: got restricted %v, want %v", name, got, c.want)
+		}
+	}
+}
+
+func TestParseACLRestrictionInvalid(t *testing.T) {
+	for _, spec := range []string{"", "=r", "*"} {
+		_, err := internal.ParseACLRestriction([]string{spec})
+		if err == nil {
+			t.Errorf("expected an error for %q", spec)
+		}
+	}
+}
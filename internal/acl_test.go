@@ -0,0 +1,126 @@
+package internal_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/internal"
+)
+
+func TestACLMappingApply(t *testing.T) {
+	mapping, err := internal.ParseACLMapping([]string{
+		"core://unit/editors=core://unit/stage-editors",
+		"core://user/*=core://user/stage-",
+		"core://user/admins/*=core://user/stage-admins/",
+	}, "")
+	if err != nil {
+		t.Fatalf("parse mapping: %v", err)
+	}
+
+	got := mapping.Apply([]*repository.ACLEntry{
+		{Uri: "core://unit/editors", Permissions: []string{"r", "w"}},
+		{Uri: "core://user/alice", Permissions: []string{"r"}},
+		{Uri: "core://user/admins/bob", Permissions: []string{"w"}},
+		{Uri: "core://unit/unmapped", Permissions: []string{"r"}},
+	})
+
+	want := map[string][]string{
+		"core://unit/stage-editors":    {"r", "w"},
+		"core://user/stage-alice":      {"r"},
+		"core://user/stage-admins/bob": {"w"},
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(got), len(want))
+	}
+
+	for _, entry := range got {
+		perms, ok := want[entry.Uri]
+		if !ok {
+			t.Errorf("unexpected grantee %q", entry.Uri)
+
+			continue
+		}
+
+		if !slices.Equal(entry.Permissions, perms) {
+			t.Errorf("got permissions %v for %q, want %v",
+				entry.Permissions, entry.Uri, perms)
+		}
+	}
+}
+
+func TestACLMappingDefault(t *testing.T) {
+	mapping, err := internal.ParseACLMapping(nil, "core://unit/stage")
+	if err != nil {
+		t.Fatalf("parse mapping: %v", err)
+	}
+
+	got := mapping.Apply([]*repository.ACLEntry{
+		{Uri: "core://user/alice", Permissions: []string{"w"}},
+		{Uri: "core://user/bob", Permissions: []string{"r", "w"}},
+	})
+
+	if len(got) != 1 {
+		t.Fatalf("got %d entries, want the grantees to be merged", len(got))
+	}
+
+	if got[0].Uri != "core://unit/stage" {
+		t.Errorf("got grantee %q, want the default", got[0].Uri)
+	}
+
+	if !slices.Equal(got[0].Permissions, []string{"r", "w"}) {
+		t.Errorf("got permissions %v, want [r w]", got[0].Permissions)
+	}
+}
+
+func TestACLMappingZeroCopiesVerbatim(t *testing.T) {
+	acl := []*repository.ACLEntry{
+		{Uri: "core://user/alice", Permissions: []string{"r"}},
+	}
+
+	got := internal.ACLMapping{}.Apply(acl)
+
+	if len(got) != 1 || got[0].Uri != "core://user/alice" {
+		t.Errorf("expected ACL to be copied verbatim, got %v", got)
+	}
+}
+
+func TestParseACLTemplate(t *testing.T) {
+	template, err := internal.ParseACLTemplate([]string{
+		"core://public=r",
+		"core://unit/editors=wrr",
+	})
+	if err != nil {
+		t.Fatalf("parse ACL template: %v", err)
+	}
+
+	entries := template.Entries()
+
+	if len(entries) != 2 ||
+		entries[0].Uri != "core://public" ||
+		!slices.Equal(entries[0].Permissions, []string{"r"}) ||
+		!slices.Equal(entries[1].Permissions, []string{"r", "w"}) {
+		t.Fatalf("unexpected template entries: %v", entries)
+	}
+
+	entries[0].Permissions[0] = "w"
+
+	if template.Entries()[0].Permissions[0] != "r" {
+		t.Error("expected the entries to be copies of the template")
+	}
+
+	invalid := [][]string{
+		{"core://public"},
+		{"core://public="},
+		{"=r"},
+		{"core://public=r", "core://public=w"},
+	}
+
+	for _, specs := range invalid {
+		_, err := internal.ParseACLTemplate(specs)
+		if err == nil {
+			t.Errorf("expected an error for %v", specs)
+		}
+	}
+}
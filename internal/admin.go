@@ -0,0 +1,921 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/ttab/elephant-replicant/postgres"
+	"github.com/ttab/elephantine"
+	"github.com/ttab/elephantine/pg"
+)
+
+// AdminAPI exposes operational endpoints that aren't covered by the
+// replication Twirp service. All endpoints require the "doc_admin" scope.
+type AdminAPI struct {
+	logger   *slog.Logger
+	db       *pgxpool.Pool
+	manager  *TargetManager
+	managers []*TargetManager
+	fanOut   *pg.FanOut[TargetNotification]
+	parser   elephantine.AuthInfoParser
+}
+
+// NewAdminAPI creates a new admin API. The managers are the target managers
+// of the source shards, the first one is used for document level endpoints.
+func NewAdminAPI(
+	logger *slog.Logger,
+	db *pgxpool.Pool,
+	managers []*TargetManager,
+	fanOut *pg.FanOut[TargetNotification],
+	parser elephantine.AuthInfoParser,
+) *AdminAPI {
+	return &AdminAPI{
+		logger:   logger,
+		db:       db,
+		manager:  managers[0],
+		managers: managers,
+		fanOut:   fanOut,
+		parser:   parser,
+	}
+}
+
+// shardManager returns the target manager for the source shard given in the
+// "shard" query parameter, defaults to the first shard.
+func (a *AdminAPI) shardManager(r *http.Request) (*TargetManager, error) {
+	shard := r.URL.Query().Get("shard")
+	if shard == "" {
+		return a.manager, nil
+	}
+
+	for _, m := range a.managers {
+		if m.Shard() == shard {
+			return m, nil
+		}
+	}
+
+	return nil, elephantine.HTTPErrorf(http.StatusBadRequest,
+		"unknown source shard %q", shard)
+}
+
+// Register adds the admin endpoints to the mux.
+func (a *AdminAPI) Register(mux *http.ServeMux) {
+	mux.Handle("GET /admin/targets/{target}/documents/{uuid}/versions",
+		a.handler(a.listVersionMappings))
+	mux.Handle("GET /admin/targets/{target}/status",
+		a.handler(a.targetStatus))
+	mux.Handle("GET /admin/targets/{target}/errors",
+		a.handler(a.listReplicationErrors))
+	mux.Handle("DELETE /admin/targets/{target}/errors/{uuid}",
+		a.handler(a.clearReplicationErrors))
+	mux.Handle("GET /admin/targets/{target}/conflicts",
+		a.handler(a.listReplicationConflicts))
+	mux.Handle("GET /admin/targets/{target}/documents/{uuid}/compare",
+		a.handler(a.compareDocument))
+	mux.Handle("POST /admin/targets/{target}/documents/{uuid}/resync",
+		a.handler(a.resyncDocument))
+	mux.Handle("POST /admin/targets/{target}/events/{id}/replay",
+		a.handler(a.replayEvent))
+	mux.Handle("POST /admin/targets/{target}/reset",
+		a.handler(a.resetTarget))
+	mux.Handle("POST /admin/targets/{target}/pause",
+		a.handler(a.pauseTarget))
+	mux.Handle("POST /admin/targets/{target}/resume",
+		a.handler(a.resumeTarget))
+	mux.Handle("POST /admin/targets/{target}/poll",
+		a.handler(a.pollTarget))
+	mux.Handle("POST /admin/targets/{target}/attachments/backfill",
+		a.handler(a.startAttachmentBackfill))
+	mux.Handle("GET /admin/targets/{target}/attachments/backfill",
+		a.handler(a.attachmentBackfillStatus))
+}
+
+func (a *AdminAPI) handler(
+	fn func(w http.ResponseWriter, r *http.Request) error,
+) http.Handler {
+	return elephantine.HTTPErrorHandlerFunc(func(
+		w http.ResponseWriter, r *http.Request,
+	) error {
+		auth, err := a.parser.AuthInfoFromHeader(r.Header.Get("Authorization"))
+		if errors.Is(err, elephantine.ErrNoAuthorization) {
+			return elephantine.NewHTTPError(http.StatusUnauthorized,
+				"authentication required")
+		} else if err != nil {
+			return elephantine.HTTPErrorf(http.StatusForbidden,
+				"invalid authorization: %v", err)
+		}
+
+		ctx := elephantine.SetAuthInfo(r.Context(), auth)
+
+		_, err = elephantine.RequireAnyScope(ctx, "doc_admin")
+		if err != nil {
+			return elephantine.NewHTTPError(
+				elephantine.TwirpErrorToHTTPStatusCode(err), err.Error())
+		}
+
+		return fn(w, r.WithContext(ctx))
+	})
+}
+
+// VersionMapping maps a source document version to a target version.
+type VersionMapping struct {
+	SourceVersion int64     `json:"source_version"`
+	TargetVersion int64     `json:"target_version"`
+	Created       time.Time `json:"created"`
+}
+
+// VersionMappingsResponse is a page of version mappings. Pass NextAfter as
+// the "after" parameter to get the next page.
+type VersionMappingsResponse struct {
+	Mappings  []VersionMapping `json:"mappings"`
+	NextAfter int64            `json:"next_after,omitempty"`
+}
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+func (a *AdminAPI) listVersionMappings(
+	w http.ResponseWriter, r *http.Request,
+) error {
+	docUUID, err := uuid.Parse(r.PathValue("uuid"))
+	if err != nil {
+		return elephantine.HTTPErrorf(http.StatusBadRequest,
+			"invalid document UUID: %v", err)
+	}
+
+	after, err := int64Param(r, "after", 0)
+	if err != nil {
+		return err
+	}
+
+	limit, err := pageSizeParam(r)
+	if err != nil {
+		return err
+	}
+
+	rows, err := postgres.New(a.db).ListVersionMappings(r.Context(),
+		postgres.ListVersionMappingsParams{
+			TargetName: r.PathValue("target"),
+			ID:         a.manager.TargetUUID(docUUID),
+			After:      after,
+			RowLimit:   limit,
+		})
+	if err != nil {
+		return fmt.Errorf("list version mappings: %w", err)
+	}
+
+	res := VersionMappingsResponse{
+		Mappings: make([]VersionMapping, 0, len(rows)),
+	}
+
+	for _, row := range rows {
+		res.Mappings = append(res.Mappings, VersionMapping{
+			SourceVersion: row.SourceVersion,
+			TargetVersion: row.TargetVersion,
+			Created:       row.Created.Time,
+		})
+	}
+
+	if len(rows) == int(limit) {
+		res.NextAfter = rows[len(rows)-1].SourceVersion
+	}
+
+	return writeJSON(w, res)
+}
+
+func (a *AdminAPI) compareDocument(
+	w http.ResponseWriter, r *http.Request,
+) error {
+	docUUID, err := uuid.Parse(r.PathValue("uuid"))
+	if err != nil {
+		return elephantine.HTTPErrorf(http.StatusBadRequest,
+			"invalid document UUID: %v", err)
+	}
+
+	res, err := a.manager.CompareDocument(
+		r.Context(), r.PathValue("target"), docUUID)
+
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return elephantine.NewHTTPError(http.StatusNotFound, "target not found")
+	case errors.Is(err, ErrSkipped):
+		return elephantine.NewHTTPError(http.StatusNotFound,
+			"document not found in source")
+	case errors.Is(err, ErrNotInTarget):
+		return elephantine.NewHTTPError(http.StatusNotFound,
+			"document not found in target")
+	case err != nil:
+		return fmt.Errorf("compare document: %w", err)
+	}
+
+	return writeJSON(w, res)
+}
+
+// ResyncResponse is the result of a document resync.
+type ResyncResponse struct {
+	TargetVersion int64 `json:"target_version"`
+	// Deleted is true if the document no longer exists in the source and
+	// was deleted from the target.
+	Deleted bool `json:"deleted"`
+}
+
+func (a *AdminAPI) resyncDocument(
+	w http.ResponseWriter, r *http.Request,
+) error {
+	docUUID, err := uuid.Parse(r.PathValue("uuid"))
+	if err != nil {
+		return elephantine.HTTPErrorf(http.StatusBadRequest,
+			"invalid document UUID: %v", err)
+	}
+
+	version, deleted, err := a.manager.ResyncDocument(
+		r.Context(), r.PathValue("target"), docUUID, false)
+
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return elephantine.NewHTTPError(http.StatusNotFound, "target not found")
+	case errors.Is(err, ErrSkipped):
+		return elephantine.HTTPErrorf(http.StatusNotFound,
+			"document could not be replicated: %v", err)
+	case err != nil:
+		return fmt.Errorf("resync document: %w", err)
+	}
+
+	a.logger.InfoContext(r.Context(), "resynced document",
+		"target", r.PathValue("target"),
+		elephantine.LogKeyDocumentUUID, docUUID,
+		"target_version", version,
+		"deleted", deleted,
+	)
+
+	return writeJSON(w, ResyncResponse{
+		TargetVersion: version,
+		Deleted:       deleted,
+	})
+}
+
+// clearReplicationErrors takes a document out of quarantine by resyncing its
+// current source state and then removing its replication errors. The errors
+// are kept if the resync fails.
+func (a *AdminAPI) clearReplicationErrors(
+	w http.ResponseWriter, r *http.Request,
+) error {
+	docUUID, err := uuid.Parse(r.PathValue("uuid"))
+	if err != nil {
+		return elephantine.HTTPErrorf(http.StatusBadRequest,
+			"invalid document UUID: %v", err)
+	}
+
+	target := r.PathValue("target")
+	q := postgres.New(a.db)
+
+	quarantined, err := q.DocumentHasErrors(r.Context(),
+		postgres.DocumentHasErrorsParams{
+			TargetName: target,
+			ID:         docUUID,
+		})
+	if err != nil {
+		return fmt.Errorf("check document errors: %w", err)
+	}
+
+	if !quarantined {
+		return elephantine.NewHTTPError(http.StatusNotFound,
+			"document has no replication errors")
+	}
+
+	version, deleted, err := a.manager.ResyncDocument(
+		r.Context(), target, docUUID, true)
+
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return elephantine.NewHTTPError(http.StatusNotFound, "target not found")
+	case errors.Is(err, ErrSkipped):
+		return elephantine.HTTPErrorf(http.StatusNotFound,
+			"document could not be replicated: %v", err)
+	case err != nil:
+		return fmt.Errorf("resync document: %w", err)
+	}
+
+	err = q.RemoveDocumentErrors(r.Context(),
+		postgres.RemoveDocumentErrorsParams{
+			TargetName: target,
+			ID:         docUUID,
+		})
+	if err != nil {
+		return fmt.Errorf("remove document errors: %w", err)
+	}
+
+	a.logger.InfoContext(r.Context(), "cleared document from quarantine",
+		"target", target,
+		elephantine.LogKeyDocumentUUID, docUUID,
+		"target_version", version,
+		"deleted", deleted,
+	)
+
+	return writeJSON(w, ResyncResponse{
+		TargetVersion: version,
+		Deleted:       deleted,
+	})
+}
+
+// TargetStatus describes the replication progress of a target. Position,
+// CaughtUp, and Lag are only reported when the target is active in the
+// responding instance. The persisted state is reported by all instances.
+type TargetStatus struct {
+	Target      string `json:"target"`
+	Shard       string `json:"shard,omitempty"`
+	Active      bool   `json:"active"`
+	Position    int64  `json:"position,omitempty"`
+	CaughtUp    bool   `json:"caught_up,omitempty"`
+	LastEventID int64  `json:"last_event_id"`
+	Lag         int64  `json:"lag,omitempty"`
+	// StoredPosition is the last persisted log position.
+	StoredPosition int64 `json:"stored_position"`
+	// LastEventTimestamp is the timestamp of the event at StoredPosition.
+	LastEventTimestamp *time.Time `json:"last_event_timestamp,omitempty"`
+	// LastUpdated is when the state last was persisted.
+	LastUpdated *time.Time `json:"last_updated,omitempty"`
+	// Paused is true if replication to the target has been paused.
+	Paused bool `json:"paused"`
+	// Halted is true if the active worker has finished its last batch
+	// and is waiting to be resumed.
+	Halted bool `json:"halted,omitempty"`
+}
+
+func (a *AdminAPI) targetStatus(
+	w http.ResponseWriter, r *http.Request,
+) error {
+	name := r.PathValue("target")
+
+	manager, err := a.shardManager(r)
+	if err != nil {
+		return err
+	}
+
+	q := postgres.New(a.db)
+
+	exists, err := q.TargetExists(r.Context(), name)
+	if err != nil {
+		return fmt.Errorf("check target exists: %w", err)
+	}
+
+	if !exists {
+		return elephantine.NewHTTPError(http.StatusNotFound, "target not found")
+	}
+
+	var stored LogState
+
+	err = LoadState(r.Context(), q, manager.logStateKey(name), &stored)
+	if err != nil {
+		return fmt.Errorf("load log state: %w", err)
+	}
+
+	lastEvent, err := manager.LastEventID(r.Context())
+	if err != nil {
+		return fmt.Errorf("get last source event: %w", err)
+	}
+
+	status := TargetStatus{
+		Target:         name,
+		Shard:          manager.Shard(),
+		LastEventID:    lastEvent,
+		StoredPosition: stored.Position,
+	}
+
+	if !stored.LastEventTimestamp.IsZero() {
+		status.LastEventTimestamp = &stored.LastEventTimestamp
+	}
+
+	if !stored.LastUpdated.IsZero() {
+		status.LastUpdated = &stored.LastUpdated
+	}
+
+	var pause PauseState
+
+	err = LoadState(r.Context(), q, pauseStateKey(name), &pause)
+	if err != nil {
+		return fmt.Errorf("load pause state: %w", err)
+	}
+
+	status.Paused = pause.Paused
+
+	worker, ok := manager.ActiveWorker(name)
+	if ok {
+		state := worker.FollowerState()
+
+		status.Active = true
+		status.Halted = manager.TargetHalted(name)
+		status.Position = state.Position
+		status.CaughtUp = state.CaughtUp
+		status.Lag = max(lastEvent-state.Position, 0)
+	}
+
+	return writeJSON(w, status)
+}
+
+// ResetRequest moves the log position of a target.
+type ResetRequest struct {
+	// EventID is the position to continue after, the event itself won't
+	// be handled again.
+	EventID int64 `json:"event_id"`
+	// CaughtUp controls whether replication continues event by event. The
+	// default is to catch up using the compacted eventlog, which replicates
+	// the current state of all documents that have changed since EventID.
+	CaughtUp bool `json:"caught_up"`
+}
+
+func (a *AdminAPI) resetTarget(
+	w http.ResponseWriter, r *http.Request,
+) error {
+	name := r.PathValue("target")
+
+	manager, err := a.shardManager(r)
+	if err != nil {
+		return err
+	}
+
+	var req ResetRequest
+
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return elephantine.HTTPErrorf(http.StatusBadRequest,
+			"invalid request body: %v", err)
+	}
+
+	q := postgres.New(a.db)
+
+	target, err := q.GetTarget(r.Context(), name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return elephantine.NewHTTPError(http.StatusNotFound, "target not found")
+	} else if err != nil {
+		return fmt.Errorf("get target: %w", err)
+	}
+
+	if req.EventID < target.StartFrom {
+		return elephantine.HTTPErrorf(http.StatusBadRequest,
+			"event_id must not be lower than the start event %d of the target",
+			target.StartFrom)
+	}
+
+	// Events after the new position are replicated again.
+	err = q.ClearDocumentEventsAfter(r.Context(),
+		postgres.ClearDocumentEventsAfterParams{
+			TargetName: name,
+			EventID:    req.EventID,
+		})
+	if err != nil {
+		return fmt.Errorf("clear replicated events: %w", err)
+	}
+
+	err = StoreState(r.Context(), q, manager.logStateKey(name), LogState{
+		Position:    req.EventID,
+		CaughtUp:    req.CaughtUp,
+		LastUpdated: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("persist log state: %w", err)
+	}
+
+	err = a.fanOut.Publish(r.Context(), a.db, TargetNotification{
+		Name:     name,
+		Action:   TargetActionReset,
+		Position: req.EventID,
+		CaughtUp: req.CaughtUp,
+		Shard:    manager.Shard(),
+	})
+	if err != nil {
+		return fmt.Errorf("publish reset notification: %w", err)
+	}
+
+	a.logger.InfoContext(r.Context(), "reset target log position",
+		"target", name,
+		"shard", manager.Shard(),
+		elephantine.LogKeyEventID, req.EventID,
+		"caught_up", req.CaughtUp,
+	)
+
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+func (a *AdminAPI) pauseTarget(
+	w http.ResponseWriter, r *http.Request,
+) error {
+	return a.setTargetPaused(w, r, true)
+}
+
+func (a *AdminAPI) resumeTarget(
+	w http.ResponseWriter, r *http.Request,
+) error {
+	return a.setTargetPaused(w, r, false)
+}
+
+// setTargetPaused persists the pause state of a target and notifies all
+// processes. Paused workers finish the batch that they're handling and then
+// wait at the batch boundary until they're resumed.
+func (a *AdminAPI) setTargetPaused(
+	w http.ResponseWriter, r *http.Request, paused bool,
+) error {
+	name := r.PathValue("target")
+
+	q := postgres.New(a.db)
+
+	exists, err := q.TargetExists(r.Context(), name)
+	if err != nil {
+		return fmt.Errorf("check target exists: %w", err)
+	}
+
+	if !exists {
+		return elephantine.NewHTTPError(http.StatusNotFound, "target not found")
+	}
+
+	err = StoreState(r.Context(), q, pauseStateKey(name), PauseState{
+		Paused: paused,
+	})
+	if err != nil {
+		return fmt.Errorf("persist pause state: %w", err)
+	}
+
+	action := TargetActionResume
+	if paused {
+		action = TargetActionPause
+	}
+
+	err = a.fanOut.Publish(r.Context(), a.db, TargetNotification{
+		Name:   name,
+		Action: action,
+	})
+	if err != nil {
+		return fmt.Errorf("publish %s notification: %w", action, err)
+	}
+
+	a.logger.InfoContext(r.Context(), "changed target pause state",
+		"target", name,
+		"paused", paused,
+	)
+
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+func (a *AdminAPI) pollTarget(
+	w http.ResponseWriter, r *http.Request,
+) error {
+	name := r.PathValue("target")
+
+	exists, err := postgres.New(a.db).TargetExists(r.Context(), name)
+	if err != nil {
+		return fmt.Errorf("check target exists: %w", err)
+	}
+
+	if !exists {
+		return elephantine.NewHTTPError(http.StatusNotFound, "target not found")
+	}
+
+	// The worker could be running in another process.
+	err = a.fanOut.Publish(r.Context(), a.db, TargetNotification{
+		Name:   name,
+		Action: TargetActionPoll,
+	})
+	if err != nil {
+		return fmt.Errorf("publish poll notification: %w", err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+// ReplayRequest replays a single event. Events are replayed as a dry run
+// unless DryRun is set to false.
+type ReplayRequest struct {
+	DryRun *bool `json:"dry_run"`
+}
+
+func (a *AdminAPI) replayEvent(
+	w http.ResponseWriter, r *http.Request,
+) error {
+	eventID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || eventID <= 0 {
+		return elephantine.NewHTTPError(http.StatusBadRequest,
+			"invalid event ID")
+	}
+
+	var req ReplayRequest
+
+	if r.ContentLength != 0 {
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			return elephantine.HTTPErrorf(http.StatusBadRequest,
+				"invalid request body: %v", err)
+		}
+	}
+
+	manager, err := a.shardManager(r)
+	if err != nil {
+		return err
+	}
+
+	dryRun := req.DryRun == nil || *req.DryRun
+	name := r.PathValue("target")
+
+	res, err := manager.ReplayEvent(r.Context(), name, eventID, dryRun)
+
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return elephantine.NewHTTPError(http.StatusNotFound, "target not found")
+	case errors.Is(err, ErrEventNotFound):
+		return elephantine.NewHTTPError(http.StatusNotFound, "event not found")
+	case err != nil:
+		return fmt.Errorf("replay event: %w", err)
+	}
+
+	a.logger.InfoContext(r.Context(), "replayed event",
+		"target", name,
+		elephantine.LogKeyEventID, eventID,
+		"dry_run", res.DryRun,
+		"outcome", res.Outcome,
+	)
+
+	return writeJSON(w, res)
+}
+
+// AttachmentBackfillRequest starts an attachment backfill.
+type AttachmentBackfillRequest struct {
+	// Rate is the maximum number of documents to check per second.
+	Rate float64 `json:"rate"`
+	// Restart discards the stored progress and starts over.
+	Restart bool `json:"restart"`
+}
+
+// AttachmentBackfillStatus is the progress of an attachment backfill. Running
+// is only reported by the instance that runs the backfill.
+type AttachmentBackfillStatus struct {
+	AttachmentBackfillState
+
+	Running bool `json:"running"`
+}
+
+const defaultBackfillRate = 5
+
+func (a *AdminAPI) startAttachmentBackfill(
+	w http.ResponseWriter, r *http.Request,
+) error {
+	req := AttachmentBackfillRequest{
+		Rate: defaultBackfillRate,
+	}
+
+	if r.ContentLength != 0 {
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			return elephantine.HTTPErrorf(http.StatusBadRequest,
+				"invalid request body: %v", err)
+		}
+	}
+
+	if req.Rate <= 0 {
+		return elephantine.NewHTTPError(http.StatusBadRequest,
+			"rate must be positive")
+	}
+
+	name := r.PathValue("target")
+
+	err := a.manager.StartAttachmentBackfill(
+		r.Context(), name, req.Rate, req.Restart)
+
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return elephantine.NewHTTPError(http.StatusNotFound, "target not found")
+	case errors.Is(err, ErrBackfillRunning):
+		return elephantine.NewHTTPError(http.StatusConflict, err.Error())
+	case err != nil:
+		return fmt.Errorf("start attachment backfill: %w", err)
+	}
+
+	a.logger.InfoContext(r.Context(), "started attachment backfill",
+		"target", name,
+		"rate", req.Rate,
+		"restart", req.Restart,
+	)
+
+	w.WriteHeader(http.StatusAccepted)
+
+	return nil
+}
+
+func (a *AdminAPI) attachmentBackfillStatus(
+	w http.ResponseWriter, r *http.Request,
+) error {
+	name := r.PathValue("target")
+
+	var status AttachmentBackfillStatus
+
+	key := shardKey(attachmentBackfillKey(name), a.manager.Shard())
+
+	err := LoadState(r.Context(), postgres.New(a.db),
+		key, &status.AttachmentBackfillState)
+	if err != nil {
+		return fmt.Errorf("load attachment backfill state: %w", err)
+	}
+
+	status.Running = a.manager.AttachmentBackfillRunning(name)
+
+	return writeJSON(w, status)
+}
+
+// ReplicationError is a quarantined event that failed to replicate. Created is
+// when the event last was quarantined, and FirstSeen when it first was.
+type ReplicationError struct {
+	EventID      int64     `json:"event_id"`
+	DocumentUUID uuid.UUID `json:"document_uuid"`
+	EventType    string    `json:"event_type"`
+	Error        string    `json:"error"`
+	Attempts     int32     `json:"attempts"`
+	Created      time.Time `json:"created"`
+	FirstSeen    time.Time `json:"first_seen"`
+}
+
+// ReplicationErrorsResponse is a page of replication errors. Pass NextAfter as
+// the "after" parameter to get the next page. Shard is the source shard that
+// the errors belong to, empty for unsharded sources.
+type ReplicationErrorsResponse struct {
+	Shard     string             `json:"shard,omitempty"`
+	Errors    []ReplicationError `json:"errors"`
+	NextAfter int64              `json:"next_after,omitempty"`
+}
+
+func (a *AdminAPI) listReplicationErrors(
+	w http.ResponseWriter, r *http.Request,
+) error {
+	after, err := int64Param(r, "after", 0)
+	if err != nil {
+		return err
+	}
+
+	limit, err := pageSizeParam(r)
+	if err != nil {
+		return err
+	}
+
+	manager, err := a.shardManager(r)
+	if err != nil {
+		return err
+	}
+
+	rows, err := postgres.New(a.db).ListReplicationErrors(r.Context(),
+		postgres.ListReplicationErrorsParams{
+			TargetName: r.PathValue("target"),
+			Shard:      manager.Shard(),
+			After:      after,
+			RowLimit:   limit,
+		})
+	if err != nil {
+		return fmt.Errorf("list replication errors: %w", err)
+	}
+
+	res := ReplicationErrorsResponse{
+		Shard:  manager.Shard(),
+		Errors: make([]ReplicationError, 0, len(rows)),
+	}
+
+	for _, row := range rows {
+		res.Errors = append(res.Errors, ReplicationError{
+			EventID:      row.EventID,
+			DocumentUUID: row.ID,
+			EventType:    row.EventType,
+			Error:        row.Error,
+			Attempts:     row.Attempts,
+			Created:      row.Created.Time,
+			FirstSeen:    row.FirstSeen.Time,
+		})
+	}
+
+	if len(rows) == int(limit) {
+		res.NextAfter = rows[len(rows)-1].EventID
+	}
+
+	return writeJSON(w, res)
+}
+
+// ReplicationConflict is an event that wasn't replicated because the document
+// had been changed in the target.
+type ReplicationConflict struct {
+	EventID         int64     `json:"event_id"`
+	DocumentUUID    uuid.UUID `json:"document_uuid"`
+	EventType       string    `json:"event_type"`
+	ExpectedVersion int64     `json:"expected_version"`
+	TargetVersion   int64     `json:"target_version"`
+	Created         time.Time `json:"created"`
+}
+
+// ReplicationConflictsResponse is a page of conflicts, most recent first. Pass
+// NextBefore as the "before" parameter to get the next page. Shard is the
+// source shard that the conflicts belong to, empty for unsharded sources.
+type ReplicationConflictsResponse struct {
+	Shard      string                `json:"shard,omitempty"`
+	Conflicts  []ReplicationConflict `json:"conflicts"`
+	NextBefore int64                 `json:"next_before,omitempty"`
+}
+
+func (a *AdminAPI) listReplicationConflicts(
+	w http.ResponseWriter, r *http.Request,
+) error {
+	before, err := int64Param(r, "before", 0)
+	if err != nil {
+		return err
+	}
+
+	limit, err := pageSizeParam(r)
+	if err != nil {
+		return err
+	}
+
+	manager, err := a.shardManager(r)
+	if err != nil {
+		return err
+	}
+
+	rows, err := postgres.New(a.db).ListReplicationConflicts(r.Context(),
+		postgres.ListReplicationConflictsParams{
+			TargetName: r.PathValue("target"),
+			Shard:      manager.Shard(),
+			Before:     before,
+			RowLimit:   limit,
+		})
+	if err != nil {
+		return fmt.Errorf("list replication conflicts: %w", err)
+	}
+
+	res := ReplicationConflictsResponse{
+		Shard:     manager.Shard(),
+		Conflicts: make([]ReplicationConflict, 0, len(rows)),
+	}
+
+	for _, row := range rows {
+		res.Conflicts = append(res.Conflicts, ReplicationConflict{
+			EventID:         row.EventID,
+			DocumentUUID:    row.ID,
+			EventType:       row.EventType,
+			ExpectedVersion: row.ExpectedVersion,
+			TargetVersion:   row.TargetVersion,
+			Created:         row.Created.Time,
+		})
+	}
+
+	if len(rows) == int(limit) {
+		res.NextBefore = rows[len(rows)-1].EventID
+	}
+
+	return writeJSON(w, res)
+}
+
+func int64Param(r *http.Request, name string, defaultValue int64) (int64, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return defaultValue, nil
+	}
+
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, elephantine.HTTPErrorf(http.StatusBadRequest,
+			"invalid %q parameter: %v", name, err)
+	}
+
+	return n, nil
+}
+
+func pageSizeParam(r *http.Request) (int32, error) {
+	n, err := int64Param(r, "limit", defaultPageSize)
+	if err != nil {
+		return 0, err
+	}
+
+	if n < 1 || n > maxPageSize {
+		return 0, elephantine.HTTPErrorf(http.StatusBadRequest,
+			"limit must be between 1 and %d", maxPageSize)
+	}
+
+	return int32(n), nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) error {
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		return fmt.Errorf("write response: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,273 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/postgres"
+	"github.com/ttab/elephantine"
+	"github.com/ttab/elephantine/pg"
+	"github.com/twitchtv/twirp"
+	"golang.org/x/time/rate"
+)
+
+// ErrBackfillRunning is returned when an attachment backfill already is running
+// for a target.
+var ErrBackfillRunning = errors.New("attachment backfill already running")
+
+const attachmentBackfillPageSize = 100
+
+// AttachmentBackfillState is the persisted progress of an attachment backfill.
+type AttachmentBackfillState struct {
+	// After is the last document that has been checked.
+	After uuid.UUID `json:"after"`
+	// Checked is the number of documents that have been checked.
+	Checked int64 `json:"checked"`
+	// Updated is the number of documents that were missing attachments in
+	// the target and have been updated.
+	Updated int64 `json:"updated"`
+	// Done is true when all documents have been checked.
+	Done bool `json:"done"`
+	// LastUpdated is when the progress last was persisted.
+	LastUpdated time.Time `json:"last_updated"`
+}
+
+func attachmentBackfillKey(target string) string {
+	return target + ":attachment_backfill"
+}
+
+func (w *Worker) attachmentBackfillKey() string {
+	return shardKey(attachmentBackfillKey(w.name), w.shard)
+}
+
+// StartAttachmentBackfill starts a background job that transfers attachments
+// that are missing in the target for all documents that have been replicated
+// to it. The job continues from the persisted progress unless restart is set.
+// Documents are checked at most at the given rate per second.
+func (tm *TargetManager) StartAttachmentBackfill(
+	ctx context.Context, name string, perSecond float64, restart bool,
+) error {
+	target, err := postgres.New(tm.db).GetTarget(ctx, name)
+	if err != nil {
+		return fmt.Errorf("get target: %w", err)
+	}
+
+	logger := tm.logger.With("target", name)
+
+	w, err := tm.newWorker(ctx, logger, target)
+	if err != nil {
+		return fmt.Errorf("create worker: %w", err)
+	}
+
+	if w.uuidMapping.Namespace != uuid.Nil {
+		return errors.New("attachments can't be backfilled with UUID remapping enabled")
+	}
+
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	if tm.runCtx == nil {
+		return errors.New("target manager isn't running")
+	}
+
+	if tm.backfills[name] {
+		return ErrBackfillRunning
+	}
+
+	tm.backfills[name] = true
+
+	runCtx := tm.runCtx
+	limiter := rate.NewLimiter(rate.Limit(perSecond), 1)
+
+	go func() {
+		defer func() {
+			tm.mu.Lock()
+			delete(tm.backfills, name)
+			tm.mu.Unlock()
+		}()
+
+		err := w.backfillAttachments(runCtx, limiter, restart)
+		if err != nil && runCtx.Err() == nil {
+			logger.Error("attachment backfill failed",
+				elephantine.LogKeyError, err)
+		}
+	}()
+
+	return nil
+}
+
+// AttachmentBackfillRunning returns true if an attachment backfill is running
+// for the target in this instance.
+func (tm *TargetManager) AttachmentBackfillRunning(name string) bool {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	return tm.backfills[name]
+}
+
+func (w *Worker) backfillAttachments(
+	ctx context.Context, limiter *rate.Limiter, restart bool,
+) error {
+	q := postgres.New(w.db)
+	key := w.attachmentBackfillKey()
+
+	var state AttachmentBackfillState
+
+	if !restart {
+		err := LoadState(ctx, q, key, &state)
+		if err != nil {
+			return fmt.Errorf("load progress: %w", err)
+		}
+	}
+
+	if restart || state.Done {
+		state = AttachmentBackfillState{}
+	}
+
+	w.logger.InfoContext(ctx, "starting attachment backfill",
+		"after", state.After,
+		"checked", state.Checked,
+	)
+
+	for {
+		docs, err := q.ListDocuments(ctx, postgres.ListDocumentsParams{
+			TargetName: w.name,
+			After:      state.After,
+			RowLimit:   attachmentBackfillPageSize,
+		})
+		if err != nil {
+			return fmt.Errorf("list documents: %w", err)
+		}
+
+		for _, doc := range docs {
+			err := limiter.Wait(ctx)
+			if err != nil {
+				return fmt.Errorf("wait for rate limiter: %w", err)
+			}
+
+			updated, err := w.backfillDocumentAttachments(ctx, doc.ID)
+			if err != nil {
+				return fmt.Errorf("backfill document %s: %w", doc.ID, err)
+			}
+
+			state.After = doc.ID
+			state.Checked++
+
+			if updated {
+				state.Updated++
+			}
+		}
+
+		state.Done = len(docs) < attachmentBackfillPageSize
+		state.LastUpdated = time.Now()
+
+		// Dry runs don't leave any progress behind for a real
+		// backfill to continue from.
+		if !w.dryRun {
+			err = StoreState(ctx, q, key, state)
+			if err != nil {
+				return fmt.Errorf("persist progress: %w", err)
+			}
+		}
+
+		if state.Done {
+			w.logger.InfoContext(ctx, "finished attachment backfill",
+				"checked", state.Checked,
+				"updated", state.Updated,
+			)
+
+			return nil
+		}
+	}
+}
+
+// backfillDocumentAttachments replicates the current version of the document
+// together with the attachments that should be replicated but are missing in
+// the target. Returns true if the document was updated.
+func (w *Worker) backfillDocumentAttachments(
+	ctx context.Context, docUUID uuid.UUID,
+) (_ bool, outErr error) {
+	sourceRes, err := w.source.GetMeta(ctx, &repository.GetMetaRequest{
+		Uuid: docUUID.String(),
+	})
+	if elephantine.IsTwirpErrorCode(err, twirp.NotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("get source meta: %w", err)
+	}
+
+	var wanted []string
+
+	for _, a := range sourceRes.Meta.Attachments {
+		if w.shouldReplicateAttachment(a.Name, sourceRes.Meta.Type) {
+			wanted = append(wanted, a.Name)
+		}
+	}
+
+	if len(wanted) == 0 {
+		return false, nil
+	}
+
+	targetRes, err := w.target.GetMeta(ctx, &repository.GetMetaRequest{
+		Uuid: docUUID.String(),
+	})
+	if elephantine.IsTwirpErrorCode(err, twirp.NotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("get target meta: %w", err)
+	}
+
+	missing := slices.DeleteFunc(wanted, func(name string) bool {
+		return slices.ContainsFunc(targetRes.Meta.Attachments,
+			func(a *repository.AttachmentRef) bool {
+				return a.Name == name
+			})
+	})
+
+	if len(missing) == 0 {
+		return false, nil
+	}
+
+	evt := currentVersionEvent(docUUID, sourceRes.Meta)
+
+	evt.Version = sourceRes.Meta.CurrentVersion
+	evt.AttachedObjects = missing
+
+	tx, err := w.db.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("begin transaction: %w", err)
+	}
+
+	defer pg.Rollback(tx, &outErr)
+
+	_, err = w.replicate(ctx, postgres.New(tx), evt, nil, true)
+
+	switch {
+	case errors.Is(err, ErrSkipped), errors.Is(err, ErrConflict):
+		w.logger.WarnContext(ctx, "could not backfill attachments",
+			elephantine.LogKeyDocumentUUID, docUUID,
+			elephantine.LogKeyError, err,
+		)
+
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return false, fmt.Errorf("commit state: %w", err)
+	}
+
+	w.logger.DebugContext(ctx, "backfilled attachments",
+		elephantine.LogKeyDocumentUUID, docUUID,
+		"attachments", missing,
+	)
+
+	return true, nil
+}
@@ -0,0 +1,74 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephantine"
+	"github.com/twitchtv/twirp"
+)
+
+// removedAttachments compares the attachments of the document in the target
+// with the ones in the source, and returns the names of the attachments that
+// should be detached in the target. Only attachments that would be replicated
+// are detached, attachments that have been added in the target are kept.
+func (w *Worker) removedAttachments(
+	ctx context.Context, evt *repository.EventlogItem, targetUUID uuid.UUID,
+	attaching map[string]string,
+) ([]string, error) {
+	var none []string
+
+	targetRes, err := w.target.GetMeta(ctx, &repository.GetMetaRequest{
+		Uuid: targetUUID.String(),
+	})
+	if elephantine.IsTwirpErrorCode(err, twirp.NotFound) {
+		return none, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("get target meta for attachments: %w", err)
+	}
+
+	if len(targetRes.Meta.Attachments) == 0 {
+		return none, nil
+	}
+
+	sourceRes, err := w.source.GetMeta(ctx, &repository.GetMetaRequest{
+		Uuid: evt.Uuid,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get source meta for attachments: %w", err)
+	}
+
+	return RemovedAttachments(
+		sourceRes.Meta.Attachments, targetRes.Meta.Attachments,
+		func(name string) bool {
+			_, ok := attaching[name]
+
+			return !ok && w.shouldReplicateAttachment(name, evt.Type)
+		}), nil
+}
+
+// RemovedAttachments returns the names of the target attachments that are
+// missing in the source and are managed by the replicant.
+func RemovedAttachments(
+	source []*repository.AttachmentRef, target []*repository.AttachmentRef,
+	managed func(name string) bool,
+) []string {
+	var removed []string
+
+	for _, t := range target {
+		inSource := slices.ContainsFunc(source, func(s *repository.AttachmentRef) bool {
+			return s.Name == t.Name
+		})
+
+		if inSource || !managed(t.Name) {
+			continue
+		}
+
+		removed = append(removed, t.Name)
+	}
+
+	return removed
+}
@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/ttab/elephantine"
+	"golang.org/x/sync/semaphore"
+)
+
+// AttachmentMemory bounds the number of attachment bytes that are in flight at
+// once, shared by the workers of all targets. Transfers wait for room in the
+// budget instead of adding to the memory use of the process. A nil
+// AttachmentMemory doesn't track or limit transfers.
+type AttachmentMemory struct {
+	limit    int64
+	sem      *semaphore.Weighted
+	inFlight prometheus.Gauge
+}
+
+// NewAttachmentMemory creates a budget of limit bytes. A zero limit only tracks
+// the bytes in flight.
+func NewAttachmentMemory(
+	limit int64, reg prometheus.Registerer,
+) (*AttachmentMemory, error) {
+	m := AttachmentMemory{
+		limit: limit,
+	}
+
+	if limit > 0 {
+		m.sem = semaphore.NewWeighted(limit)
+	}
+
+	mh := elephantine.NewMetricsHelper(reg)
+
+	mh.Gauge(&m.inFlight, prometheus.GaugeOpts{
+		Name: "replicant_attachment_inflight_bytes",
+		Help: "Number of attachment bytes reserved by transfers in progress.",
+	})
+
+	if err := mh.Err(); err != nil {
+		return nil, fmt.Errorf("register metrics: %w", err)
+	}
+
+	return &m, nil
+}
+
+// Reservation returns the number of bytes that a transfer reserves. Transfers
+// of unknown length reserve the maximum attachment size, or the whole budget
+// if there's no maximum size. Reservations are capped at the budget so that
+// large attachments can be transferred on their own.
+func (m *AttachmentMemory) Reservation(contentLength int64, maxSize int64) int64 {
+	if m == nil {
+		return 0
+	}
+
+	size := contentLength
+
+	switch {
+	case size >= 0:
+	case maxSize > 0:
+		size = maxSize
+	default:
+		size = m.limit
+	}
+
+	if m.limit > 0 {
+		size = min(size, m.limit)
+	}
+
+	return max(size, 0)
+}
+
+// Acquire waits until n bytes are available in the budget, and returns a
+// function that gives them back.
+func (m *AttachmentMemory) Acquire(ctx context.Context, n int64) (func(), error) {
+	if m == nil || n <= 0 {
+		return func() {}, nil
+	}
+
+	if m.sem != nil {
+		err := m.sem.Acquire(ctx, n)
+		if err != nil {
+			return nil, fmt.Errorf("wait for attachment memory: %w", err)
+		}
+	}
+
+	m.inFlight.Add(float64(n))
+
+	return func() {
+		m.inFlight.Sub(float64(n))
+
+		if m.sem != nil {
+			m.sem.Release(n)
+		}
+	}, nil
+}
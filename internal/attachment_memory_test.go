@@ -0,0 +1,68 @@
+package internal_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/ttab/elephant-replicant/internal"
+)
+
+func TestAttachmentMemory(t *testing.T) {
+	mem, err := internal.NewAttachmentMemory(100, prometheus.NewRegistry())
+	if err != nil {
+		t.Fatalf("create attachment memory: %v", err)
+	}
+
+	reservations := []struct {
+		contentLength int64
+		maxSize       int64
+		want          int64
+	}{
+		{contentLength: 40, want: 40},
+		{contentLength: 500, want: 100},
+		{contentLength: -1, maxSize: 60, want: 60},
+		{contentLength: -1, want: 100},
+	}
+
+	for _, r := range reservations {
+		got := mem.Reservation(r.contentLength, r.maxSize)
+		if got != r.want {
+			t.Errorf("reservation for %d bytes with the max size %d: got %d, want %d",
+				r.contentLength, r.maxSize, got, r.want)
+		}
+	}
+
+	release, err := mem.Acquire(t.Context(), 70)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = mem.Acquire(ctx, 40)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected acquiring over the budget to block, got %v", err)
+	}
+
+	release()
+
+	release, err = mem.Acquire(t.Context(), 100)
+	if err != nil {
+		t.Fatalf("acquire the whole budget: %v", err)
+	}
+
+	release()
+
+	var unlimited *internal.AttachmentMemory
+
+	release, err = unlimited.Acquire(t.Context(), unlimited.Reservation(-1, 0))
+	if err != nil {
+		t.Fatalf("expected a nil budget not to block: %v", err)
+	}
+
+	release()
+}
@@ -0,0 +1,310 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// ErrAttachmentTooLarge is returned when an attachment exceeds the configured
+// maximum size.
+var ErrAttachmentTooLarge = errors.New("attachment exceeds the maximum size")
+
+const (
+	checksumModeHeader   = "X-Amz-Checksum-Mode"
+	checksumSHA256Header = "X-Amz-Checksum-Sha256"
+	checksumTypeHeader   = "X-Amz-Checksum-Type"
+	userMetaHeaderPrefix = "X-Amz-Meta-"
+)
+
+// transferReader counts and hashes the data read through it, and aborts the
+// read if the size limit is exceeded.
+type transferReader struct {
+	r     io.Reader
+	hash  hash.Hash
+	n     int64
+	limit int64
+	err   error
+}
+
+func newTransferReader(r io.Reader, limit int64) *transferReader {
+	return &transferReader{
+		r:     r,
+		hash:  sha256.New(),
+		limit: limit,
+	}
+}
+
+func (tr *transferReader) Read(p []byte) (int, error) {
+	if tr.err != nil {
+		return 0, tr.err
+	}
+
+	n, err := tr.r.Read(p)
+
+	tr.n += int64(n)
+	_, _ = tr.hash.Write(p[:n])
+
+	if tr.limit > 0 && tr.n > tr.limit {
+		tr.err = fmt.Errorf("%w of %d bytes", ErrAttachmentTooLarge, tr.limit)
+
+		return n, tr.err
+	}
+
+	return n, err //nolint: wrapcheck
+}
+
+// Verify checks the transferred data against the SHA-256 checksum in the
+// download response headers, if present.
+func (tr *transferReader) Verify(res *http.Response) error {
+	if res.ContentLength >= 0 && tr.n != res.ContentLength {
+		return fmt.Errorf("transferred %d bytes, expected %d",
+			tr.n, res.ContentLength)
+	}
+
+	expected, ok := ObjectChecksum(res.Header)
+	if !ok {
+		return nil
+	}
+
+	actual := base64.StdEncoding.EncodeToString(tr.hash.Sum(nil))
+	if actual != expected {
+		return fmt.Errorf("checksum mismatch, got %q, expected %q",
+			actual, expected)
+	}
+
+	return nil
+}
+
+// ObjectChecksum returns the SHA-256 checksum of the whole object from the
+// download response headers. Objects that were uploaded in parts can have a
+// composite checksum, a checksum of the checksums of the parts with a "-N"
+// part count suffix, that can't be compared to the checksum of the data.
+// Returns false if there is no checksum or if it's composite.
+func ObjectChecksum(header http.Header) (string, bool) {
+	checksum := header.Get(checksumSHA256Header)
+	if checksum == "" {
+		return "", false
+	}
+
+	if strings.EqualFold(header.Get(checksumTypeHeader), "COMPOSITE") {
+		return "", false
+	}
+
+	// Base64 doesn't use "-", so it can only be the part count suffix.
+	if strings.Contains(checksum, "-") {
+		return "", false
+	}
+
+	return checksum, true
+}
+
+// ContentTypeFilter decides which attachments to transfer based on their
+// content type. Patterns are either exact media types, f.ex. "image/tiff", or
+// a wildcard subtype, f.ex. "image/*". Deny patterns take precedence, and if
+// any allow patterns have been given the content type must match one of them.
+type ContentTypeFilter struct {
+	Allow []string
+	Deny  []string
+}
+
+// Allowed returns true if attachments with the content type should be
+// transferred.
+func (f ContentTypeFilter) Allowed(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+
+	if matchesContentType(f.Deny, mediaType) {
+		return false
+	}
+
+	return len(f.Allow) == 0 || matchesContentType(f.Allow, mediaType)
+}
+
+func matchesContentType(patterns []string, mediaType string) bool {
+	for _, p := range patterns {
+		p = strings.ToLower(p)
+
+		prefix, isWildcard := strings.CutSuffix(p, "/*")
+		if isWildcard && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+
+		if p == mediaType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ContentTypeOverrides replace the content type of attachments when they are
+// uploaded to the target, f.ex. to correct sources that store everything as
+// "application/octet-stream". Extensions are matched on the lower-cased
+// filename extension including the dot, f.ex. ".pdf", and content types are
+// matched on the media type of the source content type. Extension overrides
+// take precedence over content type overrides.
+type ContentTypeOverrides struct {
+	Extensions   map[string]string
+	ContentTypes map[string]string
+}
+
+// ParseContentTypeOverrides parses overrides in the format
+// "[.extension|content type]=[content type]", f.ex. ".pdf=application/pdf"
+// or "application/x-pdf=application/pdf".
+func ParseContentTypeOverrides(specs []string) (ContentTypeOverrides, error) {
+	var o ContentTypeOverrides
+
+	for _, s := range specs {
+		match, contentType, ok := strings.Cut(s, "=")
+		if !ok || match == "" || contentType == "" {
+			return o, fmt.Errorf("invalid content type override %q", s)
+		}
+
+		match = strings.ToLower(strings.TrimSpace(match))
+
+		overrides := &o.ContentTypes
+
+		if strings.HasPrefix(match, ".") {
+			overrides = &o.Extensions
+		} else {
+			mediaType, _, err := mime.ParseMediaType(match)
+			if err != nil {
+				return o, fmt.Errorf("invalid content type %q in override %q: %w",
+					match, s, err)
+			}
+
+			match = mediaType
+		}
+
+		if *overrides == nil {
+			*overrides = make(map[string]string)
+		}
+
+		if _, exists := (*overrides)[match]; exists {
+			return o, fmt.Errorf("duplicate content type override for %q", match)
+		}
+
+		(*overrides)[match] = strings.TrimSpace(contentType)
+	}
+
+	err := o.Validate()
+	if err != nil {
+		return o, err
+	}
+
+	return o, nil
+}
+
+// Validate checks that the overrides have valid extensions and content types.
+func (o ContentTypeOverrides) Validate() error {
+	for ext, contentType := range o.Extensions {
+		if len(ext) < 2 || !strings.HasPrefix(ext, ".") || ext != strings.ToLower(ext) {
+			return fmt.Errorf(
+				"invalid extension %q in content type override, must be lower case and start with a dot",
+				ext)
+		}
+
+		_, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			return fmt.Errorf("invalid content type %q for extension %q: %w",
+				contentType, ext, err)
+		}
+	}
+
+	for match, contentType := range o.ContentTypes {
+		mediaType, _, err := mime.ParseMediaType(match)
+		if err != nil || mediaType != match {
+			return fmt.Errorf("invalid content type %q in content type override", match)
+		}
+
+		_, _, err = mime.ParseMediaType(contentType)
+		if err != nil {
+			return fmt.Errorf("invalid content type %q for %q: %w",
+				contentType, match, err)
+		}
+	}
+
+	return nil
+}
+
+// Apply returns the content type that an attachment should be uploaded with,
+// which is the source content type if no override matches.
+func (o ContentTypeOverrides) Apply(filename string, contentType string) string {
+	ext := strings.ToLower(path.Ext(filename))
+
+	if override, ok := o.Extensions[ext]; ok && ext != "" {
+		return override
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+
+	if override, ok := o.ContentTypes[mediaType]; ok {
+		return override
+	}
+
+	return contentType
+}
+
+// AttachmentMeta extracts the user metadata of an attachment from the headers
+// of its download response. AttachmentDetails doesn't carry any metadata, so
+// the object metadata headers are the only source we have. Returns nil if
+// there is no metadata.
+func AttachmentMeta(header http.Header) map[string]string {
+	var meta map[string]string
+
+	for key, values := range header {
+		name, ok := strings.CutPrefix(
+			http.CanonicalHeaderKey(key), userMetaHeaderPrefix)
+		if !ok || name == "" || len(values) == 0 {
+			continue
+		}
+
+		if meta == nil {
+			meta = make(map[string]string)
+		}
+
+		meta[strings.ToLower(name)] = values[0]
+	}
+
+	return meta
+}
+
+// UniqueAttachmentNames returns the attachment names without duplicates, in
+// the order they first appear, and the names that were listed more than once.
+func UniqueAttachmentNames(names []string) ([]string, []string) {
+	var (
+		unique     = make([]string, 0, len(names))
+		duplicates []string
+		seen       = make(map[string]bool, len(names))
+	)
+
+	for _, name := range names {
+		listed, ok := seen[name]
+
+		switch {
+		case !ok:
+			seen[name] = false
+
+			unique = append(unique, name)
+		case !listed:
+			seen[name] = true
+
+			duplicates = append(duplicates, name)
+		}
+	}
+
+	return unique, duplicates
+}
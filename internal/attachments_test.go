@@ -0,0 +1,218 @@
+package internal_test
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/internal"
+)
+
+func TestContentTypeFilter(t *testing.T) {
+	filter := internal.ContentTypeFilter{
+		Allow: []string{"image/*", "application/pdf"},
+		Deny:  []string{"image/tiff"},
+	}
+
+	cases := map[string]bool{
+		"image/jpeg":                true,
+		"image/png; charset=binary": true,
+		"application/pdf":           true,
+		"image/tiff":                false,
+		"IMAGE/TIFF":                false,
+		"video/mp4":                 false,
+	}
+
+	for contentType, want := range cases {
+		if got := filter.Allowed(contentType); got != want {
+			t.Errorf("Allowed(%q) = %v, want %v", contentType, got, want)
+		}
+	}
+
+	if !(internal.ContentTypeFilter{}).Allowed("video/mp4") {
+		t.Error("expected empty filter to allow all content types")
+	}
+}
+
+func TestContentTypeOverrides(t *testing.T) {
+	overrides, err := internal.ParseContentTypeOverrides([]string{
+		".PDF=application/pdf",
+		"application/octet-stream=image/jpeg",
+	})
+	if err != nil {
+		t.Fatalf("parse overrides: %v", err)
+	}
+
+	cases := []struct {
+		Filename    string
+		ContentType string
+		Want        string
+	}{
+		{"report.pdf", "application/octet-stream", "application/pdf"},
+		{"REPORT.Pdf", "text/plain", "application/pdf"},
+		{"photo", "Application/Octet-Stream", "image/jpeg"},
+		{"photo.png", "image/png", "image/png"},
+		{"", "", ""},
+	}
+
+	for _, c := range cases {
+		got := overrides.Apply(c.Filename, c.ContentType)
+		if got != c.Want {
+			t.Errorf("Apply(%q, %q) = %q, want %q",
+				c.Filename, c.ContentType, got, c.Want)
+		}
+	}
+
+	invalid := [][]string{
+		{"pdf"},
+		{".pdf="},
+		{".pdf=application/pdf", ".PDF=application/x-pdf"},
+		{".pdf=not a type"},
+		{"not a type=application/pdf"},
+		{".=application/pdf"},
+	}
+
+	for _, specs := range invalid {
+		_, err := internal.ParseContentTypeOverrides(specs)
+		if err == nil {
+			t.Errorf("expected %q to be rejected", specs)
+		}
+	}
+}
+
+func TestAttachmentMeta(t *testing.T) {
+	header := http.Header{}
+
+	header.Set("Content-Type", "image/jpeg")
+	header.Set("X-Amz-Meta-Photographer", "Jane Doe")
+	header.Set("x-amz-meta-credit", "TT")
+
+	meta := internal.AttachmentMeta(header)
+
+	want := map[string]string{
+		"photographer": "Jane Doe",
+		"credit":       "TT",
+	}
+
+	if !maps.Equal(meta, want) {
+		t.Errorf("got meta %v, want %v", meta, want)
+	}
+
+	if internal.AttachmentMeta(http.Header{
+		"Content-Type": []string{"image/jpeg"},
+	}) != nil {
+		t.Error("expected no meta when there are no metadata headers")
+	}
+}
+
+func TestAttachmentRefWildcard(t *testing.T) {
+	ref, err := internal.AttachmentRefFromString("*.core/image")
+	if err != nil {
+		t.Fatalf("parse reference: %v", err)
+	}
+
+	if ref.DocType != "core/image" || ref.Name != internal.AttachmentWildcard {
+		t.Fatalf("unexpected reference %#v", ref)
+	}
+
+	if !ref.Matches("image") || !ref.Matches("thumbnail") {
+		t.Error("expected the wildcard to match any attachment name")
+	}
+
+	exact, err := internal.AttachmentRefFromString("image.core/image")
+	if err != nil {
+		t.Fatalf("parse reference: %v", err)
+	}
+
+	if !exact.Matches("image") || exact.Matches("thumbnail") {
+		t.Error("expected exact references to only match their name")
+	}
+}
+
+func TestAttachmentRefFromStringInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"image", ".core/image", "image.", "im*.core/image",
+		"image.*", "*.*", "*.core/*",
+	} {
+		_, err := internal.AttachmentRefFromString(spec)
+		if err == nil {
+			t.Errorf("expected an error for %q", spec)
+		}
+	}
+}
+
+func TestRemovedAttachments(t *testing.T) {
+	source := []*repository.AttachmentRef{
+		{Name: "image"},
+	}
+
+	target := []*repository.AttachmentRef{
+		{Name: "image"},
+		{Name: "thumbnail"},
+		{Name: "local-note"},
+	}
+
+	removed := internal.RemovedAttachments(source, target, func(name string) bool {
+		return name != "local-note"
+	})
+
+	if !slices.Equal(removed, []string{"thumbnail"}) {
+		t.Errorf("got removed attachments %v, want [thumbnail]", removed)
+	}
+}
+
+func TestUniqueAttachmentNames(t *testing.T) {
+	unique, duplicates := internal.UniqueAttachmentNames([]string{
+		"image", "thumbnail", "image", "image", "original", "thumbnail",
+	})
+
+	if !slices.Equal(unique, []string{"image", "thumbnail", "original"}) {
+		t.Errorf("unexpected unique names: %v", unique)
+	}
+
+	if !slices.Equal(duplicates, []string{"image", "thumbnail"}) {
+		t.Errorf("unexpected duplicate names: %v", duplicates)
+	}
+
+	unique, duplicates = internal.UniqueAttachmentNames(nil)
+	if len(unique) != 0 || len(duplicates) != 0 {
+		t.Errorf("expected no names, got %v and %v", unique, duplicates)
+	}
+}
+
+func TestObjectChecksum(t *testing.T) {
+	const digest = "n4bQgYhMfWWaL+qgxVrQFaO/TxsrC4Is0V1sFbDwCgg="
+
+	cases := []struct {
+		name     string
+		header   http.Header
+		expected string
+		ok       bool
+	}{
+		{"missing", http.Header{}, "", false},
+		{"full object", http.Header{
+			"X-Amz-Checksum-Sha256": {digest},
+		}, digest, true},
+		{"full object type", http.Header{
+			"X-Amz-Checksum-Sha256": {digest},
+			"X-Amz-Checksum-Type":   {"FULL_OBJECT"},
+		}, digest, true},
+		{"multipart", http.Header{
+			"X-Amz-Checksum-Sha256": {digest + "-3"},
+		}, "", false},
+		{"composite type", http.Header{
+			"X-Amz-Checksum-Sha256": {digest},
+			"X-Amz-Checksum-Type":   {"COMPOSITE"},
+		}, "", false},
+	}
+
+	for _, c := range cases {
+		checksum, ok := internal.ObjectChecksum(c.header)
+		if checksum != c.expected || ok != c.ok {
+			t.Errorf("%s: got %q %v, expected %q %v",
+				c.name, checksum, ok, c.expected, c.ok)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephantine"
+)
+
+// AuditLog configures the log line that is written for every event that has
+// been replicated. A zero AuditLog disables the log.
+type AuditLog struct {
+	Enabled bool
+	Level   slog.Level
+	// CatchingUp also logs the events that are replicated while catching
+	// up, which can be a lot during a backfill.
+	CatchingUp bool
+}
+
+// ParseAuditLog parses the audit log level, f.ex. "info" or "debug". The audit
+// log is disabled if the level is empty.
+func ParseAuditLog(level string, catchingUp bool) (AuditLog, error) {
+	if level == "" {
+		return AuditLog{}, nil
+	}
+
+	var l slog.Level
+
+	err := l.UnmarshalText([]byte(level))
+	if err != nil {
+		return AuditLog{}, fmt.Errorf("invalid audit log level: %w", err)
+	}
+
+	return AuditLog{
+		Enabled:    true,
+		Level:      l,
+		CatchingUp: catchingUp,
+	}, nil
+}
+
+// Allowed returns true if a replicated event should be logged.
+func (a AuditLog) Allowed(caughtUp bool) bool {
+	return a.Enabled && (caughtUp || a.CatchingUp)
+}
+
+func (w *Worker) logReplicated(
+	ctx context.Context, evt *repository.EventlogItem,
+	res replicateResult, caughtUp bool,
+) {
+	if w.dryRun || !w.auditLog.Allowed(caughtUp) {
+		return
+	}
+
+	w.logger.Log(ctx, w.auditLog.Level, "replicated event",
+		elephantine.LogKeyEventID, evt.Id,
+		elephantine.LogKeyEventType, evt.Event,
+		elephantine.LogKeyDocumentUUID, evt.Uuid,
+		elephantine.LogKeyDocumentType, evt.Type,
+		elephantine.LogKeyDocumentVersion, evt.Version,
+		"target_version", res.TargetVersion,
+		"attachments", res.Attachments,
+		"caught_up", caughtUp,
+	)
+}
@@ -0,0 +1,41 @@
+package internal_test
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/ttab/elephant-replicant/internal"
+)
+
+func TestParseAuditLog(t *testing.T) {
+	disabled, err := internal.ParseAuditLog("", true)
+	if err != nil {
+		t.Fatalf("parse empty level: %v", err)
+	}
+
+	if disabled.Allowed(true) {
+		t.Error("expected the audit log to be disabled without a level")
+	}
+
+	al, err := internal.ParseAuditLog("debug", false)
+	if err != nil {
+		t.Fatalf("parse level: %v", err)
+	}
+
+	if al.Level != slog.LevelDebug {
+		t.Errorf("got level %v, want %v", al.Level, slog.LevelDebug)
+	}
+
+	if !al.Allowed(true) {
+		t.Error("expected events to be logged when caught up")
+	}
+
+	if al.Allowed(false) {
+		t.Error("expected events to be left out while catching up")
+	}
+
+	_, err = internal.ParseAuditLog("loud", false)
+	if err == nil {
+		t.Error("expected an error for an invalid level")
+	}
+}
@@ -0,0 +1,366 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephantine"
+	"github.com/twitchtv/twirp"
+)
+
+// ErrCircuitOpen is returned for target requests that were short-circuited
+// because the circuit breaker of the target is open. It's always marked with
+// ErrTargetUnavailable.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitBreakerConfig controls the circuit breaker that protects targets that
+// keep failing.
+type CircuitBreakerConfig struct {
+	// Failures is the number of consecutive failed target requests that
+	// opens the breaker, zero disables the breaker.
+	Failures int
+	// CoolDown is how long the breaker stays open before a request is
+	// let through to probe if the target has recovered.
+	CoolDown time.Duration
+}
+
+// CircuitState is the state of a circuit breaker.
+type CircuitState int
+
+// Circuit breaker states, the values are used for the state metric.
+const (
+	CircuitClosed   CircuitState = 0
+	CircuitHalfOpen CircuitState = 1
+	CircuitOpen     CircuitState = 2
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitHalfOpen:
+		return "half-open"
+	case CircuitOpen:
+		return "open"
+	}
+
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+
+// CircuitBreaker tracks consecutive target failures. Once the failure
+// threshold has been reached the breaker opens, and requests fail without
+// being made until the cool-down has passed. A single probe request is then
+// let through, and the breaker closes if it succeeds, or opens again if it
+// fails.
+type CircuitBreaker struct {
+	conf     CircuitBreakerConfig
+	now      func() time.Time
+	onChange func(state CircuitState)
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewCircuitBreaker creates a circuit breaker, onChange is called with the new
+// state whenever it changes. Returns nil if the breaker is disabled, the
+// methods of a nil breaker let all requests through.
+func NewCircuitBreaker(
+	conf CircuitBreakerConfig, now func() time.Time, onChange func(state CircuitState),
+) *CircuitBreaker {
+	if conf.Failures <= 0 {
+		return nil
+	}
+
+	if now == nil {
+		now = time.Now
+	}
+
+	if onChange == nil {
+		onChange = func(_ CircuitState) {}
+	}
+
+	return &CircuitBreaker{
+		conf:     conf,
+		now:      now,
+		onChange: onChange,
+	}
+}
+
+// State returns the current state of the breaker.
+func (cb *CircuitBreaker) State() CircuitState {
+	if cb == nil {
+		return CircuitClosed
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	return cb.state
+}
+
+// Allow returns ErrCircuitOpen if the request should be short-circuited. A
+// request that is allowed must be followed by a call to Done.
+func (cb *CircuitBreaker) Allow() error {
+	if cb == nil {
+		return nil
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case CircuitClosed:
+		return nil
+	case CircuitOpen:
+		if cb.now().Sub(cb.openedAt) < cb.conf.CoolDown {
+			return fmt.Errorf("%w: %w", ErrTargetUnavailable, ErrCircuitOpen)
+		}
+
+		cb.setState(CircuitHalfOpen)
+	case CircuitHalfOpen:
+	}
+
+	if cb.probing {
+		return fmt.Errorf("%w: %w", ErrTargetUnavailable, ErrCircuitOpen)
+	}
+
+	cb.probing = true
+
+	return nil
+}
+
+// Done records the outcome of an allowed request.
+func (cb *CircuitBreaker) Done(failed bool) {
+	if cb == nil {
+		return
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	probe := cb.state == CircuitHalfOpen
+
+	if probe {
+		cb.probing = false
+	}
+
+	if !failed {
+		cb.failures = 0
+
+		cb.setState(CircuitClosed)
+
+		return
+	}
+
+	cb.failures++
+
+	if probe || cb.failures >= cb.conf.Failures {
+		cb.openedAt = cb.now()
+
+		cb.setState(CircuitOpen)
+	}
+}
+
+// Wait blocks until the cool-down of an open breaker has passed. It returns
+// errStopped if the stop channel is closed before that.
+func (cb *CircuitBreaker) Wait(ctx context.Context, stop <-chan struct{}) error {
+	if cb == nil {
+		return nil
+	}
+
+	cb.mu.Lock()
+	state := cb.state
+	remaining := cb.conf.CoolDown - cb.now().Sub(cb.openedAt)
+	cb.mu.Unlock()
+
+	if state != CircuitOpen || remaining <= 0 {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err() //nolint: wrapcheck
+	case <-stop:
+		return errStopped
+	case <-time.After(remaining):
+		return nil
+	}
+}
+
+func (cb *CircuitBreaker) setState(state CircuitState) {
+	if cb.state == state {
+		return
+	}
+
+	cb.state = state
+	cb.onChange(state)
+}
+
+// targetBreaker returns the circuit breaker for a target, or nil if the
+// breaker is disabled.
+func (tm *TargetManager) targetBreaker(name string) *CircuitBreaker {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	breaker, ok := tm.breakers[name]
+	if ok {
+		return breaker
+	}
+
+	breaker = NewCircuitBreaker(tm.opts.CircuitBreaker, nil,
+		func(state CircuitState) {
+			tm.opts.Metrics.circuitStateChanged(name, state)
+
+			tm.logger.Warn("target circuit breaker state changed",
+				"target", name,
+				"state", state.String())
+		})
+
+	tm.breakers[name] = breaker
+
+	return breaker
+}
+
+// isTargetFailure returns true if the error means that the target is
+// unhealthy, as opposed to the request being rejected.
+func isTargetFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	return errors.Is(targetError(err), ErrTargetUnavailable) ||
+		elephantine.IsTwirpErrorCode(err, twirp.Internal) ||
+		elephantine.IsTwirpErrorCode(err, twirp.DeadlineExceeded) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+// breakerSink applies a circuit breaker to the requests to a sink.
+type breakerSink struct {
+	sink    ReplicationSink
+	breaker *CircuitBreaker
+}
+
+func breakerCall[T any](
+	b *CircuitBreaker, fn func() (T, error),
+) (T, error) {
+	err := b.Allow()
+	if err != nil {
+		var zero T
+
+		return zero, err
+	}
+
+	res, err := fn()
+
+	b.Done(isTargetFailure(err))
+
+	return res, err
+}
+
+// Update implements ReplicationSink.
+func (s *breakerSink) Update(
+	ctx context.Context, req *repository.UpdateRequest,
+) (*repository.UpdateResponse, error) {
+	return breakerCall(s.breaker, func() (*repository.UpdateResponse, error) {
+		return s.sink.Update(ctx, req) //nolint: wrapcheck
+	})
+}
+
+// Delete implements ReplicationSink.
+func (s *breakerSink) Delete(
+	ctx context.Context, req *repository.DeleteDocumentRequest,
+) (*repository.DeleteDocumentResponse, error) {
+	return breakerCall(s.breaker, func() (*repository.DeleteDocumentResponse, error) {
+		return s.sink.Delete(ctx, req) //nolint: wrapcheck
+	})
+}
+
+// Get implements ReplicationSink.
+func (s *breakerSink) Get(
+	ctx context.Context, req *repository.GetDocumentRequest,
+) (*repository.GetDocumentResponse, error) {
+	return breakerCall(s.breaker, func() (*repository.GetDocumentResponse, error) {
+		return s.sink.Get(ctx, req) //nolint: wrapcheck
+	})
+}
+
+// GetMeta implements ReplicationSink.
+func (s *breakerSink) GetMeta(
+	ctx context.Context, req *repository.GetMetaRequest,
+) (*repository.GetMetaResponse, error) {
+	return breakerCall(s.breaker, func() (*repository.GetMetaResponse, error) {
+		return s.sink.GetMeta(ctx, req) //nolint: wrapcheck
+	})
+}
+
+// CreateUpload implements ReplicationSink.
+func (s *breakerSink) CreateUpload(
+	ctx context.Context, req *repository.CreateUploadRequest,
+) (*repository.CreateUploadResponse, error) {
+	return breakerCall(s.breaker, func() (*repository.CreateUploadResponse, error) {
+		return s.sink.CreateUpload(ctx, req) //nolint: wrapcheck
+	})
+}
+
+// breakerMultipartSink applies a circuit breaker to the multipart uploads to a
+// sink.
+type breakerMultipartSink struct {
+	sink    MultipartSink
+	breaker *CircuitBreaker
+}
+
+// CreateMultipartUpload implements MultipartSink.
+func (s *breakerMultipartSink) CreateMultipartUpload(
+	ctx context.Context, req *repository.CreateUploadRequest,
+) (MultipartUpload, error) {
+	upload, err := breakerCall(s.breaker, func() (MultipartUpload, error) {
+		return s.sink.CreateMultipartUpload(ctx, req) //nolint: wrapcheck
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &breakerUpload{upload: upload, breaker: s.breaker}, nil
+}
+
+// breakerUpload applies a circuit breaker to the parts of a multipart upload.
+// Aborts clean up after failed uploads and aren't short-circuited.
+type breakerUpload struct {
+	upload  MultipartUpload
+	breaker *CircuitBreaker
+}
+
+// ID implements MultipartUpload.
+func (u *breakerUpload) ID() string {
+	return u.upload.ID()
+}
+
+// UploadPart implements MultipartUpload.
+func (u *breakerUpload) UploadPart(ctx context.Context, number int, data []byte) error {
+	_, err := breakerCall(u.breaker, func() (struct{}, error) {
+		return struct{}{}, u.upload.UploadPart(ctx, number, data) //nolint: wrapcheck
+	})
+
+	return err
+}
+
+// Complete implements MultipartUpload.
+func (u *breakerUpload) Complete(ctx context.Context) error {
+	_, err := breakerCall(u.breaker, func() (struct{}, error) {
+		return struct{}{}, u.upload.Complete(ctx) //nolint: wrapcheck
+	})
+
+	return err
+}
+
+// Abort implements MultipartUpload.
+func (u *breakerUpload) Abort(ctx context.Context) error {
+	return u.upload.Abort(ctx) //nolint: wrapcheck
+}
@@ -0,0 +1,201 @@
+package internal_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/internal"
+	"github.com/twitchtv/twirp"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+
+	var changes []internal.CircuitState
+
+	cb := internal.NewCircuitBreaker(internal.CircuitBreakerConfig{
+		Failures: 2,
+		CoolDown: time.Minute,
+	}, func() time.Time { return now }, func(state internal.CircuitState) {
+		changes = append(changes, state)
+	})
+
+	for range 2 {
+		if err := cb.Allow(); err != nil {
+			t.Fatalf("expected a closed breaker to allow requests: %v", err)
+		}
+
+		cb.Done(true)
+	}
+
+	if cb.State() != internal.CircuitOpen {
+		t.Fatalf("expected the breaker to open, got %s", cb.State())
+	}
+
+	err := cb.Allow()
+	if !errors.Is(err, internal.ErrCircuitOpen) ||
+		!errors.Is(err, internal.ErrTargetUnavailable) {
+		t.Fatalf("expected an open breaker to short-circuit, got %v", err)
+	}
+
+	now = now.Add(time.Minute)
+
+	if err := cb.Allow(); err != nil {
+		t.Fatalf("expected a probe after the cool-down: %v", err)
+	}
+
+	if err := cb.Allow(); !errors.Is(err, internal.ErrCircuitOpen) {
+		t.Fatalf("expected a single probe, got %v", err)
+	}
+
+	cb.Done(true)
+
+	if cb.State() != internal.CircuitOpen {
+		t.Fatalf("expected a failed probe to open the breaker, got %s", cb.State())
+	}
+
+	now = now.Add(time.Minute)
+
+	if err := cb.Allow(); err != nil {
+		t.Fatalf("expected a probe after the cool-down: %v", err)
+	}
+
+	cb.Done(false)
+
+	if cb.State() != internal.CircuitClosed {
+		t.Fatalf("expected a successful probe to close the breaker, got %s", cb.State())
+	}
+
+	want := []internal.CircuitState{
+		internal.CircuitOpen, internal.CircuitHalfOpen, internal.CircuitOpen,
+		internal.CircuitHalfOpen, internal.CircuitClosed,
+	}
+
+	if len(changes) != len(want) {
+		t.Fatalf("got state changes %v, want %v", changes, want)
+	}
+
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Fatalf("got state changes %v, want %v", changes, want)
+		}
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	cb := internal.NewCircuitBreaker(internal.CircuitBreakerConfig{}, nil, nil)
+
+	for range 10 {
+		if err := cb.Allow(); err != nil {
+			t.Fatalf("expected a disabled breaker to allow requests: %v", err)
+		}
+
+		cb.Done(true)
+	}
+}
+
+func TestCircuitBreakerWaitStopped(t *testing.T) {
+	cb := internal.NewCircuitBreaker(internal.CircuitBreakerConfig{
+		Failures: 1,
+		CoolDown: time.Hour,
+	}, nil, nil)
+
+	if err := cb.Allow(); err != nil {
+		t.Fatalf("expected a closed breaker to allow requests: %v", err)
+	}
+
+	cb.Done(true)
+
+	stop := make(chan struct{})
+	close(stop)
+
+	err := cb.Wait(t.Context(), stop)
+	if !errors.Is(err, internal.ErrStopped) {
+		t.Fatalf("expected an open breaker to stop waiting on shutdown, got %v", err)
+	}
+}
+
+// failingMultipart is a multipart sink with a target that fails every part
+// upload.
+type failingMultipart struct {
+	calls  int
+	aborts int
+}
+
+func (m *failingMultipart) CreateMultipartUpload(
+	context.Context, *repository.CreateUploadRequest,
+) (internal.MultipartUpload, error) {
+	m.calls++
+
+	return m, nil
+}
+
+func (m *failingMultipart) ID() string { return "upload" }
+
+func (m *failingMultipart) UploadPart(context.Context, int, []byte) error {
+	m.calls++
+
+	return twirp.InternalError("target is down")
+}
+
+func (m *failingMultipart) Complete(context.Context) error {
+	m.calls++
+
+	return nil
+}
+
+func (m *failingMultipart) Abort(context.Context) error {
+	m.aborts++
+
+	return nil
+}
+
+func TestCircuitBreakerMultipartUploads(t *testing.T) {
+	ctx := t.Context()
+	target := failingMultipart{}
+
+	cb := internal.NewCircuitBreaker(internal.CircuitBreakerConfig{
+		Failures: 2,
+		CoolDown: time.Minute,
+	}, time.Now, nil)
+
+	sink := internal.NewBreakerMultipartSink(&target, cb)
+
+	upload, err := sink.CreateMultipartUpload(ctx, &repository.CreateUploadRequest{})
+	if err != nil {
+		t.Fatalf("create multipart upload: %v", err)
+	}
+
+	for i := range 2 {
+		_ = upload.UploadPart(ctx, i+1, []byte("part"))
+	}
+
+	if cb.State() != internal.CircuitOpen {
+		t.Fatalf("expected failed part uploads to open the breaker, got %s", cb.State())
+	}
+
+	calls := target.calls
+
+	err = upload.UploadPart(ctx, 3, []byte("part"))
+	if !errors.Is(err, internal.ErrCircuitOpen) {
+		t.Errorf("expected part uploads to be short-circuited, got %v", err)
+	}
+
+	_, err = sink.CreateMultipartUpload(ctx, &repository.CreateUploadRequest{})
+	if !errors.Is(err, internal.ErrCircuitOpen) {
+		t.Errorf("expected new uploads to be short-circuited, got %v", err)
+	}
+
+	if target.calls != calls {
+		t.Errorf("expected no requests to the target while open, got %d",
+			target.calls-calls)
+	}
+
+	err = upload.Abort(ctx)
+	if err != nil || target.aborts != 1 {
+		t.Errorf("expected the upload to be aborted while open: %v", err)
+	}
+}
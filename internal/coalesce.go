@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/ttab/elephant-api/repository"
+)
+
+// errSuperseded is the outcome of events that were coalesced with a later
+// event for the same document.
+var errSuperseded = fmt.Errorf("superseded by a later event in the batch: %w", ErrSkipped)
+
+// SupersededEvents finds the events in a batch that can be skipped when
+// catching up. Every event syncs the current state of its document when we
+// haven't caught up, so only the last event for a document has to be handled.
+// Deletes and restores are never superseded, so that they still take effect in
+// order, and workflow events aren't document specific.
+//
+// Events that are skipped before the document is synced, as reported by
+// skipped, don't supersede earlier events, as they never sync the document.
+//
+// The result is nil if no events were superseded.
+func SupersededEvents(
+	items []*repository.EventlogItem,
+	skipped func(evt *repository.EventlogItem) bool,
+) []bool {
+	var (
+		superseded []bool
+		seen       = make(map[string]bool, len(items))
+	)
+
+	for i := len(items) - 1; i >= 0; i-- {
+		evt := items[i]
+
+		switch evt.Event {
+		case TypeWorkflow:
+			continue
+		case TypeDeleteDocument, TypeRestoreFinished:
+			seen[evt.Uuid] = true
+
+			continue
+		}
+
+		if skipped != nil && skipped(evt) {
+			continue
+		}
+
+		if !seen[evt.Uuid] {
+			seen[evt.Uuid] = true
+
+			continue
+		}
+
+		if superseded == nil {
+			superseded = make([]bool, len(items))
+		}
+
+		superseded[i] = true
+	}
+
+	return superseded
+}
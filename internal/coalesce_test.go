@@ -0,0 +1,70 @@
+package internal_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/internal"
+)
+
+func TestSupersededEvents(t *testing.T) {
+	const (
+		docA = "5f3c0a7e-3f4b-4c3e-9d51-1c2f6f1e9a01"
+		docB = "8a1d2b3c-4e5f-4a6b-8c7d-9e0f1a2b3c4d"
+	)
+
+	items := []*repository.EventlogItem{
+		{Event: internal.TypeDocumentVersion, Uuid: docA},
+		{Event: internal.TypeNewStatus, Uuid: docA},
+		{Event: internal.TypeDocumentVersion, Uuid: docB},
+		{Event: internal.TypeDeleteDocument, Uuid: docA},
+		{Event: internal.TypeRestoreFinished, Uuid: docA},
+		{Event: internal.TypeDocumentVersion, Uuid: docA},
+		{Event: internal.TypeWorkflow, Uuid: docB},
+		{Event: internal.TypeACLUpdate, Uuid: docB},
+	}
+
+	got := internal.SupersededEvents(items, nil)
+	want := []bool{true, true, true, false, false, false, false, false}
+
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	got = internal.SupersededEvents(items[3:6], nil)
+	if got != nil {
+		t.Errorf("expected no superseded events, got %v", got)
+	}
+}
+
+func TestSupersededEventsSkippedStatus(t *testing.T) {
+	const docA = "5f3c0a7e-3f4b-4c3e-9d51-1c2f6f1e9a01"
+
+	items := []*repository.EventlogItem{
+		{Event: internal.TypeDocumentVersion, Uuid: docA, Version: 1},
+		{
+			Event:      internal.TypeNewStatus,
+			Uuid:       docA,
+			Status:     "usable",
+			UpdaterUri: "internal://scheduler",
+		},
+	}
+
+	schedulerUsable := func(evt *repository.EventlogItem) bool {
+		return evt.Event == internal.TypeNewStatus &&
+			evt.UpdaterUri == "internal://scheduler"
+	}
+
+	// The status event never syncs the document, so the document event
+	// has to be handled.
+	got := internal.SupersededEvents(items, schedulerUsable)
+	if got != nil {
+		t.Errorf("expected no superseded events, got %v", got)
+	}
+
+	got = internal.SupersededEvents(items, nil)
+	if !slices.Equal(got, []bool{true, false}) {
+		t.Errorf("expected the document event to be superseded by a handled status, got %v", got)
+	}
+}
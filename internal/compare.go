@@ -0,0 +1,378 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	rpc_newsdoc "github.com/ttab/elephant-api/newsdoc"
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/postgres"
+	"github.com/ttab/elephantine"
+	"github.com/twitchtv/twirp"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// ErrNotInTarget is returned when a document that is compared doesn't exist
+// in the target.
+var ErrNotInTarget = errors.New("document doesn't exist in the target")
+
+// DocumentDifference is a difference between the expected and actual state
+// of a document in the target. The values are JSON, and empty if missing.
+type DocumentDifference struct {
+	Field    string `json:"field"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+}
+
+// DocumentComparison is the result of comparing a document in the source
+// with its replicated copy in the target.
+type DocumentComparison struct {
+	SourceUUID    uuid.UUID `json:"source_uuid"`
+	TargetUUID    uuid.UUID `json:"target_uuid"`
+	SourceVersion int64     `json:"source_version"`
+	TargetVersion int64     `json:"target_version"`
+	// ExpectedVersion is the target version that the current source
+	// version is mapped to, zero if it hasn't been replicated.
+	ExpectedVersion int64                `json:"expected_version"`
+	Identical       bool                 `json:"identical"`
+	Differences     []DocumentDifference `json:"differences"`
+}
+
+// CompareDocument compares the current document, statuses, and ACL in the
+// source with the target. The source state is mapped the same way as when
+// replicating, so the expected differences from type, UUID, and ACL mapping,
+// transforms and stripped blocks aren't reported. Both documents are
+// normalized before they're compared. Import directives aren't
+// part of the documents and are never compared.
+func (w *Worker) CompareDocument(
+	ctx context.Context, docUUID uuid.UUID,
+) (*DocumentComparison, error) {
+	q := postgres.New(w.db)
+	targetUUID := w.uuidMapping.Map(docUUID)
+
+	sourceMeta, err := w.source.GetMeta(ctx, &repository.GetMetaRequest{
+		Uuid: docUUID.String(),
+	})
+	if elephantine.IsTwirpErrorCode(err, twirp.NotFound) {
+		return nil, fmt.Errorf("document not found in source: %w", ErrSkipped)
+	} else if err != nil {
+		return nil, fmt.Errorf("get source meta: %w", err)
+	}
+
+	sourceDoc, err := w.source.Get(ctx, &repository.GetDocumentRequest{
+		Uuid:    docUUID.String(),
+		Version: sourceMeta.Meta.CurrentVersion,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get source document: %w", err)
+	}
+
+	targetMeta, err := w.target.GetMeta(ctx, &repository.GetMetaRequest{
+		Uuid: targetUUID.String(),
+	})
+	if elephantine.IsTwirpErrorCode(err, twirp.NotFound) {
+		return nil, ErrNotInTarget
+	} else if err != nil {
+		return nil, fmt.Errorf("get target meta: %w", targetError(err))
+	}
+
+	targetDoc, err := w.target.Get(ctx, &repository.GetDocumentRequest{
+		Uuid:    targetUUID.String(),
+		Version: targetMeta.Meta.CurrentVersion,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get target document: %w", targetError(err))
+	}
+
+	expectedDoc := sourceDoc.Document
+
+	err = w.mapDocument(ctx, q, expectedDoc, targetUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := DocumentComparison{
+		SourceUUID:    docUUID,
+		TargetUUID:    targetUUID,
+		SourceVersion: sourceMeta.Meta.CurrentVersion,
+		TargetVersion: targetMeta.Meta.CurrentVersion,
+	}
+
+	res.ExpectedVersion, err = w.mappedVersion(ctx, q, targetUUID,
+		sourceMeta.Meta.CurrentVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.ExpectedVersion != res.TargetVersion {
+		res.Differences = append(res.Differences, DocumentDifference{
+			Field:    "version",
+			Expected: strconv.FormatInt(res.ExpectedVersion, 10),
+			Actual:   strconv.FormatInt(res.TargetVersion, 10),
+		})
+	}
+
+	docDiff, err := CompareDocuments(
+		w.normalizer.Normalize(expectedDoc),
+		w.normalizer.Normalize(targetDoc.Document))
+	if err != nil {
+		return nil, err
+	}
+
+	res.Differences = append(res.Differences, docDiff...)
+
+	expectedStatuses := make(map[string]ComparedStatus)
+
+	for name, head := range sourceMeta.Meta.Heads {
+		if w.skipSchedulerUsable(name, head.Creator) || !w.statusFilter.Allowed(name) {
+			continue
+		}
+
+		version, err := w.mappedVersion(ctx, q, targetUUID, head.Version)
+		if err != nil {
+			return nil, err
+		}
+
+		expectedStatuses[name] = ComparedStatus{
+			Version: version,
+			Meta:    head.Meta,
+		}
+	}
+
+	actualStatuses := make(map[string]ComparedStatus)
+
+	for name, head := range targetMeta.Meta.Heads {
+		actualStatuses[name] = ComparedStatus{
+			Version: head.Version,
+			Meta:    head.Meta,
+		}
+	}
+
+	statusDiff, err := CompareStatuses(expectedStatuses, actualStatuses)
+	if err != nil {
+		return nil, err
+	}
+
+	res.Differences = append(res.Differences, statusDiff...)
+	res.Differences = append(res.Differences, CompareACLs(
+		w.targetACL(sourceMeta.Meta.Acl), targetMeta.Meta.Acl)...)
+
+	res.Identical = len(res.Differences) == 0
+
+	if res.Differences == nil {
+		res.Differences = []DocumentDifference{}
+	}
+
+	return &res, nil
+}
+
+// CompareDocument compares a document in the source with its replicated copy
+// in the named target.
+func (tm *TargetManager) CompareDocument(
+	ctx context.Context, name string, docUUID uuid.UUID,
+) (*DocumentComparison, error) {
+	target, err := postgres.New(tm.db).GetTarget(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("load target config: %w", err)
+	}
+
+	w, err := tm.newWorker(ctx, tm.logger.With("target", name), target)
+	if err != nil {
+		return nil, fmt.Errorf("create worker: %w", err)
+	}
+
+	return w.CompareDocument(ctx, docUUID)
+}
+
+// mappedVersion returns the target version that a source version was
+// replicated as, or zero if it hasn't been replicated.
+func (w *Worker) mappedVersion(
+	ctx context.Context, q *postgres.Queries, targetUUID uuid.UUID, version int64,
+) (int64, error) {
+	mapped, err := q.GetTargetVersion(ctx, postgres.GetTargetVersionParams{
+		TargetName:    w.name,
+		ID:            targetUUID,
+		SourceVersion: version,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("get version mapping: %w", err)
+	}
+
+	return mapped, nil
+}
+
+// CompareDocuments compares the top level fields of two documents.
+func CompareDocuments(
+	expected *rpc_newsdoc.Document, actual *rpc_newsdoc.Document,
+) ([]DocumentDifference, error) {
+	expectedFields, err := messageFields(expected)
+	if err != nil {
+		return nil, fmt.Errorf("marshal expected document: %w", err)
+	}
+
+	actualFields, err := messageFields(actual)
+	if err != nil {
+		return nil, fmt.Errorf("marshal actual document: %w", err)
+	}
+
+	return compareFields("document.", expectedFields, actualFields), nil
+}
+
+// ComparedStatus is the part of a status head that is compared.
+type ComparedStatus struct {
+	Version int64             `json:"version"`
+	Meta    map[string]string `json:"meta,omitempty"`
+}
+
+// CompareStatuses compares status heads by name.
+func CompareStatuses(
+	expected map[string]ComparedStatus, actual map[string]ComparedStatus,
+) ([]DocumentDifference, error) {
+	expectedFields, err := jsonFields(expected)
+	if err != nil {
+		return nil, err
+	}
+
+	actualFields, err := jsonFields(actual)
+	if err != nil {
+		return nil, err
+	}
+
+	return compareFields("status.", expectedFields, actualFields), nil
+}
+
+// CompareACLs compares the permissions per URI, ignoring the order of
+// entries and permissions.
+func CompareACLs(
+	expected []*repository.ACLEntry, actual []*repository.ACLEntry,
+) []DocumentDifference {
+	expectedPerms := aclPermissions(expected)
+	actualPerms := aclPermissions(actual)
+
+	var diff []DocumentDifference
+
+	for _, uri := range sortedUnion(expectedPerms, actualPerms) {
+		e, a := expectedPerms[uri], actualPerms[uri]
+		if e == a {
+			continue
+		}
+
+		diff = append(diff, DocumentDifference{
+			Field:    "acl." + uri,
+			Expected: e,
+			Actual:   a,
+		})
+	}
+
+	return diff
+}
+
+func aclPermissions(acl []*repository.ACLEntry) map[string]string {
+	perms := make(map[string][]string)
+
+	for _, entry := range acl {
+		perms[entry.Uri] = append(perms[entry.Uri], entry.Permissions...)
+	}
+
+	res := make(map[string]string, len(perms))
+
+	for uri, p := range perms {
+		slices.Sort(p)
+
+		res[uri] = strings.Join(slices.Compact(p), ",")
+	}
+
+	return res
+}
+
+func compareFields(
+	prefix string, expected, actual map[string]json.RawMessage,
+) []DocumentDifference {
+	var diff []DocumentDifference
+
+	for _, field := range sortedUnion(expected, actual) {
+		var e, a string
+
+		if v, ok := expected[field]; ok {
+			e = string(canonicalJSON(v))
+		}
+
+		if v, ok := actual[field]; ok {
+			a = string(canonicalJSON(v))
+		}
+
+		if e == a {
+			continue
+		}
+
+		diff = append(diff, DocumentDifference{
+			Field:    prefix + field,
+			Expected: e,
+			Actual:   a,
+		})
+	}
+
+	return diff
+}
+
+func sortedUnion[T any](a, b map[string]T) []string {
+	keys := make([]string, 0, len(a)+len(b))
+
+	for k := range a {
+		keys = append(keys, k)
+	}
+
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+
+	slices.Sort(keys)
+
+	return keys
+}
+
+func messageFields(doc *rpc_newsdoc.Document) (map[string]json.RawMessage, error) {
+	fields := make(map[string]json.RawMessage)
+
+	if doc == nil {
+		return fields, nil
+	}
+
+	data, err := protojson.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("marshal document: %w", err)
+	}
+
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal document fields: %w", err)
+	}
+
+	return fields, nil
+}
+
+func jsonFields[T any](v map[string]T) (map[string]json.RawMessage, error) {
+	fields := make(map[string]json.RawMessage, len(v))
+
+	for k, value := range v {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("marshal %q: %w", k, err)
+		}
+
+		fields[k] = data
+	}
+
+	return fields, nil
+}
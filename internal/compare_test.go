@@ -0,0 +1,110 @@
+package internal_test
+
+import (
+	"testing"
+
+	rpc_newsdoc "github.com/ttab/elephant-api/newsdoc"
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/internal"
+)
+
+func TestCompareDocuments(t *testing.T) {
+	expected := &rpc_newsdoc.Document{
+		Uuid:  "a",
+		Title: "Title",
+		Links: []*rpc_newsdoc.Block{{Rel: "section", Uri: "core://section/1"}},
+	}
+
+	actual := &rpc_newsdoc.Document{
+		Uuid:     "a",
+		Title:    "Changed",
+		Language: "sv",
+		Links:    []*rpc_newsdoc.Block{{Rel: "section", Uri: "core://section/1"}},
+	}
+
+	diff, err := internal.CompareDocuments(expected, actual)
+	if err != nil {
+		t.Fatalf("compare: %v", err)
+	}
+
+	if len(diff) != 2 {
+		t.Fatalf("expected two differences, got %v", diff)
+	}
+
+	if diff[0].Field != "document.language" || diff[0].Expected != "" ||
+		diff[0].Actual != `"sv"` {
+		t.Errorf("unexpected language difference: %+v", diff[0])
+	}
+
+	if diff[1].Field != "document.title" || diff[1].Expected != `"Title"` {
+		t.Errorf("unexpected title difference: %+v", diff[1])
+	}
+
+	diff, err = internal.CompareDocuments(expected, expected)
+	if err != nil {
+		t.Fatalf("compare: %v", err)
+	}
+
+	if len(diff) != 0 {
+		t.Errorf("expected identical documents, got %v", diff)
+	}
+}
+
+func TestCompareStatuses(t *testing.T) {
+	diff, err := internal.CompareStatuses(
+		map[string]internal.ComparedStatus{
+			"usable": {Version: 2},
+			"done":   {Version: 1},
+		},
+		map[string]internal.ComparedStatus{
+			"usable":   {Version: 3},
+			"approved": {Version: 1},
+		},
+	)
+	if err != nil {
+		t.Fatalf("compare: %v", err)
+	}
+
+	var fields []string
+
+	for _, d := range diff {
+		fields = append(fields, d.Field)
+	}
+
+	want := []string{"status.approved", "status.done", "status.usable"}
+
+	if len(fields) != len(want) {
+		t.Fatalf("got differences %v, want %v", fields, want)
+	}
+
+	for i := range want {
+		if fields[i] != want[i] {
+			t.Fatalf("got differences %v, want %v", fields, want)
+		}
+	}
+}
+
+func TestCompareACLs(t *testing.T) {
+	diff := internal.CompareACLs(
+		[]*repository.ACLEntry{
+			{Uri: "core://unit/a", Permissions: []string{"w", "r"}},
+			{Uri: "core://unit/b", Permissions: []string{"r"}},
+		},
+		[]*repository.ACLEntry{
+			{Uri: "core://unit/a", Permissions: []string{"r", "w"}},
+			{Uri: "core://unit/c", Permissions: []string{"r"}},
+		},
+	)
+
+	if len(diff) != 2 {
+		t.Fatalf("expected two differences, got %v", diff)
+	}
+
+	if diff[0].Field != "acl.core://unit/b" || diff[0].Actual != "" {
+		t.Errorf("unexpected difference: %+v", diff[0])
+	}
+
+	if diff[1].Field != "acl.core://unit/c" || diff[1].Expected != "" {
+		t.Errorf("unexpected difference: %+v", diff[1])
+	}
+}
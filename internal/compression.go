@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AttachmentCompression controls if attachments are downloaded compressed.
+type AttachmentCompression string
+
+const (
+	// CompressionOff downloads attachments as the HTTP client sees fit.
+	CompressionOff AttachmentCompression = "off"
+	// CompressionDecompress asks for gzip compressed downloads, and
+	// decompresses them before they're uploaded to the target.
+	CompressionDecompress AttachmentCompression = "decompress"
+	// CompressionPassthrough asks for gzip compressed downloads, and
+	// uploads them compressed with the "Content-Encoding: gzip" header.
+	// The target must store and serve the content encoding of uploads.
+	CompressionPassthrough AttachmentCompression = "passthrough"
+)
+
+// ParseAttachmentCompression parses an attachment compression mode, an empty
+// value is treated as CompressionOff.
+func ParseAttachmentCompression(s string) (AttachmentCompression, error) {
+	switch c := AttachmentCompression(s); c {
+	case "":
+		return CompressionOff, nil
+	case CompressionOff, CompressionDecompress, CompressionPassthrough:
+		return c, nil
+	default:
+		return "", fmt.Errorf("unknown attachment compression %q", s)
+	}
+}
+
+// Enabled returns true if compressed downloads should be requested.
+func (c AttachmentCompression) Enabled() bool {
+	return c == CompressionDecompress || c == CompressionPassthrough
+}
+
+// TransferEncoding decides how a download with the given content encoding is
+// uploaded. Returns the content encoding of the upload, and true if the
+// download has to be decompressed first. Compressed downloads can only be
+// passed through to single PUT uploads, multipart uploads are decompressed.
+// Downloads aren't touched when compression is off.
+func (c AttachmentCompression) TransferEncoding(
+	contentEncoding string, singlePut bool,
+) (string, bool, error) {
+	if !c.Enabled() {
+		return "", false, nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(contentEncoding)) {
+	case "", "identity":
+		return "", false, nil
+	case "gzip", "x-gzip":
+		if c == CompressionPassthrough && singlePut {
+			return "gzip", false, nil
+		}
+
+		return "", true, nil
+	default:
+		return "", false, fmt.Errorf(
+			"unsupported attachment content encoding %q", contentEncoding)
+	}
+}
+
+// limitErr returns the size limit error of the downloaded or the decompressed
+// attachment data, if any.
+func limitErr(download *transferReader, content *transferReader) error {
+	if content.err != nil {
+		return content.err
+	}
+
+	return download.err
+}
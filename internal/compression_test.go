@@ -0,0 +1,292 @@
+package internal_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/internal"
+)
+
+func TestParseAttachmentCompression(t *testing.T) {
+	c, err := internal.ParseAttachmentCompression("")
+	if err != nil || c != internal.CompressionOff {
+		t.Errorf("expected compression to be off by default, got %q: %v", c, err)
+	}
+
+	_, err = internal.ParseAttachmentCompression("brotli")
+	if err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
+
+func TestTransferEncoding(t *testing.T) {
+	cases := []struct {
+		mode       internal.AttachmentCompression
+		encoding   string
+		singlePut  bool
+		upload     string
+		decompress bool
+	}{
+		{internal.CompressionOff, "gzip", true, "", false},
+		{internal.CompressionDecompress, "", true, "", false},
+		{internal.CompressionDecompress, "gzip", true, "", true},
+		{internal.CompressionPassthrough, "GZIP", true, "gzip", false},
+		{internal.CompressionPassthrough, "gzip", false, "", true},
+		{internal.CompressionPassthrough, "identity", true, "", false},
+	}
+
+	for _, c := range cases {
+		upload, decompress, err := c.mode.TransferEncoding(c.encoding, c.singlePut)
+		if err != nil {
+			t.Errorf("%s %q: unexpected error: %v", c.mode, c.encoding, err)
+
+			continue
+		}
+
+		if upload != c.upload || decompress != c.decompress {
+			t.Errorf("%s %q single PUT %v: got %q %v, expected %q %v",
+				c.mode, c.encoding, c.singlePut,
+				upload, decompress, c.upload, c.decompress)
+		}
+	}
+
+	_, _, err := internal.CompressionPassthrough.TransferEncoding("br", true)
+	if err == nil {
+		t.Error("expected an error for an unsupported content encoding")
+	}
+}
+
+// compressedSource serves an attachment gzip compressed to clients that accept
+// it.
+func compressedSource(t *testing.T, content []byte) *httptest.Server {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	gz := gzip.NewWriter(&buf)
+
+	_, _ = gz.Write(content)
+
+	err := gz.Close()
+	if err != nil {
+		t.Fatalf("compress attachment: %v", err)
+	}
+
+	compressed := buf.Bytes()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data := content
+
+		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			data = compressed
+
+			w.Header().Set("Content-Encoding", "gzip")
+		}
+
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+
+		_, _ = w.Write(data)
+	}))
+
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+type recordedUpload struct {
+	contentEncoding string
+	contentLength   int64
+}
+
+// uploadTarget accepts uploads to the fake documents and records the upload
+// headers.
+func uploadTarget(t *testing.T) (*internal.FakeDocuments, func() recordedUpload) {
+	t.Helper()
+
+	var (
+		mu       sync.Mutex
+		recorded recordedUpload
+	)
+
+	docs := internal.NewFakeDocuments()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		recorded = recordedUpload{
+			contentEncoding: r.Header.Get("Content-Encoding"),
+			contentLength:   r.ContentLength,
+		}
+		mu.Unlock()
+
+		docs.ServeHTTP(w, r)
+	}))
+
+	t.Cleanup(srv.Close)
+
+	docs.UploadURL = srv.URL
+
+	return docs, func() recordedUpload {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return recorded
+	}
+}
+
+func transferMetrics(t *testing.T) (*prometheus.Registry, *internal.ReplicationMetrics) {
+	t.Helper()
+
+	reg := prometheus.NewRegistry()
+
+	metrics, err := internal.NewReplicationMetrics(reg, 0)
+	if err != nil {
+		t.Fatalf("create metrics: %v", err)
+	}
+
+	return reg, metrics
+}
+
+// transferredBytes returns the attachment bytes metric for the direction.
+func transferredBytes(t *testing.T, reg *prometheus.Registry, direction string) float64 {
+	t.Helper()
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("gather metrics: %v", err)
+	}
+
+	for _, f := range families {
+		if f.GetName() != "replicant_attachment_bytes_total" {
+			continue
+		}
+
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "direction" && l.GetValue() == direction {
+					return m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+
+	return 0
+}
+
+func TestTransferCompressedAttachment(t *testing.T) {
+	content := bytes.Repeat([]byte("compressible attachment data "), 200)
+	src := compressedSource(t, content)
+
+	obj := &repository.AttachmentDetails{
+		Name:         "text",
+		Filename:     "text.txt",
+		ContentType:  "text/plain",
+		DownloadLink: src.URL + "/text.txt",
+	}
+
+	t.Run("decompress", func(t *testing.T) {
+		docs, upload := uploadTarget(t)
+		reg, metrics := transferMetrics(t)
+
+		id, err := internal.TestTransfer{
+			Target:      docs,
+			HTTPClient:  src.Client(),
+			Compression: internal.CompressionDecompress,
+			Verify:      true,
+			Metrics:     metrics,
+		}.Transfer(t.Context(), obj)
+		if err != nil {
+			t.Fatalf("transfer attachment: %v", err)
+		}
+
+		data, _ := docs.Upload(id)
+		if !bytes.Equal(data, content) {
+			t.Errorf("expected the decompressed attachment to be uploaded, got %d bytes",
+				len(data))
+		}
+
+		rec := upload()
+
+		if rec.contentEncoding != "" {
+			t.Errorf("expected no content encoding, got %q", rec.contentEncoding)
+		}
+
+		if rec.contentLength != -1 {
+			t.Errorf("expected the upload to be streamed without a length, got %d",
+				rec.contentLength)
+		}
+
+		if n := transferredBytes(t, reg, "upload"); n != float64(len(content)) {
+			t.Errorf("expected %d uploaded bytes, got %v", len(content), n)
+		}
+	})
+
+	t.Run("passthrough", func(t *testing.T) {
+		docs, upload := uploadTarget(t)
+		reg, metrics := transferMetrics(t)
+
+		id, err := internal.TestTransfer{
+			Target:      docs,
+			HTTPClient:  src.Client(),
+			Compression: internal.CompressionPassthrough,
+			Verify:      true,
+			Metrics:     metrics,
+		}.Transfer(t.Context(), obj)
+		if err != nil {
+			t.Fatalf("transfer attachment: %v", err)
+		}
+
+		data, _ := docs.Upload(id)
+
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("expected a gzip compressed upload: %v", err)
+		}
+
+		var decompressed bytes.Buffer
+
+		_, err = decompressed.ReadFrom(gz)
+		if err != nil || !bytes.Equal(decompressed.Bytes(), content) {
+			t.Errorf("expected the compressed attachment to be uploaded: %v", err)
+		}
+
+		rec := upload()
+
+		if rec.contentEncoding != "gzip" {
+			t.Errorf("expected gzip content encoding, got %q", rec.contentEncoding)
+		}
+
+		if rec.contentLength != int64(len(data)) {
+			t.Errorf("expected a content length of %d, got %d",
+				len(data), rec.contentLength)
+		}
+
+		if n := transferredBytes(t, reg, "upload"); n != float64(len(data)) {
+			t.Errorf("expected %d uploaded bytes, got %v", len(data), n)
+		}
+	})
+
+	t.Run("decompressed size limit", func(t *testing.T) {
+		docs, _ := uploadTarget(t)
+
+		// The compressed download is well below the limit, the
+		// decompressed data isn't.
+		_, err := internal.TestTransfer{
+			Target:      docs,
+			HTTPClient:  src.Client(),
+			Compression: internal.CompressionDecompress,
+			MaxSize:     int64(len(content) / 2),
+		}.Transfer(t.Context(), obj)
+		if !errors.Is(err, internal.ErrAttachmentTooLarge) {
+			t.Errorf("expected the decompressed size to be limited, got %v", err)
+		}
+	})
+}
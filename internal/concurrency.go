@@ -0,0 +1,223 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/ttab/elephant-api/repository"
+)
+
+// errNotHandled is the outcome of events that weren't handled because an
+// earlier event for the same document failed.
+var errNotHandled = errors.New("not handled because of an earlier failure")
+
+type eventOutcome struct {
+	err      error
+	duration time.Duration
+}
+
+// EventDisposition is how replication treats the outcome of handling an
+// event.
+type EventDisposition int
+
+const (
+	// DispositionHandled is the disposition of events that were
+	// replicated.
+	DispositionHandled EventDisposition = iota
+	// DispositionNotHandled is the disposition of events that weren't
+	// handled because of an earlier failure, the batch is rewound to the
+	// event and handled again.
+	DispositionNotHandled
+	// DispositionHalt halts replication at the event.
+	DispositionHalt
+	// DispositionSkipped is the disposition of events that were skipped.
+	DispositionSkipped
+	// DispositionOversized is the disposition of events for documents
+	// that were too large for the target, and that are recorded and
+	// skipped.
+	DispositionOversized
+	// DispositionConflict is the disposition of events for documents that
+	// have been modified in the target.
+	DispositionConflict
+	// DispositionRejected is the disposition of events that failed with
+	// an error that is classified as ErrorSkip, they're dead lettered.
+	DispositionRejected
+	// DispositionAccepted is the disposition of errors that are logged
+	// and accepted.
+	DispositionAccepted
+	// DispositionFailed is the disposition of events that failed, the
+	// document is quarantined or replication halts.
+	DispositionFailed
+)
+
+// StopsLane returns true if the events in the lane after an event with the
+// disposition shouldn't be handled.
+func (d EventDisposition) StopsLane() bool {
+	return d == DispositionHalt || d == DispositionFailed
+}
+
+// OutcomeRules decides the disposition of the outcome of handling events.
+type OutcomeRules struct {
+	OversizePolicy OversizePolicy
+	ErrorClasses   ErrorClassification
+	AcceptErrors   bool
+}
+
+// Disposition returns the disposition of an event that was handled with the
+// given error.
+func (r OutcomeRules) Disposition(err error) EventDisposition {
+	switch {
+	case err == nil:
+		return DispositionHandled
+	case errors.Is(err, errNotHandled):
+		return DispositionNotHandled
+	case errors.Is(err, ErrUnknownEvent), errors.Is(err, ErrStateConflict):
+		return DispositionHalt
+	case errors.Is(err, ErrSkipped):
+		return DispositionSkipped
+	case errors.Is(err, ErrOversized) && r.OversizePolicy != OversizeFail:
+		return DispositionOversized
+	case errors.Is(err, ErrConflict):
+		return DispositionConflict
+	case r.ErrorClasses.Classify(err) == ErrorSkip:
+		return DispositionRejected
+	case r.AcceptErrors:
+		return DispositionAccepted
+	default:
+		return DispositionFailed
+	}
+}
+
+// RunLanes calls handle for a batch of events using a pool of lanes. Events
+// are assigned to lanes by document UUID, see LaneKey, so that the events for
+// a document are handled in order, events with an empty document UUID aren't
+// handled. A
+// lane stops at the first event with a disposition that stops the lane, the
+// rest of its events get the DispositionNotHandled outcome.
+//
+// The outcomes are returned in the same order as the events.
+func (r OutcomeRules) RunLanes(
+	docUUIDs []string, lanes int, handle func(i int) error,
+) []error {
+	outcomes := make([]error, len(docUUIDs))
+	assigned := make([][]int, lanes)
+
+	for i, docUUID := range docUUIDs {
+		if docUUID == "" {
+			continue
+		}
+
+		lane := laneForDocument(docUUID, lanes)
+
+		assigned[lane] = append(assigned[lane], i)
+	}
+
+	var wg sync.WaitGroup
+
+	for _, lane := range assigned {
+		if len(lane) == 0 {
+			continue
+		}
+
+		wg.Go(func() {
+			var failed bool
+
+			for _, idx := range lane {
+				if failed {
+					outcomes[idx] = errNotHandled
+
+					continue
+				}
+
+				outcomes[idx] = handle(idx)
+
+				failed = r.Disposition(outcomes[idx]).StopsLane()
+			}
+		})
+	}
+
+	wg.Wait()
+
+	return outcomes
+}
+
+func (w *Worker) outcomeRules() OutcomeRules {
+	return OutcomeRules{
+		OversizePolicy: w.oversize.Policy,
+		ErrorClasses:   w.errorClasses,
+		AcceptErrors:   w.acceptErrors,
+	}
+}
+
+func (w *Worker) concurrent() bool {
+	return w.concurrency > 1
+}
+
+// handleConcurrently handles a batch of events using a pool of lanes, see
+// OutcomeRules.RunLanes. Superseded events aren't handled and get the
+// errSuperseded outcome.
+//
+// The outcomes are returned in the same order as the events, and must be
+// evaluated in that order to find the position up to which all events have been
+// handled.
+func (w *Worker) handleConcurrently(
+	ctx context.Context, items []*repository.EventlogItem,
+	superseded []bool, caughtUp bool,
+) []eventOutcome {
+	outcomes := make([]eventOutcome, len(items))
+	docUUIDs := make([]string, len(items))
+
+	for i, item := range items {
+		if w.skipWorkflow(item) {
+			continue
+		}
+
+		if superseded != nil && superseded[i] {
+			outcomes[i].err = errSuperseded
+
+			continue
+		}
+
+		docUUIDs[i] = LaneKey(item)
+	}
+
+	errs := w.outcomeRules().RunLanes(docUUIDs, w.concurrency, func(i int) error {
+		start := time.Now()
+
+		err := w.handleEventWithRetry(ctx, items[i], caughtUp)
+
+		outcomes[i].duration = time.Since(start)
+
+		return err
+	})
+
+	for i, err := range errs {
+		if docUUIDs[i] != "" {
+			outcomes[i].err = err
+		}
+	}
+
+	return outcomes
+}
+
+// LaneKey returns the document that decides the lane of an event. Meta
+// document events are handled in the lane of their main document, as they
+// update the main document and require it to have been replicated.
+func LaneKey(item *repository.EventlogItem) string {
+	if item.MainDocument != "" {
+		return item.MainDocument
+	}
+
+	return item.Uuid
+}
+
+func laneForDocument(docUUID string, lanes int) int {
+	h := fnv.New32a()
+
+	_, _ = h.Write([]byte(docUUID))
+
+	return int(h.Sum32() % uint32(lanes)) //nolint: gosec
+}
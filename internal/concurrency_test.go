@@ -0,0 +1,214 @@
+package internal_test
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/internal"
+	"github.com/twitchtv/twirp"
+)
+
+func TestOutcomeDisposition(t *testing.T) {
+	rules := internal.OutcomeRules{
+		OversizePolicy: internal.OversizeSkip,
+		ErrorClasses: internal.ErrorClassification{
+			twirp.InvalidArgument: internal.ErrorSkip,
+		},
+	}
+
+	cases := []struct {
+		name     string
+		err      error
+		expected internal.EventDisposition
+	}{
+		{"handled", nil, internal.DispositionHandled},
+		{"unknown event",
+			fmt.Errorf("event: %w", internal.ErrUnknownEvent),
+			internal.DispositionHalt},
+		{"skipped",
+			fmt.Errorf("excluded: %w", internal.ErrSkipped),
+			internal.DispositionSkipped},
+		{"oversized",
+			fmt.Errorf("update: %w", internal.ErrOversized),
+			internal.DispositionOversized},
+		{"conflict",
+			fmt.Errorf("update: %w", internal.ErrConflict),
+			internal.DispositionConflict},
+		{"rejected",
+			twirp.NewError(twirp.InvalidArgument, "bad document"),
+			internal.DispositionRejected},
+		{"failed", errors.New("boom"), internal.DispositionFailed},
+	}
+
+	for _, c := range cases {
+		got := rules.Disposition(c.err)
+		if got != c.expected {
+			t.Errorf("%s: got disposition %d, expected %d",
+				c.name, got, c.expected)
+		}
+	}
+
+	rules.AcceptErrors = true
+
+	if d := rules.Disposition(errors.New("boom")); d != internal.DispositionAccepted {
+		t.Errorf("expected accepted errors, got disposition %d", d)
+	}
+
+	if d := rules.Disposition(internal.ErrStateConflict); d != internal.DispositionHalt {
+		t.Errorf("expected state conflicts to halt when accepting errors, got %d", d)
+	}
+
+	rules.OversizePolicy = internal.OversizeFail
+
+	if d := rules.Disposition(internal.ErrOversized); d != internal.DispositionAccepted {
+		t.Errorf("expected oversize errors to be handled like other errors, got %d", d)
+	}
+}
+
+func TestRunLanesOrder(t *testing.T) {
+	docs := []string{"doc-a", "doc-b", "doc-a", "", "doc-c", "doc-a", "doc-b"}
+
+	var (
+		mu      sync.Mutex
+		handled = make(map[string][]int)
+	)
+
+	outcomes := internal.OutcomeRules{}.RunLanes(docs, 2, func(i int) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		handled[docs[i]] = append(handled[docs[i]], i)
+
+		if docs[i] == "doc-c" {
+			return fmt.Errorf("excluded: %w", internal.ErrSkipped)
+		}
+
+		return nil
+	})
+
+	expected := map[string][]int{
+		"doc-a": {0, 2, 5},
+		"doc-b": {1, 6},
+		"doc-c": {4},
+	}
+
+	for doc, order := range expected {
+		if !slices.Equal(handled[doc], order) {
+			t.Errorf("%s: handled events %v, expected %v",
+				doc, handled[doc], order)
+		}
+	}
+
+	if _, ok := handled[""]; ok {
+		t.Error("expected events without a document to not be handled")
+	}
+
+	if !errors.Is(outcomes[4], internal.ErrSkipped) {
+		t.Errorf("expected the skip outcome, got %v", outcomes[4])
+	}
+}
+
+func TestRunLanesFailure(t *testing.T) {
+	docs := []string{"doc-a", "doc-b", "doc-a", "doc-a", "doc-b", "doc-c", "doc-c"}
+
+	rules := internal.OutcomeRules{
+		OversizePolicy: internal.OversizeSkip,
+		ErrorClasses: internal.ErrorClassification{
+			twirp.InvalidArgument: internal.ErrorSkip,
+		},
+	}
+
+	outcomes := rules.RunLanes(docs, 4, func(i int) error {
+		switch i {
+		case 2:
+			return errors.New("boom")
+		case 1:
+			return fmt.Errorf("update: %w", internal.ErrOversized)
+		case 5:
+			return twirp.NewError(twirp.InvalidArgument, "bad document")
+		}
+
+		return nil
+	})
+
+	expected := []internal.EventDisposition{
+		internal.DispositionHandled,
+		internal.DispositionOversized,
+		internal.DispositionFailed,
+		internal.DispositionNotHandled,
+		internal.DispositionHandled,
+		internal.DispositionRejected,
+		internal.DispositionHandled,
+	}
+
+	for i, err := range outcomes {
+		got := rules.Disposition(err)
+		if got != expected[i] {
+			t.Errorf("event %d (%s): got disposition %d, expected %d",
+				i, docs[i], got, expected[i])
+		}
+	}
+
+	// The batch is rewound to the first event that wasn't handled.
+	rewind := slices.IndexFunc(outcomes, func(err error) bool {
+		return rules.Disposition(err) == internal.DispositionNotHandled
+	})
+	if rewind != 3 {
+		t.Errorf("expected the batch to be rewound to event 3, got %d", rewind)
+	}
+}
+
+func TestRunLanesMetaDocuments(t *testing.T) {
+	const (
+		mainDoc  = "5f3c0a7e-3f4b-4c3e-9d51-1c2f6f1e9a01"
+		metaDoc  = "8a1d2b3c-4e5f-4a6b-8c7d-9e0f1a2b3c4d"
+		otherDoc = "0b6c7d8e-9f0a-4b1c-8d2e-3f4a5b6c7d8e"
+	)
+
+	items := []*repository.EventlogItem{
+		{Event: internal.TypeDocumentVersion, Uuid: mainDoc},
+		{Event: internal.TypeDocumentVersion, Uuid: metaDoc, MainDocument: mainDoc},
+		{Event: internal.TypeDocumentVersion, Uuid: otherDoc},
+	}
+
+	keys := make([]string, len(items))
+
+	for i, item := range items {
+		keys[i] = internal.LaneKey(item)
+	}
+
+	if keys[1] != mainDoc {
+		t.Fatalf("expected the meta document to use the lane of its main document, got %s",
+			keys[1])
+	}
+
+	var (
+		mu    sync.Mutex
+		order []int
+	)
+
+	outcomes := internal.OutcomeRules{}.RunLanes(keys, 16, func(i int) error {
+		mu.Lock()
+		order = append(order, i)
+		mu.Unlock()
+
+		if i == 0 {
+			return errors.New("boom")
+		}
+
+		return nil
+	})
+
+	if slices.Contains(order, 1) {
+		t.Errorf("expected the meta document event to wait for its main document, handled %v",
+			order)
+	}
+
+	if !slices.Contains(order, 2) || outcomes[2] != nil {
+		t.Errorf("expected other documents to be handled, got %v", outcomes[2])
+	}
+}
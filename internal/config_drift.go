@@ -0,0 +1,212 @@
+package internal
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/ttab/elephant-api/replicant"
+	"github.com/ttab/elephant-replicant/postgres"
+	"github.com/ttab/elephantine"
+)
+
+// ConfigSnapshot is the configuration that decides what gets replicated to a
+// target, and how. Changing it can leave already replicated documents
+// inconsistent with what would be replicated now.
+type ConfigSnapshot struct {
+	IgnoreTypes            []string                    `json:"ignore_types"`
+	IgnoreSubs             []string                    `json:"ignore_subs"`
+	IgnoreSections         []*replicant.SectionForType `json:"ignore_sections"`
+	RequireSections        []*replicant.SectionForType `json:"require_sections"`
+	Languages              []string                    `json:"languages"`
+	IncludeAttachments     []AttachmentRef             `json:"include_attachments"`
+	AllAttachments         bool                        `json:"all_attachments"`
+	AttachmentContentTypes ContentTypeFilter           `json:"attachment_content_types"`
+	TypeMapping            map[string]string           `json:"type_mapping"`
+	ACLMapping             ACLMapping                  `json:"acl_mapping"`
+	ACLTemplate            ACLTemplate                 `json:"acl_template"`
+	ACLRestriction         ACLRestriction              `json:"acl_restriction"`
+	StripBlocks            []string                    `json:"strip_blocks"`
+	StatusFilter           StatusFilter                `json:"status_filter"`
+	UUIDMapping            UUIDMapping                 `json:"uuid_mapping"`
+	MinOriginalCreated     time.Time                   `json:"min_original_created"`
+	IncludeUUIDs           string                      `json:"include_uuids"`
+}
+
+// ConfigChange describes a changed configuration field, with the old and new
+// values as JSON.
+type ConfigChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// ConfigChanges compares two configuration snapshots field by field.
+func ConfigChanges(previous ConfigSnapshot, current ConfigSnapshot) ([]ConfigChange, error) {
+	oldFields, err := snapshotFields(previous)
+	if err != nil {
+		return nil, err
+	}
+
+	newFields, err := snapshotFields(current)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffFields(oldFields, newFields), nil
+}
+
+func diffFields(oldFields, newFields map[string]json.RawMessage) []ConfigChange {
+	var changes []ConfigChange
+
+	for field, value := range newFields {
+		previousValue, ok := oldFields[field]
+
+		// Fields that didn't exist when the previous snapshot was
+		// stored aren't reported as changed.
+		if !ok {
+			continue
+		}
+
+		previousValue = canonicalJSON(previousValue)
+		value = canonicalJSON(value)
+
+		if bytes.Equal(previousValue, value) {
+			continue
+		}
+
+		changes = append(changes, ConfigChange{
+			Field: field,
+			Old:   string(previousValue),
+			New:   string(value),
+		})
+	}
+
+	slices.SortFunc(changes, func(a, b ConfigChange) int {
+		return cmp.Compare(a.Field, b.Field)
+	})
+
+	return changes
+}
+
+// canonicalJSON re-encodes the value so that formatting and key order don't
+// affect comparisons, the database stores the state as jsonb.
+func canonicalJSON(data json.RawMessage) json.RawMessage {
+	var v any
+
+	err := json.Unmarshal(data, &v)
+	if err != nil {
+		return data
+	}
+
+	out, err := json.Marshal(v)
+	if err != nil {
+		return data
+	}
+
+	return out
+}
+
+func snapshotFields(s ConfigSnapshot) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, fmt.Errorf("marshal config: %w", err)
+	}
+
+	var fields map[string]json.RawMessage
+
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal config fields: %w", err)
+	}
+
+	return fields, nil
+}
+
+func configStateKey(target string) string {
+	return target + ":config"
+}
+
+// checkConfigDrift compares the configuration of the worker with the one that
+// was stored the last time the worker started, and warns about any changes.
+// With resync set the log position is moved back to the start of the target
+// so that all documents are synced with the new configuration. A dry run only
+// logs the changes, and leaves the stored config and the log position as they
+// are.
+func (w *Worker) checkConfigDrift(
+	ctx context.Context, target postgres.ReplicationTarget, resync bool,
+) error {
+	q := postgres.New(w.db)
+	key := shardKey(configStateKey(w.name), w.shard)
+
+	// The stored config is compared as raw fields so that fields that have
+	// been added since it was stored can be told apart from empty fields.
+	var stored map[string]json.RawMessage
+
+	err := LoadState(ctx, q, key, &stored)
+	if err != nil {
+		return fmt.Errorf("load stored config: %w", err)
+	}
+
+	current, err := snapshotFields(w.config)
+	if err != nil {
+		return err
+	}
+
+	if stored != nil {
+		changes := diffFields(stored, current)
+
+		for _, c := range changes {
+			w.logger.WarnContext(ctx,
+				"replication config has changed, replicated documents might not match the current config",
+				"field", c.Field,
+				"old", c.Old,
+				"new", c.New,
+			)
+		}
+
+		if len(changes) > 0 && resync && w.dryRun {
+			w.logger.InfoContext(ctx,
+				"dry run: would resync target after config change",
+				elephantine.LogKeyEventID, target.StartFrom)
+		} else if len(changes) > 0 && resync {
+			w.logger.WarnContext(ctx, "resyncing target after config change",
+				elephantine.LogKeyEventID, target.StartFrom)
+
+			// The documents have to be written again, so they
+			// can't skip the events that they've already seen.
+			err := q.ClearDocumentEventsAfter(ctx,
+				postgres.ClearDocumentEventsAfterParams{
+					TargetName: w.name,
+					EventID:    target.StartFrom,
+				})
+			if err != nil {
+				return fmt.Errorf("clear replicated events: %w", err)
+			}
+
+			err = StoreState(ctx, q, w.stateKey(), LogState{
+				Position: target.StartFrom,
+			})
+			if err != nil {
+				return fmt.Errorf("reset log state: %w", err)
+			}
+		}
+	}
+
+	// The changes are reported again by the next run that isn't a dry
+	// run.
+	if w.dryRun {
+		return nil
+	}
+
+	err = StoreState(ctx, q, key, current)
+	if err != nil {
+		return fmt.Errorf("store config: %w", err)
+	}
+
+	return nil
+}
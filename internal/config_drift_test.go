@@ -0,0 +1,49 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/ttab/elephant-replicant/internal"
+)
+
+func TestConfigChanges(t *testing.T) {
+	previous := internal.ConfigSnapshot{
+		IgnoreTypes:    []string{"tt/wire"},
+		AllAttachments: true,
+		TypeMapping:    map[string]string{"core/article": "stage/article"},
+	}
+
+	current := internal.ConfigSnapshot{
+		IgnoreTypes:    []string{"tt/wire", "core/planning-item"},
+		AllAttachments: true,
+		TypeMapping:    map[string]string{"core/article": "stage/article"},
+	}
+
+	changes, err := internal.ConfigChanges(previous, current)
+	if err != nil {
+		t.Fatalf("compare configs: %v", err)
+	}
+
+	if len(changes) != 1 {
+		t.Fatalf("got %d changes, want 1: %v", len(changes), changes)
+	}
+
+	c := changes[0]
+
+	if c.Field != "ignore_types" {
+		t.Errorf("got changed field %q, want %q", c.Field, "ignore_types")
+	}
+
+	if c.Old != `["tt/wire"]` || c.New != `["tt/wire","core/planning-item"]` {
+		t.Errorf("unexpected change values: %q -> %q", c.Old, c.New)
+	}
+
+	changes, err = internal.ConfigChanges(current, current)
+	if err != nil {
+		t.Fatalf("compare configs: %v", err)
+	}
+
+	if len(changes) != 0 {
+		t.Errorf("expected no changes for identical configs, got %v", changes)
+	}
+}
@@ -0,0 +1,243 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/postgres"
+	"github.com/ttab/elephantine"
+	"github.com/ttab/elephantine/pg"
+	"github.com/twitchtv/twirp"
+)
+
+// ConflictPolicy controls what happens when a document has been changed in
+// the target since it was last replicated.
+type ConflictPolicy string
+
+const (
+	// ConflictSkip skips the event and leaves the target changes as they
+	// are.
+	ConflictSkip ConflictPolicy = "skip"
+	// ConflictOverwrite writes the source state without an optimistic
+	// lock, discarding the target changes.
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	// ConflictQuarantine records the event as a replication error and
+	// skips all later events for the document until it has been sent or
+	// resynced.
+	ConflictQuarantine ConflictPolicy = "quarantine"
+)
+
+// ParseConflictPolicy parses a conflict policy, an empty value is treated as
+// ConflictSkip.
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch p := ConflictPolicy(s); p {
+	case "":
+		return ConflictSkip, nil
+	case ConflictSkip, ConflictOverwrite, ConflictQuarantine:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown conflict policy %q", s)
+	}
+}
+
+// ConflictError is returned when a target document has been changed since it
+// was last replicated. It matches ErrConflict.
+type ConflictError struct {
+	TargetUUID uuid.UUID
+	// ExpectedVersion is the version that the update required the
+	// target document to be at.
+	ExpectedVersion int64
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s, expected version %d",
+		ErrConflict.Error(), e.ExpectedVersion)
+}
+
+func (e *ConflictError) Unwrap() error {
+	return ErrConflict
+}
+
+// reportConflict logs a conflict together with the expected and actual target
+// versions of the document, and records it in the conflicts table. Failures to
+// report the conflict are logged, as they shouldn't stop replication.
+func (w *Worker) reportConflict(
+	ctx context.Context, evt *repository.EventlogItem, err error,
+) {
+	logArgs := []any{
+		elephantine.LogKeyEventID, evt.Id,
+		elephantine.LogKeyEventType, evt.Event,
+		elephantine.LogKeyDocumentUUID, evt.Uuid,
+		elephantine.LogKeyError, err,
+	}
+
+	var conflict *ConflictError
+
+	if !errors.As(err, &conflict) {
+		w.logger.InfoContext(ctx, "conflict with change in target repo",
+			logArgs...)
+
+		return
+	}
+
+	currentVersion, cErr := w.currentTargetVersion(ctx, conflict.TargetUUID)
+	if cErr != nil {
+		w.logger.WarnContext(ctx, "failed to get target version for conflict",
+			append(logArgs, "report_error", cErr)...)
+
+		return
+	}
+
+	w.logger.InfoContext(ctx, "conflict with change in target repo",
+		append(logArgs,
+			"expected_version", conflict.ExpectedVersion,
+			"target_version", currentVersion,
+		)...)
+
+	docUUID, cErr := uuid.Parse(evt.Uuid)
+	if cErr != nil {
+		return
+	}
+
+	cErr = postgres.New(w.db).AddReplicationConflict(ctx,
+		postgres.AddReplicationConflictParams{
+			TargetName:      w.name,
+			Shard:           w.shard,
+			EventID:         evt.Id,
+			ID:              docUUID,
+			EventType:       evt.Event,
+			ExpectedVersion: conflict.ExpectedVersion,
+			TargetVersion:   currentVersion,
+			Created:         pg.Time(time.Now()),
+		})
+	if cErr != nil {
+		w.logger.WarnContext(ctx, "failed to record conflict",
+			append(logArgs, "report_error", cErr)...)
+	}
+}
+
+// currentTargetVersion returns the current version of the document in the
+// target, or zero if it doesn't exist.
+func (w *Worker) currentTargetVersion(
+	ctx context.Context, targetUUID uuid.UUID,
+) (int64, error) {
+	res, err := w.target.GetMeta(ctx, &repository.GetMetaRequest{
+		Uuid: targetUUID.String(),
+	})
+	if elephantine.IsTwirpErrorCode(err, twirp.NotFound) {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("get target meta: %w", err)
+	}
+
+	return res.Meta.CurrentVersion, nil
+}
+
+// quarantineConflict records a conflict as a replication error so that later
+// events for the document are skipped.
+func (w *Worker) quarantineConflict(
+	ctx context.Context, evt *repository.EventlogItem, conflictErr error,
+) error {
+	docUUID, err := uuid.Parse(evt.Uuid)
+	if err != nil {
+		return fmt.Errorf("invalid document UUID: %w", err)
+	}
+
+	err = postgres.New(w.db).AddReplicationError(ctx,
+		postgres.AddReplicationErrorParams{
+			TargetName: w.name,
+			Shard:      w.shard,
+			EventID:    evt.Id,
+			ID:         docUUID,
+			EventType:  evt.Event,
+			Error:      conflictErr.Error(),
+			Attempts:   1,
+			Created:    pg.Time(time.Now()),
+		})
+	if err != nil {
+		return fmt.Errorf("record replication error: %w", err)
+	}
+
+	w.logger.WarnContext(ctx, "quarantined document after conflict",
+		elephantine.LogKeyEventID, evt.Id,
+		elephantine.LogKeyEventType, evt.Event,
+		elephantine.LogKeyDocumentUUID, evt.Uuid,
+	)
+
+	return nil
+}
+
+// UpdateTarget sends an update to the target. With the ConflictOverwrite
+// policy an update that fails its optimistic lock because the document has
+// been changed in the target is sent again without the lock, and the version
+// that the update expected is returned as overwritten. Conflicts are returned
+// as the FailedPrecondition errors of the target otherwise.
+func (p ConflictPolicy) UpdateTarget(
+	ctx context.Context, target ReplicationSink,
+	update *repository.UpdateRequest,
+) (_ *repository.UpdateResponse, overwritten int64, _ error) {
+	res, err := target.Update(ctx, update)
+	if !elephantine.IsTwirpErrorCode(err, twirp.FailedPrecondition) ||
+		p != ConflictOverwrite || update.IfMatch == 0 {
+		return res, 0, err //nolint: wrapcheck
+	}
+
+	overwritten = update.IfMatch
+	update.IfMatch = 0
+
+	res, err = target.Update(ctx, update)
+
+	return res, overwritten, err //nolint: wrapcheck
+}
+
+// CheckQuarantined returns an error that matches ErrSkipped if the document
+// has quarantined events in the target and the quarantine conflict policy is
+// used.
+func (p ConflictPolicy) CheckQuarantined(
+	ctx context.Context, q *postgres.Queries, target string, docUUID uuid.UUID,
+) error {
+	if p != ConflictQuarantine {
+		return nil
+	}
+
+	quarantined, err := q.DocumentHasErrors(ctx,
+		postgres.DocumentHasErrorsParams{
+			TargetName: target,
+			ID:         docUUID,
+		})
+	if err != nil {
+		return fmt.Errorf("check document quarantine: %w", err)
+	}
+
+	if quarantined {
+		return fmt.Errorf("document is quarantined: %w", ErrSkipped)
+	}
+
+	return nil
+}
+
+// checkQuarantined skips events for documents that have quarantined events
+// when the quarantine conflict policy is used.
+func (w *Worker) checkQuarantined(ctx context.Context, docUUID uuid.UUID) error {
+	return w.conflictPolicy.CheckQuarantined(ctx, postgres.New(w.db), w.name, docUUID)
+}
+
+// clearQuarantine removes the replication errors of the document once its
+// current state has been replicated, so that its events are handled again.
+func (w *Worker) clearQuarantine(
+	ctx context.Context, q *postgres.Queries, docUUID uuid.UUID,
+) error {
+	err := q.RemoveDocumentErrors(ctx, postgres.RemoveDocumentErrorsParams{
+		TargetName: w.name,
+		ID:         docUUID,
+	})
+	if err != nil {
+		return fmt.Errorf("remove document replication errors: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,237 @@
+package internal_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	rpc_newsdoc "github.com/ttab/elephant-api/newsdoc"
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/internal"
+	"github.com/ttab/elephant-replicant/postgres"
+	"github.com/ttab/elephantine"
+	"github.com/twitchtv/twirp"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestParseConflictPolicy(t *testing.T) {
+	cases := map[string]internal.ConflictPolicy{
+		"":           internal.ConflictSkip,
+		"skip":       internal.ConflictSkip,
+		"overwrite":  internal.ConflictOverwrite,
+		"quarantine": internal.ConflictQuarantine,
+	}
+
+	for spec, want := range cases {
+		got, err := internal.ParseConflictPolicy(spec)
+		if err != nil {
+			t.Errorf("parse %q: %v", spec, err)
+
+			continue
+		}
+
+		if got != want {
+			t.Errorf("parse %q: got %q, want %q", spec, got, want)
+		}
+	}
+
+	_, err := internal.ParseConflictPolicy("ignore")
+	if err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+}
+
+func TestConflictErrorMatchesErrConflict(t *testing.T) {
+	err := fmt.Errorf("update: %w", &internal.ConflictError{
+		ExpectedVersion: 3,
+	})
+
+	if !errors.Is(err, internal.ErrConflict) {
+		t.Error("expected conflict error to match ErrConflict")
+	}
+
+	var conflict *internal.ConflictError
+
+	if !errors.As(err, &conflict) || conflict.ExpectedVersion != 3 {
+		t.Error("expected to get the conflict details")
+	}
+}
+
+// changedTargetDocument creates a document in the target that has been changed
+// after its first version was replicated.
+func changedTargetDocument(t *testing.T) *internal.FakeDocuments {
+	t.Helper()
+
+	docs := internal.NewFakeDocuments()
+
+	for i, title := range []string{"Replicated", "Changed in target"} {
+		_, err := docs.Update(t.Context(), &repository.UpdateRequest{
+			Uuid:     fakeUUID,
+			Document: &rpc_newsdoc.Document{Uuid: fakeUUID, Title: title},
+			IfMatch:  int64(i),
+		})
+		if err != nil {
+			t.Fatalf("update document: %v", err)
+		}
+	}
+
+	return docs
+}
+
+func replicatedUpdate() *repository.UpdateRequest {
+	return &repository.UpdateRequest{
+		Uuid:     fakeUUID,
+		Document: &rpc_newsdoc.Document{Uuid: fakeUUID, Title: "Source"},
+		IfMatch:  1,
+	}
+}
+
+func TestConflictOverwriteRetriesWithoutLock(t *testing.T) {
+	docs := changedTargetDocument(t)
+
+	var ifMatch []int64
+
+	docs.Hook = func(method string, req proto.Message) error {
+		if up, ok := req.(*repository.UpdateRequest); ok {
+			ifMatch = append(ifMatch, up.IfMatch)
+		}
+
+		return nil
+	}
+
+	res, overwritten, err := internal.ConflictOverwrite.UpdateTarget(
+		t.Context(), docs, replicatedUpdate())
+	if err != nil {
+		t.Fatalf("overwrite target changes: %v", err)
+	}
+
+	if overwritten != 1 {
+		t.Errorf("expected version 1 to be reported as overwritten, got %d",
+			overwritten)
+	}
+
+	if !slices.Equal(ifMatch, []int64{1, 0}) {
+		t.Errorf("expected the update to be retried without a lock, got IfMatch %v",
+			ifMatch)
+	}
+
+	if res.Version != 3 {
+		t.Errorf("expected the source to be written as version 3, got %d",
+			res.Version)
+	}
+
+	doc, err := docs.Get(t.Context(), &repository.GetDocumentRequest{
+		Uuid: fakeUUID,
+	})
+	if err != nil {
+		t.Fatalf("get document: %v", err)
+	}
+
+	if doc.Document.Title != "Source" {
+		t.Errorf("expected the target changes to be overwritten, got %q",
+			doc.Document.Title)
+	}
+}
+
+func TestConflictSkipKeepsTargetChanges(t *testing.T) {
+	docs := changedTargetDocument(t)
+
+	var updates int
+
+	docs.Hook = func(method string, _ proto.Message) error {
+		if method == "Update" {
+			updates++
+		}
+
+		return nil
+	}
+
+	for _, policy := range []internal.ConflictPolicy{
+		internal.ConflictSkip, internal.ConflictQuarantine,
+	} {
+		updates = 0
+
+		_, overwritten, err := policy.UpdateTarget(
+			t.Context(), docs, replicatedUpdate())
+		if !elephantine.IsTwirpErrorCode(err, twirp.FailedPrecondition) {
+			t.Errorf("%s: expected a conflict, got %v", policy, err)
+		}
+
+		if overwritten != 0 || updates != 1 {
+			t.Errorf("%s: expected a single update and nothing overwritten, got %d updates, %d overwritten",
+				policy, updates, overwritten)
+		}
+	}
+}
+
+// quarantineDB answers document quarantine checks.
+type quarantineDB struct {
+	quarantined map[uuid.UUID]bool
+	checks      int
+}
+
+func (db *quarantineDB) Exec(
+	context.Context, string, ...any,
+) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, errors.New("not implemented")
+}
+
+func (db *quarantineDB) Query(context.Context, string, ...any) (pgx.Rows, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (db *quarantineDB) QueryRow(_ context.Context, _ string, args ...any) pgx.Row {
+	db.checks++
+
+	docUUID, _ := args[1].(uuid.UUID)
+
+	return existsRow(db.quarantined[docUUID])
+}
+
+type existsRow bool
+
+func (r existsRow) Scan(dest ...any) error {
+	exists, ok := dest[0].(*bool)
+	if !ok {
+		return fmt.Errorf("unexpected scan destination %T", dest[0])
+	}
+
+	*exists = bool(r)
+
+	return nil
+}
+
+func TestCheckQuarantined(t *testing.T) {
+	quarantined := uuid.MustParse(fakeUUID)
+	db := quarantineDB{
+		quarantined: map[uuid.UUID]bool{quarantined: true},
+	}
+	q := postgres.New(&db)
+	rules := internal.OutcomeRules{}
+
+	err := internal.ConflictQuarantine.CheckQuarantined(
+		t.Context(), q, "production", quarantined)
+	if rules.Disposition(err) != internal.DispositionSkipped {
+		t.Errorf("expected the events of a quarantined document to be skipped, got %v", err)
+	}
+
+	err = internal.ConflictQuarantine.CheckQuarantined(
+		t.Context(), q, "production", uuid.New())
+	if err != nil {
+		t.Errorf("expected other documents to be handled, got %v", err)
+	}
+
+	db.checks = 0
+
+	err = internal.ConflictSkip.CheckQuarantined(
+		t.Context(), q, "production", quarantined)
+	if err != nil || db.checks != 0 {
+		t.Errorf("expected no quarantine without the quarantine policy, got %v after %d checks",
+			err, db.checks)
+	}
+}
@@ -1,6 +1,11 @@
 package internal
 
 import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
 	"github.com/ttab/elephant-api/replicant"
 	"github.com/ttab/newsdoc"
 )
@@ -13,15 +18,16 @@ func NewContentFilterFromSyncConfig(cfg *replicant.SyncConfig) (*ContentFilter,
 	}
 
 	for _, s := range cfg.GetIgnoreSections() {
-		sectionUUID := s.GetSectionUuid()
-
-		matcher := newsdoc.BlockMatchFunc(func(block newsdoc.Block) bool {
-			return block.Rel == "section" && block.UUID == sectionUUID
-		})
+		matcher, err := sectionMatcher(s.GetSectionUuid())
+		if err != nil {
+			return nil, fmt.Errorf("invalid section filter for %q: %w",
+				s.GetType(), err)
+		}
 
 		cf.types[s.GetType()] = append(cf.types[s.GetType()],
 			BlockFilter{
 				Kind:    BlockKindLink,
+				Mode:    FilterModeDeny,
 				Matcher: matcher,
 			})
 	}
@@ -29,8 +35,96 @@ func NewContentFilterFromSyncConfig(cfg *replicant.SyncConfig) (*ContentFilter,
 	return &cf, nil
 }
 
+// RequireSections adds section filters that documents of the type must match
+// to be replicated.
+func (cf *ContentFilter) RequireSections(sections []*replicant.SectionForType) error {
+	for _, s := range sections {
+		matcher, err := sectionMatcher(s.GetSectionUuid())
+		if err != nil {
+			return fmt.Errorf("invalid required section for %q: %w",
+				s.GetType(), err)
+		}
+
+		cf.types[s.GetType()] = append(cf.types[s.GetType()],
+			BlockFilter{
+				Kind:    BlockKindLink,
+				Mode:    FilterModeRequire,
+				Matcher: matcher,
+			})
+	}
+
+	return nil
+}
+
+// RequireLanguages restricts replication to documents in the listed languages.
+// Languages are matched case-insensitively, and a language without a region,
+// f.ex. "sv", matches all regional variants like "sv-SE". Documents that don't
+// have a language set aren't affected.
+func (cf *ContentFilter) RequireLanguages(languages []string) {
+	for _, l := range languages {
+		cf.languages = append(cf.languages, strings.ToLower(l))
+	}
+}
+
+func (cf *ContentFilter) languageAllowed(language string) bool {
+	if len(cf.languages) == 0 || language == "" {
+		return true
+	}
+
+	language = strings.ToLower(language)
+	primary, _, _ := strings.Cut(language, "-")
+
+	return slices.Contains(cf.languages, language) ||
+		slices.Contains(cf.languages, primary)
+}
+
+// ParseSectionFilters parses section filters in the format
+// "[type]:[section UUID]" or "[type]:section~[pattern]".
+func ParseSectionFilters(specs []string) ([]*replicant.SectionForType, error) {
+	var sections []*replicant.SectionForType
+
+	for _, s := range specs {
+		docType, section, ok := strings.Cut(s, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid section filter %q", s)
+		}
+
+		sections = append(sections, &replicant.SectionForType{
+			Type:        docType,
+			SectionUuid: section,
+		})
+	}
+
+	return sections, nil
+}
+
+// SectionPatternPrefix is used to specify a regular expression instead of a
+// section UUID, f.ex. "section~^sport/". The expression is matched against the
+// URI and title of the section link.
+const SectionPatternPrefix = "section~"
+
+func sectionMatcher(spec string) (newsdoc.BlockMatcher, error) {
+	pattern, isPattern := strings.CutPrefix(spec, SectionPatternPrefix)
+	if !isPattern {
+		return newsdoc.BlockMatchFunc(func(block newsdoc.Block) bool {
+			return block.Rel == "section" && block.UUID == spec
+		}), nil
+	}
+
+	exp, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("compile section pattern: %w", err)
+	}
+
+	return newsdoc.BlockMatchFunc(func(block newsdoc.Block) bool {
+		return block.Rel == "section" &&
+			(exp.MatchString(block.URI) || exp.MatchString(block.Title))
+	}), nil
+}
+
 type ContentFilter struct {
-	types map[string][]BlockFilter
+	types     map[string][]BlockFilter
+	languages []string
 }
 
 type BlockKind string
@@ -41,17 +135,37 @@ const (
 	BlockKindContent BlockKind = "content"
 )
 
+// FilterMode controls whether a block filter rejects the documents that it
+// matches, or requires documents to match.
+type FilterMode string
+
+const (
+	FilterModeDeny    FilterMode = "deny"
+	FilterModeRequire FilterMode = "require"
+)
+
 type BlockFilter struct {
 	Kind    BlockKind
+	Mode    FilterMode
 	Matcher newsdoc.BlockMatcher
 }
 
 func (cf *ContentFilter) HasFilters(docType string) bool {
-	return len(cf.types[docType]) > 0
+	return len(cf.languages) > 0 || len(cf.types[docType]) > 0
 }
 
-// Checks if a document passes the filters and returns true if it does.
+// Checks if a document passes the filters and returns true if it does. Deny
+// filters take precedence, a document that is matched by a deny filter is
+// rejected even if it's matched by a require filter. If a type has require
+// filters the document must be matched by at least one of them. Documents in
+// languages that haven't been allowed are always rejected.
 func (cf *ContentFilter) Check(doc newsdoc.Document) bool {
+	if !cf.languageAllowed(doc.Language) {
+		return false
+	}
+
+	var required, matchedRequired bool
+
 	for _, f := range cf.types[doc.Type] {
 		var list []newsdoc.Block
 
@@ -65,10 +179,17 @@ func (cf *ContentFilter) Check(doc newsdoc.Document) bool {
 		}
 
 		_, ok := newsdoc.FirstBlock(list, f.Matcher)
-		if ok {
-			return false
+
+		switch f.Mode {
+		case FilterModeRequire:
+			required = true
+			matchedRequired = matchedRequired || ok
+		case FilterModeDeny:
+			if ok {
+				return false
+			}
 		}
 	}
 
-	return true
+	return !required || matchedRequired
 }
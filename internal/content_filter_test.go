@@ -0,0 +1,174 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/ttab/elephant-api/replicant"
+	"github.com/ttab/elephant-replicant/internal"
+	"github.com/ttab/newsdoc"
+)
+
+func articleWithSection(uuid, uri, title string) newsdoc.Document {
+	return newsdoc.Document{
+		Type: "core/article",
+		Links: []newsdoc.Block{
+			{
+				Rel:   "section",
+				UUID:  uuid,
+				URI:   uri,
+				Title: title,
+			},
+		},
+	}
+}
+
+func TestContentFilterSectionUUID(t *testing.T) {
+	cf, err := internal.NewContentFilterFromSyncConfig(&replicant.SyncConfig{
+		IgnoreSections: []*replicant.SectionForType{
+			{
+				Type:        "core/article",
+				SectionUuid: "0730efa9-43f2-468d-979a-aaffc74d7582",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("create filter: %v", err)
+	}
+
+	ignored := articleWithSection(
+		"0730efa9-43f2-468d-979a-aaffc74d7582", "", "")
+
+	if cf.Check(ignored) {
+		t.Error("expected document in ignored section to be rejected")
+	}
+
+	other := articleWithSection(
+		"5a1d2e09-6b14-4b0c-8f0c-64ab2e5f8a4e", "", "")
+
+	if !cf.Check(other) {
+		t.Error("expected document in other section to pass")
+	}
+}
+
+func TestContentFilterSectionPattern(t *testing.T) {
+	cf, err := internal.NewContentFilterFromSyncConfig(&replicant.SyncConfig{
+		IgnoreSections: []*replicant.SectionForType{
+			{
+				Type:        "core/article",
+				SectionUuid: "section~^sport/",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("create filter: %v", err)
+	}
+
+	byURI := articleWithSection("", "sport/football", "Football")
+
+	if cf.Check(byURI) {
+		t.Error("expected document with matching section URI to be rejected")
+	}
+
+	byTitle := articleWithSection("", "", "sport/tennis")
+
+	if cf.Check(byTitle) {
+		t.Error("expected document with matching section title to be rejected")
+	}
+
+	other := articleWithSection("", "news/politics", "Politics")
+
+	if !cf.Check(other) {
+		t.Error("expected document in other section to pass")
+	}
+}
+
+func TestContentFilterInvalidPattern(t *testing.T) {
+	_, err := internal.NewContentFilterFromSyncConfig(&replicant.SyncConfig{
+		IgnoreSections: []*replicant.SectionForType{
+			{
+				Type:        "core/article",
+				SectionUuid: "section~[",
+			},
+		},
+	})
+	if err == nil {
+		t.Fatal("expected an error for an invalid pattern")
+	}
+}
+
+func TestContentFilterRequiredSections(t *testing.T) {
+	cf, err := internal.NewContentFilterFromSyncConfig(&replicant.SyncConfig{
+		IgnoreSections: []*replicant.SectionForType{
+			{
+				Type:        "core/article",
+				SectionUuid: "section~^sport/tennis",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("create filter: %v", err)
+	}
+
+	err = cf.RequireSections([]*replicant.SectionForType{
+		{
+			Type:        "core/article",
+			SectionUuid: "section~^sport/",
+		},
+	})
+	if err != nil {
+		t.Fatalf("add required sections: %v", err)
+	}
+
+	if !cf.Check(articleWithSection("", "sport/football", "")) {
+		t.Error("expected document in required section to pass")
+	}
+
+	if cf.Check(articleWithSection("", "news/politics", "")) {
+		t.Error("expected document outside of required section to be rejected")
+	}
+
+	if cf.Check(articleWithSection("", "sport/tennis", "")) {
+		t.Error("expected deny filter to take precedence over require filter")
+	}
+
+	otherType := newsdoc.Document{Type: "core/image"}
+
+	if !cf.Check(otherType) {
+		t.Error("expected document of unfiltered type to pass")
+	}
+}
+
+func TestContentFilterLanguages(t *testing.T) {
+	cf, err := internal.NewContentFilterFromSyncConfig(&replicant.SyncConfig{})
+	if err != nil {
+		t.Fatalf("create filter: %v", err)
+	}
+
+	cf.RequireLanguages([]string{"sv", "en-GB"})
+
+	if !cf.HasFilters("core/article") {
+		t.Error("expected language filter to apply to all types")
+	}
+
+	cases := map[string]bool{
+		"sv":    true,
+		"sv-SE": true,
+		"SV-fi": true,
+		"en-gb": true,
+		"en-US": false,
+		"en":    false,
+		"fi":    false,
+		"":      true,
+	}
+
+	for lang, want := range cases {
+		doc := newsdoc.Document{
+			Type:     "core/article",
+			Language: lang,
+		}
+
+		if got := cf.Check(doc); got != want {
+			t.Errorf("language %q: got %v, want %v", lang, got, want)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package internal
+
+import (
+	"fmt"
+	"time"
+)
+
+// CreatedBefore returns true if the document was originally created before
+// the cutoff. The created timestamp is the RFC3339 timestamp from the
+// document meta. A zero cutoff never matches.
+func CreatedBefore(created string, cutoff time.Time) (bool, error) {
+	if cutoff.IsZero() {
+		return false, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, created)
+	if err != nil {
+		return false, fmt.Errorf("invalid created timestamp %q: %w", created, err)
+	}
+
+	return t.Before(cutoff), nil
+}
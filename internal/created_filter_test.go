@@ -0,0 +1,39 @@
+package internal_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ttab/elephant-replicant/internal"
+)
+
+func TestCreatedBefore(t *testing.T) {
+	cutoff := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		created string
+		cutoff  time.Time
+		want    bool
+	}{
+		{"2023-12-31T23:59:59Z", cutoff, true},
+		{"2024-01-01T00:00:00Z", cutoff, false},
+		{"2024-01-01T01:00:00+02:00", cutoff, true},
+		{"2020-01-01T00:00:00Z", time.Time{}, false},
+	}
+
+	for _, c := range cases {
+		got, err := internal.CreatedBefore(c.created, c.cutoff)
+		if err != nil {
+			t.Fatalf("check %q: %v", c.created, err)
+		}
+
+		if got != c.want {
+			t.Errorf("%q before %v: got %v, want %v", c.created, c.cutoff, got, c.want)
+		}
+	}
+
+	_, err := internal.CreatedBefore("yesterday", cutoff)
+	if err == nil {
+		t.Error("expected an error for an invalid timestamp")
+	}
+}
@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/postgres"
+	"github.com/ttab/elephantine/pg"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// deadLetter records an event that we failed to handle in the dead letter
+// table, together with the error and the state of the document in the target,
+// so that it can be examined and replayed once the cause has been fixed.
+func (w *Worker) deadLetter(
+	ctx context.Context,
+	evt *repository.EventlogItem,
+	caughtUp bool,
+	handleErr error,
+) error {
+	payload, err := protojson.Marshal(evt)
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+
+	docUUID, err := uuid.Parse(evt.Uuid)
+	if err != nil {
+		return fmt.Errorf("invalid document UUID: %w", err)
+	}
+
+	q := postgres.New(w.db)
+
+	targetVersion, err := q.GetDocumentVersion(ctx,
+		postgres.GetDocumentVersionParams{
+			TargetName: w.name,
+			ID:         w.uuidMapping.Map(docUUID),
+		})
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("get current target version: %w", err)
+	}
+
+	// The current document state is replicated while catching up,
+	// regardless of the event type.
+	updateType := evt.Event
+	if !caughtUp {
+		updateType = TypeDocumentVersion
+	}
+
+	err = q.AddDeadLetter(ctx, postgres.AddDeadLetterParams{
+		TargetName:    w.name,
+		Shard:         w.shard,
+		EventID:       evt.Id,
+		Event:         payload,
+		UpdateType:    updateType,
+		TargetVersion: targetVersion,
+		Error:         handleErr.Error(),
+		Created:       pg.Time(time.Now()),
+	})
+	if err != nil {
+		return fmt.Errorf("record dead letter: %w", err)
+	}
+
+	return nil
+}
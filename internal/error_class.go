@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/twitchtv/twirp"
+)
+
+// ErrorClass decides how a failure to handle an event is treated.
+type ErrorClass string
+
+const (
+	// ErrorRetryable errors are transient, the event is retried with
+	// backoff.
+	ErrorRetryable ErrorClass = "retryable"
+	// ErrorSkip errors are permanent for the event, f.ex. a document that
+	// fails validation in the target. The event is recorded as a dead
+	// letter and replication moves on.
+	ErrorSkip ErrorClass = "skip"
+	// ErrorFatal errors are quarantined or halt replication.
+	ErrorFatal ErrorClass = "fatal"
+)
+
+// defaultErrorRetries is the number of times an event is retried for retryable
+// errors other than an unreachable target.
+const defaultErrorRetries = 5
+
+// defaultErrorClasses is used for the twirp error codes that haven't been
+// classified explicitly, codes that aren't listed are fatal.
+var defaultErrorClasses = map[twirp.ErrorCode]ErrorClass{
+	twirp.Unavailable:       ErrorRetryable,
+	twirp.DeadlineExceeded:  ErrorRetryable,
+	twirp.ResourceExhausted: ErrorRetryable,
+	twirp.Aborted:           ErrorRetryable,
+	twirp.InvalidArgument:   ErrorSkip,
+	twirp.OutOfRange:        ErrorSkip,
+	twirp.Malformed:         ErrorSkip,
+}
+
+// ErrorClassification maps twirp error codes to error classes. Codes that
+// aren't in the map use the default classification, where unavailable,
+// deadline exceeded, resource exhausted, and aborted errors are retryable,
+// invalid argument, out of range, and malformed errors are skipped, and all
+// other errors are fatal. The zero value uses the default classification.
+//
+// Conflicts and authentication failures are handled before the classification
+// is applied.
+type ErrorClassification map[twirp.ErrorCode]ErrorClass
+
+// ParseErrorClassification parses error classes in the format
+// "[twirp error code]=[class]", f.ex. "invalid_argument=fatal", that override
+// the default classification.
+func ParseErrorClassification(specs []string) (ErrorClassification, error) {
+	c := make(ErrorClassification, len(specs))
+
+	for _, spec := range specs {
+		code, class, ok := strings.Cut(spec, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid error class %q", spec)
+		}
+
+		if !twirp.IsValidErrorCode(twirp.ErrorCode(code)) {
+			return nil, fmt.Errorf("unknown twirp error code %q", code)
+		}
+
+		switch ErrorClass(class) {
+		case ErrorRetryable, ErrorSkip, ErrorFatal:
+		default:
+			return nil, fmt.Errorf("unknown error class %q for %q", class, code)
+		}
+
+		c[twirp.ErrorCode(code)] = ErrorClass(class)
+	}
+
+	return c, nil
+}
+
+// Classify returns the class of an error. Errors that aren't twirp errors are
+// fatal, except for errors from reaching the target, which are retryable.
+// Size limit errors are always fatal, as retrying the same document won't
+// make it smaller, and oversized documents are handled by the oversize
+// policy.
+func (c ErrorClassification) Classify(err error) ErrorClass {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return ErrorFatal
+	}
+
+	if errors.Is(err, ErrTargetUnavailable) {
+		return ErrorRetryable
+	}
+
+	if errors.Is(err, ErrOversized) || IsSizeLimitError(err) {
+		return ErrorFatal
+	}
+
+	var twErr twirp.Error
+
+	if !errors.As(err, &twErr) {
+		return ErrorFatal
+	}
+
+	if class, ok := c[twErr.Code()]; ok {
+		return class
+	}
+
+	if class, ok := defaultErrorClasses[twErr.Code()]; ok {
+		return class
+	}
+
+	return ErrorFatal
+}
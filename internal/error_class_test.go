@@ -0,0 +1,122 @@
+package internal_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ttab/elephant-replicant/internal"
+	"github.com/twitchtv/twirp"
+)
+
+func TestErrorClassification(t *testing.T) {
+	var defaults internal.ErrorClassification
+
+	cases := map[string]struct {
+		err  error
+		want internal.ErrorClass
+	}{
+		"unavailable": {
+			err:  twirp.NewError(twirp.Unavailable, "down for maintenance"),
+			want: internal.ErrorRetryable,
+		},
+		"wrapped deadline exceeded": {
+			err: fmt.Errorf("update document: %w",
+				twirp.NewError(twirp.DeadlineExceeded, "timeout")),
+			want: internal.ErrorRetryable,
+		},
+		"invalid argument": {
+			err:  twirp.InvalidArgumentError("document", "missing title"),
+			want: internal.ErrorSkip,
+		},
+		"internal": {
+			err:  twirp.InternalError("database error"),
+			want: internal.ErrorFatal,
+		},
+		"target unavailable": {
+			err:  fmt.Errorf("%w: connection refused", internal.ErrTargetUnavailable),
+			want: internal.ErrorRetryable,
+		},
+		"not a twirp error": {
+			err:  errors.New("something broke"),
+			want: internal.ErrorFatal,
+		},
+		"canceled": {
+			err:  context.Canceled,
+			want: internal.ErrorFatal,
+		},
+		"oversized document": {
+			err: fmt.Errorf("%w: %w", internal.ErrOversized,
+				twirp.NewError(twirp.ResourceExhausted, "document too large")),
+			want: internal.ErrorFatal,
+		},
+		"size limit from proxy": {
+			err: twirp.NewError(twirp.ResourceExhausted, "request entity too large").
+				WithMeta("http_error_from_intermediary", "true").
+				WithMeta("status_code", "413"),
+			want: internal.ErrorFatal,
+		},
+		"too many requests from proxy": {
+			err: twirp.NewError(twirp.ResourceExhausted, "too many requests").
+				WithMeta("http_error_from_intermediary", "true").
+				WithMeta("status_code", "429"),
+			want: internal.ErrorRetryable,
+		},
+	}
+
+	for name, c := range cases {
+		got := defaults.Classify(c.err)
+		if got != c.want {
+			t.Errorf("%s: expected %q, got %q", name, c.want, got)
+		}
+	}
+}
+
+func TestParseErrorClassification(t *testing.T) {
+	classes, err := internal.ParseErrorClassification([]string{
+		"invalid_argument=fatal",
+		"internal=retryable",
+	})
+	if err != nil {
+		t.Fatalf("parse classification: %v", err)
+	}
+
+	got := classes.Classify(twirp.InvalidArgumentError("document", "missing title"))
+	if got != internal.ErrorFatal {
+		t.Errorf("expected overridden invalid argument to be fatal, got %q", got)
+	}
+
+	got = classes.Classify(twirp.InternalError("database error"))
+	if got != internal.ErrorRetryable {
+		t.Errorf("expected overridden internal to be retryable, got %q", got)
+	}
+
+	oversized := internal.ErrorClassification{
+		twirp.ResourceExhausted: internal.ErrorRetryable,
+	}
+
+	got = oversized.Classify(fmt.Errorf("%w: %w", internal.ErrOversized,
+		twirp.NewError(twirp.ResourceExhausted, "document too large")))
+	if got != internal.ErrorFatal {
+		t.Errorf("expected oversized documents to be fatal regardless of overrides, got %q", got)
+	}
+
+	got = classes.Classify(twirp.NewError(twirp.Unavailable, "down"))
+	if got != internal.ErrorRetryable {
+		t.Errorf("expected unavailable to keep the default class, got %q", got)
+	}
+
+	invalid := []string{
+		"invalid_argument",
+		"no_such_code=skip",
+		"invalid_argument=ignore",
+	}
+
+	for _, spec := range invalid {
+		_, err := internal.ParseErrorClassification([]string{spec})
+		if err == nil {
+			t.Errorf("expected an error for %q", spec)
+		}
+	}
+}
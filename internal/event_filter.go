@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ttab/elephant-api/repository"
+)
+
+// EventFilter decides if an event should be skipped without being handled.
+// Skip returns true and the reason if the event should be skipped.
+type EventFilter interface {
+	Skip(evt *repository.EventlogItem) (bool, string)
+}
+
+// IgnoreSubs skips events from the listed updaters.
+type IgnoreSubs []string
+
+// Skip implements EventFilter.
+func (f IgnoreSubs) Skip(evt *repository.EventlogItem) (bool, string) {
+	return slices.Contains(f, evt.UpdaterUri), "ignored sub"
+}
+
+// IgnoreTypes skips events for documents of the listed types.
+type IgnoreTypes []string
+
+// Skip implements EventFilter.
+func (f IgnoreTypes) Skip(evt *repository.EventlogItem) (bool, string) {
+	return slices.Contains(f, evt.Type), "ignored type"
+}
+
+// IgnoreSubForType skips events from an updater for documents of a type.
+type IgnoreSubForType struct {
+	Type string
+	Sub  string
+}
+
+// Skip implements EventFilter.
+func (f IgnoreSubForType) Skip(evt *repository.EventlogItem) (bool, string) {
+	return evt.Type == f.Type && evt.UpdaterUri == f.Sub,
+		"ignored sub for type"
+}
+
+// ParseIgnoreSubForType parses filters in the format "[type]:[sub]".
+func ParseIgnoreSubForType(specs []string) ([]EventFilter, error) {
+	var filters []EventFilter
+
+	for _, s := range specs {
+		docType, sub, ok := strings.Cut(s, ":")
+		if !ok || docType == "" || sub == "" {
+			return nil, fmt.Errorf("invalid sub filter %q", s)
+		}
+
+		filters = append(filters, IgnoreSubForType{
+			Type: docType,
+			Sub:  sub,
+		})
+	}
+
+	return filters, nil
+}
+
+// IgnoreBefore skips events that occurred before the cutoff. Events without a
+// valid timestamp are let through.
+type IgnoreBefore time.Time
+
+// Skip implements EventFilter.
+func (f IgnoreBefore) Skip(evt *repository.EventlogItem) (bool, string) {
+	ts := eventTimestamp(evt)
+
+	return !ts.IsZero() && ts.Before(time.Time(f)), "event before cutoff"
+}
+
+// StatusFilter restricts which statuses are replicated. Only the included
+// statuses are replicated if any have been listed, and ignored statuses are
+// never replicated. A zero StatusFilter allows all statuses.
+type StatusFilter struct {
+	Include []string
+	Ignore  []string
+}
+
+// Allowed returns true if the status should be replicated.
+func (f StatusFilter) Allowed(name string) bool {
+	if len(f.Include) > 0 && !slices.Contains(f.Include, name) {
+		return false
+	}
+
+	return !slices.Contains(f.Ignore, name)
+}
@@ -0,0 +1,88 @@
+package internal_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/internal"
+)
+
+func TestIgnoreSubForType(t *testing.T) {
+	filters, err := internal.ParseIgnoreSubForType([]string{
+		"core/article:core://application/importer",
+	})
+	if err != nil {
+		t.Fatalf("parse filters: %v", err)
+	}
+
+	f := filters[0]
+
+	skip, _ := f.Skip(&repository.EventlogItem{
+		Type:       "core/article",
+		UpdaterUri: "core://application/importer",
+	})
+	if !skip {
+		t.Error("expected event from sub for type to be skipped")
+	}
+
+	skip, _ = f.Skip(&repository.EventlogItem{
+		Type:       "core/image",
+		UpdaterUri: "core://application/importer",
+	})
+	if skip {
+		t.Error("expected event from sub for other type to pass")
+	}
+
+	_, err = internal.ParseIgnoreSubForType([]string{"core/article"})
+	if err == nil {
+		t.Error("expected an error for a filter without a sub")
+	}
+}
+
+func TestIgnoreBefore(t *testing.T) {
+	cutoff := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	f := internal.IgnoreBefore(cutoff)
+
+	skip, _ := f.Skip(&repository.EventlogItem{
+		Timestamp: "2024-05-31T23:59:59Z",
+	})
+	if !skip {
+		t.Error("expected event before cutoff to be skipped")
+	}
+
+	skip, _ = f.Skip(&repository.EventlogItem{
+		Timestamp: "2024-06-01T00:00:00Z",
+	})
+	if skip {
+		t.Error("expected event at cutoff to pass")
+	}
+
+	skip, _ = f.Skip(&repository.EventlogItem{})
+	if skip {
+		t.Error("expected event without timestamp to pass")
+	}
+}
+
+func TestStatusFilter(t *testing.T) {
+	f := internal.StatusFilter{
+		Include: []string{"usable", "done", "draft"},
+		Ignore:  []string{"draft"},
+	}
+
+	if !f.Allowed("usable") {
+		t.Error("expected included status to be allowed")
+	}
+
+	if f.Allowed("draft") {
+		t.Error("expected ignored status to be rejected even if included")
+	}
+
+	if f.Allowed("approved") {
+		t.Error("expected status outside of the include list to be rejected")
+	}
+
+	if !(internal.StatusFilter{}).Allowed("approved") {
+		t.Error("expected zero filter to allow all statuses")
+	}
+}
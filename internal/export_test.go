@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/ttab/elephant-api/repository"
+)
+
+// TestTransfer runs single attachment transfer attempts for the tests.
+type TestTransfer struct {
+	Target      ReplicationSink
+	HTTPClient  *http.Client
+	Compression AttachmentCompression
+	MaxSize     int64
+	Verify      bool
+	Metrics     *ReplicationMetrics
+}
+
+// Transfer transfers the attachment to the target and returns the upload ID.
+func (t TestTransfer) Transfer(
+	ctx context.Context, obj *repository.AttachmentDetails,
+) (string, error) {
+	w := Worker{
+		name:                  "test",
+		target:                t.Target,
+		httpClient:            t.HTTPClient,
+		attachmentCompression: t.Compression,
+		maxAttachmentSize:     t.MaxSize,
+		verifyAttachments:     t.Verify,
+		metrics:               t.Metrics,
+	}
+
+	return w.attemptTransfer(ctx, obj)
+}
+
+// NewBreakerMultipartSink applies the circuit breaker to a multipart sink.
+func NewBreakerMultipartSink(sink MultipartSink, breaker *CircuitBreaker) MultipartSink {
+	return &breakerMultipartSink{sink: sink, breaker: breaker}
+}
+
+// NewSharedEventlog creates a shared eventlog without a database, the minimum
+// log position can't be stored.
+func NewSharedEventlog(docs repository.Documents) repository.Documents {
+	return newSharedEventlog(docs, nil, "")
+}
+
+// ErrStopped is returned when the worker stops for shutdown.
+var ErrStopped = errStopped
+
+// RouteByLanguage runs the language routing of a worker with the source and
+// routing for the tests.
+func RouteByLanguage(
+	ctx context.Context, source repository.Documents, routing LanguageRouting,
+	name string, evt *repository.EventlogItem, caughtUp bool,
+) (*repository.GetDocumentResponse, error) {
+	w := Worker{
+		name:            name,
+		source:          source,
+		languageRouting: routing,
+	}
+
+	return w.routeByLanguage(ctx, evt, uuid.MustParse(evt.Uuid), caughtUp, nil)
+}
@@ -0,0 +1,495 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	rpc_newsdoc "github.com/ttab/elephant-api/newsdoc"
+	"github.com/ttab/elephant-api/repository"
+	"github.com/twitchtv/twirp"
+	"google.golang.org/protobuf/proto"
+)
+
+// FakeDocuments is an in-memory repository.Documents for tests, it can be used
+// both as the source and as a target sink. Only the methods that are used for
+// replication are implemented, calling any other method panics.
+//
+// Uploads are made to UploadURL, serve the fake with f.ex. httptest to accept
+// them. The ACL entries in updates replace the permissions of the grantee,
+// and entries without permissions remove it.
+type FakeDocuments struct {
+	repository.Documents
+
+	// UploadURL is the base URL of the upload URLs returned by
+	// CreateUpload.
+	UploadURL string
+	// Hook is called with the method name, f.ex. "Update", and the request
+	// before every implemented method. A returned error is returned by the
+	// method instead of handling the request, use it to inject twirp
+	// errors.
+	Hook func(method string, req proto.Message) error
+
+	mu       sync.Mutex
+	docs     map[string]*fakeDocument
+	uploads  map[string]*fakeUpload
+	statusID int64
+	uploadID int64
+}
+
+type fakeDocument struct {
+	versions    []*rpc_newsdoc.Document
+	created     string
+	modified    string
+	statuses    map[string][]*repository.Status
+	acl         []*repository.ACLEntry
+	attachments map[string]*repository.AttachmentDetails
+}
+
+type fakeUpload struct {
+	req  *repository.CreateUploadRequest
+	data []byte
+	done bool
+}
+
+var _ ReplicationSink = &FakeDocuments{}
+
+// NewFakeDocuments creates an empty fake repository.
+func NewFakeDocuments() *FakeDocuments {
+	return &FakeDocuments{
+		docs:    make(map[string]*fakeDocument),
+		uploads: make(map[string]*fakeUpload),
+	}
+}
+
+// SetAttachment adds an attachment to the current version of a document,
+// f.ex. with a download link to a test server.
+func (f *FakeDocuments) SetAttachment(
+	docUUID string, details *repository.AttachmentDetails,
+) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	doc, ok := f.docs[docUUID]
+	if !ok {
+		return twirp.NotFoundError("document not found")
+	}
+
+	details = proto.CloneOf(details)
+	details.Document = docUUID
+	details.Version = int64(len(doc.versions))
+
+	doc.attachments[details.Name] = details
+
+	return nil
+}
+
+// Upload returns the data that was uploaded for an upload ID.
+func (f *FakeDocuments) Upload(id string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	u, ok := f.uploads[id]
+	if !ok || !u.done {
+		return nil, false
+	}
+
+	return u.data, true
+}
+
+// ServeHTTP accepts uploads to the URLs returned by CreateUpload.
+func (f *FakeDocuments) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	u, ok := f.uploads[id]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	u.data = data
+	u.done = true
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (f *FakeDocuments) hook(method string, req proto.Message) error {
+	if f.Hook == nil {
+		return nil
+	}
+
+	return f.Hook(method, req)
+}
+
+// Get implements repository.Documents.
+func (f *FakeDocuments) Get(
+	_ context.Context, req *repository.GetDocumentRequest,
+) (*repository.GetDocumentResponse, error) {
+	err := f.hook("Get", req)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	doc, ok := f.docs[req.Uuid]
+	if !ok {
+		return nil, twirp.NotFoundError("document not found")
+	}
+
+	version := req.Version
+
+	var status *repository.Status
+
+	if req.Status != "" {
+		status = doc.head(req.Status)
+		if status == nil {
+			return nil, twirp.NotFoundError("status not found")
+		}
+
+		version = status.Version
+	}
+
+	if version == 0 {
+		version = int64(len(doc.versions))
+	}
+
+	if version < 1 || version > int64(len(doc.versions)) {
+		return nil, twirp.NotFoundError("version not found")
+	}
+
+	return &repository.GetDocumentResponse{
+		Document: proto.CloneOf(doc.versions[version-1]),
+		Version:  version,
+		Status:   proto.CloneOf(status),
+	}, nil
+}
+
+// GetMeta implements repository.Documents.
+func (f *FakeDocuments) GetMeta(
+	_ context.Context, req *repository.GetMetaRequest,
+) (*repository.GetMetaResponse, error) {
+	err := f.hook("GetMeta", req)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	doc, ok := f.docs[req.Uuid]
+	if !ok {
+		return nil, twirp.NotFoundError("document not found")
+	}
+
+	meta := repository.DocumentMeta{
+		Created:        doc.created,
+		Modified:       doc.modified,
+		CurrentVersion: int64(len(doc.versions)),
+		Heads:          make(map[string]*repository.Status),
+	}
+
+	for name := range doc.statuses {
+		meta.Heads[name] = proto.CloneOf(doc.head(name))
+	}
+
+	for _, entry := range doc.acl {
+		meta.Acl = append(meta.Acl, proto.CloneOf(entry))
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(doc.attachments)) {
+		meta.Attachments = append(meta.Attachments, &repository.AttachmentRef{
+			Name:    name,
+			Version: doc.attachments[name].Version,
+		})
+	}
+
+	return &repository.GetMetaResponse{Meta: &meta}, nil
+}
+
+// GetStatus implements repository.Documents.
+func (f *FakeDocuments) GetStatus(
+	_ context.Context, req *repository.GetStatusRequest,
+) (*repository.GetStatusResponse, error) {
+	err := f.hook("GetStatus", req)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	doc, ok := f.docs[req.Uuid]
+	if !ok {
+		return nil, twirp.NotFoundError("document not found")
+	}
+
+	for _, s := range doc.statuses[req.Name] {
+		if req.Id == 0 && s == doc.head(req.Name) || s.Id == req.Id {
+			return &repository.GetStatusResponse{
+				Status: proto.CloneOf(s),
+			}, nil
+		}
+	}
+
+	return nil, twirp.NotFoundError("status not found")
+}
+
+// Update implements repository.Documents.
+func (f *FakeDocuments) Update(
+	_ context.Context, req *repository.UpdateRequest,
+) (*repository.UpdateResponse, error) {
+	err := f.hook("Update", req)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	doc, exists := f.docs[req.Uuid]
+
+	err = checkFakeIfMatch(req.IfMatch, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists && req.Document == nil {
+		return nil, twirp.InvalidArgumentError("document",
+			"a document is required for new documents")
+	}
+
+	now := time.Now().Format(time.RFC3339)
+
+	if !exists {
+		doc = &fakeDocument{
+			created:     now,
+			statuses:    make(map[string][]*repository.Status),
+			attachments: make(map[string]*repository.AttachmentDetails),
+		}
+	}
+
+	version := int64(len(doc.versions))
+	if req.Document != nil {
+		version++
+	}
+
+	// Validate the whole update before changing anything.
+	for _, s := range req.Status {
+		head := doc.head(s.Name)
+
+		if s.IfMatch != 0 && (head == nil || head.Id != s.IfMatch) {
+			return nil, twirp.NewError(twirp.FailedPrecondition,
+				"status head doesn't match")
+		}
+
+		if s.Version < 0 || s.Version > version {
+			return nil, twirp.InvalidArgumentError("status",
+				"unknown document version "+strconv.FormatInt(s.Version, 10))
+		}
+	}
+
+	for name, id := range req.AttachObjects {
+		u, ok := f.uploads[id]
+		if !ok || !u.done {
+			return nil, twirp.InvalidArgumentError("attach_objects",
+				"no completed upload for "+name)
+		}
+	}
+
+	if req.Document != nil {
+		doc.versions = append(doc.versions, proto.CloneOf(req.Document))
+	}
+
+	for _, s := range req.Status {
+		statusVersion := s.Version
+		if statusVersion == 0 {
+			statusVersion = version
+		}
+
+		f.statusID++
+
+		doc.statuses[s.Name] = append(doc.statuses[s.Name], &repository.Status{
+			Id:      f.statusID,
+			Version: statusVersion,
+			Created: now,
+			Meta:    s.Meta,
+		})
+	}
+
+	for _, entry := range req.Acl {
+		doc.acl = slices.DeleteFunc(doc.acl, func(e *repository.ACLEntry) bool {
+			return e.Uri == entry.Uri
+		})
+
+		if len(entry.Permissions) > 0 {
+			doc.acl = append(doc.acl, proto.CloneOf(entry))
+		}
+	}
+
+	for name, id := range req.AttachObjects {
+		u := f.uploads[id]
+
+		doc.attachments[name] = &repository.AttachmentDetails{
+			Document:    req.Uuid,
+			Name:        name,
+			Version:     version,
+			Filename:    u.req.Name,
+			ContentType: u.req.ContentType,
+		}
+	}
+
+	for _, name := range req.DetachObjects {
+		delete(doc.attachments, name)
+	}
+
+	doc.modified = now
+	f.docs[req.Uuid] = doc
+
+	return &repository.UpdateResponse{
+		Version: version,
+		Uuid:    req.Uuid,
+	}, nil
+}
+
+// Delete implements repository.Documents.
+func (f *FakeDocuments) Delete(
+	_ context.Context, req *repository.DeleteDocumentRequest,
+) (*repository.DeleteDocumentResponse, error) {
+	err := f.hook("Delete", req)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	err = checkFakeIfMatch(req.IfMatch, f.docs[req.Uuid])
+	if err != nil {
+		return nil, err
+	}
+
+	delete(f.docs, req.Uuid)
+
+	return &repository.DeleteDocumentResponse{}, nil
+}
+
+// CreateUpload implements repository.Documents.
+func (f *FakeDocuments) CreateUpload(
+	_ context.Context, req *repository.CreateUploadRequest,
+) (*repository.CreateUploadResponse, error) {
+	err := f.hook("CreateUpload", req)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.uploadID++
+
+	id := strconv.FormatInt(f.uploadID, 10)
+
+	f.uploads[id] = &fakeUpload{
+		req: proto.CloneOf(req),
+	}
+
+	return &repository.CreateUploadResponse{
+		Id:  id,
+		Url: strings.TrimSuffix(f.UploadURL, "/") + "/" + id,
+	}, nil
+}
+
+// GetAttachments implements repository.Documents.
+func (f *FakeDocuments) GetAttachments(
+	_ context.Context, req *repository.GetAttachmentsRequest,
+) (*repository.GetAttachmentsResponse, error) {
+	err := f.hook("GetAttachments", req)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var res repository.GetAttachmentsResponse
+
+	for _, docUUID := range req.Documents {
+		doc, ok := f.docs[docUUID]
+		if !ok {
+			continue
+		}
+
+		a, ok := doc.attachments[req.AttachmentName]
+		if !ok {
+			continue
+		}
+
+		a = proto.CloneOf(a)
+
+		if !req.DownloadLink {
+			a.DownloadLink = ""
+		}
+
+		res.Attachments = append(res.Attachments, a)
+	}
+
+	return &res, nil
+}
+
+// checkFakeIfMatch checks the optimistic lock of a request the same way as
+// the repository: -1 requires that the document doesn't exist, and other
+// non-zero values must match the current version.
+func checkFakeIfMatch(ifMatch int64, doc *fakeDocument) error {
+	var current int64
+
+	if doc != nil {
+		current = int64(len(doc.versions))
+	}
+
+	switch {
+	case ifMatch == 0:
+		return nil
+	case ifMatch == -1 && doc == nil:
+		return nil
+	case ifMatch == current:
+		return nil
+	}
+
+	return twirp.NewError(twirp.FailedPrecondition,
+		"document version doesn't match")
+}
+
+// head returns the latest status with the name, or nil.
+func (d *fakeDocument) head(name string) *repository.Status {
+	statuses := d.statuses[name]
+	if len(statuses) == 0 {
+		return nil
+	}
+
+	return statuses[len(statuses)-1]
+}
@@ -0,0 +1,196 @@
+package internal_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	rpc_newsdoc "github.com/ttab/elephant-api/newsdoc"
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/internal"
+	"github.com/ttab/elephantine"
+	"github.com/twitchtv/twirp"
+	"google.golang.org/protobuf/proto"
+)
+
+const fakeUUID = "6a8723a6-b9b1-4b16-b9f3-7a1e1e1b5f6e"
+
+func TestFakeDocumentsUpdate(t *testing.T) {
+	ctx := t.Context()
+	docs := internal.NewFakeDocuments()
+
+	_, err := docs.Update(ctx, &repository.UpdateRequest{
+		Uuid:   fakeUUID,
+		Status: []*repository.StatusUpdate{{Name: "usable"}},
+	})
+	if !elephantine.IsTwirpErrorCode(err, twirp.InvalidArgument) {
+		t.Fatalf("expected a status update of a missing document to fail, got %v", err)
+	}
+
+	res, err := docs.Update(ctx, &repository.UpdateRequest{
+		Uuid:     fakeUUID,
+		Document: &rpc_newsdoc.Document{Uuid: fakeUUID, Title: "First"},
+		IfMatch:  -1,
+		Acl: []*repository.ACLEntry{
+			{Uri: "core://unit/a", Permissions: []string{"r"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("create document: %v", err)
+	}
+
+	if res.Version != 1 {
+		t.Fatalf("expected version 1, got %d", res.Version)
+	}
+
+	_, err = docs.Update(ctx, &repository.UpdateRequest{
+		Uuid:     fakeUUID,
+		Document: &rpc_newsdoc.Document{Uuid: fakeUUID, Title: "Conflict"},
+		IfMatch:  -1,
+	})
+	if !elephantine.IsTwirpErrorCode(err, twirp.FailedPrecondition) {
+		t.Fatalf("expected a conflict for an existing document, got %v", err)
+	}
+
+	_, err = docs.Update(ctx, &repository.UpdateRequest{
+		Uuid:     fakeUUID,
+		Document: &rpc_newsdoc.Document{Uuid: fakeUUID, Title: "Second"},
+		IfMatch:  1,
+		Status:   []*repository.StatusUpdate{{Name: "usable"}},
+		Acl: []*repository.ACLEntry{
+			{Uri: "core://unit/a", Permissions: []string{}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("update document: %v", err)
+	}
+
+	meta, err := docs.GetMeta(ctx, &repository.GetMetaRequest{Uuid: fakeUUID})
+	if err != nil {
+		t.Fatalf("get meta: %v", err)
+	}
+
+	if meta.Meta.CurrentVersion != 2 {
+		t.Errorf("expected current version 2, got %d", meta.Meta.CurrentVersion)
+	}
+
+	if head := meta.Meta.Heads["usable"]; head == nil || head.Version != 2 {
+		t.Errorf("expected the status to be set on version 2, got %v", head)
+	}
+
+	if len(meta.Meta.Acl) != 0 {
+		t.Errorf("expected the ACL entry to be removed, got %v", meta.Meta.Acl)
+	}
+
+	doc, err := docs.Get(ctx, &repository.GetDocumentRequest{
+		Uuid:    fakeUUID,
+		Version: 1,
+	})
+	if err != nil {
+		t.Fatalf("get first version: %v", err)
+	}
+
+	if doc.Document.Title != "First" {
+		t.Errorf("expected the first version, got %q", doc.Document.Title)
+	}
+
+	_, err = docs.Delete(ctx, &repository.DeleteDocumentRequest{
+		Uuid:    fakeUUID,
+		IfMatch: 1,
+	})
+	if !elephantine.IsTwirpErrorCode(err, twirp.FailedPrecondition) {
+		t.Fatalf("expected a conflict for a stale delete, got %v", err)
+	}
+
+	_, err = docs.Delete(ctx, &repository.DeleteDocumentRequest{Uuid: fakeUUID})
+	if err != nil {
+		t.Fatalf("delete document: %v", err)
+	}
+
+	_, err = docs.Get(ctx, &repository.GetDocumentRequest{Uuid: fakeUUID})
+	if !elephantine.IsTwirpErrorCode(err, twirp.NotFound) {
+		t.Errorf("expected the document to be deleted, got %v", err)
+	}
+}
+
+func TestFakeDocumentsUpload(t *testing.T) {
+	ctx := t.Context()
+	docs := internal.NewFakeDocuments()
+
+	server := httptest.NewServer(docs)
+	t.Cleanup(server.Close)
+
+	docs.UploadURL = server.URL
+
+	upload, err := docs.CreateUpload(ctx, &repository.CreateUploadRequest{
+		Name:        "photo.jpg",
+		ContentType: "image/jpeg",
+	})
+	if err != nil {
+		t.Fatalf("create upload: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, upload.Url,
+		bytes.NewReader([]byte("data")))
+	if err != nil {
+		t.Fatalf("create upload request: %v", err)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+
+	_ = res.Body.Close()
+
+	if data, ok := docs.Upload(upload.Id); !ok || string(data) != "data" {
+		t.Fatalf("expected the uploaded data, got %q", data)
+	}
+
+	_, err = docs.Update(ctx, &repository.UpdateRequest{
+		Uuid:          fakeUUID,
+		Document:      &rpc_newsdoc.Document{Uuid: fakeUUID},
+		AttachObjects: map[string]string{"image": upload.Id},
+	})
+	if err != nil {
+		t.Fatalf("attach upload: %v", err)
+	}
+
+	attachments, err := docs.GetAttachments(ctx, &repository.GetAttachmentsRequest{
+		Documents:      []string{fakeUUID},
+		AttachmentName: "image",
+	})
+	if err != nil {
+		t.Fatalf("get attachments: %v", err)
+	}
+
+	want := &repository.AttachmentDetails{
+		Document:    fakeUUID,
+		Name:        "image",
+		Version:     1,
+		Filename:    "photo.jpg",
+		ContentType: "image/jpeg",
+	}
+
+	if len(attachments.Attachments) != 1 || !proto.Equal(attachments.Attachments[0], want) {
+		t.Errorf("unexpected attachments: %v", attachments.Attachments)
+	}
+}
+
+func TestFakeDocumentsHook(t *testing.T) {
+	docs := internal.NewFakeDocuments()
+
+	docs.Hook = func(method string, _ proto.Message) error {
+		if method == "GetMeta" {
+			return twirp.NewError(twirp.Unavailable, "maintenance")
+		}
+
+		return nil
+	}
+
+	_, err := docs.GetMeta(t.Context(), &repository.GetMetaRequest{Uuid: fakeUUID})
+	if !elephantine.IsTwirpErrorCode(err, twirp.Unavailable) {
+		t.Errorf("expected the injected error, got %v", err)
+	}
+}
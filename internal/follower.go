@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ttab/elephant-api/repository"
+)
+
+// FollowerConfig controls how the source eventlog is read.
+//
+// The log follower reads the compacted eventlog in fixed blocks of 500 events
+// while catching up, koonkie doesn't allow that to be tuned, so the batch size
+// only applies once the follower has caught up and is tailing the eventlog.
+type FollowerConfig struct {
+	// BatchSize is the number of events to read per eventlog request once
+	// caught up. Zero uses the koonkie default of 100.
+	BatchSize int32
+	// WaitDuration is how long an eventlog request waits for new events
+	// before returning an empty result.
+	WaitDuration time.Duration
+	// MinWait and MaxWait make the wait adaptive when both are set. The
+	// wait starts at MinWait, is doubled for every empty poll up to
+	// MaxWait, and is reset to MinWait when new events arrive.
+	MinWait time.Duration
+	MaxWait time.Duration
+	// Shared lets the workers of all targets in the process share their
+	// reads of the eventlog once they have caught up.
+	Shared bool
+}
+
+// Documents wraps the source documents client to apply the configured eventlog
+// batch size and adaptive wait. Every follower needs its own wrapper as the
+// adaptive wait is tracked per wrapper.
+func (fc FollowerConfig) Documents(docs repository.Documents) repository.Documents {
+	if fc.BatchSize <= 0 && !fc.adaptive() {
+		return docs
+	}
+
+	d := followerDocuments{
+		Documents: docs,
+		batchSize: fc.BatchSize,
+	}
+
+	if fc.adaptive() {
+		d.minWait = fc.MinWait
+		d.maxWait = fc.MaxWait
+		d.wait = fc.MinWait
+	}
+
+	return &d
+}
+
+// adaptive returns true if the wait should adapt to the event arrival rate.
+func (fc FollowerConfig) adaptive() bool {
+	return fc.MinWait > 0 && fc.MaxWait > fc.MinWait
+}
+
+type followerDocuments struct {
+	repository.Documents
+
+	batchSize int32
+	minWait   time.Duration
+	maxWait   time.Duration
+
+	mu   sync.Mutex
+	wait time.Duration
+}
+
+// Eventlog implements repository.Documents.
+func (d *followerDocuments) Eventlog(
+	ctx context.Context, req *repository.GetEventlogRequest,
+) (*repository.GetEventlogResponse, error) {
+	// Requests with a batch size are polls of the eventlog, leave other
+	// requests, like reads of the last event, alone. The follower creates
+	// a new request for every call, so it's safe to modify it.
+	if req.BatchSize <= 0 {
+		return d.Documents.Eventlog(ctx, req) //nolint: wrapcheck
+	}
+
+	if d.batchSize > 0 {
+		req.BatchSize = d.batchSize
+	}
+
+	if d.maxWait == 0 {
+		return d.Documents.Eventlog(ctx, req) //nolint: wrapcheck
+	}
+
+	d.mu.Lock()
+	// The wait is bounded by MaxWait, so it won't overflow.
+	req.WaitMs = int32(d.wait.Milliseconds()) //nolint: gosec
+	d.mu.Unlock()
+
+	res, err := d.Documents.Eventlog(ctx, req)
+	if err != nil {
+		return nil, err //nolint: wrapcheck
+	}
+
+	d.mu.Lock()
+	d.wait = nextWait(d.wait, len(res.Items) > 0, d.minWait, d.maxWait)
+	d.mu.Unlock()
+
+	return res, nil
+}
+
+// nextWait resets the wait to the minimum when events arrive, and doubles it
+// up to the maximum for every empty poll.
+func nextWait(wait time.Duration, gotEvents bool, minWait, maxWait time.Duration) time.Duration {
+	if gotEvents {
+		return minWait
+	}
+
+	return min(max(wait*2, minWait), maxWait)
+}
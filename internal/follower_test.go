@@ -0,0 +1,99 @@
+package internal_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/internal"
+)
+
+type eventlogRecorder struct {
+	repository.Documents
+
+	requests []*repository.GetEventlogRequest
+}
+
+func (r *eventlogRecorder) Eventlog(
+	_ context.Context, req *repository.GetEventlogRequest,
+) (*repository.GetEventlogResponse, error) {
+	r.requests = append(r.requests, req)
+
+	return &repository.GetEventlogResponse{}, nil
+}
+
+func TestFollowerConfigBatchSize(t *testing.T) {
+	rec := &eventlogRecorder{}
+
+	docs := internal.FollowerConfig{BatchSize: 500}.Documents(rec)
+
+	_, _ = docs.Eventlog(t.Context(), &repository.GetEventlogRequest{
+		After: -1,
+	})
+	_, _ = docs.Eventlog(t.Context(), &repository.GetEventlogRequest{
+		After:     10,
+		BatchSize: 100,
+	})
+
+	if rec.requests[0].BatchSize != 0 {
+		t.Errorf("got batch size %d for last event read, want 0",
+			rec.requests[0].BatchSize)
+	}
+
+	if rec.requests[1].BatchSize != 500 {
+		t.Errorf("got batch size %d for eventlog poll, want 500",
+			rec.requests[1].BatchSize)
+	}
+}
+
+type scriptedEventlog struct {
+	repository.Documents
+
+	results []int
+	waits   []int32
+}
+
+func (s *scriptedEventlog) Eventlog(
+	_ context.Context, req *repository.GetEventlogRequest,
+) (*repository.GetEventlogResponse, error) {
+	s.waits = append(s.waits, req.WaitMs)
+
+	var res repository.GetEventlogResponse
+
+	n := s.results[len(s.waits)-1]
+
+	for range n {
+		res.Items = append(res.Items, &repository.EventlogItem{})
+	}
+
+	return &res, nil
+}
+
+func TestFollowerConfigAdaptiveWait(t *testing.T) {
+	log := &scriptedEventlog{
+		results: []int{0, 0, 0, 0, 5, 0},
+	}
+
+	docs := internal.FollowerConfig{
+		MinWait: time.Second,
+		MaxWait: 5 * time.Second,
+	}.Documents(log)
+
+	for range log.results {
+		_, err := docs.Eventlog(t.Context(), &repository.GetEventlogRequest{
+			BatchSize: 100,
+			WaitMs:    10000,
+		})
+		if err != nil {
+			t.Fatalf("read eventlog: %v", err)
+		}
+	}
+
+	want := []int32{1000, 2000, 4000, 5000, 5000, 1000}
+
+	if !slices.Equal(log.waits, want) {
+		t.Errorf("got waits %v, want %v", log.waits, want)
+	}
+}
@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/ttab/elephant-api/repository"
+)
+
+// Import directive fields.
+const (
+	DirectiveCreated = "created"
+	DirectiveCreator = "creator"
+)
+
+// ImportDirectives controls which import directive fields are sent with the
+// updates written to the target. The directive lets the target keep the
+// original creation time and creator of a document instead of the time and
+// client of the replication. The zero value sends all fields.
+type ImportDirectives struct {
+	// OmitCreated leaves out the original creation time.
+	OmitCreated bool
+	// OmitCreator leaves out the URI of the original creator.
+	OmitCreator bool
+}
+
+// ParseImportDirectives parses the list of import directive fields to send,
+// "created" and "creator", or "none" to not send an import directive. All
+// fields are sent if the list is empty.
+func ParseImportDirectives(fields []string) (ImportDirectives, error) {
+	if len(fields) == 0 {
+		return ImportDirectives{}, nil
+	}
+
+	d := ImportDirectives{
+		OmitCreated: true,
+		OmitCreator: true,
+	}
+
+	for _, f := range fields {
+		switch f {
+		case DirectiveCreated:
+			d.OmitCreated = false
+		case DirectiveCreator:
+			d.OmitCreator = false
+		case "none":
+			if len(fields) > 1 {
+				return ImportDirectives{}, fmt.Errorf(
+					"%q can't be combined with other import directives", f)
+			}
+		default:
+			return ImportDirectives{}, fmt.Errorf(
+				"unknown import directive %q", f)
+		}
+	}
+
+	return d, nil
+}
+
+// Directive returns the import directive for a change, or nil if no fields
+// are sent.
+func (d ImportDirectives) Directive(
+	created string, creator string,
+) *repository.ImportDirective {
+	if d.OmitCreated && d.OmitCreator {
+		return nil
+	}
+
+	var directive repository.ImportDirective
+
+	if !d.OmitCreated {
+		directive.OriginallyCreated = created
+	}
+
+	if !d.OmitCreator {
+		directive.OriginalCreator = creator
+	}
+
+	return &directive
+}
+
+// importDirective returns the import directive for an event. The creation time
+// and creator of the document are taken from the meta when it has been read,
+// f.ex. when a new document is synced from its current state, and from the
+// event otherwise.
+func (w *Worker) importDirective(
+	evt *repository.EventlogItem, meta *repository.DocumentMeta,
+) *repository.ImportDirective {
+	if meta != nil {
+		return w.directives.Directive(meta.Created, meta.CreatorUri)
+	}
+
+	return w.directives.Directive(evt.Timestamp, evt.UpdaterUri)
+}
@@ -0,0 +1,54 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/internal"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestImportDirectives(t *testing.T) {
+	cases := map[string]struct {
+		fields []string
+		want   *repository.ImportDirective
+	}{
+		"default": {
+			want: &repository.ImportDirective{
+				OriginallyCreated: "2026-01-01T10:00:00Z",
+				OriginalCreator:   "core://user/1",
+			},
+		},
+		"created only": {
+			fields: []string{"created"},
+			want: &repository.ImportDirective{
+				OriginallyCreated: "2026-01-01T10:00:00Z",
+			},
+		},
+		"none": {
+			fields: []string{"none"},
+		},
+	}
+
+	for name, c := range cases {
+		d, err := internal.ParseImportDirectives(c.fields)
+		if err != nil {
+			t.Fatalf("%s: parse import directives: %v", name, err)
+		}
+
+		got := d.Directive("2026-01-01T10:00:00Z", "core://user/1")
+		if !proto.Equal(got, c.want) {
+			t.Errorf("%s: got %v, want %v", name, got, c.want)
+		}
+	}
+
+	for _, fields := range [][]string{
+		{"updater"},
+		{"none", "created"},
+	} {
+		_, err := internal.ParseImportDirectives(fields)
+		if err == nil {
+			t.Errorf("expected %q to be rejected", fields)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package internal
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Jitter is the fraction that the interval of periodic jobs is randomly
+// adjusted by, so that the jobs of several replicant instances don't all hit
+// the database at the same time. A jitter of 0.1 gives intervals within ±10%
+// of the configured interval.
+type Jitter float64
+
+// Apply returns the interval adjusted by a random amount within the jitter
+// range.
+func (j Jitter) Apply(interval time.Duration) time.Duration {
+	if j <= 0 {
+		return interval
+	}
+
+	spread := float64(interval) * float64(j)
+
+	return interval + time.Duration((rand.Float64()*2-1)*spread) //nolint: gosec
+}
@@ -0,0 +1,38 @@
+package internal_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ttab/elephant-replicant/internal"
+)
+
+func TestJitterRange(t *testing.T) {
+	const interval = time.Hour
+
+	jitter := internal.Jitter(0.1)
+
+	var varied bool
+
+	for range 1000 {
+		got := jitter.Apply(interval)
+
+		if got < 54*time.Minute || got > 66*time.Minute {
+			t.Fatalf("interval %v is outside of the jitter range", got)
+		}
+
+		if got != interval {
+			varied = true
+		}
+	}
+
+	if !varied {
+		t.Error("expected the jitter to vary the interval")
+	}
+}
+
+func TestJitterZero(t *testing.T) {
+	if got := internal.Jitter(0).Apply(time.Hour); got != time.Hour {
+		t.Errorf("got %v, expected the interval to be unchanged", got)
+	}
+}
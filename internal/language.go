@@ -0,0 +1,222 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/postgres"
+	"github.com/ttab/elephantine"
+	"github.com/twitchtv/twirp"
+)
+
+// LanguageRouting routes documents to targets by language, f.ex. to send
+// Swedish documents to a Nordic repository and everything else to the main
+// repository. Languages are matched case-insensitively, either exactly or by
+// their primary subtag, so "sv" matches "sv-SE". Documents in languages
+// without a route go to the default target. Targets that neither are the
+// default nor have any routes aren't affected and replicate all documents as
+// usual.
+//
+// A document that changes language is deleted from the target of its old
+// language and replicated to the target of the new one.
+type LanguageRouting struct {
+	// Routes maps lower case languages to target names.
+	Routes map[string]string
+	// Default is the target for documents in languages without a route.
+	Default string
+}
+
+// IsZero returns true if no routes have been configured.
+func (r LanguageRouting) IsZero() bool {
+	return len(r.Routes) == 0
+}
+
+// Target returns the target that documents in the language should be
+// replicated to.
+func (r LanguageRouting) Target(language string) string {
+	language = strings.ToLower(language)
+
+	if target, ok := r.Routes[language]; ok {
+		return target
+	}
+
+	primary, _, _ := strings.Cut(language, "-")
+
+	if target, ok := r.Routes[primary]; ok {
+		return target
+	}
+
+	return r.Default
+}
+
+// Participates returns true if the target is part of the routing.
+func (r LanguageRouting) Participates(target string) bool {
+	if r.IsZero() {
+		return false
+	}
+
+	if target == r.Default {
+		return true
+	}
+
+	for _, t := range r.Routes {
+		if t == target {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseLanguageRouting parses language routes in the format
+// "[language]=[target name]".
+func ParseLanguageRouting(specs []string, defaultTarget string) (LanguageRouting, error) {
+	r := LanguageRouting{
+		Routes:  make(map[string]string),
+		Default: defaultTarget,
+	}
+
+	for _, s := range specs {
+		language, target, ok := strings.Cut(s, "=")
+		if !ok || language == "" || target == "" {
+			return LanguageRouting{}, fmt.Errorf("invalid language route %q", s)
+		}
+
+		language = strings.ToLower(language)
+
+		if _, exists := r.Routes[language]; exists {
+			return LanguageRouting{}, fmt.Errorf(
+				"duplicate language route for %q", language)
+		}
+
+		r.Routes[language] = target
+	}
+
+	return r, nil
+}
+
+// LanguageChanged returns true if the language of a document has changed
+// since it was last replicated. Changes in case aren't reported, and nothing
+// is reported if the previous language isn't known.
+func LanguageChanged(previous string, known bool, current string) bool {
+	return known && !strings.EqualFold(previous, current)
+}
+
+// routeByLanguage skips documents that are routed to the target of another
+// language, and deletes them from this target if they have been replicated to
+// it before. New versions are routed by the language of the version of the
+// event, or of the current version when catching up, which is read from the
+// source unless the document already has been read for content filtering.
+// Other events are routed by the last replicated
+// language so that they don't require a source read. Returns the source
+// document if it was read.
+func (w *Worker) routeByLanguage(
+	ctx context.Context,
+	evt *repository.EventlogItem,
+	docUUID uuid.UUID,
+	caughtUp bool,
+	checkRes *repository.GetDocumentResponse,
+) (*repository.GetDocumentResponse, error) {
+	if w.languageRouting.IsZero() {
+		return checkRes, nil
+	}
+
+	var language string
+
+	switch {
+	case caughtUp && evt.Event != TypeDocumentVersion:
+		stored, err := postgres.New(w.db).GetDocumentLanguage(ctx,
+			postgres.GetDocumentLanguageParams{
+				TargetName: w.name,
+				ID:         w.uuidMapping.Map(docUUID),
+			})
+		if errors.Is(err, pgx.ErrNoRows) || (err == nil && !stored.Valid) {
+			// Documents that haven't been replicated are
+			// handled as usual, f.ex. as mapping gaps.
+			return checkRes, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("get replicated document language: %w", err)
+		}
+
+		language = stored.String
+	case checkRes != nil:
+		language = checkRes.Document.Language
+	default:
+		req := repository.GetDocumentRequest{
+			Uuid: evt.Uuid,
+		}
+
+		// Caught up events replicate the version of the event, the
+		// document is reused by replicate().
+		if caughtUp {
+			req.Version = evt.Version
+		}
+
+		res, err := w.source.Get(ctx, &req)
+		if elephantine.IsTwirpErrorCode(err, twirp.NotFound) {
+			return nil, fmt.Errorf("document not found for language routing: %w", ErrSkipped)
+		} else if err != nil {
+			return nil, fmt.Errorf("get document for language routing: %w", err)
+		}
+
+		checkRes = res
+		language = res.Document.Language
+	}
+
+	if w.languageRouting.Target(language) == w.name {
+		return checkRes, nil
+	}
+
+	err := w.removeExcluded(ctx, docUUID, "routed to other language target")
+	if err != nil {
+		return nil, fmt.Errorf("remove document routed to other language target: %w", err)
+	}
+
+	return nil, fmt.Errorf("routed to the target for %q: %w", language, ErrSkipped)
+}
+
+// recordLanguage stores the language of a replicated document, and reports if
+// it has changed since the last replicated version.
+func (w *Worker) recordLanguage(
+	ctx context.Context,
+	q *postgres.Queries,
+	evt *repository.EventlogItem,
+	targetUUID uuid.UUID,
+	language string,
+) error {
+	previous, err := q.GetDocumentLanguage(ctx, postgres.GetDocumentLanguageParams{
+		TargetName: w.name,
+		ID:         targetUUID,
+	})
+	if err != nil {
+		return fmt.Errorf("get replicated document language: %w", err)
+	}
+
+	if LanguageChanged(previous.String, previous.Valid, language) {
+		w.logger.InfoContext(ctx, "document language changed",
+			elephantine.LogKeyEventID, evt.Id,
+			elephantine.LogKeyDocumentUUID, evt.Uuid,
+			"previous_language", previous.String,
+			"language", language,
+		)
+
+		w.metrics.languageChanged(w.name)
+	}
+
+	err = q.SetDocumentLanguage(ctx, postgres.SetDocumentLanguageParams{
+		TargetName: w.name,
+		ID:         targetUUID,
+		Language:   pgtype.Text{String: language, Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("record document language: %w", err)
+	}
+
+	return nil
+}
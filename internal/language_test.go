@@ -0,0 +1,107 @@
+package internal_test
+
+import (
+	"testing"
+
+	rpc_newsdoc "github.com/ttab/elephant-api/newsdoc"
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/internal"
+)
+
+func TestLanguageRouting(t *testing.T) {
+	routing, err := internal.ParseLanguageRouting([]string{
+		"SV=nordic",
+		"nb=nordic",
+		"en-gb=uk",
+	}, "default")
+	if err != nil {
+		t.Fatalf("parse routing: %v", err)
+	}
+
+	cases := map[string]string{
+		"sv":    "nordic",
+		"sv-SE": "nordic",
+		"nb-NO": "nordic",
+		"en-GB": "uk",
+		"en-US": "default",
+		"":      "default",
+	}
+
+	for language, want := range cases {
+		got := routing.Target(language)
+		if got != want {
+			t.Errorf("%q: expected target %q, got %q", language, want, got)
+		}
+	}
+
+	for target, want := range map[string]bool{
+		"nordic":  true,
+		"default": true,
+		"media":   false,
+	} {
+		if routing.Participates(target) != want {
+			t.Errorf("%q: expected participation to be %v", target, want)
+		}
+	}
+
+	_, err = internal.ParseLanguageRouting([]string{"sv=nordic", "sv=other"}, "default")
+	if err == nil {
+		t.Error("expected an error for a duplicate route")
+	}
+
+	_, err = internal.ParseLanguageRouting([]string{"sv"}, "default")
+	if err == nil {
+		t.Error("expected an error for a route without a target")
+	}
+}
+
+func TestLanguageRoutingEventVersion(t *testing.T) {
+	source := internal.NewFakeDocuments()
+
+	for i, language := range []string{"sv-se", "en-gb"} {
+		_, err := source.Update(t.Context(), &repository.UpdateRequest{
+			Uuid: fakeUUID,
+			Document: &rpc_newsdoc.Document{
+				Uuid:     fakeUUID,
+				Language: language,
+			},
+			IfMatch: int64(i),
+		})
+		if err != nil {
+			t.Fatalf("update document: %v", err)
+		}
+	}
+
+	routing, err := internal.ParseLanguageRouting([]string{"sv=nordic"}, "default")
+	if err != nil {
+		t.Fatalf("parse routing: %v", err)
+	}
+
+	res, err := internal.RouteByLanguage(t.Context(), source, routing, "nordic",
+		&repository.EventlogItem{
+			Event:   internal.TypeDocumentVersion,
+			Uuid:    fakeUUID,
+			Version: 1,
+		}, true)
+	if err != nil {
+		t.Fatalf("expected the event version to be routed to the target: %v", err)
+	}
+
+	if res.Version != 1 {
+		t.Errorf("expected the document of the event version, got version %d", res.Version)
+	}
+}
+
+func TestLanguageChanged(t *testing.T) {
+	if !internal.LanguageChanged("sv-se", true, "en-gb") {
+		t.Error("expected a change of language to be reported")
+	}
+
+	if internal.LanguageChanged("sv-se", true, "sv-SE") {
+		t.Error("expected a change of case not to be reported")
+	}
+
+	if internal.LanguageChanged("", false, "en-gb") {
+		t.Error("expected an unknown previous language not to be reported")
+	}
+}
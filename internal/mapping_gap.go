@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephantine"
+)
+
+// Kinds of version mapping gaps.
+const (
+	// mappingGapPruned is a gap for a version that is older than the
+	// mapping retention, its mapping is expected to have been removed.
+	mappingGapPruned = "pruned"
+	// mappingGapUnexpected is a gap for a version that should still have
+	// had a mapping.
+	mappingGapUnexpected = "unexpected"
+	// mappingGapUnknown is a gap for a version that we couldn't get the
+	// creation time for.
+	mappingGapUnknown = "unknown"
+)
+
+// mappingGapLogInterval is the minimum time between warnings about version
+// mapping gaps for a target.
+const mappingGapLogInterval = time.Minute
+
+// MappingGapKind classifies a missing version mapping by the creation time of
+// the source version. Versions created before the mapping retention are
+// expected to have lost their mappings in the cleanup.
+func MappingGapKind(
+	created time.Time, retention time.Duration, now time.Time,
+) string {
+	switch {
+	case created.IsZero():
+		return mappingGapUnknown
+	case created.Before(now.Add(-retention)):
+		return mappingGapPruned
+	default:
+		return mappingGapUnexpected
+	}
+}
+
+// logThrottle limits how often a message is logged, and counts the messages
+// that were suppressed in between. It's shared by concurrently handled
+// events.
+type logThrottle struct {
+	mu         sync.Mutex
+	last       time.Time
+	suppressed int
+}
+
+// allow returns true if a message should be logged now, together with the
+// number of messages that have been suppressed since the last one.
+func (t *logThrottle) allow(now time.Time, interval time.Duration) (bool, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.last.IsZero() && now.Sub(t.last) < interval {
+		t.suppressed++
+
+		return false, 0
+	}
+
+	suppressed := t.suppressed
+
+	t.last = now
+	t.suppressed = 0
+
+	return true, suppressed
+}
+
+// mappingGap records a status change that is skipped because the document
+// version that it's for doesn't have a version mapping.
+func (w *Worker) mappingGap(ctx context.Context, evt *repository.EventlogItem) {
+	created, err := w.sourceVersionCreated(ctx, evt.Uuid, evt.Version)
+	if err != nil {
+		w.logger.DebugContext(ctx,
+			"failed to get the creation time of a version without a mapping",
+			elephantine.LogKeyDocumentUUID, evt.Uuid,
+			elephantine.LogKeyError, err)
+	}
+
+	kind := MappingGapKind(created, w.mappingRetention, time.Now())
+
+	w.metrics.mappingGap(w.name, kind)
+
+	ok, suppressed := w.mappingGaps.allow(time.Now(), mappingGapLogInterval)
+	if !ok {
+		return
+	}
+
+	w.logger.WarnContext(ctx, "skipped status for a version without a version mapping",
+		elephantine.LogKeyEventID, evt.Id,
+		elephantine.LogKeyDocumentUUID, evt.Uuid,
+		"version", evt.Version,
+		"status", evt.Status,
+		"kind", kind,
+		"older_than_retention", kind == mappingGapPruned,
+		"suppressed", suppressed,
+	)
+}
+
+// sourceVersionCreated returns the time when a document version was created
+// in the source, or the zero time if the version isn't in the history.
+func (w *Worker) sourceVersionCreated(
+	ctx context.Context, docUUID string, version int64,
+) (time.Time, error) {
+	res, err := w.source.GetHistory(ctx, &repository.GetHistoryRequest{
+		Uuid:   docUUID,
+		Before: version + 1,
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("get source document history: %w", err)
+	}
+
+	for _, v := range res.Versions {
+		if v.Version != version {
+			continue
+		}
+
+		created, err := time.Parse(time.RFC3339, v.Created)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("parse version created time: %w", err)
+		}
+
+		return created, nil
+	}
+
+	return time.Time{}, nil
+}
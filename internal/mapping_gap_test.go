@@ -0,0 +1,29 @@
+package internal_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ttab/elephant-replicant/internal"
+)
+
+func TestMappingGapKind(t *testing.T) {
+	now := time.Now()
+	retention := 24 * time.Hour
+
+	cases := map[string]struct {
+		Created time.Time
+		Want    string
+	}{
+		"pruned":     {now.Add(-48 * time.Hour), "pruned"},
+		"unexpected": {now.Add(-time.Hour), "unexpected"},
+		"unknown":    {time.Time{}, "unknown"},
+	}
+
+	for name, c := range cases {
+		got := internal.MappingGapKind(c.Created, retention, now)
+		if got != c.Want {
+			t.Errorf("%s: got %q, want %q", name, got, c.Want)
+		}
+	}
+}
@@ -0,0 +1,367 @@
+package internal
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/ttab/elephantine"
+)
+
+// Event handling results used as metric labels.
+const (
+	resultReplicated  = "replicated"
+	resultSkipped     = "skipped"
+	resultConflict    = "conflict"
+	resultError       = "error"
+	resultQuarantined = "quarantined"
+)
+
+// Attachment transfer stages used as metric labels.
+const (
+	stageDownload = "download"
+	stageUpload   = "upload"
+)
+
+// OtherDocType is the doc_type label used for document types that are over the
+// label limit.
+const OtherDocType = "other"
+
+// DocTypeLabels bounds the number of distinct doc_type label values so that
+// the metric cardinality can't grow without bounds. The first types that are
+// seen get their own label, the rest are bucketed as OtherDocType.
+type DocTypeLabels struct {
+	limit int
+
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+// NewDocTypeLabels creates a label set with room for limit document types.
+func NewDocTypeLabels(limit int) *DocTypeLabels {
+	return &DocTypeLabels{
+		limit: limit,
+		seen:  make(map[string]bool),
+	}
+}
+
+// Label returns the label value to use for the document type.
+func (l *DocTypeLabels) Label(docType string) string {
+	if docType == "" {
+		return OtherDocType
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.seen[docType] {
+		return docType
+	}
+
+	if len(l.seen) >= l.limit {
+		return OtherDocType
+	}
+
+	l.seen[docType] = true
+
+	return docType
+}
+
+// ReplicationMetrics tracks the application level replication progress.
+type ReplicationMetrics struct {
+	docTypes      *DocTypeLabels
+	events        *prometheus.CounterVec
+	attachments   *prometheus.CounterVec
+	transferBytes *prometheus.CounterVec
+	transferTime  *prometheus.HistogramVec
+	transferFails *prometheus.CounterVec
+	eventDuration *prometheus.HistogramVec
+	drift         *prometheus.CounterVec
+	lag           *prometheus.GaugeVec
+	position      *prometheus.GaugeVec
+	caughtUp      *prometheus.GaugeVec
+	circuitState  *prometheus.GaugeVec
+	paused        *prometheus.GaugeVec
+	mappingGaps   *prometheus.CounterVec
+	fallbackTypes *prometheus.CounterVec
+	noVersions    *prometheus.CounterVec
+	shadowWrites  *prometheus.CounterVec
+	languages     *prometheus.CounterVec
+	verified      *prometheus.CounterVec
+	verifyScans   *prometheus.CounterVec
+}
+
+// NewReplicationMetrics registers the replication metrics. Events are labelled
+// with at most docTypeLimit distinct document types.
+func NewReplicationMetrics(
+	reg prometheus.Registerer, docTypeLimit int,
+) (*ReplicationMetrics, error) {
+	m := ReplicationMetrics{
+		docTypes: NewDocTypeLabels(docTypeLimit),
+	}
+
+	mh := elephantine.NewMetricsHelper(reg)
+
+	mh.CounterVec(&m.events, prometheus.CounterOpts{
+		Name: "replicant_events_total",
+		Help: "Number of handled eventlog events by event type, document type, and result.",
+	}, []string{"target", "event", "doc_type", "result"})
+
+	mh.CounterVec(&m.attachments, prometheus.CounterOpts{
+		Name: "replicant_attachments_transferred_total",
+		Help: "Number of attachments transferred to the target.",
+	}, []string{"target"})
+
+	mh.CounterVec(&m.transferBytes, prometheus.CounterOpts{
+		Name: "replicant_attachment_bytes_total",
+		Help: "Number of attachment bytes downloaded from the source and uploaded to the target.",
+	}, []string{"target", "direction"})
+
+	mh.HistogramVec(&m.transferTime, prometheus.HistogramOpts{
+		Name:    "replicant_attachment_transfer_duration_seconds",
+		Help:    "Time spent on successful attachment transfer attempts.",
+		Buckets: prometheus.ExponentialBuckets(0.05, 2, 12),
+	}, []string{"target"})
+
+	mh.CounterVec(&m.transferFails, prometheus.CounterOpts{
+		Name: "replicant_attachment_transfer_failures_total",
+		Help: "Number of failed attachment transfer attempts by the stage that failed.",
+	}, []string{"target", "stage"})
+
+	mh.HistogramVec(&m.eventDuration, prometheus.HistogramOpts{
+		Name:    "replicant_event_duration_seconds",
+		Help:    "Time spent handling an eventlog event.",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 12),
+	}, []string{"target", "event"})
+
+	mh.CounterVec(&m.drift, prometheus.CounterOpts{
+		Name: "replicant_drift_detected_total",
+		Help: "Number of documents where the target has drifted from the version mappings.",
+	}, []string{"target", "kind"})
+
+	mh.CounterVec(&m.verified, prometheus.CounterOpts{
+		Name: "replicant_verified_documents_total",
+		Help: "Number of replicated documents that have been verified against the target.",
+	}, []string{"target"})
+
+	mh.CounterVec(&m.verifyScans, prometheus.CounterOpts{
+		Name: "replicant_verification_scans_total",
+		Help: "Number of completed full verification scans.",
+	}, []string{"target"})
+
+	mh.CounterVec(&m.mappingGaps, prometheus.CounterOpts{
+		Name: "replicant_mapping_gaps_total",
+		Help: "Number of statuses skipped because the document version didn't have a version mapping.",
+	}, []string{"target", "kind"})
+
+	mh.CounterVec(&m.fallbackTypes, prometheus.CounterOpts{
+		Name: "replicant_fallback_types_total",
+		Help: "Number of replicated documents without a type that were given the fallback type.",
+	}, []string{"target"})
+
+	mh.CounterVec(&m.noVersions, prometheus.CounterOpts{
+		Name: "replicant_missing_current_versions_total",
+		Help: "Number of documents read while catching up whose source meta had no current version.",
+	}, []string{"target"})
+
+	mh.CounterVec(&m.shadowWrites, prometheus.CounterOpts{
+		Name: "replicant_shadow_writes_total",
+		Help: "Number of writes mirrored to shadow targets by the result of the comparison with the primary write.",
+	}, []string{"target", "result"})
+
+	mh.CounterVec(&m.languages, prometheus.CounterOpts{
+		Name: "replicant_language_changes_total",
+		Help: "Number of replicated document versions that changed the language of the document.",
+	}, []string{"target"})
+
+	mh.GaugeVec(&m.lag, prometheus.GaugeOpts{
+		Name: "replicant_replication_lag_seconds",
+		Help: "Time since the last handled event was emitted, zero when caught up and idle.",
+	}, []string{"target"})
+
+	mh.GaugeVec(&m.position, prometheus.GaugeOpts{
+		Name: "replicant_log_position",
+		Help: "The persisted eventlog position of the target.",
+	}, []string{"target"})
+
+	mh.GaugeVec(&m.caughtUp, prometheus.GaugeOpts{
+		Name: "replicant_caught_up",
+		Help: "Set to one when the persisted log state of the target is caught up.",
+	}, []string{"target"})
+
+	mh.GaugeVec(&m.circuitState, prometheus.GaugeOpts{
+		Name: "replicant_target_circuit_state",
+		Help: "State of the target circuit breaker, zero when closed, one when half-open, and two when open.",
+	}, []string{"target"})
+
+	mh.GaugeVec(&m.paused, prometheus.GaugeOpts{
+		Name: "replicant_target_paused",
+		Help: "Set to one when replication to the target has been paused.",
+	}, []string{"target"})
+
+	if err := mh.Err(); err != nil {
+		return nil, fmt.Errorf("register metrics: %w", err)
+	}
+
+	return &m, nil
+}
+
+func (m *ReplicationMetrics) eventHandled(
+	target string, event string, docType string, result string,
+	duration time.Duration,
+) {
+	if m == nil {
+		return
+	}
+
+	m.events.WithLabelValues(target, event, m.docTypes.Label(docType), result).Inc()
+	m.eventDuration.WithLabelValues(target, event).Observe(duration.Seconds())
+}
+
+func (m *ReplicationMetrics) replicationLag(target string, lag time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.lag.WithLabelValues(target).Set(max(lag, 0).Seconds())
+}
+
+// statePersisted tracks the log state that has been committed for the target.
+func (m *ReplicationMetrics) statePersisted(target string, state LogState) {
+	if m == nil {
+		return
+	}
+
+	var caughtUp float64
+
+	if state.CaughtUp {
+		caughtUp = 1
+	}
+
+	m.position.WithLabelValues(target).Set(float64(state.Position))
+	m.caughtUp.WithLabelValues(target).Set(caughtUp)
+}
+
+func (m *ReplicationMetrics) circuitStateChanged(target string, state CircuitState) {
+	if m == nil {
+		return
+	}
+
+	m.circuitState.WithLabelValues(target).Set(float64(state))
+}
+
+func (m *ReplicationMetrics) targetPaused(target string, paused bool) {
+	if m == nil {
+		return
+	}
+
+	var value float64
+
+	if paused {
+		value = 1
+	}
+
+	m.paused.WithLabelValues(target).Set(value)
+}
+
+func (m *ReplicationMetrics) driftDetected(target string, kind string) {
+	if m == nil {
+		return
+	}
+
+	m.drift.WithLabelValues(target, kind).Inc()
+}
+
+func (m *ReplicationMetrics) documentVerified(target string) {
+	if m == nil {
+		return
+	}
+
+	m.verified.WithLabelValues(target).Inc()
+}
+
+func (m *ReplicationMetrics) verificationScanCompleted(target string) {
+	if m == nil {
+		return
+	}
+
+	m.verifyScans.WithLabelValues(target).Inc()
+}
+
+func (m *ReplicationMetrics) mappingGap(target string, kind string) {
+	if m == nil {
+		return
+	}
+
+	m.mappingGaps.WithLabelValues(target, kind).Inc()
+}
+
+func (m *ReplicationMetrics) fallbackTypeUsed(target string) {
+	if m == nil {
+		return
+	}
+
+	m.fallbackTypes.WithLabelValues(target).Inc()
+}
+
+func (m *ReplicationMetrics) missingCurrentVersion(target string) {
+	if m == nil {
+		return
+	}
+
+	m.noVersions.WithLabelValues(target).Inc()
+}
+
+func (m *ReplicationMetrics) shadowWrite(target string, result ShadowResult) {
+	if m == nil {
+		return
+	}
+
+	m.shadowWrites.WithLabelValues(target, string(result)).Inc()
+}
+
+func (m *ReplicationMetrics) languageChanged(target string) {
+	if m == nil {
+		return
+	}
+
+	m.languages.WithLabelValues(target).Inc()
+}
+
+func (m *ReplicationMetrics) attachmentTransferred(target string) {
+	if m == nil {
+		return
+	}
+
+	m.attachments.WithLabelValues(target).Inc()
+}
+
+func (m *ReplicationMetrics) attachmentBytes(
+	target string, downloaded int64, uploaded int64,
+) {
+	if m == nil {
+		return
+	}
+
+	m.transferBytes.WithLabelValues(target, stageDownload).Add(float64(downloaded))
+	m.transferBytes.WithLabelValues(target, stageUpload).Add(float64(uploaded))
+}
+
+func (m *ReplicationMetrics) attachmentTransferTime(
+	target string, duration time.Duration,
+) {
+	if m == nil {
+		return
+	}
+
+	m.transferTime.WithLabelValues(target).Observe(duration.Seconds())
+}
+
+func (m *ReplicationMetrics) attachmentTransferFailed(target string, stage string) {
+	if m == nil {
+		return
+	}
+
+	m.transferFails.WithLabelValues(target, stage).Inc()
+}
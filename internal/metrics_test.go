@@ -0,0 +1,28 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/ttab/elephant-replicant/internal"
+)
+
+func TestDocTypeLabels(t *testing.T) {
+	labels := internal.NewDocTypeLabels(2)
+
+	cases := []struct {
+		docType string
+		want    string
+	}{
+		{"core/article", "core/article"},
+		{"core/image", "core/image"},
+		{"core/event", internal.OtherDocType},
+		{"core/article", "core/article"},
+		{"", internal.OtherDocType},
+	}
+
+	for _, c := range cases {
+		if got := labels.Label(c.docType); got != c.want {
+			t.Errorf("label for %q: got %q, want %q", c.docType, got, c.want)
+		}
+	}
+}
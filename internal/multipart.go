@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephantine"
+)
+
+// MultipartUploads controls when attachments are uploaded in parts to sinks
+// that implement MultipartSink.
+type MultipartUploads struct {
+	// Threshold is the size in bytes from which attachments are uploaded
+	// in parts. Zero disables multipart uploads.
+	Threshold int64
+	// PartSize is the size in bytes of the uploaded parts. Every upload
+	// buffers one part in memory.
+	PartSize int64
+}
+
+// Use returns true if an attachment of the given size should be uploaded in
+// parts. Attachments of unknown size are uploaded with a single PUT.
+func (mu MultipartUploads) Use(size int64) bool {
+	return mu.Threshold > 0 && mu.PartSize > 0 && size >= mu.Threshold
+}
+
+// abortTimeout is how long we wait for a failed multipart upload to be
+// aborted.
+const abortTimeout = 30 * time.Second
+
+// multipartUpload uploads the downloaded attachment in parts, every part is
+// retried on its own. The parts are read from content, which is the download
+// body, or the decompressed body for compressed downloads. The upload is
+// aborted if it fails so that no incomplete objects are left in the target.
+func (w *Worker) multipartUpload(
+	ctx context.Context, obj *repository.AttachmentDetails,
+	res *http.Response, body *transferReader, content *transferReader,
+	stage *string,
+) (_ string, outErr error) {
+	upload, err := w.multipart.CreateMultipartUpload(ctx, &repository.CreateUploadRequest{
+		Name:        obj.Filename,
+		ContentType: w.contentTypes.Apply(obj.Filename, obj.ContentType),
+		Meta:        AttachmentMeta(res.Header),
+	})
+	if err != nil {
+		return "", fmt.Errorf("create multipart upload: %w", err)
+	}
+
+	defer func() {
+		if outErr == nil {
+			return
+		}
+
+		abortCtx, cancel := context.WithTimeout(
+			context.WithoutCancel(ctx), abortTimeout)
+		defer cancel()
+
+		err := upload.Abort(abortCtx)
+		if err != nil {
+			w.logger.ErrorContext(ctx, "failed to abort multipart upload",
+				"upload_id", upload.ID(),
+				elephantine.LogKeyError, err)
+		}
+	}()
+
+	buf := make([]byte, w.multipartUploads.PartSize)
+
+	for number := 1; ; number++ {
+		*stage = stageDownload
+
+		n, readErr := io.ReadFull(content, buf)
+		if readErr != nil &&
+			!errors.Is(readErr, io.EOF) && !errors.Is(readErr, io.ErrUnexpectedEOF) {
+			if err := limitErr(body, content); err != nil {
+				return "", err
+			}
+
+			return "", Retryable(fmt.Errorf("read attachment: %w", readErr))
+		}
+
+		if n > 0 {
+			*stage = stageUpload
+
+			part := buf[:n]
+
+			err := w.attachmentRetry.Do(ctx, w.logger, "upload attachment part",
+				func(ctx context.Context) error {
+					return upload.UploadPart(ctx, number, part)
+				})
+			if err != nil {
+				return "", fmt.Errorf("upload part %d: %w", number, err)
+			}
+		}
+
+		if readErr != nil {
+			break
+		}
+	}
+
+	if w.verifyAttachments {
+		err := body.Verify(res)
+		if err != nil {
+			return "", Retryable(fmt.Errorf("verify transfer: %w", err))
+		}
+	}
+
+	err = upload.Complete(ctx)
+	if err != nil {
+		return "", fmt.Errorf("complete multipart upload: %w", err)
+	}
+
+	return upload.ID(), nil
+}
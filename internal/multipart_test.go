@@ -0,0 +1,31 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/ttab/elephant-replicant/internal"
+)
+
+func TestMultipartUploadsUse(t *testing.T) {
+	mu := internal.MultipartUploads{
+		Threshold: 100,
+		PartSize:  10,
+	}
+
+	cases := map[int64]bool{
+		-1:  false,
+		99:  false,
+		100: true,
+		500: true,
+	}
+
+	for size, want := range cases {
+		if got := mu.Use(size); got != want {
+			t.Errorf("Use(%d) = %v, want %v", size, got, want)
+		}
+	}
+
+	if (internal.MultipartUploads{}).Use(500) {
+		t.Error("expected multipart uploads to be disabled by default")
+	}
+}
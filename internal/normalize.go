@@ -0,0 +1,187 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+
+	rpc_newsdoc "github.com/ttab/elephant-api/newsdoc"
+	"google.golang.org/protobuf/proto"
+)
+
+// Normalization actions.
+const (
+	// NormalizeSort sorts the blocks of a kind, so that their order isn't
+	// compared.
+	NormalizeSort = "sort"
+	// NormalizeWhitespace trims text fields and collapses runs of
+	// whitespace into a single space.
+	NormalizeWhitespace = "whitespace"
+)
+
+// NormalizeRule canonicalizes a part of the documents of a type before they
+// are compared. A DocType of "*" applies the rule to all document types.
+type NormalizeRule struct {
+	DocType string
+	Action  string
+	// Kind is the kind of blocks that are sorted, only used by sort rules.
+	Kind BlockKind
+	// Spec is the rule in the format it was parsed from.
+	Spec string
+}
+
+// CompareNormalization is applied to both the expected and the actual
+// document when comparing a document in the source with the target, so that
+// differences that the target introduces when it normalizes documents aren't
+// reported. Unlike the transform pipeline it never changes what is written to
+// the target.
+type CompareNormalization struct {
+	Rules []NormalizeRule
+}
+
+// Normalize returns a normalized copy of the document, the document itself is
+// left unchanged. Rules are matched against the type of the document, and
+// applied recursively to nested blocks.
+func (n CompareNormalization) Normalize(
+	doc *rpc_newsdoc.Document,
+) *rpc_newsdoc.Document {
+	if doc == nil {
+		return nil
+	}
+
+	var (
+		sortKinds  []BlockKind
+		whitespace bool
+	)
+
+	for _, r := range n.Rules {
+		if r.DocType != "*" && r.DocType != doc.Type {
+			continue
+		}
+
+		switch r.Action {
+		case NormalizeSort:
+			sortKinds = append(sortKinds, r.Kind)
+		case NormalizeWhitespace:
+			whitespace = true
+		}
+	}
+
+	if len(sortKinds) == 0 && !whitespace {
+		return doc
+	}
+
+	norm := docNormalizer{
+		sort:       sortKinds,
+		whitespace: whitespace,
+	}
+
+	doc = proto.CloneOf(doc)
+
+	if whitespace {
+		doc.Title = collapseSpace(doc.Title)
+	}
+
+	doc.Meta = norm.blocks(doc.Meta, BlockKindMeta)
+	doc.Links = norm.blocks(doc.Links, BlockKindLink)
+	doc.Content = norm.blocks(doc.Content, BlockKindContent)
+
+	return doc
+}
+
+type docNormalizer struct {
+	sort       []BlockKind
+	whitespace bool
+}
+
+func (n docNormalizer) blocks(
+	blocks []*rpc_newsdoc.Block, kind BlockKind,
+) []*rpc_newsdoc.Block {
+	for _, b := range blocks {
+		if n.whitespace {
+			b.Title = collapseSpace(b.Title)
+			b.Value = collapseSpace(b.Value)
+
+			for k, v := range b.Data {
+				b.Data[k] = collapseSpace(v)
+			}
+		}
+
+		b.Meta = n.blocks(b.Meta, BlockKindMeta)
+		b.Links = n.blocks(b.Links, BlockKindLink)
+		b.Content = n.blocks(b.Content, BlockKindContent)
+	}
+
+	if !slices.Contains(n.sort, kind) || len(blocks) < 2 {
+		return blocks
+	}
+
+	// Nested blocks have already been normalized, so the marshalled
+	// blocks can be used as sort keys.
+	keys := make(map[*rpc_newsdoc.Block][]byte, len(blocks))
+
+	for _, b := range blocks {
+		key, err := proto.MarshalOptions{Deterministic: true}.Marshal(b)
+		if err != nil {
+			// Leave the order as is, the comparison will
+			// report the difference.
+			return blocks
+		}
+
+		keys[b] = key
+	}
+
+	slices.SortStableFunc(blocks, func(a, b *rpc_newsdoc.Block) int {
+		return bytes.Compare(keys[a], keys[b])
+	})
+
+	return blocks
+}
+
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// ParseNormalizeRules parses comparison normalization rules in the format
+// "[doc type]:sort:[kind]", where kind is one of "meta", "link", or "content",
+// or "[doc type]:whitespace". F.ex. "*:sort:link" ignores the order of links
+// in all documents.
+func ParseNormalizeRules(specs []string) (CompareNormalization, error) {
+	var n CompareNormalization
+
+	for _, spec := range specs {
+		parts := strings.Split(spec, ":")
+		if len(parts) < 2 || parts[0] == "" {
+			return CompareNormalization{}, fmt.Errorf(
+				"invalid normalization rule %q", spec)
+		}
+
+		rule := NormalizeRule{
+			DocType: parts[0],
+			Action:  parts[1],
+			Spec:    spec,
+		}
+
+		switch {
+		case rule.Action == NormalizeSort && len(parts) == 3:
+			rule.Kind = BlockKind(parts[2])
+
+			switch rule.Kind {
+			case BlockKindMeta, BlockKindLink, BlockKindContent:
+			default:
+				return CompareNormalization{}, fmt.Errorf(
+					"invalid block kind %q in normalization rule %q",
+					parts[2], spec)
+			}
+		case rule.Action == NormalizeWhitespace && len(parts) == 2:
+		default:
+			return CompareNormalization{}, fmt.Errorf(
+				"invalid normalization rule %q", spec)
+		}
+
+		n.Rules = append(n.Rules, rule)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,96 @@
+package internal_test
+
+import (
+	"testing"
+
+	rpc_newsdoc "github.com/ttab/elephant-api/newsdoc"
+	"github.com/ttab/elephant-replicant/internal"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestCompareNormalization(t *testing.T) {
+	n, err := internal.ParseNormalizeRules([]string{
+		"*:sort:link",
+		"core/article:whitespace",
+	})
+	if err != nil {
+		t.Fatalf("parse rules: %v", err)
+	}
+
+	source := &rpc_newsdoc.Document{
+		Type:  "core/article",
+		Title: "A  title ",
+		Links: []*rpc_newsdoc.Block{
+			{Rel: "subject", Uri: "core://b"},
+			{Rel: "subject", Uri: "core://a"},
+		},
+		Content: []*rpc_newsdoc.Block{
+			{Type: "core/text", Data: map[string]string{"text": " Some\ntext"}},
+			{Type: "core/heading", Data: map[string]string{"text": "Heading"}},
+		},
+	}
+
+	target := &rpc_newsdoc.Document{
+		Type:  "core/article",
+		Title: "A title",
+		Links: []*rpc_newsdoc.Block{
+			{Rel: "subject", Uri: "core://a"},
+			{Rel: "subject", Uri: "core://b"},
+		},
+		Content: []*rpc_newsdoc.Block{
+			{Type: "core/text", Data: map[string]string{"text": "Some text"}},
+			{Type: "core/heading", Data: map[string]string{"text": "Heading"}},
+		},
+	}
+
+	original := proto.CloneOf(source)
+
+	diff, err := internal.CompareDocuments(n.Normalize(source), n.Normalize(target))
+	if err != nil {
+		t.Fatalf("compare documents: %v", err)
+	}
+
+	if len(diff) != 0 {
+		t.Errorf("expected the normalized documents to be identical, got %v", diff)
+	}
+
+	if !proto.Equal(source, original) {
+		t.Error("expected the source document to be left unchanged")
+	}
+
+	// The content order is still compared.
+	target.Content[0], target.Content[1] = target.Content[1], target.Content[0]
+
+	diff, err = internal.CompareDocuments(n.Normalize(source), n.Normalize(target))
+	if err != nil {
+		t.Fatalf("compare documents: %v", err)
+	}
+
+	if len(diff) != 1 || diff[0].Field != "document.content" {
+		t.Errorf("expected a content difference, got %v", diff)
+	}
+
+	// Whitespace is only normalized for articles.
+	other := &rpc_newsdoc.Document{Type: "core/image", Title: " Image "}
+
+	if got := n.Normalize(other).Title; got != " Image " {
+		t.Errorf("expected the image title to be left as is, got %q", got)
+	}
+}
+
+func TestParseNormalizeRulesInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"*",
+		"*:sort",
+		"*:sort:block",
+		"*:whitespace:link",
+		"*:reorder:link",
+		":whitespace",
+	} {
+		_, err := internal.ParseNormalizeRules([]string{spec})
+		if err == nil {
+			t.Errorf("expected %q to be rejected", spec)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/postgres"
+	"github.com/ttab/elephantine"
+	"github.com/ttab/elephantine/pg"
+	"github.com/twitchtv/twirp"
+)
+
+// ErrOversized is returned when the target rejected a document because it's
+// larger than the target accepts.
+var ErrOversized = errors.New("document exceeds the target size limit")
+
+// OversizePolicy controls what happens when the target rejects a document
+// because of its size.
+type OversizePolicy string
+
+const (
+	// OversizeFail handles the rejection like any other error.
+	OversizeFail OversizePolicy = "fail"
+	// OversizeSkip records the event as a replication error and moves on.
+	OversizeSkip OversizePolicy = "skip"
+	// OversizeReduce removes the blocks matched by the reduction rules and
+	// retries the update. The event is skipped and recorded if the
+	// document still is too large.
+	OversizeReduce OversizePolicy = "reduce"
+)
+
+// ParseOversizePolicy parses an oversize policy, an empty value is treated as
+// OversizeFail.
+func ParseOversizePolicy(s string) (OversizePolicy, error) {
+	switch p := OversizePolicy(s); p {
+	case "":
+		return OversizeFail, nil
+	case OversizeFail, OversizeSkip, OversizeReduce:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown oversize policy %q", s)
+	}
+}
+
+// OversizeHandling configures the handling of documents that are too large for
+// the target.
+type OversizeHandling struct {
+	Policy OversizePolicy
+	// Reduce are the blocks that are removed from oversized documents
+	// with the reduce policy.
+	Reduce BlockStripper
+}
+
+// IsSizeLimitError returns true if the target rejected the request because of
+// its size. That's either a 413 response from a proxy in front of the target,
+// or a resource exhausted error from the target itself. Too many requests
+// responses from proxies are reported as resource exhausted as well, and
+// aren't size limit errors.
+func IsSizeLimitError(err error) bool {
+	var twErr twirp.Error
+
+	if !errors.As(err, &twErr) {
+		return false
+	}
+
+	if twErr.Meta("http_error_from_intermediary") == "true" {
+		return twErr.Meta("status_code") == "413"
+	}
+
+	return twErr.Code() == twirp.ResourceExhausted
+}
+
+// reduceOversized removes blocks from a document that was rejected because of
+// its size. Returns false if no blocks could be removed.
+func (w *Worker) reduceOversized(
+	ctx context.Context, evt *repository.EventlogItem,
+	update *repository.UpdateRequest,
+) bool {
+	if w.oversize.Policy != OversizeReduce || update.Document == nil {
+		return false
+	}
+
+	removed := w.oversize.Reduce.Strip(update.Document)
+	if removed == 0 {
+		return false
+	}
+
+	w.logger.WarnContext(ctx, "removed blocks from oversized document",
+		elephantine.LogKeyEventID, evt.Id,
+		elephantine.LogKeyDocumentUUID, evt.Uuid,
+		"blocks", removed,
+	)
+
+	return true
+}
+
+// recordOversized records a skipped oversized document as a replication error
+// so that it can be reviewed.
+func (w *Worker) recordOversized(
+	ctx context.Context, evt *repository.EventlogItem, oversizeErr error,
+) error {
+	docUUID, err := uuid.Parse(evt.Uuid)
+	if err != nil {
+		return fmt.Errorf("invalid document UUID: %w", err)
+	}
+
+	err = postgres.New(w.db).AddReplicationError(ctx,
+		postgres.AddReplicationErrorParams{
+			TargetName: w.name,
+			Shard:      w.shard,
+			EventID:    evt.Id,
+			ID:         docUUID,
+			EventType:  evt.Event,
+			Error:      oversizeErr.Error(),
+			Attempts:   1,
+			Created:    pg.Time(time.Now()),
+		})
+	if err != nil {
+		return fmt.Errorf("record replication error: %w", err)
+	}
+
+	w.logger.WarnContext(ctx, "skipped document that is too large for the target",
+		elephantine.LogKeyEventID, evt.Id,
+		elephantine.LogKeyEventType, evt.Event,
+		elephantine.LogKeyDocumentUUID, evt.Uuid,
+		elephantine.LogKeyError, oversizeErr,
+	)
+
+	return nil
+}
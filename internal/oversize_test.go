@@ -0,0 +1,60 @@
+package internal_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ttab/elephant-replicant/internal"
+	"github.com/twitchtv/twirp"
+)
+
+func TestIsSizeLimitError(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"resource exhausted", twirp.NewError(twirp.ResourceExhausted, "too large"), true},
+		{
+			"proxy 413",
+			twirp.NewError(twirp.Unknown, "too large").
+				WithMeta("http_error_from_intermediary", "true").
+				WithMeta("status_code", "413"),
+			true,
+		},
+		{
+			"proxy 429",
+			twirp.NewError(twirp.ResourceExhausted, "slow down").
+				WithMeta("http_error_from_intermediary", "true").
+				WithMeta("status_code", "429"),
+			false,
+		},
+		{"wrapped", fmt.Errorf("update: %w", twirp.NewError(twirp.ResourceExhausted, "")), true},
+		{"other", twirp.NewError(twirp.InvalidArgument, "bad"), false},
+		{"plain", errors.New("failed"), false},
+	}
+
+	for _, c := range cases {
+		if got := internal.IsSizeLimitError(c.err); got != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestParseOversizePolicy(t *testing.T) {
+	p, err := internal.ParseOversizePolicy("")
+	if err != nil || p != internal.OversizeFail {
+		t.Errorf("expected the empty policy to fail, got %q, %v", p, err)
+	}
+
+	p, err = internal.ParseOversizePolicy("reduce")
+	if err != nil || p != internal.OversizeReduce {
+		t.Errorf("got %q, %v", p, err)
+	}
+
+	_, err = internal.ParseOversizePolicy("truncate")
+	if err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+}
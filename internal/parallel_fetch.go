@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephantine"
+	"github.com/twitchtv/twirp"
+	"golang.org/x/sync/errgroup"
+)
+
+// sourceDocument reads a version of a document from the source, version zero
+// reads the current version.
+func (w *Worker) sourceDocument(
+	ctx context.Context, docUUID string, version int64,
+) (*repository.GetDocumentResponse, error) {
+	fetchCtx, span := w.tracer.Start(ctx, "get source document")
+
+	res, err := w.source.Get(fetchCtx, &repository.GetDocumentRequest{
+		Uuid:    docUUID,
+		Version: version,
+	})
+
+	endSpan(span, err)
+
+	if elephantine.IsTwirpErrorCode(err, twirp.NotFound) {
+		return nil, fmt.Errorf("document not found: %w", ErrSkipped)
+	} else if err != nil {
+		return nil, fmt.Errorf("get source document: %w", err)
+	}
+
+	return res, nil
+}
+
+// prefetchCurrent starts reading the current version of a document, so that
+// the read overlaps with the meta read when catching up. The returned function
+// waits for the read to finish. It returns nil if the read failed, the version
+// is then read again after the meta.
+func (w *Worker) prefetchCurrent(
+	ctx context.Context, docUUID string,
+) func() *repository.GetDocumentResponse {
+	var (
+		res  *repository.GetDocumentResponse
+		done = make(chan struct{})
+	)
+
+	go func() {
+		defer close(done)
+
+		r, err := w.sourceDocument(ctx, docUUID, 0)
+		if err != nil {
+			return
+		}
+
+		res = r
+	}()
+
+	return func() *repository.GetDocumentResponse {
+		<-done
+
+		return res
+	}
+}
+
+// runFetches runs the source reads for an update, concurrently if parallel
+// fetching is enabled, and in order otherwise. Returns the first error.
+func (w *Worker) runFetches(
+	ctx context.Context, fetches []func(ctx context.Context) error,
+) error {
+	if !w.parallelFetch {
+		for _, fetch := range fetches {
+			err := fetch(ctx)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	grp, gCtx := errgroup.WithContext(ctx)
+
+	for _, fetch := range fetches {
+		grp.Go(func() error {
+			return fetch(gCtx)
+		})
+	}
+
+	return grp.Wait() //nolint: wrapcheck
+}
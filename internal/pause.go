@@ -0,0 +1,178 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/ttab/elephant-replicant/postgres"
+)
+
+// PauseState is the persisted pause state of a target.
+type PauseState struct {
+	Paused bool
+}
+
+func pauseStateKey(target string) string {
+	return target + ":paused"
+}
+
+// PauseGate blocks replication at batch boundaries while it's paused. The
+// zero value is resumed, and a nil gate is never paused.
+type PauseGate struct {
+	mu      sync.Mutex
+	resumed chan struct{}
+	halted  int
+}
+
+// Set pauses or resumes the gate, and returns true if that changed the state.
+func (g *PauseGate) Set(paused bool) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	switch {
+	case paused && g.resumed == nil:
+		g.resumed = make(chan struct{})
+	case !paused && g.resumed != nil:
+		close(g.resumed)
+
+		g.resumed = nil
+	default:
+		return false
+	}
+
+	return true
+}
+
+// Paused returns true if the gate is paused.
+func (g *PauseGate) Paused() bool {
+	if g == nil {
+		return false
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.resumed != nil
+}
+
+// Halted returns true if replication is blocked by the gate.
+func (g *PauseGate) Halted() bool {
+	if g == nil {
+		return false
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.halted > 0
+}
+
+// Wait blocks until the gate is resumed or the context is done.
+func (g *PauseGate) Wait(ctx context.Context) error {
+	if g == nil {
+		return nil
+	}
+
+	g.mu.Lock()
+
+	resumed := g.resumed
+	if resumed == nil {
+		g.mu.Unlock()
+
+		return nil
+	}
+
+	g.halted++
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		g.halted--
+		g.mu.Unlock()
+	}()
+
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err() //nolint: wrapcheck
+	}
+}
+
+// waitWhilePaused blocks replication while the target is paused. Shutdown
+// isn't held up by a paused target.
+func (w *Worker) waitWhilePaused(ctx context.Context) error {
+	if !w.pause.Paused() {
+		return nil
+	}
+
+	w.logger.InfoContext(ctx, "replication paused")
+
+	waitCtx, cancel := w.readContext(ctx)
+	defer cancel()
+
+	err := w.pause.Wait(waitCtx)
+	if err != nil && ctx.Err() == nil && w.stopRequested() {
+		return errStopped
+	} else if err != nil {
+		return fmt.Errorf("wait for resume: %w", err)
+	}
+
+	w.logger.InfoContext(ctx, "replication resumed")
+
+	return nil
+}
+
+// targetPause returns the pause gate of a target. Gates are kept per target so
+// that worker restarts don't resume replication.
+func (tm *TargetManager) targetPause(name string) *PauseGate {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	gate, ok := tm.pauses[name]
+	if !ok {
+		gate = &PauseGate{}
+		tm.pauses[name] = gate
+	}
+
+	return gate
+}
+
+// setPaused pauses or resumes replication to a target in this process.
+func (tm *TargetManager) setPaused(name string, paused bool) {
+	if !tm.targetPause(name).Set(paused) {
+		return
+	}
+
+	tm.opts.Metrics.targetPaused(name, paused)
+
+	tm.logger.Info("changed target pause state",
+		"target", name,
+		"paused", paused)
+}
+
+// loadPauseState applies the persisted pause state of a target, so that a
+// paused target stays paused when the process is restarted.
+func (tm *TargetManager) loadPauseState(ctx context.Context, name string) error {
+	var state PauseState
+
+	err := LoadState(ctx, postgres.New(tm.db), pauseStateKey(name), &state)
+	if err != nil {
+		return fmt.Errorf("load pause state: %w", err)
+	}
+
+	tm.setPaused(name, state.Paused)
+
+	return nil
+}
+
+// TargetHalted returns true if replication to the target is blocked at a
+// batch boundary in this process because the target is paused.
+func (tm *TargetManager) TargetHalted(name string) bool {
+	tm.mu.Lock()
+	gate := tm.pauses[name]
+	tm.mu.Unlock()
+
+	return gate.Halted()
+}
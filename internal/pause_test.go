@@ -0,0 +1,66 @@
+package internal_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ttab/elephant-replicant/internal"
+)
+
+func TestPauseGate(t *testing.T) {
+	var gate internal.PauseGate
+
+	if err := gate.Wait(t.Context()); err != nil {
+		t.Fatalf("expected a resumed gate not to block: %v", err)
+	}
+
+	if !gate.Set(true) {
+		t.Fatal("expected pausing to change the state")
+	}
+
+	if gate.Set(true) {
+		t.Error("expected pausing a paused gate not to change the state")
+	}
+
+	if !gate.Paused() {
+		t.Error("expected the gate to be paused")
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+	defer cancel()
+
+	err := gate.Wait(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a paused gate to block until the deadline, got %v", err)
+	}
+
+	done := make(chan error)
+
+	go func() {
+		done <- gate.Wait(t.Context())
+	}()
+
+	for !gate.Halted() {
+		time.Sleep(time.Millisecond)
+	}
+
+	if !gate.Set(false) {
+		t.Fatal("expected resuming to change the state")
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("expected resuming to release the wait: %v", err)
+	}
+
+	if gate.Halted() || gate.Paused() {
+		t.Error("expected the gate to be resumed")
+	}
+
+	var nilGate *internal.PauseGate
+
+	if nilGate.Paused() || nilGate.Wait(t.Context()) != nil {
+		t.Error("expected a nil gate never to be paused")
+	}
+}
@@ -0,0 +1,31 @@
+package internal
+
+import "errors"
+
+// errPollRequested is the cancellation cause of an eventlog read that was
+// interrupted to poll the eventlog again right away.
+var errPollRequested = errors.New("immediate poll requested")
+
+// RequestPoll makes the worker poll the eventlog right away instead of waiting
+// for new events. A request made while the worker is handling events makes
+// the next wait return immediately. Returns false if a poll already has been
+// requested.
+func (w *Worker) RequestPoll() bool {
+	select {
+	case w.poll <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// pollWorker requests an immediate poll from the worker of the named target,
+// if it's replicating in this process.
+func (tm *TargetManager) pollWorker(name string) {
+	w, ok := tm.ActiveWorker(name)
+	if !ok {
+		return
+	}
+
+	w.RequestPoll()
+}
@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ttab/elephant-api/repository"
+)
+
+// Provenance fields that can be added to the meta of replicated versions and
+// deletes.
+const (
+	ProvenanceEvent   = "event"
+	ProvenanceSource  = "source"
+	ProvenanceTime    = "time"
+	ProvenanceUpdater = "updater"
+	ProvenanceVersion = "version"
+)
+
+// ProvenanceMeta adds meta data about where replicated documents came from to
+// the versions and deletes written to the target. The meta keys are chosen by
+// the operator, fields without a key aren't added. A zero ProvenanceMeta
+// doesn't add any meta data.
+type ProvenanceMeta struct {
+	// EventKey is the key for the ID of the source event.
+	EventKey string
+	// SourceKey is the key for the URL of the source repository.
+	SourceKey string
+	// TimeKey is the key for the time that the change was replicated.
+	TimeKey string
+	// UpdaterKey is the key for the URI of the client that made the
+	// change in the source.
+	UpdaterKey string
+	// VersionKey is the key for the source version of the document.
+	VersionKey string
+	// Source is the URL of the source repository.
+	Source string
+}
+
+// ParseProvenanceMeta parses provenance fields in the format "[field]=[key]",
+// f.ex. "event=replicant_event_id". The fields are "event", "source", "time",
+// "updater", and "version".
+func ParseProvenanceMeta(specs []string, source string) (ProvenanceMeta, error) {
+	pm := ProvenanceMeta{
+		Source: source,
+	}
+
+	keys := make(map[string]bool)
+
+	for _, s := range specs {
+		field, key, ok := strings.Cut(s, "=")
+		if !ok || key == "" {
+			return ProvenanceMeta{}, fmt.Errorf(
+				"invalid provenance meta %q", s)
+		}
+
+		if keys[key] || key == deleteRecordMetaKey {
+			return ProvenanceMeta{}, fmt.Errorf(
+				"provenance meta key %q is already in use", key)
+		}
+
+		keys[key] = true
+
+		switch field {
+		case ProvenanceEvent:
+			pm.EventKey = key
+		case ProvenanceSource:
+			pm.SourceKey = key
+		case ProvenanceTime:
+			pm.TimeKey = key
+		case ProvenanceUpdater:
+			pm.UpdaterKey = key
+		case ProvenanceVersion:
+			pm.VersionKey = key
+		default:
+			return ProvenanceMeta{}, fmt.Errorf(
+				"unknown provenance field %q", field)
+		}
+	}
+
+	return pm, nil
+}
+
+// IsZero returns true if no provenance meta is added.
+func (pm ProvenanceMeta) IsZero() bool {
+	return pm.EventKey == "" && pm.SourceKey == "" && pm.TimeKey == "" &&
+		pm.UpdaterKey == "" && pm.VersionKey == ""
+}
+
+// Apply adds the provenance meta for the event to the meta data. Keys that
+// already are set, f.ex. by replicated version meta data, are left as they
+// are.
+func (pm ProvenanceMeta) Apply(
+	meta map[string]string, evt *repository.EventlogItem, now time.Time,
+) map[string]string {
+	if pm.IsZero() {
+		return meta
+	}
+
+	if meta == nil {
+		meta = make(map[string]string)
+	}
+
+	set := func(key, value string) {
+		if key == "" || value == "" {
+			return
+		}
+
+		if _, exists := meta[key]; exists {
+			return
+		}
+
+		meta[key] = value
+	}
+
+	set(pm.EventKey, strconv.FormatInt(evt.Id, 10))
+	set(pm.SourceKey, pm.Source)
+	set(pm.TimeKey, now.UTC().Format(time.RFC3339))
+	set(pm.UpdaterKey, evt.UpdaterUri)
+
+	if evt.Version > 0 {
+		set(pm.VersionKey, strconv.FormatInt(evt.Version, 10))
+	}
+
+	return meta
+}
@@ -0,0 +1,69 @@
+package internal_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/internal"
+)
+
+func TestProvenanceMetaApply(t *testing.T) {
+	pm, err := internal.ParseProvenanceMeta([]string{
+		"event=replicant_event",
+		"source=replicant_source",
+		"time=replicant_time",
+		"updater=replicant_updater",
+		"version=replicant_version",
+	}, "https://repository.example.com")
+	if err != nil {
+		t.Fatalf("parse provenance meta: %v", err)
+	}
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	meta := pm.Apply(map[string]string{
+		"replicant_time": "set by the application",
+	}, &repository.EventlogItem{
+		Id:         42,
+		Version:    3,
+		UpdaterUri: "core://user/1",
+	}, now)
+
+	want := map[string]string{
+		"replicant_event":   "42",
+		"replicant_source":  "https://repository.example.com",
+		"replicant_time":    "set by the application",
+		"replicant_updater": "core://user/1",
+		"replicant_version": "3",
+	}
+
+	for k, v := range want {
+		if meta[k] != v {
+			t.Errorf("got %q for %q, want %q", meta[k], k, v)
+		}
+	}
+}
+
+func TestProvenanceMetaZero(t *testing.T) {
+	var pm internal.ProvenanceMeta
+
+	if meta := pm.Apply(nil, &repository.EventlogItem{Id: 1}, time.Now()); meta != nil {
+		t.Errorf("expected no meta, got %v", meta)
+	}
+}
+
+func TestParseProvenanceMetaInvalid(t *testing.T) {
+	for _, specs := range [][]string{
+		{"event"},
+		{"event="},
+		{"commit=replicant_commit"},
+		{"event=replicant", "time=replicant"},
+		{"event=original_delete_record"},
+	} {
+		_, err := internal.ParseProvenanceMeta(specs, "")
+		if err == nil {
+			t.Errorf("expected an error for %q", specs)
+		}
+	}
+}
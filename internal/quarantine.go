@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/postgres"
+	"github.com/ttab/elephantine"
+	"github.com/ttab/elephantine/pg"
+)
+
+// eventFailures tracks consecutive failures to handle the same event. It's
+// owned by the target worker so that the count survives worker restarts.
+type eventFailures struct {
+	eventID int64
+	count   int
+}
+
+// Fail registers a failure for the event and returns the number of consecutive
+// failures for it.
+func (ef *eventFailures) Fail(eventID int64) int {
+	if ef.eventID != eventID {
+		ef.eventID = eventID
+		ef.count = 0
+	}
+
+	ef.count++
+
+	return ef.count
+}
+
+// Reset clears the failure count.
+func (ef *eventFailures) Reset() {
+	ef.eventID = 0
+	ef.count = 0
+}
+
+// quarantine registers a failure to handle the event, and records it in the
+// replication errors table once the quarantine threshold has been reached.
+// Returns true if the event was quarantined and replication should move past
+// it.
+func (w *Worker) quarantine(
+	ctx context.Context, evt *repository.EventlogItem, handleErr error,
+) (bool, error) {
+	if w.quarantineThreshold <= 0 || w.failures == nil {
+		return false, nil
+	}
+
+	attempts := w.failures.Fail(evt.Id)
+	if attempts < w.quarantineThreshold {
+		return false, nil
+	}
+
+	docUUID, err := uuid.Parse(evt.Uuid)
+	if err != nil {
+		return false, fmt.Errorf("invalid document UUID: %w", err)
+	}
+
+	err = postgres.New(w.db).AddReplicationError(ctx,
+		postgres.AddReplicationErrorParams{
+			TargetName: w.name,
+			Shard:      w.shard,
+			EventID:    evt.Id,
+			ID:         docUUID,
+			EventType:  evt.Event,
+			Error:      handleErr.Error(),
+			Attempts:   int32(attempts), //nolint: gosec
+			Created:    pg.Time(time.Now()),
+		})
+	if err != nil {
+		return false, fmt.Errorf("record replication error: %w", err)
+	}
+
+	w.failures.Reset()
+
+	w.logger.Error("quarantined document after repeated failures",
+		elephantine.LogKeyEventID, evt.Id,
+		elephantine.LogKeyEventType, evt.Event,
+		elephantine.LogKeyDocumentUUID, evt.Uuid,
+		"attempts", attempts,
+		elephantine.LogKeyError, handleErr,
+	)
+
+	return true, nil
+}
@@ -0,0 +1,29 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// redirectPolicy follows at most maxRedirects redirects for GET and HEAD
+// requests, so that attachment downloads can be served from a CDN. Redirects
+// are never followed for other requests, as an upload has to be a single PUT
+// to the URL that we were given, the redirect response is returned instead
+// and reported as a failed upload. Headers are carried over to the redirected
+// request by the HTTP client, except for sensitive headers when the redirect
+// goes to another domain.
+func redirectPolicy(maxRedirects int) func(req *http.Request, via []*http.Request) error {
+	return func(_ *http.Request, via []*http.Request) error {
+		method := via[0].Method
+
+		if method != http.MethodGet && method != http.MethodHead {
+			return http.ErrUseLastResponse
+		}
+
+		if len(via) > maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+
+		return nil
+	}
+}
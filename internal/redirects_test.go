@@ -0,0 +1,121 @@
+package internal_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ttab/elephant-replicant/internal"
+)
+
+func TestAttachmentClientRedirects(t *testing.T) {
+	var uploads int
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /download", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/cdn?checksum="+r.Header.Get("X-Checksum"),
+			http.StatusFound)
+	})
+
+	mux.HandleFunc("GET /cdn", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("checksum") != r.Header.Get("X-Checksum") {
+			http.Error(w, "header not preserved", http.StatusBadRequest)
+
+			return
+		}
+
+		_, _ = w.Write([]byte("data"))
+	})
+
+	mux.HandleFunc("GET /loop/{n}", func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(r.PathValue("n"))
+
+		http.Redirect(w, r, "/loop/"+strconv.Itoa(n+1), http.StatusFound)
+	})
+
+	mux.HandleFunc("PUT /upload", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/elsewhere", http.StatusTemporaryRedirect)
+	})
+
+	mux.HandleFunc("/elsewhere", func(w http.ResponseWriter, _ *http.Request) {
+		uploads++
+
+		w.WriteHeader(http.StatusOK)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := internal.HTTPTimeouts{
+		Request:      5 * time.Second,
+		Dial:         time.Second,
+		MaxRedirects: 3,
+	}.NewHTTPClient()
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet,
+		server.URL+"/download", nil)
+	if err != nil {
+		t.Fatalf("create request: %v", err)
+	}
+
+	req.Header.Set("X-Checksum", "ENABLED")
+
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("download: %v", err)
+	}
+
+	_ = res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected the download to follow the redirect, got %s", res.Status)
+	}
+
+	req, err = http.NewRequestWithContext(t.Context(), http.MethodGet,
+		server.URL+"/loop/0", nil)
+	if err != nil {
+		t.Fatalf("create request: %v", err)
+	}
+
+	res, err = client.Do(req)
+	if err == nil {
+		_ = res.Body.Close()
+
+		t.Fatal("expected an error after too many redirects")
+	}
+
+	req, err = http.NewRequestWithContext(t.Context(), http.MethodPut,
+		server.URL+"/upload", strings.NewReader("data"))
+	if err != nil {
+		t.Fatalf("create request: %v", err)
+	}
+
+	res, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+
+	_ = res.Body.Close()
+
+	if res.StatusCode != http.StatusTemporaryRedirect || uploads != 0 {
+		t.Errorf("expected the upload not to be redirected, got %s", res.Status)
+	}
+}
+
+func TestHTTPTimeoutDefaults(t *testing.T) {
+	client := internal.HTTPTimeouts{}.NewHTTPClient()
+
+	if client.Timeout != internal.DefaultAttachmentTimeout {
+		t.Errorf("expected the default request timeout, got %s", client.Timeout)
+	}
+
+	client = internal.HTTPTimeouts{Request: time.Minute}.NewHTTPClient()
+
+	if client.Timeout != time.Minute {
+		t.Errorf("expected the configured request timeout, got %s", client.Timeout)
+	}
+}
@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/postgres"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// ErrEventNotFound is returned when an event that should be replayed doesn't
+// exist in the source eventlog.
+var ErrEventNotFound = errors.New("event not found")
+
+// eventReplay collects the updates that a dry run replay would have made.
+type eventReplay struct {
+	updates []*repository.UpdateRequest
+}
+
+// ReplayResult is the outcome of replaying a single event.
+type ReplayResult struct {
+	EventID      int64  `json:"event_id"`
+	Event        string `json:"event"`
+	DocumentUUID string `json:"document_uuid"`
+	DocumentType string `json:"document_type"`
+	DryRun       bool   `json:"dry_run"`
+	// Outcome is one of "replicated", "skipped", "conflict", or "error".
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+	// Updates are the target updates that would have been made, only
+	// set for dry runs.
+	Updates []json.RawMessage `json:"updates,omitempty"`
+}
+
+// ReplayEvent runs a single event from the source eventlog through the normal
+// event handling for the named target. With dryRun set nothing is written to
+// the target, and the updates that would have been made are returned instead.
+// The log state of the target isn't affected.
+func (tm *TargetManager) ReplayEvent(
+	ctx context.Context, name string, eventID int64, dryRun bool,
+) (*ReplayResult, error) {
+	target, err := postgres.New(tm.db).GetTarget(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("load target config: %w", err)
+	}
+
+	log, err := tm.source.Eventlog(ctx, &repository.GetEventlogRequest{
+		After:     eventID - 1,
+		BatchSize: 1,
+		WaitMs:    1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read event: %w", err)
+	}
+
+	if len(log.Items) == 0 || log.Items[0].Id != eventID {
+		return nil, ErrEventNotFound
+	}
+
+	evt := log.Items[0]
+
+	w, err := tm.newWorker(ctx, tm.logger.With("target", name), target)
+	if err != nil {
+		return nil, fmt.Errorf("create worker: %w", err)
+	}
+
+	replay := eventReplay{}
+
+	w.replay = &replay
+	w.dryRun = w.dryRun || dryRun
+
+	res := ReplayResult{
+		EventID:      evt.Id,
+		Event:        evt.Event,
+		DocumentUUID: evt.Uuid,
+		DocumentType: evt.Type,
+		DryRun:       w.dryRun,
+	}
+
+	handleErr := w.handleEvent(ctx, evt, true)
+
+	switch {
+	case handleErr == nil:
+		res.Outcome = resultReplicated
+	case errors.Is(handleErr, ErrSkipped):
+		res.Outcome = resultSkipped
+	case errors.Is(handleErr, ErrConflict):
+		res.Outcome = resultConflict
+	default:
+		res.Outcome = resultError
+	}
+
+	if handleErr != nil {
+		res.Error = handleErr.Error()
+	}
+
+	for _, u := range replay.updates {
+		data, err := protojson.Marshal(u)
+		if err != nil {
+			return nil, fmt.Errorf("marshal update: %w", err)
+		}
+
+		res.Updates = append(res.Updates, data)
+	}
+
+	return &res, nil
+}
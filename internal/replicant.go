@@ -6,9 +6,11 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/ttab/elephant-api/replicant"
@@ -46,34 +48,446 @@ type Parameters struct {
 	CORSHosts         []string
 	DefaultTarget     *DefaultTargetConfig
 	EncryptionKey     []byte
+	AttachmentRetry   RetryPolicy
+	AttachmentHTTP    HTTPTimeouts
+	VerifyAttachments bool
+	MaxAttachmentSize int64
+	// AttachmentMemoryLimit bounds the total number of attachment bytes that
+	// are in flight at once over all targets, transfers wait for the budget
+	// to be available. Transfers of unknown length reserve the maximum
+	// attachment size. Zero means no limit.
+	AttachmentMemoryLimit int64
+	// AttachmentCompression requests gzip compressed attachment downloads,
+	// and either passes them through compressed to the target upload, or
+	// decompresses them before the upload. Sizes and checksums are
+	// verified against the downloaded bytes. Off by default.
+	AttachmentCompression AttachmentCompression
+	// DetachAttachments compares the attachments of documents in the
+	// target with the source when a new version is replicated, and
+	// detaches the replicated attachments that have been removed in the
+	// source. Requires a meta read from both the source and the target
+	// for every replicated document version.
+	DetachAttachments bool
+	// MultipartUploads controls when attachments are uploaded in parts to
+	// sinks that implement MultipartSink. Parts are retried on their own,
+	// so a failure doesn't restart the upload of a large attachment from
+	// the beginning.
+	MultipartUploads MultipartUploads
+	// AttachmentConcurrency is the number of attachments of a document that
+	// are transferred in parallel. Attachments are transferred one at a
+	// time if it's unset, the -attachment-concurrency flag defaults to
+	// four.
+	AttachmentConcurrency int
+	// AttachmentContentTypes restricts which attachments are transferred
+	// based on their content type. Applies in addition to the attachment
+	// name and document type rules.
+	AttachmentContentTypes ContentTypeFilter
+	// AttachmentContentTypeOverrides replace the content type that
+	// attachments are uploaded to the targets with, based on the filename
+	// extension or the source content type. Attachments that don't match
+	// an override keep their source content type.
+	AttachmentContentTypeOverrides ContentTypeOverrides
+	// RequireSections are section filters in the same format as
+	// IgnoreSections that documents must match to be replicated. Applies
+	// to all targets.
+	RequireSections []string
+	// Languages restricts replication to documents in the listed
+	// languages. Applies to all targets.
+	Languages []string
+	// TypeMapping maps source document types to the types they should be
+	// written as in the target. Filters are applied to the source type.
+	TypeMapping map[string]string
+	// TargetTypeMappings are type mappings for specific targets, by
+	// target name, f.ex. when targets use different types for the same
+	// documents. They take precedence over TypeMapping.
+	TargetTypeMappings TargetTypeMappings
+	// FallbackType is used as the source type of replicated documents that
+	// don't have a type, f.ex. because of a bug in the source, instead of
+	// letting the target reject them. The type mapping is applied to the
+	// fallback type. Leave empty to write the documents as they are.
+	FallbackType string
+	// AllowNoCurrentVersion replicates documents whose source meta has no
+	// current version while catching up by reading the document without
+	// a version. By default they are skipped, as the meta is malformed
+	// and the read can return anything.
+	AllowNoCurrentVersion bool
+	// ACLMapping rewrites the grantee URIs of replicated ACLs. Leave empty
+	// to copy ACLs verbatim.
+	ACLMapping ACLMapping
+	// ACLTemplate is set as the ACL of all replicated documents instead of
+	// their source ACL, and ACL events are skipped as the target ACL never
+	// changes. Can't be combined with ACLMapping.
+	ACLTemplate ACLTemplate
+	// TracingEndpoint is the OTLP/HTTP endpoint URL that traces are
+	// exported to. Tracing is disabled if empty.
+	TracingEndpoint string
+	// ACLRestriction prevents documents that are granted to restricted
+	// grantees in the source from being replicated. Documents that become
+	// restricted are deleted from the target.
+	ACLRestriction ACLRestriction
+	// EventFilters are used to skip events for all targets, in addition to
+	// the ignored subs and types in the target configuration.
+	EventFilters []EventFilter
+	// IncludeUUIDs restricts replication to an explicit set of source
+	// document UUIDs, f.ex. to mirror a curated set of documents. Events
+	// for all other documents are skipped before any other filter is
+	// applied, meta documents are included together with their main
+	// documents. A nil set replicates all documents.
+	IncludeUUIDs UUIDSet
+	// TypeRouting sends documents of different types to different targets.
+	// The version mappings are kept per target, so the same document can
+	// exist in several targets.
+	TypeRouting TypeRouting
+	// LanguageRouting sends documents in different languages to different
+	// targets. Documents that change language are moved from the target
+	// of the old language to the target of the new one.
+	LanguageRouting LanguageRouting
+	// StripBlocks removes blocks from documents before they are written to
+	// the target, f.ex. internal notes that shouldn't leave the source
+	// environment.
+	StripBlocks BlockStripper
+	// StatusFilter restricts which statuses are replicated, by name.
+	// Ignored status events still advance the log position.
+	StatusFilter StatusFilter
+	// Transformers make custom changes to documents before they are
+	// written to the target, and are applied in order after blocks have
+	// been stripped, but before types and UUIDs are mapped.
+	Transformers TransformPipeline
+	// CompareNormalization canonicalizes both the source and the target
+	// documents before they are compared, so that changes that the target
+	// makes when it normalizes documents aren't reported as differences.
+	// It's never applied to what is written to the target.
+	CompareNormalization CompareNormalization
+	// UUIDMapping derives the UUIDs documents get in the target from the
+	// source UUIDs. Source UUIDs are kept if no namespace is set. The
+	// document and version mapping tables are keyed by target UUID.
+	UUIDMapping UUIDMapping
+	// QuarantineThreshold is the number of consecutive failures to handle
+	// an event before the document is recorded in the replication errors
+	// table and replication moves on. Zero disables quarantining, and
+	// replication halts on the failing event.
+	QuarantineThreshold int
+	// ReplicationConcurrency is the number of events that are handled
+	// concurrently. Events are sharded by document UUID, so the events for
+	// a document still are handled in order. Values lower than two handle
+	// events serially.
+	ReplicationConcurrency int
+	// UnavailableBackoff controls how long we wait before retrying an
+	// event when the target repository can't be reached. The event is
+	// retried until it succeeds or fails for other reasons. A zero base
+	// delay disables retries, and the worker is restarted instead.
+	UnavailableBackoff Backoff
+	// ErrorClasses overrides the default classification of twirp errors
+	// from handling events. Retryable errors are retried with the
+	// UnavailableBackoff, skipped errors are recorded as dead letters
+	// before replication moves on, and fatal errors are quarantined or
+	// halt replication.
+	ErrorClasses ErrorClassification
+	// ErrorRetries is the number of times an event is retried when it fails
+	// with a retryable error other than an unreachable target, which is
+	// retried until the target is back. The error is then treated as
+	// fatal. Defaults to five.
+	ErrorRetries int
+	// MinOriginalCreated skips documents that originally were created
+	// before this time, regardless of when their events were emitted.
+	// Already replicated documents are left as they are in the target.
+	MinOriginalCreated time.Time
+	// CircuitBreaker opens after a number of consecutive failed requests
+	// to a target. Requests to the target then fail right away until the
+	// cool-down has passed, and replication of the target is paused
+	// instead of hammering a target that is having problems. A zero
+	// failure threshold disables the breaker.
+	CircuitBreaker CircuitBreakerConfig
+	// SoftDeleteStatus enables soft deletes when set. Deletes that can be
+	// restored in the source are then replicated by setting this status
+	// on the current version of the document in the target, and the
+	// version mappings are kept so that restores update the same document.
+	// Deletes without a delete record are always hard deletes.
+	SoftDeleteStatus string
+	// SoftDeleteClearACL removes all ACL entries of soft deleted documents
+	// in the target, so that they only are accessible to admins.
+	SoftDeleteClearACL bool
+	// ResyncOnConfigChange moves the log position of a target back to its
+	// start when the replication config has changed since the last time
+	// the target was started, so that all documents are synced with the
+	// new config.
+	ResyncOnConfigChange bool
+	// ConflictPolicy controls what happens when a document has been
+	// changed in the target since it was last replicated. Defaults to
+	// skipping the event.
+	ConflictPolicy ConflictPolicy
+	// Oversize controls what happens when the target rejects a document
+	// because of its size. By default the rejection is handled like any
+	// other error. Skipped documents are recorded as replication errors.
+	Oversize OversizeHandling
+	// UnknownEvents controls what happens to events of types that the
+	// replicant doesn't handle, f.ex. document type definition changes.
+	// Defaults to skipping them with a warning.
+	UnknownEvents UnknownEventPolicy
+	// Withheld controls how documents that are withheld in the source,
+	// under embargo until the scheduler releases them, are replicated. The
+	// default is to replicate the "withheld" status and leave the release
+	// to the scheduler of the target.
+	Withheld WithheldPolicy
+	// AuditLog writes a log line for every replicated event, with the
+	// source and target versions of the document.
+	AuditLog AuditLog
+	// ReplicateVersionMeta copies the meta data of every replicated source
+	// document version, f.ex. a commit message, to the new version in the
+	// target. Requires an additional history read from the source for
+	// every replicated document version.
+	ReplicateVersionMeta bool
+	// RefreshVersionACL sets the current ACL of the source document
+	// together with every document version that is replicated when caught
+	// up, so that ACL changes made at the same time as the version aren't
+	// missed. Requires an additional meta read from the source for every
+	// replicated document version.
+	RefreshVersionACL bool
+	// ParallelFetch runs the source reads of a replicated document
+	// version, the document, version meta, ACL, and attachment links and
+	// transfers, concurrently instead of one after another. When catching
+	// up the current document is also read together with the meta. The
+	// update is still written once all reads have completed.
+	ParallelFetch bool
+	// ProvenanceMeta adds the source event ID, source repository,
+	// replication time, updater, and source version to the meta of
+	// replicated versions and deletes, under keys chosen by the operator.
+	// Existing version meta data is never overwritten.
+	ProvenanceMeta ProvenanceMeta
+	// ImportDirectives controls which fields of the import directive, the
+	// original creation time and creator, are sent to the target. All
+	// fields are sent by default.
+	ImportDirectives ImportDirectives
+	// BackfillStatuses records the status heads that point at older
+	// document versions while catching up, when only the statuses of the
+	// current version are set, and sets them once the target has caught
+	// up. Statuses can only be set for versions that have been replicated
+	// to the target.
+	BackfillStatuses bool
+	// PurgeBelowStartFrom removes the version mappings of a target that
+	// were recorded for events before its start event, when the start
+	// event has been moved past the persisted log position. Mappings
+	// recorded before event IDs were tracked are left for the retention
+	// cleanup.
+	PurgeBelowStartFrom bool
+	// Shadow mirrors the updates and deletes of targets to shadow targets,
+	// f.ex. the new repository before a cutover, and compares the results.
+	// Shadow writes are made in the background and never block or fail
+	// the replication to the primary target, differences are logged and
+	// counted in the metrics.
+	Shadow ShadowConfig
+	// Sinks registers custom sinks that targets can replicate to instead of
+	// an Elephant repository, keyed by the repository URL scheme that
+	// selects them. A target with the repository URL "search://index"
+	// would f.ex. use the "search" sink.
+	Sinks map[string]SinkFactory
+	// Follower controls how the source eventlog is read.
+	Follower FollowerConfig
+	// StateBatching persists the log state every N events or interval
+	// instead of with every replicated event, which reduces the writes
+	// during large backfills. Events after the last persisted position are
+	// handled again after a restart, and skipped for the documents that
+	// they already have been replicated to. Persisting the state with
+	// every event is the default.
+	StateBatching StateBatching
+	// SourceRateLimit limits the rate of document reads from the source,
+	// shared by all targets, and applied to every source shard separately.
+	SourceRateLimit SourceRateLimit
+	// SourceShards replaces Documents with several source repositories
+	// whose eventlogs are followed separately.
+	SourceShards []SourceShard
+	// MappingRetention is how long version mappings are kept. Status
+	// changes can't be replicated for document versions that no longer
+	// have a mapping.
+	MappingRetention time.Duration
+	// MappingCleanupInterval is how often old version mappings are
+	// removed.
+	MappingCleanupInterval time.Duration
+	// TimerJitter randomly adjusts the interval of the mapping cleanup and
+	// verification by up to the given fraction.
+	TimerJitter Jitter
+	// Verification periodically compares a sample of replicated documents
+	// with the target to detect drift.
+	Verification VerificationConfig
+	// MetricsDocTypeLimit is the number of distinct document types that
+	// get their own doc_type label in the event metrics. Events for
+	// other types are counted as "other", which keeps the cardinality of
+	// the metrics bounded.
+	MetricsDocTypeLimit int
+	// ReplicateWorkflows copies the workflow configuration of document
+	// types to the targets when workflow events are seen, so that
+	// documents get the same workflow states in the targets. Requires
+	// SourceWorkflows, and the "workflow_admin" scope in the targets.
+	ReplicateWorkflows bool
+	// SourceWorkflows is the workflows client for the source repository.
+	SourceWorkflows repository.Workflows
+	// SourceTokens is used to force a new source access token when a
+	// source request has been rejected as unauthenticated. Optional.
+	SourceTokens TokenRefresher
+	// TokenRefreshMargin is how long before they expire that target
+	// access tokens are refreshed.
+	TokenRefreshMargin time.Duration
+	// DryRun reads from the source and evaluates filters as usual, but
+	// logs the changes that would have been made instead of writing to the
+	// target. The log position is still persisted, but no version mappings
+	// are recorded, so status changes for documents won't be logged.
+	DryRun bool
+}
+
+// Default attachment HTTP timeouts, used in place of timeouts that are zero.
+const (
+	DefaultAttachmentTimeout       = 10 * time.Minute
+	DefaultAttachmentDialTimeout   = 5 * time.Second
+	DefaultAttachmentHeaderTimeout = 30 * time.Second
+)
+
+// HTTPTimeouts configures the HTTP client used for attachment transfers.
+// Timeouts that are zero get their defaults.
+type HTTPTimeouts struct {
+	// Request is the timeout for a full request, including reading the
+	// response body.
+	Request time.Duration
+	// Dial is the timeout for establishing a connection.
+	Dial time.Duration
+	// ResponseHeader is the time we wait for the response headers after the
+	// request has been written.
+	ResponseHeader time.Duration
+	// MaxConnsPerHost limits the number of connections per host.
+	MaxConnsPerHost int
+	// MaxRedirects is the number of redirects that are followed for
+	// downloads. Uploads are never redirected.
+	MaxRedirects int
+}
+
+// NewHTTPClient creates a HTTP client with the configured timeouts.
+func (t HTTPTimeouts) NewHTTPClient() *http.Client {
+	t = t.withDefaults()
+
+	opts := []elephantine.HTTPClientOption{
+		elephantine.DialTimeout(t.Dial),
+		elephantine.ResponseHeaderTimeout(t.ResponseHeader),
+	}
+
+	if t.MaxConnsPerHost > 0 {
+		opts = append(opts,
+			elephantine.MaxConnectionsPerHost(t.MaxConnsPerHost))
+	}
+
+	client := elephantine.NewHTTPClient(t.Request, opts...)
+
+	client.CheckRedirect = redirectPolicy(t.MaxRedirects)
+
+	return client
+}
+
+// withDefaults sets the timeouts that are zero to their defaults, a client
+// without timeouts could hang forever on a stalled transfer.
+func (t HTTPTimeouts) withDefaults() HTTPTimeouts {
+	if t.Request == 0 {
+		t.Request = DefaultAttachmentTimeout
+	}
+
+	if t.Dial == 0 {
+		t.Dial = DefaultAttachmentDialTimeout
+	}
+
+	if t.ResponseHeader == 0 {
+		t.ResponseHeader = DefaultAttachmentHeaderTimeout
+	}
+
+	return t
 }
 
 var (
-	ErrSkipped  = errors.New("skipped event")
-	ErrConflict = errors.New("document has been updated in target")
+	ErrSkipped   = errors.New("skipped event")
+	ErrConflict  = errors.New("document has been updated in target")
+	ErrNoTargets = errors.New("no enabled targets")
 )
 
+// AttachmentWildcard is used as the attachment name to match all attachments
+// of a document type, f.ex. "*.core/image".
+const AttachmentWildcard = "*"
+
 type AttachmentRef struct {
 	DocType string
 	Name    string
 }
 
+// AttachmentRefFromString parses an attachment reference in the format
+// "[name].[doc type]". The name can be the AttachmentWildcard, but wildcards
+// can't be combined with a name, or be used for the document type.
 func AttachmentRefFromString(str string) (AttachmentRef, error) {
 	name, docType, ok := strings.Cut(str, ".")
-	if !ok {
+	if !ok || name == "" || docType == "" {
 		return AttachmentRef{}, fmt.Errorf(
 			"invalid attachment reference %q", str)
 	}
 
+	if name != AttachmentWildcard && strings.Contains(name, AttachmentWildcard) {
+		return AttachmentRef{}, fmt.Errorf(
+			"invalid attachment reference %q, wildcards can't be combined with a name", str)
+	}
+
+	if strings.Contains(docType, AttachmentWildcard) {
+		return AttachmentRef{}, fmt.Errorf(
+			"invalid attachment reference %q, use all attachments instead of a wildcard document type", str)
+	}
+
 	return AttachmentRef{
 		DocType: docType,
 		Name:    name,
 	}, nil
 }
 
+// Matches returns true if the reference matches the attachment name.
+func (r AttachmentRef) Matches(name string) bool {
+	return r.Name == AttachmentWildcard || r.Name == name
+}
+
+// ParseTypeMapping parses type mappings in the format
+// "[source type]=[target type]".
+func ParseTypeMapping(specs []string) (map[string]string, error) {
+	mapping := make(map[string]string, len(specs))
+
+	for _, s := range specs {
+		source, target, ok := strings.Cut(s, "=")
+		if !ok || source == "" || target == "" {
+			return nil, fmt.Errorf("invalid type mapping %q", s)
+		}
+
+		if _, exists := mapping[source]; exists {
+			return nil, fmt.Errorf("duplicate type mapping for %q", source)
+		}
+
+		mapping[source] = target
+	}
+
+	return mapping, nil
+}
+
 type LogState struct {
 	CaughtUp bool
 	Position int64
+	// LastEventTimestamp is the timestamp of the event at Position.
+	LastEventTimestamp time.Time
+	// LastUpdated is the time when the state was persisted.
+	LastUpdated time.Time
+}
+
+// logStateKey returns the state key for the log state of a target.
+func logStateKey(target string) string {
+	return target + ":log_state"
+}
+
+// eventTimestamp parses the timestamp of an eventlog item, returns the zero
+// time if it can't be parsed.
+func eventTimestamp(evt *repository.EventlogItem) time.Time {
+	t, err := time.Parse(time.RFC3339, evt.Timestamp)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return t
 }
 
 const (
@@ -86,28 +500,125 @@ const (
 )
 
 func Run(ctx context.Context, p Parameters) error {
+	err := p.Validate()
+	if err != nil {
+		return fmt.Errorf("invalid parameters: %w", err)
+	}
+
 	grace := elephantine.NewGracefulShutdown(p.Logger, 10*time.Second)
 
-	logMetrics, err := koonkie.NewPrometheusFollowerMetrics(
-		p.MetricsRegisterer, "replicant_follower")
+	tracerProvider, shutdownTracing, err := newTracerProvider(
+		ctx, p.TracingEndpoint)
 	if err != nil {
-		return fmt.Errorf("set up log follower metrics: %w", err)
+		return fmt.Errorf("set up tracing: %w", err)
 	}
 
+	defer func() {
+		sCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		err := shutdownTracing(sCtx)
+		if err != nil {
+			p.Logger.Error("failed to flush traces",
+				elephantine.LogKeyError, err)
+		}
+	}()
+
 	fanOut := pg.NewFanOut[TargetNotification](TargetNotifyChannel)
 
+	attachmentMemory, err := NewAttachmentMemory(
+		p.AttachmentMemoryLimit, p.MetricsRegisterer)
+	if err != nil {
+		return fmt.Errorf("set up attachment memory limit: %w", err)
+	}
+
 	err = registerDefaultTarget(ctx, p)
 	if err != nil {
 		return fmt.Errorf("register default target: %w", err)
 	}
 
-	manager := NewTargetManager(
-		p.Logger, p.Database, p.Documents, logMetrics, p.EncryptionKey,
-	)
+	requireSections, err := ParseSectionFilters(p.RequireSections)
+	if err != nil {
+		return fmt.Errorf("parse required sections: %w", err)
+	}
 
-	notifications := make(chan TargetNotification, 16)
+	workerOpts := WorkerOptions{
+		HTTPClient:        p.AttachmentHTTP.NewHTTPClient(),
+		AttachmentRetry:   p.AttachmentRetry,
+		VerifyAttachments: p.VerifyAttachments,
+		MaxAttachmentSize: p.MaxAttachmentSize,
+		AttachmentMemory:  attachmentMemory,
+		DetachAttachments: p.DetachAttachments,
+		MultipartUploads:  p.MultipartUploads,
+
+		AttachmentCompression:  p.AttachmentCompression,
+		AttachmentConcurrency:  p.AttachmentConcurrency,
+		AttachmentContentTypes: p.AttachmentContentTypes,
+
+		AttachmentContentTypeOverrides: p.AttachmentContentTypeOverrides,
+
+		RequireSections:        requireSections,
+		Languages:              p.Languages,
+		TypeMapping:            p.TypeMapping,
+		TargetTypeMappings:     p.TargetTypeMappings,
+		FallbackType:           p.FallbackType,
+		AllowNoCurrentVersion:  p.AllowNoCurrentVersion,
+		ACLMapping:             p.ACLMapping,
+		ACLTemplate:            p.ACLTemplate,
+		ACLRestriction:         p.ACLRestriction,
+		StripBlocks:            p.StripBlocks,
+		Transformers:           p.Transformers,
+		CompareNormalization:   p.CompareNormalization,
+		StatusFilter:           p.StatusFilter,
+		EventFilters:           p.EventFilters,
+		IncludeUUIDs:           p.IncludeUUIDs,
+		TypeRouting:            p.TypeRouting,
+		LanguageRouting:        p.LanguageRouting,
+		UUIDMapping:            p.UUIDMapping,
+		QuarantineThreshold:    p.QuarantineThreshold,
+		ReplicationConcurrency: p.ReplicationConcurrency,
+		UnavailableBackoff:     p.UnavailableBackoff,
+		ErrorClasses:           p.ErrorClasses,
+		ErrorRetries:           p.ErrorRetries,
+		CircuitBreaker:         p.CircuitBreaker,
+		MinOriginalCreated:     p.MinOriginalCreated,
+		Sinks:                  p.Sinks,
+		Shadow:                 p.Shadow,
+		ResyncOnConfigChange:   p.ResyncOnConfigChange,
+		PurgeBelowStartFrom:    p.PurgeBelowStartFrom,
+		MappingRetention:       p.MappingRetention,
+		SoftDeleteStatus:       p.SoftDeleteStatus,
+		SoftDeleteClearACL:     p.SoftDeleteClearACL,
+		ConflictPolicy:         p.ConflictPolicy,
+		Oversize:               p.Oversize,
+		UnknownEvents:          p.UnknownEvents,
+		Withheld:               p.Withheld,
+		AuditLog:               p.AuditLog,
+		ReplicateVersionMeta:   p.ReplicateVersionMeta,
+		RefreshVersionACL:      p.RefreshVersionACL,
+		ParallelFetch:          p.ParallelFetch,
+		ProvenanceMeta:         p.ProvenanceMeta,
+		ImportDirectives:       p.ImportDirectives,
+		BackfillStatuses:       p.BackfillStatuses,
+		Follower:               p.Follower,
+		StateBatching:          p.StateBatching,
+		ReplicateWorkflows:     p.ReplicateWorkflows,
+		SourceWorkflows:        p.SourceWorkflows,
+		SourceTokens:           p.SourceTokens,
+		TokenRefreshMargin:     p.TokenRefreshMargin,
+		DryRun:                 p.DryRun,
+		Stop:                   grace.ShouldStop(),
+		Tracer:                 tracerProvider.Tracer(tracerName),
+	}
+
+	managers, err := newShardManagers(p, workerOpts)
+	if err != nil {
+		return err
+	}
 
-	go fanOut.ListenAll(ctx, notifications)
+	// The first manager looks documents up in all shards, and handles the
+	// document level API calls and the verification.
+	manager := managers[0]
 
 	app := Application{
 		logger:        p.Logger,
@@ -131,11 +642,24 @@ func Run(ctx context.Context, p Parameters) error {
 
 	p.Server.RegisterAPI(service, opts)
 
+	admin := NewAdminAPI(p.Logger, p.Database, managers, fanOut, p.AuthInfoParser)
+
+	admin.Register(p.Server.Mux)
+
 	group := elephantine.NewErrGroup(ctx, p.Logger)
 
-	group.Go("target-manager", func(ctx context.Context) error {
-		return manager.Run(grace.CancelOnStop(ctx), notifications)
-	})
+	for _, m := range managers {
+		notifications := make(chan TargetNotification, 16)
+
+		go fanOut.ListenAll(ctx, notifications)
+
+		group.Go(shardKey("target-manager", m.Shard()), func(ctx context.Context) error {
+			// The manager stops the workers between events when
+			// the shutdown starts, cancellation is only used once
+			// the grace period is over.
+			return m.Run(grace.CancelOnQuit(ctx), notifications)
+		})
+	}
 
 	group.Go("pg-subscribe", func(ctx context.Context) error {
 		pg.Subscribe(grace.CancelOnStop(ctx), p.Logger, p.Database, fanOut) //nolint:staticcheck
@@ -148,12 +672,73 @@ func Run(ctx context.Context, p Parameters) error {
 	})
 
 	group.Go("cleanup", func(ctx context.Context) error {
-		return mappingCleanup(grace.CancelOnStop(ctx), p.Database)
+		return mappingCleanup(grace.CancelOnStop(ctx), p.Database,
+			p.MappingCleanupInterval, p.TimerJitter, p.MappingRetention)
+	})
+
+	group.Go("verification", func(ctx context.Context) error {
+		return verification(grace.CancelOnStop(ctx), p.Logger, manager,
+			p.Verification, p.TimerJitter)
 	})
 
 	return group.Wait() //nolint: wrapcheck
 }
 
+// newShardManagers creates a target manager for every source shard, or a
+// single manager for an unsharded source. The metrics of the shards are
+// labelled with the shard name.
+func newShardManagers(p Parameters, opts WorkerOptions) ([]*TargetManager, error) {
+	shards := p.SourceShards
+	if len(shards) == 0 {
+		shards = []SourceShard{{Documents: p.Documents}}
+	}
+
+	sources := make([]repository.Documents, len(shards))
+
+	for i, shard := range shards {
+		sources[i] = p.SourceRateLimit.Documents(shard.Documents)
+	}
+
+	managers := make([]*TargetManager, len(shards))
+
+	for i, shard := range shards {
+		reg := shardRegisterer(p.MetricsRegisterer, shard.Name)
+
+		logMetrics, err := koonkie.NewPrometheusFollowerMetrics(
+			reg, "replicant_follower")
+		if err != nil {
+			return nil, fmt.Errorf("set up log follower metrics: %w", err)
+		}
+
+		metrics, err := NewReplicationMetrics(reg, p.MetricsDocTypeLimit)
+		if err != nil {
+			return nil, fmt.Errorf("set up replication metrics: %w", err)
+		}
+
+		logger := p.Logger
+		source := sources[i]
+
+		if shard.Name != "" {
+			logger = logger.With("shard", shard.Name)
+		}
+
+		if i == 0 {
+			source = newShardLookup(sources)
+		}
+
+		shardOpts := opts
+
+		shardOpts.Shard = shard.Name
+		shardOpts.Metrics = metrics
+
+		managers[i] = NewTargetManager(
+			logger, p.Database, source, logMetrics, p.EncryptionKey,
+			shardOpts)
+	}
+
+	return managers, nil
+}
+
 func registerDefaultTarget(ctx context.Context, p Parameters) error {
 	if p.DefaultTarget == nil {
 		return nil
@@ -179,19 +764,13 @@ func registerDefaultTarget(ctx context.Context, p Parameters) error {
 		IgnoreSubs:     dt.IgnoreSubs,
 	}
 
-	for _, s := range dt.IgnoreSections {
-		docType, sectionUUID, ok := strings.Cut(s, ":")
-		if !ok {
-			return fmt.Errorf("invalid section filter %q", s)
-		}
-
-		syncConfig.IgnoreSections = append(syncConfig.IgnoreSections,
-			&replicant.SectionForType{
-				Type:        docType,
-				SectionUuid: sectionUUID,
-			})
+	ignoreSections, err := ParseSectionFilters(dt.IgnoreSections)
+	if err != nil {
+		return fmt.Errorf("parse ignored sections: %w", err)
 	}
 
+	syncConfig.IgnoreSections = ignoreSections
+
 	for _, a := range dt.IncludeAttachments {
 		syncConfig.IncludeAttachments = append(syncConfig.IncludeAttachments,
 			&replicant.AttachmentForType{
@@ -200,6 +779,11 @@ func registerDefaultTarget(ctx context.Context, p Parameters) error {
 			})
 	}
 
+	_, err = NewContentFilterFromSyncConfig(&syncConfig)
+	if err != nil {
+		return fmt.Errorf("invalid content filter: %w", err)
+	}
+
 	configJSON, err := json.Marshal(&syncConfig)
 	if err != nil {
 		return fmt.Errorf("marshal sync config: %w", err)
@@ -229,9 +813,12 @@ func registerDefaultTarget(ctx context.Context, p Parameters) error {
 	return nil
 }
 
-func mappingCleanup(ctx context.Context, db *pgxpool.Pool) error {
+func mappingCleanup(
+	ctx context.Context, db *pgxpool.Pool,
+	interval time.Duration, jitter Jitter, retention time.Duration,
+) error {
 	for {
-		run := time.After(1 * time.Hour)
+		run := time.After(jitter.Apply(interval))
 
 		select {
 		case <-ctx.Done():
@@ -242,7 +829,7 @@ func mappingCleanup(ctx context.Context, db *pgxpool.Pool) error {
 		q := postgres.New(db)
 
 		err := q.RemoveOldMappings(ctx, pg.Time(
-			time.Now().AddDate(0, -6, 0)))
+			time.Now().Add(-retention)))
 		if err != nil {
 			return fmt.Errorf("remove old mappings: %w", err)
 		}
@@ -261,14 +848,34 @@ type Application struct {
 
 // SendDocument implements replicant.Replication.
 func (a *Application) SendDocument(
-	ctx context.Context, _ *replicant.SendDocumentRequest,
+	ctx context.Context, req *replicant.SendDocumentRequest,
 ) (*replicant.SendDocumentResponse, error) {
 	_, err := elephantine.RequireAnyScope(ctx, "doc_admin", "doc_write")
 	if err != nil {
 		return nil, err
 	}
 
-	return nil, twirp.NewError(twirp.Unimplemented, "soon")
+	docUUID, err := uuid.Parse(req.GetUuid())
+	if err != nil {
+		return nil, elephantine.InvalidArgumentf("uuid", "invalid UUID: %v", err)
+	}
+
+	version, err := a.manager.SendDocument(ctx, docUUID, req.GetForce())
+
+	switch {
+	case errors.Is(err, ErrConflict):
+		return nil, twirp.NewError(twirp.FailedPrecondition, err.Error())
+	case errors.Is(err, ErrSkipped):
+		return nil, twirp.NewError(twirp.NotFound, err.Error())
+	case errors.Is(err, ErrNoTargets):
+		return nil, twirp.NewError(twirp.FailedPrecondition, err.Error())
+	case err != nil:
+		return nil, fmt.Errorf("send document: %w", err)
+	}
+
+	return &replicant.SendDocumentResponse{
+		TargetVersion: version,
+	}, nil
 }
 
 // ConfigureTarget implements replicant.Replication.
@@ -305,6 +912,11 @@ func (a *Application) ConfigureTarget(
 		syncConfig = &replicant.SyncConfig{}
 	}
 
+	_, err = NewContentFilterFromSyncConfig(syncConfig)
+	if err != nil {
+		return nil, elephantine.InvalidArgumentf("config", "%v", err)
+	}
+
 	configJSON, err := json.Marshal(syncConfig)
 	if err != nil {
 		return nil, fmt.Errorf("marshal sync config: %w", err)
@@ -360,7 +972,7 @@ func (a *Application) RemoveTarget(
 		return nil, fmt.Errorf("delete target: %w", err)
 	}
 
-	stateKey := req.GetName() + ":log_state"
+	stateKey := logStateKey(req.GetName())
 
 	err = q.RemoveTargetData(ctx, req.GetName())
 	if err != nil {
@@ -377,6 +989,47 @@ func (a *Application) RemoveTarget(
 		return nil, fmt.Errorf("remove target state: %w", err)
 	}
 
+	err = q.RemoveTargetState(ctx, attachmentBackfillKey(req.GetName()))
+	if err != nil {
+		return nil, fmt.Errorf("remove attachment backfill state: %w", err)
+	}
+
+	err = q.RemoveTargetState(ctx, configStateKey(req.GetName()))
+	if err != nil {
+		return nil, fmt.Errorf("remove config state: %w", err)
+	}
+
+	for _, key := range []string{
+		stateKey,
+		configStateKey(req.GetName()),
+		attachmentBackfillKey(req.GetName()),
+	} {
+		err = q.RemoveStatesWithPrefix(ctx, shardKeyPrefix(key))
+		if err != nil {
+			return nil, fmt.Errorf("remove source shard states: %w", err)
+		}
+	}
+
+	err = q.RemoveStatesWithPrefix(ctx, statusBackfillPrefix(req.GetName()))
+	if err != nil {
+		return nil, fmt.Errorf("remove pending statuses: %w", err)
+	}
+
+	err = q.RemoveTargetErrors(ctx, req.GetName())
+	if err != nil {
+		return nil, fmt.Errorf("remove target errors: %w", err)
+	}
+
+	err = q.RemoveTargetDeadLetters(ctx, req.GetName())
+	if err != nil {
+		return nil, fmt.Errorf("remove target dead letters: %w", err)
+	}
+
+	err = q.RemoveTargetConflicts(ctx, req.GetName())
+	if err != nil {
+		return nil, fmt.Errorf("remove target conflicts: %w", err)
+	}
+
 	err = a.fanOut.Publish(ctx, a.db, TargetNotification{
 		Name:   req.GetName(),
 		Action: TargetActionRemove,
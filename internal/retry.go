@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/ttab/elephantine"
+)
+
+// RetryPolicy controls how many times an operation is attempted and how long
+// we wait between attempts. The delay is doubled for every failed attempt.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+}
+
+// Do runs fn until it succeeds, returns an error that hasn't been marked as
+// retryable, or the maximum number of attempts has been reached.
+func (rp RetryPolicy) Do(
+	ctx context.Context,
+	logger *slog.Logger,
+	operation string,
+	fn func(ctx context.Context) error,
+) error {
+	attempts := max(rp.MaxAttempts, 1)
+	delay := rp.BaseDelay
+
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || !IsRetryable(err) || attempt >= attempts {
+			return err
+		}
+
+		logger.WarnContext(ctx, "retrying failed operation",
+			"operation", operation,
+			"attempt", attempt,
+			"delay", delay,
+			elephantine.LogKeyError, err,
+		)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err() //nolint: wrapcheck
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+	}
+}
+
+type retryableError struct {
+	err error
+}
+
+func (re retryableError) Error() string {
+	return re.err.Error()
+}
+
+func (re retryableError) Unwrap() error {
+	return re.err
+}
+
+// Retryable marks an error as retryable.
+func Retryable(err error) error {
+	return retryableError{err: err}
+}
+
+// IsRetryable returns true if the error has been marked as retryable.
+func IsRetryable(err error) bool {
+	var re retryableError
+
+	return errors.As(err, &re)
+}
+
+// Backoff is an exponential delay between retries that is capped at MaxDelay.
+type Backoff struct {
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// Delay returns the delay before the given retry, starting at one.
+func (b Backoff) Delay(retry int) time.Duration {
+	delay := b.BaseDelay
+
+	for i := 1; i < retry && (b.MaxDelay <= 0 || delay < b.MaxDelay); i++ {
+		delay *= 2
+	}
+
+	if b.MaxDelay > 0 {
+		delay = min(delay, b.MaxDelay)
+	}
+
+	return delay
+}
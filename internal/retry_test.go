@@ -0,0 +1,136 @@
+package internal_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/ttab/elephant-replicant/internal"
+)
+
+func TestRetryPolicyRetriesRetryableErrors(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	policy := internal.RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+	}
+
+	var calls int
+
+	err := policy.Do(t.Context(), logger, "test",
+		func(_ context.Context) error {
+			calls++
+
+			if calls < 3 {
+				return internal.Retryable(errors.New("transient"))
+			}
+
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("expected success, got: %v", err)
+	}
+
+	if calls != 3 {
+		t.Fatalf("got %d calls, want 3", calls)
+	}
+}
+
+func TestRetryPolicyStopsOnPermanentError(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	policy := internal.RetryPolicy{
+		MaxAttempts: 5,
+		BaseDelay:   time.Millisecond,
+	}
+
+	permanent := errors.New("permanent")
+
+	var calls int
+
+	err := policy.Do(t.Context(), logger, "test",
+		func(_ context.Context) error {
+			calls++
+
+			return permanent
+		})
+	if !errors.Is(err, permanent) {
+		t.Fatalf("got error %v, want %v", err, permanent)
+	}
+
+	if calls != 1 {
+		t.Fatalf("got %d calls, want 1", calls)
+	}
+}
+
+func TestRetryPolicyGivesUpAfterMaxAttempts(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	policy := internal.RetryPolicy{
+		MaxAttempts: 2,
+		BaseDelay:   time.Millisecond,
+	}
+
+	var calls int
+
+	err := policy.Do(t.Context(), logger, "test",
+		func(_ context.Context) error {
+			calls++
+
+			return internal.Retryable(errors.New("transient"))
+		})
+	if !internal.IsRetryable(err) {
+		t.Fatalf("expected the last retryable error, got: %v", err)
+	}
+
+	if calls != 2 {
+		t.Fatalf("got %d calls, want 2", calls)
+	}
+}
+
+func TestRetryPolicyRespectsCancellation(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	policy := internal.RetryPolicy{
+		MaxAttempts: 10,
+		BaseDelay:   time.Hour,
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+
+	err := policy.Do(ctx, logger, "test",
+		func(_ context.Context) error {
+			cancel()
+
+			return internal.Retryable(errors.New("transient"))
+		})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want context.Canceled", err)
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	b := internal.Backoff{
+		BaseDelay: time.Second,
+		MaxDelay:  5 * time.Second,
+	}
+
+	want := []time.Duration{
+		time.Second, 2 * time.Second, 4 * time.Second,
+		5 * time.Second, 5 * time.Second,
+	}
+
+	for i, w := range want {
+		if got := b.Delay(i + 1); got != w {
+			t.Errorf("retry %d: got delay %v, want %v", i+1, got, w)
+		}
+	}
+
+	if got := b.Delay(1000); got != 5*time.Second {
+		t.Errorf("expected delay to be capped for high retry counts, got %v", got)
+	}
+}
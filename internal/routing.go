@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ttab/elephant-api/repository"
+)
+
+// TypeRouting routes documents to targets by type, f.ex. to send images to a
+// media repository and everything else to the main repository. Documents of
+// types without a route go to the default target. Targets that neither are the
+// default nor have any routes aren't affected and replicate all documents as
+// usual.
+//
+// Meta documents are routed together with their main document.
+type TypeRouting struct {
+	// Routes maps document types to target names.
+	Routes map[string]string
+	// Default is the target for documents of types without a route.
+	Default string
+}
+
+// IsZero returns true if no routes have been configured.
+func (r TypeRouting) IsZero() bool {
+	return len(r.Routes) == 0
+}
+
+// Target returns the target that documents of the type should be replicated
+// to.
+func (r TypeRouting) Target(docType string) string {
+	target, ok := r.Routes[docType]
+	if !ok {
+		return r.Default
+	}
+
+	return target
+}
+
+// Filter returns an event filter that skips the documents that aren't routed
+// to the target. Returns nil if the target isn't part of the routing.
+func (r TypeRouting) Filter(target string) EventFilter {
+	if r.IsZero() {
+		return nil
+	}
+
+	participates := target == r.Default
+
+	for _, t := range r.Routes {
+		participates = participates || t == target
+	}
+
+	if !participates {
+		return nil
+	}
+
+	return routeFilter{routing: r, target: target}
+}
+
+type routeFilter struct {
+	routing TypeRouting
+	target  string
+}
+
+// Skip implements EventFilter.
+func (f routeFilter) Skip(evt *repository.EventlogItem) (bool, string) {
+	docType := evt.Type
+	if evt.MainDocumentType != "" {
+		docType = evt.MainDocumentType
+	}
+
+	return f.routing.Target(docType) != f.target, "routed to other target"
+}
+
+// ParseTypeRouting parses type routes in the format "[type]=[target name]".
+func ParseTypeRouting(specs []string, defaultTarget string) (TypeRouting, error) {
+	r := TypeRouting{
+		Routes:  make(map[string]string),
+		Default: defaultTarget,
+	}
+
+	for _, s := range specs {
+		docType, target, ok := strings.Cut(s, "=")
+		if !ok || docType == "" || target == "" {
+			return TypeRouting{}, fmt.Errorf("invalid type route %q", s)
+		}
+
+		if _, exists := r.Routes[docType]; exists {
+			return TypeRouting{}, fmt.Errorf(
+				"duplicate type route for %q", docType)
+		}
+
+		r.Routes[docType] = target
+	}
+
+	return r, nil
+}
@@ -0,0 +1,69 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/internal"
+)
+
+func TestTypeRouting(t *testing.T) {
+	r, err := internal.ParseTypeRouting([]string{"core/image=media"}, "default")
+	if err != nil {
+		t.Fatalf("parse routing: %v", err)
+	}
+
+	image := &repository.EventlogItem{Type: "core/image"}
+	article := &repository.EventlogItem{Type: "core/article"}
+	imageMeta := &repository.EventlogItem{
+		Type:             "core/metadata",
+		MainDocumentType: "core/image",
+	}
+
+	media := r.Filter("media")
+	if media == nil {
+		t.Fatal("expected a filter for the media target")
+	}
+
+	if skip, _ := media.Skip(image); skip {
+		t.Error("expected image to be routed to media")
+	}
+
+	if skip, _ := media.Skip(imageMeta); skip {
+		t.Error("expected image meta document to be routed to media")
+	}
+
+	if skip, _ := media.Skip(article); !skip {
+		t.Error("expected article to be skipped by media")
+	}
+
+	def := r.Filter("default")
+	if def == nil {
+		t.Fatal("expected a filter for the default target")
+	}
+
+	if skip, _ := def.Skip(article); skip {
+		t.Error("expected article to be routed to the default target")
+	}
+
+	if skip, _ := def.Skip(image); !skip {
+		t.Error("expected image to be skipped by the default target")
+	}
+
+	if r.Filter("qa") != nil {
+		t.Error("expected no filter for target outside of the routing")
+	}
+}
+
+func TestParseTypeRoutingInvalid(t *testing.T) {
+	_, err := internal.ParseTypeRouting([]string{"core/image"}, "default")
+	if err == nil {
+		t.Error("expected an error for a route without a target")
+	}
+
+	_, err = internal.ParseTypeRouting(
+		[]string{"core/image=a", "core/image=b"}, "default")
+	if err == nil {
+		t.Error("expected an error for duplicate routes")
+	}
+}
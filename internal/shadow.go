@@ -0,0 +1,377 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/postgres"
+	"github.com/ttab/elephantine"
+	"github.com/twitchtv/twirp"
+	"google.golang.org/protobuf/proto"
+)
+
+// ShadowMode controls how the writes to a shadow target are compared with the
+// writes to the primary target.
+type ShadowMode string
+
+const (
+	// ShadowOutcome only compares if the writes succeeded. The shadow
+	// target keeps its own versions, so the optimistic locks of the
+	// primary target aren't sent, and statuses that are set on earlier
+	// versions aren't mirrored.
+	ShadowOutcome ShadowMode = "outcome"
+	// ShadowVersion expects the shadow target to have the same versions
+	// as the primary, f.ex. after a restore from a backup. The writes are
+	// sent with the same optimistic locks, and the returned versions are
+	// compared as well.
+	ShadowVersion ShadowMode = "version"
+)
+
+// ParseShadowMode parses a shadow mode, an empty value is treated as
+// ShadowOutcome.
+func ParseShadowMode(s string) (ShadowMode, error) {
+	switch m := ShadowMode(s); m {
+	case "":
+		return ShadowOutcome, nil
+	case ShadowOutcome, ShadowVersion:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown shadow mode %q", s)
+	}
+}
+
+// ShadowResult is the result of comparing a shadow write with the primary
+// write.
+type ShadowResult string
+
+const (
+	// ShadowMatch is used when the writes had the same outcome.
+	ShadowMatch ShadowResult = "match"
+	// ShadowOutcomeMismatch is used when only one of the writes failed.
+	ShadowOutcomeMismatch ShadowResult = "outcome_mismatch"
+	// ShadowVersionMismatch is used when the writes returned different
+	// versions.
+	ShadowVersionMismatch ShadowResult = "version_mismatch"
+	// ShadowDropped is used when the shadow write was dropped because
+	// the shadow target didn't keep up.
+	ShadowDropped ShadowResult = "dropped"
+)
+
+// ShadowConfig sends the writes of targets to shadow targets as well, f.ex. to
+// verify a new target before a cutover. Shadow writes are best-effort, they're
+// made in the background after the primary write, and never affect the
+// replication to the primary target.
+type ShadowConfig struct {
+	// Targets are the repository URLs of the shadow targets by primary
+	// target name. A shadow target uses the credentials of its primary.
+	Targets map[string]string
+	Mode    ShadowMode
+}
+
+// ParseShadowTargets parses shadow targets in the format
+// "[target]=[repository URL]".
+func ParseShadowTargets(specs []string) (map[string]string, error) {
+	targets := make(map[string]string, len(specs))
+
+	for _, spec := range specs {
+		name, repoURL, ok := strings.Cut(spec, "=")
+		if !ok || name == "" || repoURL == "" {
+			return nil, fmt.Errorf("invalid shadow target %q", spec)
+		}
+
+		_, err := url.Parse(repoURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid repository URL for shadow target %q: %w",
+				name, err)
+		}
+
+		if _, dup := targets[name]; dup {
+			return nil, fmt.Errorf("duplicate shadow target for %q", name)
+		}
+
+		targets[name] = repoURL
+	}
+
+	return targets, nil
+}
+
+// CompareShadowWrite compares the outcome of a shadow write with the primary
+// write. Versions are only compared in ShadowVersion mode, and when both
+// writes succeeded.
+func CompareShadowWrite(
+	mode ShadowMode,
+	primaryVersion int64, primaryErr error,
+	shadowVersion int64, shadowErr error,
+) ShadowResult {
+	switch {
+	case (primaryErr == nil) != (shadowErr == nil):
+		return ShadowOutcomeMismatch
+	case primaryErr != nil:
+		return ShadowMatch
+	case mode == ShadowVersion && primaryVersion != shadowVersion:
+		return ShadowVersionMismatch
+	default:
+		return ShadowMatch
+	}
+}
+
+// ShadowUpdate returns the update that mirrors an update of the primary target
+// to the shadow target, or nil if it can't be mirrored. In ShadowOutcome mode
+// the versions of the primary mean nothing to the shadow target, so the
+// optimistic locks are cleared, and statuses for specific versions are
+// dropped. Writes that failed on an optimistic lock in the primary can't be
+// reproduced in the shadow target and aren't mirrored either.
+func ShadowUpdate(
+	mode ShadowMode, req *repository.UpdateRequest, primaryErr error,
+) *repository.UpdateRequest {
+	shadowReq := proto.CloneOf(req)
+
+	shadowReq.AttachObjects = nil
+	shadowReq.DetachObjects = nil
+
+	if mode == ShadowVersion {
+		return shadowReq
+	}
+
+	if elephantine.IsTwirpErrorCode(primaryErr, twirp.FailedPrecondition) {
+		return nil
+	}
+
+	shadowReq.IfMatch = 0
+
+	shadowReq.Status = slices.DeleteFunc(shadowReq.Status,
+		func(st *repository.StatusUpdate) bool {
+			return st.Version != 0
+		})
+
+	for _, st := range shadowReq.Status {
+		st.IfMatch = 0
+	}
+
+	if shadowReq.Document == nil && len(shadowReq.Status) == 0 &&
+		len(shadowReq.Acl) == 0 {
+		return nil
+	}
+
+	return shadowReq
+}
+
+// ShadowDelete returns the delete that mirrors a delete in the primary target
+// to the shadow target, or nil if it can't be mirrored, see ShadowUpdate().
+func ShadowDelete(
+	mode ShadowMode, req *repository.DeleteDocumentRequest, primaryErr error,
+) *repository.DeleteDocumentRequest {
+	shadowReq := proto.CloneOf(req)
+
+	if mode == ShadowVersion {
+		return shadowReq
+	}
+
+	if elephantine.IsTwirpErrorCode(primaryErr, twirp.FailedPrecondition) {
+		return nil
+	}
+
+	shadowReq.IfMatch = 0
+
+	return shadowReq
+}
+
+const (
+	// shadowQueueSize is the number of shadow writes that can wait for
+	// the shadow target before new writes are dropped.
+	shadowQueueSize = 100
+	// shadowWriteTimeout bounds the time spent on a single shadow write.
+	shadowWriteTimeout = 30 * time.Second
+)
+
+// shadowSink writes to the primary sink, and mirrors the updates and deletes
+// to the shadow sink in the background. Reads and uploads only go to the
+// primary. Attachments aren't mirrored, as the uploads belong to the primary.
+type shadowSink struct {
+	ReplicationSink
+
+	shadow  ReplicationSink
+	mode    ShadowMode
+	target  string
+	logger  *slog.Logger
+	metrics *ReplicationMetrics
+
+	mu      sync.Mutex
+	pending []shadowWrite
+	running bool
+}
+
+type shadowWrite struct {
+	ctx            context.Context
+	document       string
+	primaryVersion int64
+	primaryErr     error
+	write          func(ctx context.Context) (int64, error)
+}
+
+// Update implements ReplicationSink.
+func (s *shadowSink) Update(
+	ctx context.Context, req *repository.UpdateRequest,
+) (*repository.UpdateResponse, error) {
+	res, err := s.ReplicationSink.Update(ctx, req)
+
+	shadowReq := ShadowUpdate(s.mode, req, err)
+	if shadowReq == nil {
+		return res, err //nolint: wrapcheck
+	}
+
+	s.enqueue(shadowWrite{
+		ctx:            ctx,
+		document:       req.Uuid,
+		primaryVersion: res.GetVersion(),
+		primaryErr:     err,
+		write: func(ctx context.Context) (int64, error) {
+			res, err := s.shadow.Update(ctx, shadowReq)
+
+			return res.GetVersion(), err //nolint: wrapcheck
+		},
+	})
+
+	return res, err //nolint: wrapcheck
+}
+
+// Delete implements ReplicationSink.
+func (s *shadowSink) Delete(
+	ctx context.Context, req *repository.DeleteDocumentRequest,
+) (*repository.DeleteDocumentResponse, error) {
+	res, err := s.ReplicationSink.Delete(ctx, req)
+
+	shadowReq := ShadowDelete(s.mode, req, err)
+	if shadowReq == nil {
+		return res, err //nolint: wrapcheck
+	}
+
+	s.enqueue(shadowWrite{
+		ctx:        ctx,
+		document:   req.Uuid,
+		primaryErr: err,
+		write: func(ctx context.Context) (int64, error) {
+			_, err := s.shadow.Delete(ctx, shadowReq)
+
+			return 0, err //nolint: wrapcheck
+		},
+	})
+
+	return res, err //nolint: wrapcheck
+}
+
+// enqueue queues a shadow write without waiting for it. The writes are made
+// in order by a single goroutine that runs as long as there are queued
+// writes.
+func (s *shadowSink) enqueue(w shadowWrite) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.pending) >= shadowQueueSize {
+		s.metrics.shadowWrite(s.target, ShadowDropped)
+
+		s.logger.WarnContext(w.ctx, "dropped shadow write, the shadow target is behind",
+			elephantine.LogKeyDocumentUUID, w.document,
+		)
+
+		return
+	}
+
+	s.pending = append(s.pending, w)
+
+	if !s.running {
+		s.running = true
+
+		go s.drain()
+	}
+}
+
+func (s *shadowSink) drain() {
+	for {
+		s.mu.Lock()
+
+		if len(s.pending) == 0 {
+			s.running = false
+			s.mu.Unlock()
+
+			return
+		}
+
+		w := s.pending[0]
+		s.pending = s.pending[1:]
+
+		s.mu.Unlock()
+
+		s.run(w)
+	}
+}
+
+func (s *shadowSink) run(w shadowWrite) {
+	// The primary write has finished, so the shadow write must outlive
+	// the cancellation of the event.
+	ctx, cancel := context.WithTimeout(
+		context.WithoutCancel(w.ctx), shadowWriteTimeout)
+	defer cancel()
+
+	version, err := w.write(ctx)
+
+	result := CompareShadowWrite(s.mode, w.primaryVersion, w.primaryErr, version, err)
+
+	s.metrics.shadowWrite(s.target, result)
+
+	if result == ShadowMatch {
+		return
+	}
+
+	args := []any{
+		elephantine.LogKeyDocumentUUID, w.document,
+		"result", result,
+		"primary_version", w.primaryVersion,
+		"shadow_version", version,
+	}
+
+	if w.primaryErr != nil {
+		args = append(args, "primary_error", w.primaryErr.Error())
+	}
+
+	if err != nil {
+		args = append(args, "shadow_error", err.Error())
+	}
+
+	s.logger.WarnContext(ctx, "shadow write differs from the primary", args...)
+}
+
+// shadowSink wraps the sink of a target if it has a shadow target.
+func (tm *TargetManager) shadowSink(
+	ctx context.Context, logger *slog.Logger,
+	target postgres.ReplicationTarget, primary ReplicationSink,
+) (ReplicationSink, error) {
+	repoURL, ok := tm.opts.Shadow.Targets[target.Name]
+	if !ok {
+		return primary, nil
+	}
+
+	shadowTarget := target
+	shadowTarget.RepositoryUrl = repoURL
+
+	clients, err := tm.newSink(ctx, shadowTarget)
+	if err != nil {
+		return nil, fmt.Errorf("create shadow sink: %w", err)
+	}
+
+	return &shadowSink{
+		ReplicationSink: primary,
+		shadow:          clients.Documents,
+		mode:            tm.opts.Shadow.Mode,
+		target:          target.Name,
+		logger:          logger.With("shadow", repoURL),
+		metrics:         tm.opts.Metrics,
+	}, nil
+}
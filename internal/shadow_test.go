@@ -0,0 +1,148 @@
+package internal_test
+
+import (
+	"errors"
+	"testing"
+
+	rpc_newsdoc "github.com/ttab/elephant-api/newsdoc"
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/internal"
+	"github.com/twitchtv/twirp"
+)
+
+func TestParseShadowTargets(t *testing.T) {
+	targets, err := internal.ParseShadowTargets([]string{
+		"production=https://repository.new.example.com",
+	})
+	if err != nil {
+		t.Fatalf("parse shadow targets: %v", err)
+	}
+
+	if targets["production"] != "https://repository.new.example.com" {
+		t.Errorf("unexpected shadow targets: %v", targets)
+	}
+
+	invalid := [][]string{
+		{"production"},
+		{"=https://repository.new.example.com"},
+		{"production=https://a.example.com", "production=https://b.example.com"},
+	}
+
+	for _, specs := range invalid {
+		_, err := internal.ParseShadowTargets(specs)
+		if err == nil {
+			t.Errorf("expected an error for %v", specs)
+		}
+	}
+}
+
+func TestParseShadowMode(t *testing.T) {
+	mode, err := internal.ParseShadowMode("")
+	if err != nil || mode != internal.ShadowOutcome {
+		t.Errorf("expected the outcome mode by default, got %q: %v", mode, err)
+	}
+
+	_, err = internal.ParseShadowMode("mirror")
+	if err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
+
+func TestCompareShadowWrite(t *testing.T) {
+	failed := errors.New("failed")
+
+	cases := []struct {
+		name           string
+		mode           internal.ShadowMode
+		primaryVersion int64
+		primaryErr     error
+		shadowVersion  int64
+		shadowErr      error
+		want           internal.ShadowResult
+	}{
+		{"same versions", internal.ShadowVersion, 3, nil, 3, nil, internal.ShadowMatch},
+		{"other versions", internal.ShadowVersion, 3, nil, 7, nil, internal.ShadowVersionMismatch},
+		{"versions not compared", internal.ShadowOutcome, 3, nil, 7, nil, internal.ShadowMatch},
+		{"shadow failed", internal.ShadowOutcome, 3, nil, 0, failed, internal.ShadowOutcomeMismatch},
+		{"primary failed", internal.ShadowOutcome, 0, failed, 7, nil, internal.ShadowOutcomeMismatch},
+		{"both failed", internal.ShadowVersion, 0, failed, 0, failed, internal.ShadowMatch},
+	}
+
+	for _, c := range cases {
+		got := internal.CompareShadowWrite(c.mode,
+			c.primaryVersion, c.primaryErr, c.shadowVersion, c.shadowErr)
+		if got != c.want {
+			t.Errorf("%s: expected %q, got %q", c.name, c.want, got)
+		}
+	}
+}
+
+func TestShadowUpdateStatuses(t *testing.T) {
+	statusUpdate := &repository.UpdateRequest{
+		Uuid:    fakeUUID,
+		IfMatch: 4,
+		Status: []*repository.StatusUpdate{
+			{Name: "usable", Version: 3, IfMatch: 12},
+		},
+	}
+
+	shadowReq := internal.ShadowUpdate(internal.ShadowOutcome, statusUpdate, nil)
+	if shadowReq != nil {
+		t.Errorf("expected statuses on primary versions to not be mirrored, got %v",
+			shadowReq)
+	}
+
+	shadowReq = internal.ShadowUpdate(internal.ShadowVersion, statusUpdate, nil)
+	if len(shadowReq.GetStatus()) != 1 || shadowReq.Status[0].Version != 3 ||
+		shadowReq.Status[0].IfMatch != 12 || shadowReq.IfMatch != 4 {
+		t.Errorf("expected the status to be mirrored as is in version mode, got %v",
+			shadowReq)
+	}
+
+	versionUpdate := &repository.UpdateRequest{
+		Uuid:     fakeUUID,
+		IfMatch:  4,
+		Document: &rpc_newsdoc.Document{Uuid: fakeUUID},
+		Status: []*repository.StatusUpdate{
+			{Name: "usable", IfMatch: 12},
+			{Name: "done", Version: 3},
+		},
+	}
+
+	shadowReq = internal.ShadowUpdate(internal.ShadowOutcome, versionUpdate, nil)
+	if shadowReq.GetIfMatch() != 0 || len(shadowReq.GetStatus()) != 1 ||
+		shadowReq.Status[0].Name != "usable" || shadowReq.Status[0].IfMatch != 0 {
+		t.Errorf("expected only the status of the new version without locks, got %v",
+			shadowReq)
+	}
+
+	if len(versionUpdate.Status) != 2 || versionUpdate.IfMatch != 4 {
+		t.Error("expected the primary update to be left as it was")
+	}
+}
+
+func TestShadowLockConflicts(t *testing.T) {
+	conflict := twirp.NewError(twirp.FailedPrecondition, "version mismatch")
+	update := &repository.UpdateRequest{
+		Uuid:     fakeUUID,
+		IfMatch:  4,
+		Document: &rpc_newsdoc.Document{Uuid: fakeUUID},
+	}
+	del := &repository.DeleteDocumentRequest{Uuid: fakeUUID, IfMatch: 4}
+
+	if internal.ShadowUpdate(internal.ShadowOutcome, update, conflict) != nil {
+		t.Error("expected updates that failed on a lock to not be mirrored")
+	}
+
+	if internal.ShadowDelete(internal.ShadowOutcome, del, conflict) != nil {
+		t.Error("expected deletes that failed on a lock to not be mirrored")
+	}
+
+	if req := internal.ShadowDelete(internal.ShadowOutcome, del, nil); req.GetIfMatch() != 0 {
+		t.Errorf("expected the delete to be sent without a lock, got %v", req)
+	}
+
+	if req := internal.ShadowDelete(internal.ShadowVersion, del, conflict); req.GetIfMatch() != 4 {
+		t.Errorf("expected the delete to keep its lock in version mode, got %v", req)
+	}
+}
@@ -0,0 +1,197 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephantine"
+	"github.com/twitchtv/twirp"
+)
+
+// SourceShard is one of the repositories of a sharded source. Every shard has
+// its own eventlog that is followed separately, while the targets, version
+// mappings, and other replication data are shared. Document UUIDs must be
+// unique across the shards.
+type SourceShard struct {
+	// Name identifies the shard in state keys, job locks, and metrics.
+	Name string
+	// Documents is the client for the repository of the shard.
+	Documents repository.Documents
+}
+
+// SourceShardURL is a source shard given as a repository URL.
+type SourceShardURL struct {
+	Name string
+	URL  string
+}
+
+var shardNamePattern = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// ParseSourceShards parses source shards in the format "[name]=[repository
+// URL]".
+func ParseSourceShards(specs []string) ([]SourceShardURL, error) {
+	shards := make([]SourceShardURL, 0, len(specs))
+	seen := make(map[string]bool, len(specs))
+
+	for _, s := range specs {
+		name, repoURL, ok := strings.Cut(s, "=")
+		if !ok || repoURL == "" {
+			return nil, fmt.Errorf("invalid source shard %q", s)
+		}
+
+		err := validateShardName(name)
+		if err != nil {
+			return nil, err
+		}
+
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate source shard %q", name)
+		}
+
+		u, err := url.Parse(repoURL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid repository URL for source shard %q", name)
+		}
+
+		seen[name] = true
+
+		shards = append(shards, SourceShardURL{
+			Name: name,
+			URL:  repoURL,
+		})
+	}
+
+	return shards, nil
+}
+
+func validateShardName(name string) error {
+	if !shardNamePattern.MatchString(name) {
+		return fmt.Errorf(
+			"invalid source shard name %q, must be lower case letters, digits, dashes or underscores",
+			name)
+	}
+
+	return nil
+}
+
+// shardKey adds the shard suffix to a target state key, state keys of
+// unsharded sources don't have a suffix.
+func shardKey(key string, shard string) string {
+	if shard == "" {
+		return key
+	}
+
+	return shardKeyPrefix(key) + shard
+}
+
+// shardKeyPrefix returns the prefix of the shard state keys for a target state
+// key.
+func shardKeyPrefix(key string) string {
+	return key + "_"
+}
+
+// shardRegisterer labels the metrics of a shard with its name.
+func shardRegisterer(reg prometheus.Registerer, shard string) prometheus.Registerer {
+	if shard == "" {
+		return reg
+	}
+
+	return prometheus.WrapRegistererWith(prometheus.Labels{
+		"shard": shard,
+	}, reg)
+}
+
+// shardLookupDocuments reads documents from whichever shard has them. The
+// eventlog and all other methods use the first shard.
+type shardLookupDocuments struct {
+	repository.Documents
+
+	shards []repository.Documents
+}
+
+// newShardLookup returns a documents client that looks up documents in the
+// given shards in order, moving on to the next shard when a document isn't
+// found.
+func newShardLookup(shards []repository.Documents) repository.Documents {
+	if len(shards) == 1 {
+		return shards[0]
+	}
+
+	return &shardLookupDocuments{
+		Documents: shards[0],
+		shards:    shards,
+	}
+}
+
+func lookupShards[Req any, Res any](
+	ctx context.Context, shards []repository.Documents, req Req,
+	fn func(repository.Documents, context.Context, Req) (Res, error),
+) (Res, error) {
+	var (
+		res Res
+		err error
+	)
+
+	for _, s := range shards {
+		res, err = fn(s, ctx, req)
+		if !elephantine.IsTwirpErrorCode(err, twirp.NotFound) {
+			break
+		}
+	}
+
+	return res, err //nolint: wrapcheck
+}
+
+// Get implements repository.Documents.
+func (d *shardLookupDocuments) Get(
+	ctx context.Context, req *repository.GetDocumentRequest,
+) (*repository.GetDocumentResponse, error) {
+	return lookupShards(ctx, d.shards, req, repository.Documents.Get)
+}
+
+// GetMeta implements repository.Documents.
+func (d *shardLookupDocuments) GetMeta(
+	ctx context.Context, req *repository.GetMetaRequest,
+) (*repository.GetMetaResponse, error) {
+	return lookupShards(ctx, d.shards, req, repository.Documents.GetMeta)
+}
+
+// GetStatus implements repository.Documents.
+func (d *shardLookupDocuments) GetStatus(
+	ctx context.Context, req *repository.GetStatusRequest,
+) (*repository.GetStatusResponse, error) {
+	return lookupShards(ctx, d.shards, req, repository.Documents.GetStatus)
+}
+
+// GetHistory implements repository.Documents.
+func (d *shardLookupDocuments) GetHistory(
+	ctx context.Context, req *repository.GetHistoryRequest,
+) (*repository.GetHistoryResponse, error) {
+	return lookupShards(ctx, d.shards, req, repository.Documents.GetHistory)
+}
+
+// GetAttachments implements repository.Documents, the attachments of all
+// shards are combined.
+func (d *shardLookupDocuments) GetAttachments(
+	ctx context.Context, req *repository.GetAttachmentsRequest,
+) (*repository.GetAttachmentsResponse, error) {
+	var res repository.GetAttachmentsResponse
+
+	for _, s := range d.shards {
+		r, err := s.GetAttachments(ctx, req)
+		if elephantine.IsTwirpErrorCode(err, twirp.NotFound) {
+			continue
+		} else if err != nil {
+			return nil, err //nolint: wrapcheck
+		}
+
+		res.Attachments = append(res.Attachments, r.Attachments...)
+	}
+
+	return &res, nil
+}
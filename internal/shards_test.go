@@ -0,0 +1,152 @@
+package internal_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/ttab/elephant-replicant/internal"
+	"github.com/ttab/elephant-replicant/postgres"
+)
+
+func TestParseSourceShards(t *testing.T) {
+	shards, err := internal.ParseSourceShards([]string{
+		"north=https://north.example.com",
+		"south_2=http://south:1080",
+	})
+	if err != nil {
+		t.Fatalf("parse source shards: %v", err)
+	}
+
+	want := []internal.SourceShardURL{
+		{Name: "north", URL: "https://north.example.com"},
+		{Name: "south_2", URL: "http://south:1080"},
+	}
+
+	if len(shards) != len(want) {
+		t.Fatalf("expected %d shards, got %d", len(want), len(shards))
+	}
+
+	for i := range want {
+		if shards[i] != want[i] {
+			t.Errorf("expected shard %d to be %v, got %v", i, want[i], shards[i])
+		}
+	}
+
+	invalid := [][]string{
+		{"north"},
+		{"north="},
+		{"North=https://north.example.com"},
+		{"=https://north.example.com"},
+		{"north=north.example.com"},
+		{"north=https://a.example.com", "north=https://b.example.com"},
+	}
+
+	for _, specs := range invalid {
+		_, err := internal.ParseSourceShards(specs)
+		if err == nil {
+			t.Errorf("expected %q to be rejected", specs)
+		}
+	}
+}
+
+// upsertDB records the rows written by upserts by their conflict key.
+type upsertDB struct {
+	rows map[string]int
+}
+
+var (
+	insertPattern = regexp.MustCompile(
+		`(?s)INSERT INTO (\w+)\s*\(([^)]*)\)\s*VALUES\s*\(([^)]*)\)\s*ON CONFLICT \(([^)]*)\)`)
+	splitPattern = regexp.MustCompile(`\s*,\s*`)
+)
+
+func (db *upsertDB) Exec(
+	_ context.Context, sql string, args ...any,
+) (pgconn.CommandTag, error) {
+	m := insertPattern.FindStringSubmatch(sql)
+	if m == nil {
+		return pgconn.CommandTag{}, fmt.Errorf("not an upsert: %s", sql)
+	}
+
+	columns := splitPattern.Split(strings.TrimSpace(m[2]), -1)
+	values := splitPattern.Split(strings.TrimSpace(m[3]), -1)
+
+	byColumn := make(map[string]any, len(columns))
+
+	for i, col := range columns {
+		n, err := strconv.Atoi(strings.TrimPrefix(values[i], "$"))
+		if err != nil {
+			return pgconn.CommandTag{}, fmt.Errorf("parse placeholder: %w", err)
+		}
+
+		byColumn[col] = args[n-1]
+	}
+
+	key := []string{m[1]}
+
+	for _, col := range splitPattern.Split(strings.TrimSpace(m[4]), -1) {
+		key = append(key, fmt.Sprint(byColumn[col]))
+	}
+
+	db.rows[strings.Join(key, "/")]++
+
+	return pgconn.CommandTag{}, nil
+}
+
+func (db *upsertDB) Query(context.Context, string, ...any) (pgx.Rows, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (db *upsertDB) QueryRow(context.Context, string, ...any) pgx.Row {
+	return nil
+}
+
+func TestShardEventIDCollisions(t *testing.T) {
+	ctx := t.Context()
+	db := upsertDB{rows: make(map[string]int)}
+	q := postgres.New(&db)
+
+	for _, shard := range []string{"north", "south"} {
+		err := q.AddReplicationError(ctx, postgres.AddReplicationErrorParams{
+			TargetName: "production",
+			Shard:      shard,
+			EventID:    42,
+			ID:         uuid.New(),
+		})
+		if err != nil {
+			t.Fatalf("add replication error: %v", err)
+		}
+
+		err = q.AddDeadLetter(ctx, postgres.AddDeadLetterParams{
+			TargetName: "production",
+			Shard:      shard,
+			EventID:    42,
+		})
+		if err != nil {
+			t.Fatalf("add dead letter: %v", err)
+		}
+
+		err = q.AddReplicationConflict(ctx, postgres.AddReplicationConflictParams{
+			TargetName: "production",
+			Shard:      shard,
+			EventID:    42,
+			ID:         uuid.New(),
+		})
+		if err != nil {
+			t.Fatalf("add replication conflict: %v", err)
+		}
+	}
+
+	if len(db.rows) != 6 {
+		t.Fatalf("expected the same event ID in two shards to give separate rows, got %v",
+			db.rows)
+	}
+}
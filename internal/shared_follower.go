@@ -0,0 +1,263 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/postgres"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// sharedEventlogSize is the number of recent events that are kept for
+	// the workers that are behind the end of the eventlog.
+	sharedEventlogSize = 1000
+	// sharedPollMargin is added to the wait of a shared eventlog poll to
+	// bound the time it can take.
+	sharedPollMargin = 30 * time.Second
+	// sharedStateInterval is the minimum time between stores of the
+	// shared follower state.
+	sharedStateInterval = 10 * time.Second
+)
+
+// sharedFollowerStateKey is the state key of the minimum log position that
+// has been persisted by the enabled targets.
+const sharedFollowerStateKey = "shared_follower"
+
+// sharedEventlog lets the workers of all targets in a process share their
+// reads of the source eventlog. Every worker still has its own log follower
+// and position, so the targets advance independently, but a poll of the end
+// of the eventlog is made once for all workers that are waiting for it, and
+// the events are kept so that workers that are a bit behind get them without
+// reading the source again. Workers that are further behind, and workers that
+// are catching up using the compacted eventlog, read the source directly.
+//
+// The minimum log position that has been persisted by the enabled targets is
+// stored under the shared follower state key, all events after it are yet to
+// be handled by at least one target.
+type sharedEventlog struct {
+	repository.Documents
+
+	db    *pgxpool.Pool
+	shard string
+
+	mu sync.Mutex
+	// events are the events after start, up to and including end.
+	start  int64
+	end    int64
+	events []*repository.EventlogItem
+	// poll is set while the end of the eventlog is being read.
+	poll *sharedPoll
+
+	storeMu    sync.Mutex
+	lastStored time.Time
+}
+
+type sharedPoll struct {
+	done  chan struct{}
+	items []*repository.EventlogItem
+	err   error
+}
+
+func newSharedEventlog(
+	docs repository.Documents, db *pgxpool.Pool, shard string,
+) *sharedEventlog {
+	return &sharedEventlog{
+		Documents: docs,
+		db:        db,
+		shard:     shard,
+	}
+}
+
+// Eventlog implements repository.Documents.
+func (s *sharedEventlog) Eventlog(
+	ctx context.Context, req *repository.GetEventlogRequest,
+) (*repository.GetEventlogResponse, error) {
+	// Requests without a batch size, like reads of the last event, aren't
+	// polls of the eventlog.
+	if req.BatchSize <= 0 {
+		return s.Documents.Eventlog(ctx, req) //nolint: wrapcheck
+	}
+
+	for {
+		s.mu.Lock()
+
+		// Nothing has been read yet, start following the eventlog
+		// from the first worker that polls it.
+		if len(s.events) == 0 && s.poll == nil {
+			s.start, s.end = req.After, req.After
+		}
+
+		switch {
+		case req.After >= s.start && req.After < s.end:
+			items := s.eventsAfter(req.After, req.BatchSize)
+
+			s.mu.Unlock()
+
+			return &repository.GetEventlogResponse{Items: items}, nil
+		case req.After == s.end:
+			poll := s.poll
+			if poll == nil {
+				poll = s.startPoll(ctx, req)
+			}
+
+			s.mu.Unlock()
+
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err() //nolint: wrapcheck
+			case <-poll.done:
+			}
+
+			if poll.err != nil {
+				return nil, poll.err //nolint: wrapcheck
+			}
+
+			if len(poll.items) == 0 {
+				return &repository.GetEventlogResponse{}, nil
+			}
+
+			// The events are returned from the kept events.
+			continue
+		default:
+			s.mu.Unlock()
+
+			return s.Documents.Eventlog(ctx, req) //nolint: wrapcheck
+		}
+	}
+}
+
+// eventsAfter returns copies of the kept events after the position, the
+// workers modify the events that they handle.
+func (s *sharedEventlog) eventsAfter(
+	after int64, batchSize int32,
+) []*repository.EventlogItem {
+	idx, _ := slices.BinarySearchFunc(s.events, after,
+		func(item *repository.EventlogItem, pos int64) int {
+			if item.Id <= pos {
+				return -1
+			}
+
+			return 1
+		})
+
+	events := s.events[idx:]
+	if len(events) > int(batchSize) {
+		events = events[:batchSize]
+	}
+
+	items := make([]*repository.EventlogItem, len(events))
+
+	for i, item := range events {
+		items[i] = proto.CloneOf(item)
+	}
+
+	return items
+}
+
+// startPoll reads the events after the end of the kept events. Must be called
+// with the lock held.
+func (s *sharedEventlog) startPoll(
+	ctx context.Context, req *repository.GetEventlogRequest,
+) *sharedPoll {
+	poll := sharedPoll{done: make(chan struct{})}
+	after := s.end
+
+	s.poll = &poll
+
+	// The poll is shared by all waiting workers, so it must outlive the
+	// cancellation of the worker that started it.
+	pollCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx),
+		time.Duration(req.WaitMs)*time.Millisecond+sharedPollMargin)
+
+	go func() {
+		defer cancel()
+
+		res, err := s.Documents.Eventlog(pollCtx, &repository.GetEventlogRequest{
+			After:     after,
+			BatchSize: req.BatchSize,
+			WaitMs:    req.WaitMs,
+		})
+
+		s.mu.Lock()
+
+		if err == nil && s.end == after {
+			s.keep(res.Items)
+		}
+
+		poll.items = res.GetItems()
+		poll.err = err
+		s.poll = nil
+
+		s.mu.Unlock()
+
+		close(poll.done)
+	}()
+
+	return &poll
+}
+
+// keep adds the events to the kept events, dropping the oldest events once
+// there are more than sharedEventlogSize. Must be called with the lock held.
+func (s *sharedEventlog) keep(items []*repository.EventlogItem) {
+	if len(items) == 0 {
+		return
+	}
+
+	s.events = append(s.events, items...)
+	s.end = items[len(items)-1].Id
+
+	if over := len(s.events) - sharedEventlogSize; over > 0 {
+		s.start = s.events[over-1].Id
+		s.events = slices.Clone(s.events[over:])
+	}
+}
+
+// Commit stores the minimum log position that has been persisted by the
+// enabled targets. It's called every time a worker persists its position, but
+// the minimum is stored at most once every sharedStateInterval.
+func (s *sharedEventlog) Commit(ctx context.Context) error {
+	s.storeMu.Lock()
+	defer s.storeMu.Unlock()
+
+	if time.Since(s.lastStored) < sharedStateInterval {
+		return nil
+	}
+
+	q := postgres.New(s.db)
+
+	targets, err := q.ListEnabledTargets(ctx)
+	if err != nil {
+		return fmt.Errorf("list enabled targets: %w", err)
+	}
+
+	keys := make([]string, len(targets))
+
+	for i, t := range targets {
+		keys[i] = shardKey(logStateKey(t.Name), s.shard)
+	}
+
+	minPos, err := q.GetMinLogPosition(ctx, keys)
+	if err != nil {
+		return fmt.Errorf("get minimum log position: %w", err)
+	}
+
+	now := time.Now()
+
+	err = StoreState(ctx, q, shardKey(sharedFollowerStateKey, s.shard), LogState{
+		Position:    minPos,
+		LastUpdated: now,
+	})
+	if err != nil {
+		return fmt.Errorf("store shared follower state: %w", err)
+	}
+
+	s.lastStored = now
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package internal_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/internal"
+	"github.com/ttab/koonkie"
+)
+
+// countingEventlog serves a fixed eventlog and counts the polls.
+type countingEventlog struct {
+	repository.Documents
+
+	mu     sync.Mutex
+	events []*repository.EventlogItem
+	polls  int
+}
+
+func newCountingEventlog(n int) *countingEventlog {
+	l := countingEventlog{}
+
+	for i := range n {
+		l.events = append(l.events, &repository.EventlogItem{
+			Id:    int64(i + 1),
+			Event: internal.TypeDocumentVersion,
+			Uuid:  fakeUUID,
+		})
+	}
+
+	return &l
+}
+
+func (l *countingEventlog) Eventlog(
+	_ context.Context, req *repository.GetEventlogRequest,
+) (*repository.GetEventlogResponse, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.polls++
+
+	var items []*repository.EventlogItem
+
+	for _, evt := range l.events {
+		if evt.Id > req.After && len(items) < int(req.BatchSize) {
+			items = append(items, evt)
+		}
+	}
+
+	return &repository.GetEventlogResponse{Items: items}, nil
+}
+
+func sharedFollower(docs repository.Documents, after int64) *koonkie.LogFollower {
+	return koonkie.NewLogFollower(docs, koonkie.FollowerOptions{
+		StartAfter: after,
+		CaughtUp:   true,
+	})
+}
+
+func TestSharedEventlogReadsOnce(t *testing.T) {
+	source := newCountingEventlog(150)
+	shared := internal.NewSharedEventlog(source)
+
+	first := sharedFollower(shared, 0)
+	second := sharedFollower(shared, 0)
+
+	items, err := first.GetNext(t.Context())
+	if err != nil {
+		t.Fatalf("read first target: %v", err)
+	}
+
+	// The last event is read separately before the first poll.
+	polls := source.polls
+
+	items[0].Version = 99
+
+	other, err := second.GetNext(t.Context())
+	if err != nil {
+		t.Fatalf("read second target: %v", err)
+	}
+
+	if len(other) != len(items) || other[0].Id != 1 {
+		t.Fatalf("expected the second target to get the same %d events, got %d",
+			len(items), len(other))
+	}
+
+	if source.polls != polls+1 {
+		t.Errorf("expected the events to be read from the source once, got %d polls",
+			source.polls-polls)
+	}
+
+	if other[0].Version == 99 {
+		t.Error("expected every target to get its own copy of the events")
+	}
+
+	// The second target is now at the end of the kept events and reads the
+	// next batch for both.
+	_, err = second.GetNext(t.Context())
+	if err != nil {
+		t.Fatalf("read second target: %v", err)
+	}
+
+	pos, _ := second.GetState()
+
+	if pos != 150 {
+		t.Errorf("expected the second target to be at the end of the eventlog, got %d", pos)
+	}
+
+	polls = source.polls
+
+	_, err = first.GetNext(t.Context())
+	if err != nil {
+		t.Fatalf("read first target: %v", err)
+	}
+
+	if pos, _ := first.GetState(); pos != 150 || source.polls != polls {
+		t.Errorf("expected the first target to catch up from the kept events, got position %d after %d polls",
+			pos, source.polls-polls)
+	}
+}
+
+func TestSharedEventlogLaggingTarget(t *testing.T) {
+	source := newCountingEventlog(1500)
+	shared := internal.NewSharedEventlog(source)
+
+	leader := sharedFollower(shared, 300)
+
+	for {
+		_, err := leader.GetNext(t.Context())
+		if err != nil {
+			t.Fatalf("read leading target: %v", err)
+		}
+
+		if pos, _ := leader.GetState(); pos == 1500 {
+			break
+		}
+	}
+
+	// The events that the lagging target needs are no longer kept, it
+	// reads them from the source on its own.
+	lagging := sharedFollower(shared, 100)
+
+	items, err := lagging.GetNext(t.Context())
+	if err != nil {
+		t.Fatalf("read lagging target: %v", err)
+	}
+
+	if len(items) == 0 || items[0].Id != 101 {
+		t.Fatalf("expected the lagging target to get the events after its position, got %v",
+			items)
+	}
+}
@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"context"
+	"errors"
+)
+
+// errStopped is returned by the replication loop when it has stopped at an
+// event boundary because the process is shutting down.
+var errStopped = errors.New("stopped for shutdown")
+
+// stopRequested returns true if the process has started shutting down.
+func (w *Worker) stopRequested() bool {
+	select {
+	case <-w.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// readContext returns a context that is cancelled when the process starts
+// shutting down, so that waiting for new events doesn't hold up the shutdown,
+// or with errPollRequested as the cause when an immediate poll is requested.
+func (w *Worker) readContext(ctx context.Context) (context.Context, func()) {
+	readCtx, cancel := context.WithCancelCause(ctx)
+
+	if w.stop == nil && w.poll == nil {
+		return readCtx, func() { cancel(nil) }
+	}
+
+	go func() {
+		select {
+		case <-w.stop:
+			cancel(nil)
+		case <-w.poll:
+			cancel(errPollRequested)
+		case <-readCtx.Done():
+		}
+	}()
+
+	return readCtx, func() { cancel(nil) }
+}
+
+// drainAll waits for all workers to stop at an event boundary. Workers that
+// aren't replicating yet, f.ex. because they're waiting for the job lock, are
+// cancelled right away. Workers are still cancelled if the context is done
+// before they have stopped.
+func (tm *TargetManager) drainAll(ctx context.Context) {
+	tm.mu.Lock()
+	workers := make(map[string]*targetWorker, len(tm.workers))
+
+	for k, v := range tm.workers {
+		workers[k] = v
+
+		if v.worker == nil {
+			v.cancel()
+		}
+	}
+
+	tm.workers = make(map[string]*targetWorker)
+
+	tm.mu.Unlock()
+
+	for _, tw := range workers {
+		select {
+		case <-tw.done:
+		case <-ctx.Done():
+			tw.cancel()
+			<-tw.done
+		}
+	}
+
+	for _, tw := range workers {
+		tw.cancel()
+	}
+}
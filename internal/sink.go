@@ -0,0 +1,182 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/postgres"
+	"github.com/ttab/elephantine"
+	"golang.org/x/oauth2"
+)
+
+// ReplicationSink is the destination that a target replicates to. The version
+// mappings are kept by the replicant, so sinks only have to store the changes
+// they're given. The Elephant repository client is the default sink, and the
+// requests and responses follow the semantics of the repository API.
+type ReplicationSink interface {
+	// Update upserts a document together with its statuses and ACL.
+	// Returns a twirp FailedPrecondition error if IfMatch is set and
+	// doesn't match the current version of the document.
+	Update(
+		ctx context.Context, req *repository.UpdateRequest,
+	) (*repository.UpdateResponse, error)
+	// Delete removes a document.
+	Delete(
+		ctx context.Context, req *repository.DeleteDocumentRequest,
+	) (*repository.DeleteDocumentResponse, error)
+	// Get reads the current version of a document, or its meta document.
+	// Returns a twirp NotFound error if the document doesn't exist.
+	Get(
+		ctx context.Context, req *repository.GetDocumentRequest,
+	) (*repository.GetDocumentResponse, error)
+	// GetMeta reads the current version and attachments of a document.
+	// Returns a twirp NotFound error if the document doesn't exist.
+	GetMeta(
+		ctx context.Context, req *repository.GetMetaRequest,
+	) (*repository.GetMetaResponse, error)
+	// CreateUpload returns an upload ID and the URL that an attachment
+	// object should be uploaded to with a PUT request. The upload ID is
+	// then used to attach the object in an update.
+	CreateUpload(
+		ctx context.Context, req *repository.CreateUploadRequest,
+	) (*repository.CreateUploadResponse, error)
+}
+
+// WorkflowSink is implemented by sinks that support workflow configurations.
+// Workflow events are skipped for sinks that don't.
+type WorkflowSink interface {
+	GetWorkflow(
+		ctx context.Context, req *repository.GetWorkflowRequest,
+	) (*repository.GetWorkflowResponse, error)
+	SetWorkflow(
+		ctx context.Context, req *repository.SetWorkflowRequest,
+	) (*repository.SetWorkflowResponse, error)
+}
+
+// MultipartSink is implemented by sinks that support uploading large
+// attachments in parts. Attachments are uploaded with a single PUT for sinks
+// that don't.
+type MultipartSink interface {
+	CreateMultipartUpload(
+		ctx context.Context, req *repository.CreateUploadRequest,
+	) (MultipartUpload, error)
+}
+
+// MultipartUpload is a multipart upload in progress. Errors marked with
+// Retryable are retried for the part that failed.
+type MultipartUpload interface {
+	// ID is the upload ID that the object is attached with once the
+	// upload has been completed.
+	ID() string
+	// UploadPart uploads a part of the object, parts are numbered from
+	// one.
+	UploadPart(ctx context.Context, number int, data []byte) error
+	// Complete assembles the uploaded parts into the object.
+	Complete(ctx context.Context) error
+	// Abort removes the uploaded parts.
+	Abort(ctx context.Context) error
+}
+
+var (
+	_ ReplicationSink = repository.Documents(nil)
+	_ WorkflowSink    = repository.Workflows(nil)
+)
+
+// SinkConfig is the target configuration passed to sink factories.
+type SinkConfig struct {
+	Name         string
+	URL          *url.URL
+	OIDCConfig   string
+	ClientID     string
+	ClientSecret string
+}
+
+// SinkFactory creates a sink for a target.
+type SinkFactory func(ctx context.Context, conf SinkConfig) (ReplicationSink, error)
+
+// sinkClients are the clients for a target sink. Workflows and Tokens are nil
+// if the sink doesn't support them.
+type sinkClients struct {
+	Documents ReplicationSink
+	Workflows WorkflowSink
+	Tokens    TokenRefresher
+}
+
+// newSink creates the sink for a target. Targets with a repository URL scheme
+// that has a registered sink factory use that sink, all other targets are
+// replicated to an Elephant repository.
+func (tm *TargetManager) newSink(
+	ctx context.Context, target postgres.ReplicationTarget,
+) (sinkClients, error) {
+	var clients sinkClients
+
+	clientSecret, err := DecryptSecret(tm.encryptionKey, target.ClientSecret)
+	if err != nil {
+		return clients, fmt.Errorf("decrypt client secret: %w", err)
+	}
+
+	repoURL, err := url.Parse(target.RepositoryUrl)
+	if err != nil {
+		return clients, fmt.Errorf("invalid repository URL: %w", err)
+	}
+
+	factory, ok := tm.opts.Sinks[repoURL.Scheme]
+	if ok {
+		sink, err := factory(ctx, SinkConfig{
+			Name:         target.Name,
+			URL:          repoURL,
+			OIDCConfig:   target.OidcConfig,
+			ClientID:     target.ClientID,
+			ClientSecret: clientSecret,
+		})
+		if err != nil {
+			return clients, fmt.Errorf("create %q sink: %w",
+				repoURL.Scheme, err)
+		}
+
+		clients.Documents = sink
+		clients.Workflows, _ = sink.(WorkflowSink)
+		clients.Tokens, _ = sink.(TokenRefresher)
+
+		return clients, nil
+	}
+
+	scopes := []string{"doc_admin"}
+
+	if tm.opts.ReplicateWorkflows {
+		scopes = append(scopes, "workflow_admin")
+	}
+
+	auth, err := elephantine.AuthenticationConfigFromSettings(
+		ctx,
+		elephantine.AuthenticationSettings{
+			OIDCConfig:   target.OidcConfig,
+			ClientID:     target.ClientID,
+			ClientSecret: clientSecret,
+		},
+		scopes,
+	)
+	if err != nil {
+		return clients, fmt.Errorf("set up target authentication: %w", err)
+	}
+
+	tokens := NewRefreshingTokenSource(func() (oauth2.TokenSource, error) {
+		return auth.NewTokenSource(ctx, scopes) //nolint: wrapcheck
+	}, tm.opts.TokenRefreshMargin)
+
+	targetClient := NewTokenClient(tokens)
+
+	clients.Documents = repository.NewDocumentsProtobufClient(
+		target.RepositoryUrl, targetClient,
+	)
+
+	clients.Workflows = repository.NewWorkflowsProtobufClient(
+		target.RepositoryUrl, targetClient,
+	)
+
+	clients.Tokens = tokens
+
+	return clients, nil
+}
@@ -0,0 +1,169 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/postgres"
+	"github.com/ttab/elephantine"
+	"github.com/twitchtv/twirp"
+)
+
+// isSoftDelete returns true if the delete event can be handled as a soft
+// delete. Deletes that have a delete record can be restored in the source.
+func (w *Worker) isSoftDelete(evt *repository.EventlogItem) bool {
+	return w.softDeleteStatus != "" && evt.DeleteRecordId != 0
+}
+
+// softDelete marks the document as deleted in the target by setting the
+// tombstone status on its current version, instead of deleting it. The version
+// mappings are kept, so that a restore in the source updates the same target
+// document, which also moves the tombstone off the current version. The ACL
+// of the target document is cleared in the same update if configured.
+func (w *Worker) softDelete(
+	ctx context.Context, evt *repository.EventlogItem, docUUID uuid.UUID,
+) error {
+	targetUUID := w.uuidMapping.Map(docUUID)
+
+	targetVersion, err := postgres.New(w.db).GetDocumentVersion(ctx,
+		postgres.GetDocumentVersionParams{
+			TargetName: w.name,
+			ID:         targetUUID,
+		})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("document hasn't been replicated: %w", ErrSkipped)
+	} else if err != nil {
+		return fmt.Errorf("get current target version: %w", err)
+	}
+
+	soft := SoftDelete{
+		Status:         w.softDeleteStatus,
+		ClearACL:       w.softDeleteClearACL,
+		ConflictPolicy: w.conflictPolicy,
+		DryRun:         w.dryRun,
+	}
+
+	update, err := soft.Apply(ctx, w.target, Tombstone{
+		TargetUUID:      targetUUID,
+		TargetVersion:   targetVersion,
+		DeleteRecordID:  evt.DeleteRecordId,
+		ImportDirective: w.importDirective(evt, nil),
+	})
+	if err != nil {
+		return err
+	}
+
+	if w.dryRun {
+		w.logDryRunUpdate(ctx, evt, TypeDeleteDocument, update)
+	}
+
+	return nil
+}
+
+// SoftDelete controls how a deleted document is marked as deleted in the
+// target.
+type SoftDelete struct {
+	// Status is the tombstone status that is set on the current version
+	// of the document.
+	Status string
+	// ClearACL removes all ACL entries of the document.
+	ClearACL bool
+	// ConflictPolicy decides what happens if the document has been
+	// changed in the target.
+	ConflictPolicy ConflictPolicy
+	// DryRun builds the update without sending it to the target.
+	DryRun bool
+}
+
+// Tombstone identifies the target document of a soft delete.
+type Tombstone struct {
+	TargetUUID    uuid.UUID
+	TargetVersion int64
+	// DeleteRecordID is the source delete record that the document can
+	// be restored from.
+	DeleteRecordID  int64
+	ImportDirective *repository.ImportDirective
+}
+
+// Apply sets the tombstone status on the replicated version of the target
+// document, the update fails if the document has been changed in the target
+// unless the conflict policy overwrites changes. Returns the update that was
+// sent, or that would have been sent in a dry run.
+func (s SoftDelete) Apply(
+	ctx context.Context, target ReplicationSink, tomb Tombstone,
+) (*repository.UpdateRequest, error) {
+	var acl []*repository.ACLEntry
+
+	if s.ClearACL {
+		cleared, err := clearedACL(ctx, target, tomb.TargetUUID)
+		if err != nil {
+			return nil, err
+		}
+
+		acl = cleared
+	}
+
+	update := repository.UpdateRequest{
+		Uuid: tomb.TargetUUID.String(),
+		Acl:  acl,
+		Status: []*repository.StatusUpdate{
+			{
+				Name:    s.Status,
+				Version: tomb.TargetVersion,
+				Meta: map[string]string{
+					"original_delete_record": strconv.FormatInt(
+						tomb.DeleteRecordID, 10),
+				},
+			},
+		},
+		IfMatch:         tomb.TargetVersion,
+		ImportDirective: tomb.ImportDirective,
+	}
+
+	if s.DryRun {
+		return &update, nil
+	}
+
+	_, _, err := s.ConflictPolicy.UpdateTarget(ctx, target, &update)
+	if elephantine.IsTwirpErrorCode(err, twirp.FailedPrecondition) {
+		return nil, &ConflictError{
+			TargetUUID:      tomb.TargetUUID,
+			ExpectedVersion: tomb.TargetVersion,
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("set tombstone status: %w", targetError(err))
+	}
+
+	return &update, nil
+}
+
+// clearedACL returns ACL entries without permissions for all grantees of the
+// target document, which removes them when the document is updated.
+func clearedACL(
+	ctx context.Context, target ReplicationSink, targetUUID uuid.UUID,
+) ([]*repository.ACLEntry, error) {
+	meta, err := target.GetMeta(ctx, &repository.GetMetaRequest{
+		Uuid: targetUUID.String(),
+	})
+	if elephantine.IsTwirpErrorCode(err, twirp.NotFound) {
+		return nil, fmt.Errorf("document doesn't exist in the target: %w", ErrSkipped)
+	} else if err != nil {
+		return nil, fmt.Errorf("get target meta: %w", targetError(err))
+	}
+
+	acl := make([]*repository.ACLEntry, 0, len(meta.Meta.Acl))
+
+	for _, entry := range meta.Meta.Acl {
+		acl = append(acl, &repository.ACLEntry{
+			Uri:         entry.Uri,
+			Permissions: []string{},
+		})
+	}
+
+	return acl, nil
+}
@@ -0,0 +1,193 @@
+package internal_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	rpc_newsdoc "github.com/ttab/elephant-api/newsdoc"
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/internal"
+	"google.golang.org/protobuf/proto"
+)
+
+// replicatedDocument creates a target document with two versions and a couple
+// of ACL entries.
+func replicatedDocument(t *testing.T) *internal.FakeDocuments {
+	t.Helper()
+
+	docs := internal.NewFakeDocuments()
+
+	for i := range 2 {
+		_, err := docs.Update(t.Context(), &repository.UpdateRequest{
+			Uuid:     fakeUUID,
+			Document: &rpc_newsdoc.Document{Uuid: fakeUUID, Title: "Replicated"},
+			IfMatch:  int64(i),
+			Acl: []*repository.ACLEntry{
+				{Uri: "core://unit/a", Permissions: []string{"r", "w"}},
+				{Uri: "core://unit/b", Permissions: []string{"r"}},
+			},
+		})
+		if err != nil {
+			t.Fatalf("update document: %v", err)
+		}
+	}
+
+	return docs
+}
+
+func tombstone() internal.Tombstone {
+	return internal.Tombstone{
+		TargetUUID:     uuid.MustParse(fakeUUID),
+		TargetVersion:  2,
+		DeleteRecordID: 17,
+	}
+}
+
+func targetMeta(t *testing.T, docs *internal.FakeDocuments) *repository.DocumentMeta {
+	t.Helper()
+
+	res, err := docs.GetMeta(t.Context(), &repository.GetMetaRequest{
+		Uuid: fakeUUID,
+	})
+	if err != nil {
+		t.Fatalf("get meta: %v", err)
+	}
+
+	return res.Meta
+}
+
+func TestSoftDeleteSetsTombstone(t *testing.T) {
+	docs := replicatedDocument(t)
+
+	var ifMatch int64
+
+	docs.Hook = func(method string, req proto.Message) error {
+		if up, ok := req.(*repository.UpdateRequest); ok {
+			ifMatch = up.IfMatch
+		}
+
+		return nil
+	}
+
+	soft := internal.SoftDelete{Status: "deleted"}
+
+	_, err := soft.Apply(t.Context(), docs, tombstone())
+	if err != nil {
+		t.Fatalf("soft delete: %v", err)
+	}
+
+	if ifMatch != 2 {
+		t.Errorf("expected the update to require version 2, got IfMatch %d", ifMatch)
+	}
+
+	meta := targetMeta(t, docs)
+
+	head := meta.Heads["deleted"]
+	if head == nil || head.Version != 2 {
+		t.Fatalf("expected the tombstone on version 2, got %v", head)
+	}
+
+	if head.Meta["original_delete_record"] != "17" {
+		t.Errorf("expected the delete record in the status meta, got %v", head.Meta)
+	}
+
+	if meta.CurrentVersion != 2 || len(meta.Acl) != 2 {
+		t.Errorf("expected the document and its ACL to be kept, got version %d and %d ACL entries",
+			meta.CurrentVersion, len(meta.Acl))
+	}
+}
+
+func TestSoftDeleteClearsACL(t *testing.T) {
+	docs := replicatedDocument(t)
+
+	soft := internal.SoftDelete{Status: "deleted", ClearACL: true}
+
+	update, err := soft.Apply(t.Context(), docs, tombstone())
+	if err != nil {
+		t.Fatalf("soft delete: %v", err)
+	}
+
+	for _, entry := range update.Acl {
+		if len(entry.Permissions) != 0 {
+			t.Errorf("expected %s to have its permissions removed, got %v",
+				entry.Uri, entry.Permissions)
+		}
+	}
+
+	if len(update.Acl) != 2 {
+		t.Errorf("expected both grantees in the update, got %d", len(update.Acl))
+	}
+
+	meta := targetMeta(t, docs)
+
+	if len(meta.Acl) != 0 {
+		t.Errorf("expected the ACL to be cleared, got %v", meta.Acl)
+	}
+
+	if meta.Heads["deleted"] == nil {
+		t.Error("expected the tombstone status in the same update")
+	}
+}
+
+func TestSoftDeleteConflict(t *testing.T) {
+	docs := replicatedDocument(t)
+	tomb := tombstone()
+
+	tomb.TargetVersion = 1
+
+	_, err := internal.SoftDelete{Status: "deleted"}.Apply(t.Context(), docs, tomb)
+
+	var conflict *internal.ConflictError
+
+	if !errors.As(err, &conflict) || conflict.ExpectedVersion != 1 {
+		t.Fatalf("expected a conflict for a changed document, got %v", err)
+	}
+
+	soft := internal.SoftDelete{
+		Status:         "deleted",
+		ConflictPolicy: internal.ConflictOverwrite,
+	}
+
+	_, err = soft.Apply(t.Context(), docs, tomb)
+	if err != nil {
+		t.Fatalf("expected the tombstone to overwrite target changes, got %v", err)
+	}
+
+	if head := targetMeta(t, docs).Heads["deleted"]; head == nil || head.Version != 1 {
+		t.Errorf("expected the tombstone on the replicated version, got %v", head)
+	}
+}
+
+func TestSoftDeleteDryRun(t *testing.T) {
+	docs := replicatedDocument(t)
+
+	docs.Hook = func(method string, _ proto.Message) error {
+		if method == "Update" {
+			t.Error("expected no updates in dry run")
+		}
+
+		return nil
+	}
+
+	soft := internal.SoftDelete{
+		Status:   "deleted",
+		ClearACL: true,
+		DryRun:   true,
+	}
+
+	update, err := soft.Apply(t.Context(), docs, tombstone())
+	if err != nil {
+		t.Fatalf("soft delete: %v", err)
+	}
+
+	if update.IfMatch != 2 || len(update.Status) != 1 || len(update.Acl) != 2 {
+		t.Errorf("expected the update that would have been sent, got %v", update)
+	}
+
+	meta := targetMeta(t, docs)
+
+	if meta.Heads["deleted"] != nil || len(meta.Acl) != 2 {
+		t.Error("expected the target document to be left as it was")
+	}
+}
@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ttab/elephant-api/repository"
+	"golang.org/x/time/rate"
+)
+
+// SourceRateLimit limits the rate of document reads from the source
+// repository. Eventlog reads aren't limited.
+type SourceRateLimit struct {
+	// PerSecond is the number of reads per second, zero disables the
+	// limit.
+	PerSecond float64
+	// Burst is the number of reads that can be made at once, defaults to
+	// one.
+	Burst int
+}
+
+// Documents wraps the source documents client to apply the rate limit. The
+// returned client is shared by all targets, so the limit applies to the
+// replicant as a whole.
+func (rl SourceRateLimit) Documents(docs repository.Documents) repository.Documents {
+	if rl.PerSecond <= 0 {
+		return docs
+	}
+
+	return &rateLimitedDocuments{
+		Documents: docs,
+		limiter:   rate.NewLimiter(rate.Limit(rl.PerSecond), max(rl.Burst, 1)),
+	}
+}
+
+type rateLimitedDocuments struct {
+	repository.Documents
+
+	limiter *rate.Limiter
+}
+
+func (d *rateLimitedDocuments) wait(ctx context.Context) error {
+	err := d.limiter.Wait(ctx)
+	if err != nil {
+		return fmt.Errorf("wait for source rate limit: %w", err)
+	}
+
+	return nil
+}
+
+// Get implements repository.Documents.
+func (d *rateLimitedDocuments) Get(
+	ctx context.Context, req *repository.GetDocumentRequest,
+) (*repository.GetDocumentResponse, error) {
+	err := d.wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.Documents.Get(ctx, req) //nolint: wrapcheck
+}
+
+// GetMeta implements repository.Documents.
+func (d *rateLimitedDocuments) GetMeta(
+	ctx context.Context, req *repository.GetMetaRequest,
+) (*repository.GetMetaResponse, error) {
+	err := d.wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.Documents.GetMeta(ctx, req) //nolint: wrapcheck
+}
+
+// GetStatus implements repository.Documents.
+func (d *rateLimitedDocuments) GetStatus(
+	ctx context.Context, req *repository.GetStatusRequest,
+) (*repository.GetStatusResponse, error) {
+	err := d.wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.Documents.GetStatus(ctx, req) //nolint: wrapcheck
+}
+
+// GetAttachments implements repository.Documents.
+func (d *rateLimitedDocuments) GetAttachments(
+	ctx context.Context, req *repository.GetAttachmentsRequest,
+) (*repository.GetAttachmentsResponse, error) {
+	err := d.wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.Documents.GetAttachments(ctx, req) //nolint: wrapcheck
+}
+
+// GetHistory implements repository.Documents.
+func (d *rateLimitedDocuments) GetHistory(
+	ctx context.Context, req *repository.GetHistoryRequest,
+) (*repository.GetHistoryResponse, error) {
+	err := d.wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.Documents.GetHistory(ctx, req) //nolint: wrapcheck
+}
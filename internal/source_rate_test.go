@@ -0,0 +1,56 @@
+package internal_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/internal"
+)
+
+type metaCounter struct {
+	repository.Documents
+
+	calls int
+}
+
+func (c *metaCounter) GetMeta(
+	_ context.Context, _ *repository.GetMetaRequest,
+) (*repository.GetMetaResponse, error) {
+	c.calls++
+
+	return &repository.GetMetaResponse{}, nil
+}
+
+func TestSourceRateLimitDisabled(t *testing.T) {
+	counter := &metaCounter{}
+
+	docs := internal.SourceRateLimit{}.Documents(counter)
+	if docs != counter {
+		t.Error("expected the client to be left unwrapped without a limit")
+	}
+}
+
+func TestSourceRateLimitRespectsCancellation(t *testing.T) {
+	counter := &metaCounter{}
+
+	docs := internal.SourceRateLimit{PerSecond: 0.001}.Documents(counter)
+
+	_, err := docs.GetMeta(t.Context(), &repository.GetMetaRequest{})
+	if err != nil {
+		t.Fatalf("expected the first read to use the burst, got: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	_, err = docs.GetMeta(ctx, &repository.GetMetaRequest{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a cancellation error, got: %v", err)
+	}
+
+	if counter.calls != 1 {
+		t.Errorf("got %d calls to the source, want 1", counter.calls)
+	}
+}
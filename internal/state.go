@@ -52,3 +52,60 @@ func StoreState[T any](
 
 	return nil
 }
+
+// ErrStateConflict is returned when state has been changed by someone else
+// since it was loaded.
+var ErrStateConflict = errors.New("state has been changed by another process")
+
+// LoadStateRevision loads state together with its revision, which is used to
+// detect concurrent changes when the state is stored using
+// StoreStateRevision. The revision is zero if the state doesn't exist.
+func LoadStateRevision[T any](
+	ctx context.Context,
+	q *postgres.Queries,
+	name string,
+	state *T,
+) (int64, error) {
+	row, err := q.GetStateWithRevision(ctx, name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("read from database: %w", err)
+	}
+
+	err = json.Unmarshal(row.Value, &state)
+	if err != nil {
+		return 0, fmt.Errorf("unmarshal state: %w", err)
+	}
+
+	return row.Revision, nil
+}
+
+// StoreStateRevision stores state if it still is at the expected revision, and
+// returns the new revision. Returns ErrStateConflict if the state has been
+// changed since it was loaded.
+func StoreStateRevision[T any](
+	ctx context.Context,
+	q *postgres.Queries,
+	name string,
+	value T,
+	revision int64,
+) (int64, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return 0, fmt.Errorf("marshal state: %w", err)
+	}
+
+	newRevision, err := q.CompareAndSetState(ctx, postgres.CompareAndSetStateParams{
+		Name:             name,
+		Value:            data,
+		ExpectedRevision: revision,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrStateConflict
+	} else if err != nil {
+		return 0, fmt.Errorf("write to database: %w", err)
+	}
+
+	return newRevision, nil
+}
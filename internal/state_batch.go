@@ -0,0 +1,33 @@
+package internal
+
+import "time"
+
+// StateBatching controls how often the log state is persisted when events
+// are handled one at a time. By default the state is persisted in the same
+// transaction as every replicated event. With batching the state is
+// persisted every Events events or Interval, whichever comes first, and
+// always at the end of an eventlog batch.
+//
+// The version mappings are still committed for every event, as they have to
+// be in place before the next write to the target. Events after the last
+// persisted position are handled again after a restart, but are skipped for
+// documents where they already have been replicated, see EventApplied().
+type StateBatching struct {
+	Events   int
+	Interval time.Duration
+}
+
+// Due returns true if the state should be persisted together with the event
+// that is being handled. Unstored is the number of events that have been
+// replicated since the state last was persisted, including the current one.
+func (sb StateBatching) Due(unstored int, lastStored time.Time, now time.Time) bool {
+	if sb.Events <= 1 && sb.Interval <= 0 {
+		return true
+	}
+
+	if sb.Events > 0 && unstored >= sb.Events {
+		return true
+	}
+
+	return sb.Interval > 0 && now.Sub(lastStored) >= sb.Interval
+}
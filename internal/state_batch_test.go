@@ -0,0 +1,155 @@
+package internal_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/internal"
+	"github.com/ttab/elephant-replicant/postgres"
+)
+
+func TestStateBatchingDue(t *testing.T) {
+	now := time.Now()
+
+	cases := []struct {
+		name     string
+		batching internal.StateBatching
+		unstored int
+		since    time.Duration
+		want     bool
+	}{
+		{"default", internal.StateBatching{}, 1, 0, true},
+		{"below count", internal.StateBatching{Events: 10}, 9, time.Hour, false},
+		{"count reached", internal.StateBatching{Events: 10}, 10, 0, true},
+		{"before interval", internal.StateBatching{Interval: time.Second}, 100, time.Millisecond, false},
+		{"interval passed", internal.StateBatching{Interval: time.Second}, 1, 2 * time.Second, true},
+		{"either", internal.StateBatching{Events: 10, Interval: time.Second}, 2, 2 * time.Second, true},
+	}
+
+	for _, c := range cases {
+		got := c.batching.Due(c.unstored, now.Add(-c.since), now)
+		if got != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+// appliedDB answers last event and version mapping lookups for a single
+// document.
+type appliedDB struct {
+	lastEvent pgtype.Int8
+	mapped    map[int64]int64
+}
+
+func (db *appliedDB) Exec(
+	context.Context, string, ...any,
+) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, errors.New("not implemented")
+}
+
+func (db *appliedDB) Query(context.Context, string, ...any) (pgx.Rows, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (db *appliedDB) QueryRow(_ context.Context, sql string, args ...any) pgx.Row {
+	if strings.Contains(sql, "last_event") {
+		return valueRow{value: db.lastEvent}
+	}
+
+	version, _ := args[2].(int64)
+
+	target, ok := db.mapped[version]
+	if !ok {
+		return valueRow{err: pgx.ErrNoRows}
+	}
+
+	return valueRow{value: target}
+}
+
+type valueRow struct {
+	value any
+	err   error
+}
+
+func (r valueRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+
+	switch d := dest[0].(type) {
+	case *pgtype.Int8:
+		*d = r.value.(pgtype.Int8)
+	case *int64:
+		*d = r.value.(int64)
+	default:
+		return fmt.Errorf("unexpected scan destination %T", dest[0])
+	}
+
+	return nil
+}
+
+func TestEventApplied(t *testing.T) {
+	docUUID := uuid.MustParse(fakeUUID)
+	db := appliedDB{
+		lastEvent: pgtype.Int8{Int64: 20, Valid: true},
+		mapped:    map[int64]int64{3: 5},
+	}
+	q := postgres.New(&db)
+
+	cases := []struct {
+		name     string
+		evt      *repository.EventlogItem
+		caughtUp bool
+		want     bool
+	}{
+		{"replayed status",
+			&repository.EventlogItem{Id: 20, Event: internal.TypeNewStatus, Version: 4},
+			true, true},
+		{"new status",
+			&repository.EventlogItem{Id: 21, Event: internal.TypeNewStatus, Version: 3},
+			true, false},
+		{"mapped version",
+			&repository.EventlogItem{Id: 22, Event: internal.TypeDocumentVersion, Version: 3},
+			true, true},
+		{"new version",
+			&repository.EventlogItem{Id: 22, Event: internal.TypeDocumentVersion, Version: 4},
+			true, false},
+		{"catching up",
+			&repository.EventlogItem{Id: 22, Event: internal.TypeDocumentVersion, Version: 3},
+			false, false},
+		{"synthetic",
+			&repository.EventlogItem{Event: internal.TypeDocumentVersion, Version: 4},
+			false, false},
+	}
+
+	for _, c := range cases {
+		got, err := internal.EventApplied(t.Context(), q, "production", docUUID, c.evt, c.caughtUp)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+
+		if got != c.want {
+			t.Errorf("%s: got applied %v, expected %v", c.name, got, c.want)
+		}
+	}
+
+	// Documents replicated before the last event was recorded are only
+	// checked against the version mappings.
+	db.lastEvent = pgtype.Int8{}
+
+	applied, err := internal.EventApplied(t.Context(), q, "production", docUUID,
+		&repository.EventlogItem{Id: 10, Event: internal.TypeNewStatus, Version: 3}, true)
+	if err != nil || applied {
+		t.Errorf("expected the status to be applied again without a last event, got %v, %v",
+			applied, err)
+	}
+}
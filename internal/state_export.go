@@ -0,0 +1,449 @@
+package internal
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/ttab/elephant-replicant/postgres"
+	"github.com/ttab/elephantine/pg"
+)
+
+// StateExportVersion is the version of the state export format. Imports
+// accept exports of this version and older. Version 2 added the language of
+// replicated documents.
+const StateExportVersion = 2
+
+// ErrNotEmpty is returned when state is imported into a database that already
+// has targets or replicated documents.
+var ErrNotEmpty = errors.New("the database already has replication data")
+
+// Kinds of state export records.
+const (
+	exportTarget   = "target"
+	exportState    = "state"
+	exportDocument = "document"
+	exportMapping  = "mapping"
+)
+
+// stateExportHeader is the first record of a state export.
+type stateExportHeader struct {
+	FormatVersion int       `json:"format_version"`
+	Exported      time.Time `json:"exported"`
+}
+
+// stateExportRecord is a single row in a state export, only the field of the
+// record kind is set.
+type stateExportRecord struct {
+	Kind     string          `json:"kind"`
+	Target   *exportedTarget `json:"target,omitempty"`
+	State    *exportedState  `json:"state,omitempty"`
+	Document *exportedDoc    `json:"document,omitempty"`
+	Mapping  *exportedMap    `json:"mapping,omitempty"`
+}
+
+// exportedTarget is a target configuration. The client secret is exported
+// encrypted, so the importing replicant must use the same encryption key.
+type exportedTarget struct {
+	Name          string          `json:"name"`
+	RepositoryURL string          `json:"repository_url"`
+	OIDCConfig    string          `json:"oidc_config"`
+	ClientID      string          `json:"client_id"`
+	ClientSecret  string          `json:"client_secret"`
+	StartFrom     int64           `json:"start_from"`
+	Config        json.RawMessage `json:"config"`
+	Enabled       bool            `json:"enabled"`
+}
+
+type exportedState struct {
+	Name  string          `json:"name"`
+	Value json.RawMessage `json:"value"`
+}
+
+type exportedDoc struct {
+	Target        string    `json:"target"`
+	ID            uuid.UUID `json:"id"`
+	TargetVersion int64     `json:"target_version"`
+	Language      *string   `json:"language,omitempty"`
+}
+
+type exportedMap struct {
+	Target        string    `json:"target"`
+	ID            uuid.UUID `json:"id"`
+	SourceVersion int64     `json:"source_version"`
+	TargetVersion int64     `json:"target_version"`
+	Created       time.Time `json:"created"`
+	EventID       *int64    `json:"event_id,omitempty"`
+}
+
+// StateExportStats is the number of exported or imported records by kind.
+type StateExportStats struct {
+	Targets   int
+	States    int
+	Documents int
+	Mappings  int
+}
+
+const exportPageSize = 1000
+
+// ExportState writes the targets, log states, document versions, and version
+// mappings as gzipped JSON lines. The export is read from a single snapshot
+// of the database so that it's consistent even if workers are running.
+func ExportState(
+	ctx context.Context, db *pgxpool.Pool, w io.Writer,
+) (_ StateExportStats, outErr error) {
+	var stats StateExportStats
+
+	tx, err := db.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel:   pgx.RepeatableRead,
+		AccessMode: pgx.ReadOnly,
+	})
+	if err != nil {
+		return stats, fmt.Errorf("start transaction: %w", err)
+	}
+
+	defer pg.Rollback(tx, &outErr)
+
+	q := postgres.New(tx)
+
+	gz := gzip.NewWriter(w)
+	enc := json.NewEncoder(gz)
+
+	err = enc.Encode(stateExportHeader{
+		FormatVersion: StateExportVersion,
+		Exported:      time.Now(),
+	})
+	if err != nil {
+		return stats, fmt.Errorf("write header: %w", err)
+	}
+
+	targets, err := q.ListAllTargets(ctx)
+	if err != nil {
+		return stats, fmt.Errorf("list targets: %w", err)
+	}
+
+	for _, t := range targets {
+		err := enc.Encode(stateExportRecord{
+			Kind: exportTarget,
+			Target: &exportedTarget{
+				Name:          t.Name,
+				RepositoryURL: t.RepositoryUrl,
+				OIDCConfig:    t.OidcConfig,
+				ClientID:      t.ClientID,
+				ClientSecret:  t.ClientSecret,
+				StartFrom:     t.StartFrom,
+				Config:        t.Config,
+				Enabled:       t.Enabled,
+			},
+		})
+		if err != nil {
+			return stats, fmt.Errorf("write target: %w", err)
+		}
+
+		stats.Targets++
+	}
+
+	var afterState string
+
+	for {
+		states, err := q.ListStatesWithPrefix(ctx, postgres.ListStatesWithPrefixParams{
+			After:    afterState,
+			RowLimit: exportPageSize,
+		})
+		if err != nil {
+			return stats, fmt.Errorf("list states: %w", err)
+		}
+
+		for _, s := range states {
+			err := enc.Encode(stateExportRecord{
+				Kind: exportState,
+				State: &exportedState{
+					Name:  s.Name,
+					Value: s.Value,
+				},
+			})
+			if err != nil {
+				return stats, fmt.Errorf("write state: %w", err)
+			}
+
+			afterState = s.Name
+			stats.States++
+		}
+
+		if len(states) < exportPageSize {
+			break
+		}
+	}
+
+	for _, t := range targets {
+		err := exportTargetData(ctx, q, enc, t.Name, &stats)
+		if err != nil {
+			return stats, fmt.Errorf("export target %q: %w", t.Name, err)
+		}
+	}
+
+	err = gz.Close()
+	if err != nil {
+		return stats, fmt.Errorf("flush export: %w", err)
+	}
+
+	return stats, nil
+}
+
+func exportTargetData(
+	ctx context.Context, q *postgres.Queries, enc *json.Encoder,
+	target string, stats *StateExportStats,
+) error {
+	var afterDoc uuid.UUID
+
+	for {
+		docs, err := q.ExportDocuments(ctx, postgres.ExportDocumentsParams{
+			TargetName: target,
+			After:      afterDoc,
+			RowLimit:   exportPageSize,
+		})
+		if err != nil {
+			return fmt.Errorf("list documents: %w", err)
+		}
+
+		for _, d := range docs {
+			doc := exportedDoc{
+				Target:        target,
+				ID:            d.ID,
+				TargetVersion: d.TargetVersion,
+			}
+
+			if d.Language.Valid {
+				doc.Language = &d.Language.String
+			}
+
+			err := enc.Encode(stateExportRecord{
+				Kind:     exportDocument,
+				Document: &doc,
+			})
+			if err != nil {
+				return fmt.Errorf("write document: %w", err)
+			}
+
+			afterDoc = d.ID
+			stats.Documents++
+		}
+
+		if len(docs) < exportPageSize {
+			break
+		}
+	}
+
+	var (
+		afterID      uuid.UUID
+		afterVersion int64
+	)
+
+	for {
+		mappings, err := q.ListTargetMappings(ctx, postgres.ListTargetMappingsParams{
+			TargetName:   target,
+			AfterID:      afterID,
+			AfterVersion: afterVersion,
+			RowLimit:     exportPageSize,
+		})
+		if err != nil {
+			return fmt.Errorf("list version mappings: %w", err)
+		}
+
+		for _, m := range mappings {
+			rec := exportedMap{
+				Target:        target,
+				ID:            m.ID,
+				SourceVersion: m.SourceVersion,
+				TargetVersion: m.TargetVersion,
+				Created:       m.Created.Time,
+			}
+
+			if m.EventID.Valid {
+				rec.EventID = &m.EventID.Int64
+			}
+
+			err := enc.Encode(stateExportRecord{
+				Kind:    exportMapping,
+				Mapping: &rec,
+			})
+			if err != nil {
+				return fmt.Errorf("write version mapping: %w", err)
+			}
+
+			afterID, afterVersion = m.ID, m.SourceVersion
+			stats.Mappings++
+		}
+
+		if len(mappings) < exportPageSize {
+			break
+		}
+	}
+
+	return nil
+}
+
+// ImportState restores a state export into a database that doesn't have any
+// targets or replicated documents yet. The import is done in a single
+// transaction, so nothing is imported if it fails.
+func ImportState(
+	ctx context.Context, db *pgxpool.Pool, r io.Reader,
+) (_ StateExportStats, outErr error) {
+	var stats StateExportStats
+
+	gz, err := gzip.NewReader(bufio.NewReader(r))
+	if err != nil {
+		return stats, fmt.Errorf("open export: %w", err)
+	}
+
+	dec := json.NewDecoder(gz)
+
+	var header stateExportHeader
+
+	err = dec.Decode(&header)
+	if err != nil {
+		return stats, fmt.Errorf("read header: %w", err)
+	}
+
+	if header.FormatVersion < 1 || header.FormatVersion > StateExportVersion {
+		return stats, fmt.Errorf("unsupported export format version %d",
+			header.FormatVersion)
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return stats, fmt.Errorf("start transaction: %w", err)
+	}
+
+	defer pg.Rollback(tx, &outErr)
+
+	q := postgres.New(tx)
+
+	hasData, err := q.HasReplicationData(ctx)
+	if err != nil {
+		return stats, fmt.Errorf("check for existing data: %w", err)
+	}
+
+	if hasData {
+		return stats, ErrNotEmpty
+	}
+
+	for {
+		var rec stateExportRecord
+
+		err := dec.Decode(&rec)
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return stats, fmt.Errorf("read record: %w", err)
+		}
+
+		err = importRecord(ctx, q, rec, &stats)
+		if err != nil {
+			return stats, err
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return stats, fmt.Errorf("commit import: %w", err)
+	}
+
+	return stats, nil
+}
+
+func importRecord(
+	ctx context.Context, q *postgres.Queries,
+	rec stateExportRecord, stats *StateExportStats,
+) error {
+	switch {
+	case rec.Kind == exportTarget && rec.Target != nil:
+		t := rec.Target
+
+		err := q.UpsertTarget(ctx, postgres.UpsertTargetParams{
+			Name:          t.Name,
+			RepositoryUrl: t.RepositoryURL,
+			OidcConfig:    t.OIDCConfig,
+			ClientID:      t.ClientID,
+			ClientSecret:  t.ClientSecret,
+			StartFrom:     t.StartFrom,
+			Config:        t.Config,
+			Enabled:       t.Enabled,
+		})
+		if err != nil {
+			return fmt.Errorf("import target %q: %w", t.Name, err)
+		}
+
+		stats.Targets++
+	case rec.Kind == exportState && rec.State != nil:
+		err := q.SetState(ctx, postgres.SetStateParams{
+			Name:  rec.State.Name,
+			Value: rec.State.Value,
+		})
+		if err != nil {
+			return fmt.Errorf("import state %q: %w", rec.State.Name, err)
+		}
+
+		stats.States++
+	case rec.Kind == exportDocument && rec.Document != nil:
+		d := rec.Document
+
+		err := q.SetDocumentVersion(ctx, postgres.SetDocumentVersionParams{
+			TargetName:    d.Target,
+			ID:            d.ID,
+			TargetVersion: d.TargetVersion,
+		})
+		if err != nil {
+			return fmt.Errorf("import document %s: %w", d.ID, err)
+		}
+
+		if d.Language != nil {
+			err := q.SetDocumentLanguage(ctx, postgres.SetDocumentLanguageParams{
+				Language:   pgtype.Text{String: *d.Language, Valid: true},
+				TargetName: d.Target,
+				ID:         d.ID,
+			})
+			if err != nil {
+				return fmt.Errorf("import language of document %s: %w",
+					d.ID, err)
+			}
+		}
+
+		stats.Documents++
+	case rec.Kind == exportMapping && rec.Mapping != nil:
+		m := rec.Mapping
+
+		var eventID pgtype.Int8
+
+		if m.EventID != nil {
+			eventID = pgtype.Int8{Int64: *m.EventID, Valid: true}
+		}
+
+		err := q.AddVersionMapping(ctx, postgres.AddVersionMappingParams{
+			TargetName:    m.Target,
+			ID:            m.ID,
+			SourceVersion: m.SourceVersion,
+			TargetVersion: m.TargetVersion,
+			Created:       pg.Time(m.Created),
+			EventID:       eventID,
+		})
+		if err != nil {
+			return fmt.Errorf("import version mapping for %s: %w", m.ID, err)
+		}
+
+		stats.Mappings++
+	default:
+		return fmt.Errorf("invalid export record of kind %q", rec.Kind)
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package internal_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+
+	"github.com/ttab/elephant-replicant/internal"
+)
+
+func TestImportStateRejectsNewerFormat(t *testing.T) {
+	var buf bytes.Buffer
+
+	gz := gzip.NewWriter(&buf)
+
+	_, _ = gz.Write([]byte(`{"format_version":99,"exported":"2024-05-01T12:00:00Z"}` + "\n"))
+
+	err := gz.Close()
+	if err != nil {
+		t.Fatalf("write export: %v", err)
+	}
+
+	// The format version is checked before the database is used.
+	_, err = internal.ImportState(t.Context(), nil, &buf)
+	if err == nil || !strings.Contains(err.Error(), "unsupported export format version") {
+		t.Fatalf("expected an unsupported version error, got: %v", err)
+	}
+}
+
+func TestImportStateRejectsUncompressed(t *testing.T) {
+	_, err := internal.ImportState(t.Context(), nil,
+		strings.NewReader(`{"format_version":1}`))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,212 @@
+package internal
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/postgres"
+	"github.com/ttab/elephantine"
+	"github.com/twitchtv/twirp"
+)
+
+// PendingStatus is a status head that pointed at an older version of the
+// document when it was synced while catching up.
+type PendingStatus struct {
+	Name    string `json:"name"`
+	ID      int64  `json:"id"`
+	Version int64  `json:"version"`
+}
+
+// PendingStatuses are the status heads of a document that should be backfilled
+// once the target has caught up.
+type PendingStatuses struct {
+	Statuses []PendingStatus `json:"statuses"`
+}
+
+func statusBackfillPrefix(target string) string {
+	return target + ":status_backfill:"
+}
+
+// recordPendingStatuses stores the status heads that couldn't be set while
+// catching up, as part of the transaction that syncs the document.
+func (w *Worker) recordPendingStatuses(
+	ctx context.Context, q *postgres.Queries, docUUID string,
+	pending []PendingStatus,
+) error {
+	err := StoreState(ctx, q, statusBackfillPrefix(w.name)+docUUID,
+		PendingStatuses{Statuses: pending})
+	if err != nil {
+		return fmt.Errorf("record pending statuses: %w", err)
+	}
+
+	w.statusBackfillPending.Store(true)
+
+	return nil
+}
+
+// backfillStatuses sets the pending status heads of all documents that have
+// been recorded while catching up. The pending statuses of a document are
+// removed once they have been handled, or if they can't be set.
+func (w *Worker) backfillStatuses(ctx context.Context) error {
+	q := postgres.New(w.db)
+	prefix := statusBackfillPrefix(w.name)
+
+	var after string
+
+	for {
+		rows, err := q.ListStatesWithPrefix(ctx,
+			postgres.ListStatesWithPrefixParams{
+				Prefix:   prefix,
+				After:    after,
+				RowLimit: 100,
+			})
+		if err != nil {
+			return fmt.Errorf("list pending statuses: %w", err)
+		}
+
+		if len(rows) == 0 {
+			return nil
+		}
+
+		for _, row := range rows {
+			after = row.Name
+
+			var pending PendingStatuses
+
+			err := json.Unmarshal(row.Value, &pending)
+			if err != nil {
+				return fmt.Errorf("unmarshal pending statuses: %w", err)
+			}
+
+			docUUID, err := uuid.Parse(strings.TrimPrefix(row.Name, prefix))
+			if err != nil {
+				return fmt.Errorf("invalid pending status key %q: %w",
+					row.Name, err)
+			}
+
+			err = w.backfillDocumentStatuses(ctx, docUUID, pending.Statuses)
+			if err != nil {
+				return fmt.Errorf("backfill statuses for %s: %w",
+					docUUID, err)
+			}
+
+			err = q.RemoveTargetState(ctx, row.Name)
+			if err != nil {
+				return fmt.Errorf("remove pending statuses: %w", err)
+			}
+		}
+	}
+}
+
+// backfillDocumentStatuses sets the pending statuses that still are the status
+// heads in the source, and that point at versions that have been replicated
+// to the target. Statuses are set in the order they were created.
+func (w *Worker) backfillDocumentStatuses(
+	ctx context.Context, docUUID uuid.UUID, pending []PendingStatus,
+) error {
+	metaRes, err := w.source.GetMeta(ctx, &repository.GetMetaRequest{
+		Uuid: docUUID.String(),
+	})
+	if elephantine.IsTwirpErrorCode(err, twirp.NotFound) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("get source meta: %w", err)
+	}
+
+	q := postgres.New(w.db)
+	targetUUID := w.uuidMapping.Map(docUUID)
+
+	slices.SortFunc(pending, func(a, b PendingStatus) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	update := repository.UpdateRequest{
+		Uuid: targetUUID.String(),
+	}
+
+	for _, p := range pending {
+		head, ok := metaRes.Meta.Heads[p.Name]
+		if !ok || head.Id != p.ID {
+			// Superseded by a status that has been replicated
+			// since.
+			continue
+		}
+
+		mappedVersion, err := q.GetTargetVersion(ctx,
+			postgres.GetTargetVersionParams{
+				TargetName:    w.name,
+				ID:            targetUUID,
+				SourceVersion: p.Version,
+			})
+		if errors.Is(err, pgx.ErrNoRows) {
+			w.logger.DebugContext(ctx,
+				"can't backfill status for a version that hasn't been replicated",
+				elephantine.LogKeyDocumentUUID, docUUID,
+				elephantine.LogKeyDocumentStatus, p.Name,
+				elephantine.LogKeyDocumentVersion, p.Version,
+			)
+
+			continue
+		} else if err != nil {
+			return fmt.Errorf("get target version: %w", err)
+		}
+
+		update.Status = append(update.Status, &repository.StatusUpdate{
+			Name:    p.Name,
+			Version: mappedVersion,
+			Meta:    head.Meta,
+		})
+	}
+
+	if len(update.Status) == 0 {
+		return nil
+	}
+
+	targetVersion, err := q.GetDocumentVersion(ctx,
+		postgres.GetDocumentVersionParams{
+			TargetName: w.name,
+			ID:         targetUUID,
+		})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("get current target version: %w", err)
+	}
+
+	update.IfMatch = targetVersion
+
+	if w.dryRun {
+		w.logger.InfoContext(ctx, "dry run: would backfill statuses",
+			elephantine.LogKeyDocumentUUID, docUUID,
+			"statuses", len(update.Status),
+		)
+
+		return nil
+	}
+
+	_, err = w.target.Update(ctx, &update)
+	if elephantine.IsTwirpErrorCode(err, twirp.FailedPrecondition) {
+		w.logger.InfoContext(ctx,
+			"not backfilling statuses for document that has been changed in target",
+			elephantine.LogKeyDocumentUUID, docUUID)
+
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("update target: %w", targetError(err))
+	}
+
+	w.logger.DebugContext(ctx, "backfilled statuses",
+		elephantine.LogKeyDocumentUUID, docUUID,
+		"statuses", len(update.Status),
+	)
+
+	return nil
+}
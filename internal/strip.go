@@ -0,0 +1,169 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+
+	rpc_newsdoc "github.com/ttab/elephant-api/newsdoc"
+	"github.com/ttab/newsdoc"
+)
+
+// StripRule removes the blocks of a kind that are matched by the matcher from
+// documents of a type before they are written to the target. A DocType of "*"
+// applies the rule to all document types.
+type StripRule struct {
+	DocType string
+	Kind    BlockKind
+	Matcher newsdoc.BlockMatcher
+	// Spec is the rule in the format it was parsed from, used to describe
+	// the configuration.
+	Spec string
+}
+
+// BlockStripper removes blocks from documents. Unlike the content filter,
+// which rejects whole documents, the stripper lets the rest of the document
+// through. Rules are applied recursively, so that matching blocks nested in
+// other blocks are removed as well.
+type BlockStripper struct {
+	Rules []StripRule
+}
+
+// Strip removes all matching blocks from the document and returns the number
+// of blocks that were removed.
+func (s BlockStripper) Strip(doc *rpc_newsdoc.Document) int {
+	var rules []StripRule
+
+	for _, r := range s.Rules {
+		if r.DocType == "*" || r.DocType == doc.Type {
+			rules = append(rules, r)
+		}
+	}
+
+	if len(rules) == 0 {
+		return 0
+	}
+
+	var removed int
+
+	doc.Meta = stripBlocks(doc.Meta, BlockKindMeta, rules, &removed)
+	doc.Links = stripBlocks(doc.Links, BlockKindLink, rules, &removed)
+	doc.Content = stripBlocks(doc.Content, BlockKindContent, rules, &removed)
+
+	return removed
+}
+
+func stripBlocks(
+	blocks []*rpc_newsdoc.Block, kind BlockKind, rules []StripRule,
+	removed *int,
+) []*rpc_newsdoc.Block {
+	if len(blocks) == 0 {
+		return blocks
+	}
+
+	kept := blocks[:0]
+
+	for _, b := range blocks {
+		if stripMatch(b, kind, rules) {
+			*removed++
+
+			continue
+		}
+
+		b.Meta = stripBlocks(b.Meta, BlockKindMeta, rules, removed)
+		b.Links = stripBlocks(b.Links, BlockKindLink, rules, removed)
+		b.Content = stripBlocks(b.Content, BlockKindContent, rules, removed)
+
+		kept = append(kept, b)
+	}
+
+	return kept
+}
+
+func stripMatch(b *rpc_newsdoc.Block, kind BlockKind, rules []StripRule) bool {
+	var block *newsdoc.Block
+
+	for _, r := range rules {
+		if r.Kind != kind {
+			continue
+		}
+
+		if block == nil {
+			nb := rpc_newsdoc.BlockFromRPC(b)
+			block = &nb
+		}
+
+		if r.Matcher.Match(*block) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseStripRules parses strip rules in the format
+// "[doc type]:[kind]:[attribute]=[value]", where kind is one of "meta", "link",
+// or "content", and attribute is one of "type", "rel", "role", "uri", or
+// "uuid". F.ex. "core/article:meta:type=core/note" removes all note meta
+// blocks from articles.
+func ParseStripRules(specs []string) (BlockStripper, error) {
+	var s BlockStripper
+
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, ":", 3)
+		if len(parts) != 3 || parts[0] == "" {
+			return BlockStripper{}, fmt.Errorf("invalid strip rule %q", spec)
+		}
+
+		kind := BlockKind(parts[1])
+
+		switch kind {
+		case BlockKindMeta, BlockKindLink, BlockKindContent:
+		default:
+			return BlockStripper{}, fmt.Errorf(
+				"invalid block kind %q in strip rule %q", parts[1], spec)
+		}
+
+		matcher, err := attributeMatcher(parts[2])
+		if err != nil {
+			return BlockStripper{}, fmt.Errorf(
+				"invalid strip rule %q: %w", spec, err)
+		}
+
+		s.Rules = append(s.Rules, StripRule{
+			DocType: parts[0],
+			Kind:    kind,
+			Matcher: matcher,
+			Spec:    spec,
+		})
+	}
+
+	return s, nil
+}
+
+func attributeMatcher(spec string) (newsdoc.BlockMatcher, error) {
+	attr, value, ok := strings.Cut(spec, "=")
+	if !ok || value == "" {
+		return nil, fmt.Errorf("expected [attribute]=[value], got %q", spec)
+	}
+
+	var get func(b newsdoc.Block) string
+
+	switch attr {
+	case "type":
+		get = func(b newsdoc.Block) string { return b.Type }
+	case "rel":
+		get = func(b newsdoc.Block) string { return b.Rel }
+	case "role":
+		get = func(b newsdoc.Block) string { return b.Role }
+	case "uri":
+		get = func(b newsdoc.Block) string { return b.URI }
+	case "uuid":
+		get = func(b newsdoc.Block) string { return b.UUID }
+	default:
+		return nil, fmt.Errorf("unknown block attribute %q", attr)
+	}
+
+	return newsdoc.BlockMatchFunc(func(b newsdoc.Block) bool {
+		return get(b) == value
+	}), nil
+}
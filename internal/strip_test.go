@@ -0,0 +1,98 @@
+package internal_test
+
+import (
+	"testing"
+
+	rpc_newsdoc "github.com/ttab/elephant-api/newsdoc"
+	"github.com/ttab/elephant-replicant/internal"
+)
+
+func TestBlockStripperNested(t *testing.T) {
+	s, err := internal.ParseStripRules([]string{
+		"core/article:meta:type=core/note",
+		"*:link:rel=internal",
+	})
+	if err != nil {
+		t.Fatalf("parse rules: %v", err)
+	}
+
+	doc := &rpc_newsdoc.Document{
+		Type: "core/article",
+		Meta: []*rpc_newsdoc.Block{
+			{Type: "core/note"},
+			{Type: "core/newsvalue"},
+		},
+		Links: []*rpc_newsdoc.Block{
+			{Rel: "section"},
+			{Rel: "internal"},
+		},
+		Content: []*rpc_newsdoc.Block{
+			{
+				Type: "core/text",
+				Meta: []*rpc_newsdoc.Block{
+					{Type: "core/note"},
+				},
+				Links: []*rpc_newsdoc.Block{
+					{Rel: "internal"},
+				},
+			},
+		},
+	}
+
+	removed := s.Strip(doc)
+	if removed != 4 {
+		t.Errorf("got %d removed blocks, want 4", removed)
+	}
+
+	if len(doc.Meta) != 1 || doc.Meta[0].Type != "core/newsvalue" {
+		t.Errorf("unexpected meta after strip: %v", doc.Meta)
+	}
+
+	if len(doc.Links) != 1 || doc.Links[0].Rel != "section" {
+		t.Errorf("unexpected links after strip: %v", doc.Links)
+	}
+
+	if len(doc.Content) != 1 {
+		t.Fatalf("expected the content block to be kept, got %v", doc.Content)
+	}
+
+	if len(doc.Content[0].Meta) != 0 || len(doc.Content[0].Links) != 0 {
+		t.Errorf("expected nested blocks to be stripped, got %v", doc.Content[0])
+	}
+}
+
+func TestBlockStripperOtherType(t *testing.T) {
+	s, err := internal.ParseStripRules([]string{
+		"core/article:meta:type=core/note",
+	})
+	if err != nil {
+		t.Fatalf("parse rules: %v", err)
+	}
+
+	doc := &rpc_newsdoc.Document{
+		Type: "core/event",
+		Meta: []*rpc_newsdoc.Block{
+			{Type: "core/note"},
+		},
+	}
+
+	if removed := s.Strip(doc); removed != 0 || len(doc.Meta) != 1 {
+		t.Errorf("expected rule for other type to be ignored, removed %d",
+			removed)
+	}
+}
+
+func TestParseStripRulesInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"core/article:meta",
+		"core/article:body:type=x",
+		"core/article:meta:colour=red",
+		"core/article:meta:type=",
+		":meta:type=core/note",
+	} {
+		_, err := internal.ParseStripRules([]string{spec})
+		if err == nil {
+			t.Errorf("expected an error for %q", spec)
+		}
+	}
+}
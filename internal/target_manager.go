@@ -3,11 +3,14 @@ package internal
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/ttab/elephant-api/replicant"
@@ -16,12 +19,193 @@ import (
 	"github.com/ttab/elephantine"
 	"github.com/ttab/elephantine/pg"
 	"github.com/ttab/koonkie"
-	"golang.org/x/oauth2"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 type targetWorker struct {
 	cancel context.CancelFunc
 	done   chan struct{}
+
+	// failures tracks consecutive failures across worker restarts.
+	failures eventFailures
+
+	// worker is set when the worker has acquired the job lock and is
+	// replicating in this process. Guarded by the target manager mutex.
+	worker *Worker
+}
+
+// WorkerOptions are replication settings that apply to all targets.
+type WorkerOptions struct {
+	// HTTPClient is used for attachment downloads and uploads.
+	HTTPClient      *http.Client
+	AttachmentRetry RetryPolicy
+	// VerifyAttachments enables checksum verification of transferred
+	// attachments. Composite checksums of objects that were uploaded in
+	// parts aren't verified.
+	VerifyAttachments bool
+	// MaxAttachmentSize is the maximum size in bytes of attachments that
+	// we transfer. Zero means no limit.
+	MaxAttachmentSize int64
+	// AttachmentMemory bounds the attachment bytes in flight.
+	AttachmentMemory *AttachmentMemory
+	// AttachmentCompression controls compressed attachment downloads.
+	AttachmentCompression AttachmentCompression
+	// DetachAttachments removes attachments from target documents when
+	// they have been removed in the source.
+	DetachAttachments bool
+	// MultipartUploads controls when attachments are uploaded in parts
+	// to sinks that support it.
+	MultipartUploads MultipartUploads
+	// AttachmentConcurrency is the number of attachments of a document
+	// that are transferred in parallel.
+	AttachmentConcurrency int
+	// AttachmentContentTypes restricts attachment transfers by content
+	// type.
+	AttachmentContentTypes ContentTypeFilter
+	// AttachmentContentTypeOverrides replace the content type that
+	// attachments are uploaded with.
+	AttachmentContentTypeOverrides ContentTypeOverrides
+	// RequireSections are sections that documents must belong to in order
+	// to be replicated.
+	RequireSections []*replicant.SectionForType
+	// Languages are the languages that documents must be in to be
+	// replicated.
+	Languages []string
+	// TypeMapping maps source document types to the types they should be
+	// written as in the target.
+	TypeMapping map[string]string
+	// TargetTypeMappings are type mappings for specific targets that are
+	// applied on top of TypeMapping.
+	TargetTypeMappings TargetTypeMappings
+	// FallbackType is the source type used for documents without a type.
+	FallbackType string
+	// AllowNoCurrentVersion replicates documents without a current
+	// version instead of skipping them.
+	AllowNoCurrentVersion bool
+	// ACLMapping rewrites the grantees of replicated ACLs.
+	ACLMapping ACLMapping
+	// ACLTemplate replaces the source ACLs of replicated documents.
+	ACLTemplate ACLTemplate
+	// ACLRestriction stops replication of documents with restricted
+	// grantees.
+	ACLRestriction ACLRestriction
+	// Tracer is used to trace event handling, defaults to a no-op tracer.
+	Tracer trace.Tracer
+	// EventFilters are evaluated for all events in addition to the ignored
+	// subs and types of the target.
+	EventFilters []EventFilter
+	// IncludeUUIDs restricts replication to the listed source documents
+	// if set.
+	IncludeUUIDs UUIDSet
+	// TypeRouting restricts the document types that targets replicate.
+	TypeRouting TypeRouting
+	// LanguageRouting restricts the languages that targets replicate.
+	LanguageRouting LanguageRouting
+	// StripBlocks removes blocks from documents before they're written.
+	StripBlocks BlockStripper
+	// StatusFilter restricts which statuses are replicated.
+	StatusFilter StatusFilter
+	// Transformers make custom changes to documents before they're
+	// written.
+	Transformers TransformPipeline
+	// CompareNormalization is applied to documents before they're compared
+	// with the target.
+	CompareNormalization CompareNormalization
+	// UUIDMapping derives the UUIDs of documents in the target.
+	UUIDMapping UUIDMapping
+	// QuarantineThreshold is the number of consecutive failures to handle
+	// an event before it's recorded as a replication error and skipped.
+	// Zero disables quarantining.
+	QuarantineThreshold int
+	// ReplicationConcurrency is the number of events that are handled
+	// concurrently.
+	ReplicationConcurrency int
+	// UnavailableBackoff is used when retrying events that failed because
+	// the target couldn't be reached.
+	UnavailableBackoff Backoff
+	// ErrorClasses decides which errors are retried, skipped, or fatal.
+	ErrorClasses ErrorClassification
+	// ErrorRetries caps the retries of retryable errors other than an
+	// unreachable target.
+	ErrorRetries int
+	// MinOriginalCreated skips documents that were created before this
+	// time.
+	MinOriginalCreated time.Time
+	// CircuitBreaker short-circuits target requests after repeated
+	// failures.
+	CircuitBreaker CircuitBreakerConfig
+	// SoftDeleteStatus is the tombstone status used to mark recoverable
+	// deletes in the target instead of deleting the document.
+	SoftDeleteStatus string
+	// SoftDeleteClearACL clears the ACL of documents that are soft
+	// deleted.
+	SoftDeleteClearACL bool
+	// ConflictPolicy controls how documents that have been changed in the
+	// target are handled.
+	ConflictPolicy ConflictPolicy
+	// Oversize controls how documents that are too large for the target
+	// are handled.
+	Oversize OversizeHandling
+	// UnknownEvents controls how events of unknown types are handled.
+	UnknownEvents UnknownEventPolicy
+	// Withheld controls how documents under embargo are replicated.
+	Withheld WithheldPolicy
+	// AuditLog configures the log line for replicated events.
+	AuditLog AuditLog
+	// ReplicateVersionMeta copies the meta data of source document
+	// versions to the versions written to the target.
+	ReplicateVersionMeta bool
+	// RefreshVersionACL sets the current source ACL together with every
+	// document version that is replicated when caught up.
+	RefreshVersionACL bool
+	// ParallelFetch runs the source reads of a document version
+	// concurrently.
+	ParallelFetch bool
+	// ProvenanceMeta is added to the meta of replicated versions and
+	// deletes.
+	ProvenanceMeta ProvenanceMeta
+	// ImportDirectives controls which import directive fields are sent.
+	ImportDirectives ImportDirectives
+	// BackfillStatuses sets status heads that point at older versions
+	// once the target has caught up.
+	BackfillStatuses bool
+	// ResyncOnConfigChange restarts replication from the start of the
+	// target when the config has changed.
+	ResyncOnConfigChange bool
+	// PurgeBelowStartFrom removes version mappings for events before the
+	// start event when it has been raised.
+	PurgeBelowStartFrom bool
+	// MappingRetention is how long version mappings are kept.
+	MappingRetention time.Duration
+	// Shadow mirrors the writes of targets to shadow targets.
+	Shadow ShadowConfig
+	// Sinks are factories for custom sinks by repository URL scheme.
+	Sinks map[string]SinkFactory
+	// StateBatching controls how often the log state is persisted when
+	// events are handled one at a time.
+	StateBatching StateBatching
+	// Follower controls how the eventlog is read.
+	Follower FollowerConfig
+	// Shard is the name of the source shard that the workers follow the
+	// eventlog of, empty for unsharded sources.
+	Shard string
+	// ReplicateWorkflows enables replication of workflow configurations.
+	ReplicateWorkflows bool
+	// SourceWorkflows is used to read the workflow configurations.
+	SourceWorkflows repository.Workflows
+	// SourceTokens refreshes the source access token.
+	SourceTokens TokenRefresher
+	// TokenRefreshMargin is how long before they expire that target
+	// access tokens are refreshed.
+	TokenRefreshMargin time.Duration
+	// DryRun replaces all writes to the target with log messages.
+	DryRun bool
+	// Stop is closed when the process starts shutting down. Workers
+	// finish the event they're handling and exit.
+	Stop <-chan struct{}
+	// Metrics is used to track replication progress.
+	Metrics *ReplicationMetrics
 }
 
 // TargetManager manages all target worker goroutines. It loads enabled targets
@@ -33,9 +217,22 @@ type TargetManager struct {
 	source        repository.Documents
 	logMetrics    *koonkie.PrometheusFollowerMetrics
 	encryptionKey []byte
+	opts          WorkerOptions
 
 	mu      sync.Mutex
 	workers map[string]*targetWorker
+	// runCtx is the context that the manager runs in, used for
+	// background jobs that outlive the request that started them.
+	runCtx    context.Context //nolint: containedctx
+	backfills map[string]bool
+	// breakers are kept per target so that their state survives worker
+	// restarts.
+	breakers map[string]*CircuitBreaker
+	pauses   map[string]*PauseGate
+
+	// sharedLog is set when the workers share their reads of the
+	// eventlog.
+	sharedLog *sharedEventlog
 }
 
 // NewTargetManager creates a new target manager.
@@ -45,15 +242,31 @@ func NewTargetManager(
 	source repository.Documents,
 	logMetrics *koonkie.PrometheusFollowerMetrics,
 	encryptionKey []byte,
+	opts WorkerOptions,
 ) *TargetManager {
-	return &TargetManager{
+	if opts.Tracer == nil {
+		opts.Tracer = noop.NewTracerProvider().Tracer(tracerName)
+	}
+
+	tm := TargetManager{
 		logger:        logger,
 		db:            db,
 		source:        source,
 		logMetrics:    logMetrics,
 		encryptionKey: encryptionKey,
+		opts:          opts,
 		workers:       make(map[string]*targetWorker),
+		backfills:     make(map[string]bool),
+		breakers:      make(map[string]*CircuitBreaker),
+		pauses:        make(map[string]*PauseGate),
+	}
+
+	if opts.Follower.Shared {
+		tm.sharedLog = newSharedEventlog(
+			opts.Follower.Documents(source), db, opts.Shard)
 	}
+
+	return &tm
 }
 
 // Run loads all enabled targets, starts workers for them, and then listens for
@@ -61,6 +274,10 @@ func NewTargetManager(
 func (tm *TargetManager) Run(
 	ctx context.Context, notifications <-chan TargetNotification,
 ) error {
+	tm.mu.Lock()
+	tm.runCtx = ctx
+	tm.mu.Unlock()
+
 	q := postgres.New(tm.db)
 
 	targets, err := q.ListEnabledTargets(ctx)
@@ -81,6 +298,12 @@ func (tm *TargetManager) Run(
 			tm.stopAll()
 
 			return ctx.Err() //nolint: wrapcheck
+		case <-tm.opts.Stop:
+			tm.logger.Info("waiting for workers to finish in-flight events")
+
+			tm.drainAll(ctx)
+
+			return nil
 		case n := <-notifications:
 			tm.handleNotification(ctx, n)
 		}
@@ -105,9 +328,48 @@ func (tm *TargetManager) handleNotification(
 		tm.startWorker(ctx, n.Name)
 	case TargetActionStop:
 		tm.stopWorker(n.Name)
+	case TargetActionReset:
+		tm.resetWorker(ctx, n)
+	case TargetActionPause, TargetActionResume:
+		// The worker keeps running and blocks at the next batch
+		// boundary while paused.
+		tm.setPaused(n.Name, n.Action == TargetActionPause)
+	case TargetActionPoll:
+		tm.pollWorker(n.Name)
 	}
 }
 
+// resetWorker restarts a worker from the log state in the notification. The
+// state is persisted again after the worker has stopped, as the worker could
+// have persisted its old position after the reset was requested.
+func (tm *TargetManager) resetWorker(
+	ctx context.Context, n TargetNotification,
+) {
+	tm.mu.Lock()
+	_, exists := tm.workers[n.Name]
+	tm.mu.Unlock()
+
+	if !exists || n.Shard != tm.opts.Shard {
+		return
+	}
+
+	tm.stopWorker(n.Name)
+
+	err := StoreState(ctx, postgres.New(tm.db), tm.logStateKey(n.Name), LogState{
+		Position:    n.Position,
+		CaughtUp:    n.CaughtUp,
+		LastUpdated: time.Now(),
+	})
+	if err != nil {
+		tm.logger.Error("failed to persist reset log state",
+			"target", n.Name,
+			elephantine.LogKeyError, err,
+		)
+	}
+
+	tm.startWorker(ctx, n.Name)
+}
+
 func (tm *TargetManager) startWorker(ctx context.Context, name string) {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
@@ -130,19 +392,31 @@ func (tm *TargetManager) startWorker(ctx context.Context, name string) {
 		defer cancel()
 		defer close(done)
 
-		tm.runWorker(workerCtx, name)
+		tm.runWorker(workerCtx, tw, name)
 	}()
 }
 
-func (tm *TargetManager) runWorker(ctx context.Context, name string) {
+func (tm *TargetManager) runWorker(
+	ctx context.Context, tw *targetWorker, name string,
+) {
 	logger := tm.logger.With("target", name)
 
 	err := pg.RunInJobLock(
 		ctx, tm.db, logger,
-		"replicant:"+name, "replicant:"+name,
+		shardKey("replicant:"+name, tm.opts.Shard),
+		shardKey("replicant:"+name, tm.opts.Shard),
 		pg.JobLockOptions{},
 		func(ctx context.Context) error {
-			return tm.workerFunc(ctx, logger, name)
+			err := tm.workerFunc(ctx, logger, tw, name)
+			if errors.Is(err, errStopped) {
+				// Cancel the worker context so that the
+				// job lock doesn't restart the worker.
+				tw.cancel()
+
+				return nil
+			}
+
+			return err
 		},
 	)
 	if err != nil && ctx.Err() == nil {
@@ -153,7 +427,7 @@ func (tm *TargetManager) runWorker(ctx context.Context, name string) {
 }
 
 func (tm *TargetManager) workerFunc(
-	ctx context.Context, logger *slog.Logger, name string,
+	ctx context.Context, logger *slog.Logger, tw *targetWorker, name string,
 ) error {
 	q := postgres.New(tm.db)
 
@@ -162,84 +436,346 @@ func (tm *TargetManager) workerFunc(
 		return fmt.Errorf("load target config: %w", err)
 	}
 
-	var syncConfig replicant.SyncConfig
-
-	err = json.Unmarshal(target.Config, &syncConfig)
+	w, err := tm.newWorker(ctx, logger, target)
 	if err != nil {
-		return fmt.Errorf("unmarshal sync config: %w", err)
+		return err
 	}
 
-	clientSecret, err := DecryptSecret(tm.encryptionKey, target.ClientSecret)
-	if err != nil {
-		return fmt.Errorf("decrypt client secret: %w", err)
-	}
+	w.failures = &tw.failures
 
-	auth, err := elephantine.AuthenticationConfigFromSettings(
-		ctx,
-		elephantine.AuthenticationSettings{
-			OIDCConfig:   target.OidcConfig,
-			ClientID:     target.ClientID,
-			ClientSecret: clientSecret,
-		},
-		[]string{"doc_admin"},
-	)
+	err = tm.loadPauseState(ctx, name)
 	if err != nil {
-		return fmt.Errorf("set up target authentication: %w", err)
+		return err
 	}
 
-	targetClient := oauth2.NewClient(ctx, auth.TokenSource)
-
-	targetDocs := repository.NewDocumentsProtobufClient(
-		target.RepositoryUrl, targetClient,
-	)
-
-	cFilter, err := NewContentFilterFromSyncConfig(&syncConfig)
+	err = w.checkConfigDrift(ctx, target, tm.opts.ResyncOnConfigChange)
 	if err != nil {
-		return fmt.Errorf("create content filter: %w", err)
+		return fmt.Errorf("check for config changes: %w", err)
 	}
 
 	var state LogState
 
-	stateKey := name + ":log_state"
-
-	err = LoadState(ctx, q, stateKey, &state)
+	w.stateRevision, err = LoadStateRevision(ctx, q, w.stateKey(), &state)
 	if err != nil {
 		return fmt.Errorf("load log state: %w", err)
 	}
 
+	if tm.opts.PurgeBelowStartFrom && target.StartFrom > state.Position {
+		err := w.purgeMappingsBefore(ctx, target.StartFrom)
+		if err != nil {
+			return err
+		}
+	}
+
 	state.Position = max(state.Position, target.StartFrom)
 
-	if syncConfig.AllAttachments && len(syncConfig.IncludeAttachments) > 0 {
+	w.metrics.statePersisted(name, state)
+
+	if w.allAttachments && len(w.incAttachments) > 0 {
 		logger.Warn(
 			"running with both 'all-attachments' and 'include-attachments', all attachments will be included")
 	}
 
+	if w.dryRun {
+		logger.Warn("running in dry run mode, no changes will be written to the target")
+	}
+
 	logger.Info("starting replication",
 		elephantine.LogKeyEventID, state.Position)
 
-	lf := koonkie.NewLogFollower(tm.source, koonkie.FollowerOptions{
-		Metrics:      tm.logMetrics.WithName(name),
-		StartAfter:   state.Position,
-		CaughtUp:     state.CaughtUp,
-		WaitDuration: 10 * time.Second,
-	})
+	followerDocs := tm.opts.Follower.Documents(tm.source)
+
+	if tm.sharedLog != nil {
+		followerDocs = tm.sharedLog
+		w.sharedLog = tm.sharedLog
+	}
+
+	w.lf = koonkie.NewLogFollower(
+		followerDocs,
+		koonkie.FollowerOptions{
+			Metrics:      tm.logMetrics.WithName(name),
+			StartAfter:   state.Position,
+			CaughtUp:     state.CaughtUp,
+			WaitDuration: tm.opts.Follower.WaitDuration,
+		})
+
+	w.updateFollowerState()
+
+	tm.mu.Lock()
+	tw.worker = w
+	tm.mu.Unlock()
+
+	defer func() {
+		tm.mu.Lock()
+		tw.worker = nil
+		tm.mu.Unlock()
+	}()
+
+	return w.Replicate(ctx)
+}
+
+// newWorker creates a worker for the target without a log follower.
+func (tm *TargetManager) newWorker(
+	ctx context.Context, logger *slog.Logger, target postgres.ReplicationTarget,
+) (*Worker, error) {
+	var syncConfig replicant.SyncConfig
+
+	err := json.Unmarshal(target.Config, &syncConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal sync config: %w", err)
+	}
+
+	sink, err := tm.newSink(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+
+	targetDocs, targetWorkflows := sink.Documents, sink.Workflows
+
+	cFilter, err := NewContentFilterFromSyncConfig(&syncConfig)
+	if err != nil {
+		return nil, fmt.Errorf("create content filter: %w", err)
+	}
+
+	err = cFilter.RequireSections(tm.opts.RequireSections)
+	if err != nil {
+		return nil, fmt.Errorf("add required sections: %w", err)
+	}
+
+	cFilter.RequireLanguages(tm.opts.Languages)
+
+	stripSpecs := make([]string, len(tm.opts.StripBlocks.Rules))
+
+	for i, r := range tm.opts.StripBlocks.Rules {
+		stripSpecs[i] = r.Spec
+	}
+
+	typeMapping := tm.opts.TargetTypeMappings.For(target.Name, tm.opts.TypeMapping)
+
+	multipart, _ := targetDocs.(MultipartSink)
+
+	breaker := tm.targetBreaker(target.Name)
+	if breaker != nil {
+		targetDocs = &breakerSink{sink: targetDocs, breaker: breaker}
+	}
+
+	if breaker != nil && multipart != nil {
+		multipart = &breakerMultipartSink{sink: multipart, breaker: breaker}
+	}
+
+	// The breaker only guards the primary target, shadow writes never
+	// affect the replication.
+	targetDocs, err = tm.shadowSink(ctx, logger, target, targetDocs)
+	if err != nil {
+		return nil, err
+	}
 
 	w := &Worker{
-		name:           name,
-		logger:         logger,
-		db:             tm.db,
-		source:         tm.source,
-		target:         targetDocs,
-		cFilter:        cFilter,
-		lf:             lf,
-		acceptErrors:   syncConfig.AcceptErrors,
-		ignoreSubs:     syncConfig.IgnoreSubs,
-		ignoreTypes:    syncConfig.IgnoreTypes,
+		name:         target.Name,
+		logger:       logger,
+		db:           tm.db,
+		source:       tm.source,
+		target:       targetDocs,
+		multipart:    multipart,
+		breaker:      breaker,
+		pause:        tm.targetPause(target.Name),
+		minCreated:   tm.opts.MinOriginalCreated,
+		oversize:     tm.opts.Oversize,
+		cFilter:      cFilter,
+		acceptErrors: syncConfig.AcceptErrors,
+		eventFilters: append([]EventFilter{
+			IgnoreSubs(syncConfig.IgnoreSubs),
+			IgnoreTypes(syncConfig.IgnoreTypes),
+		}, tm.opts.EventFilters...),
+		includeUUIDs:   tm.opts.IncludeUUIDs,
 		allAttachments: syncConfig.AllAttachments,
 		incAttachments: attachmentRefsFromProto(syncConfig.IncludeAttachments),
+
+		httpClient:        tm.opts.HTTPClient,
+		attachmentRetry:   tm.opts.AttachmentRetry,
+		verifyAttachments: tm.opts.VerifyAttachments,
+		maxAttachmentSize: tm.opts.MaxAttachmentSize,
+		attachmentMemory:  tm.opts.AttachmentMemory,
+		detachAttachments: tm.opts.DetachAttachments,
+		multipartUploads:  tm.opts.MultipartUploads,
+
+		attachmentCompression: tm.opts.AttachmentCompression,
+
+		stateBatching: tm.opts.StateBatching,
+
+		attachmentConcurrency: tm.opts.AttachmentConcurrency,
+		attachmentTypes:       tm.opts.AttachmentContentTypes,
+		contentTypes:          tm.opts.AttachmentContentTypeOverrides,
+
+		typeMapping:  typeMapping,
+		fallbackType: tm.opts.FallbackType,
+		aclMapping:   tm.opts.ACLMapping,
+		aclTemplate:  tm.opts.ACLTemplate,
+		restriction:  tm.opts.ACLRestriction,
+		tracer:       tm.opts.Tracer,
+		stripper:     tm.opts.StripBlocks,
+		transformer:  tm.opts.Transformers,
+		normalizer:   tm.opts.CompareNormalization,
+		statusFilter: tm.opts.StatusFilter,
+
+		allowNoCurrentVersion: tm.opts.AllowNoCurrentVersion,
+
+		config: ConfigSnapshot{
+			IgnoreTypes:            syncConfig.IgnoreTypes,
+			IgnoreSubs:             syncConfig.IgnoreSubs,
+			IgnoreSections:         syncConfig.IgnoreSections,
+			RequireSections:        tm.opts.RequireSections,
+			Languages:              tm.opts.Languages,
+			IncludeAttachments:     attachmentRefsFromProto(syncConfig.IncludeAttachments),
+			AllAttachments:         syncConfig.AllAttachments,
+			AttachmentContentTypes: tm.opts.AttachmentContentTypes,
+			TypeMapping:            typeMapping,
+			ACLMapping:             tm.opts.ACLMapping,
+			ACLTemplate:            tm.opts.ACLTemplate,
+			ACLRestriction:         tm.opts.ACLRestriction,
+			StripBlocks:            stripSpecs,
+			StatusFilter:           tm.opts.StatusFilter,
+			UUIDMapping:            tm.opts.UUIDMapping,
+			MinOriginalCreated:     tm.opts.MinOriginalCreated,
+			IncludeUUIDs:           tm.opts.IncludeUUIDs.Fingerprint(),
+		},
+		uuidMapping: tm.opts.UUIDMapping,
+
+		quarantineThreshold: tm.opts.QuarantineThreshold,
+		concurrency:         tm.opts.ReplicationConcurrency,
+		unavailableBackoff:  tm.opts.UnavailableBackoff,
+		errorClasses:        tm.opts.ErrorClasses,
+		errorRetries:        tm.opts.ErrorRetries,
+
+		replicateWorkflows: tm.opts.ReplicateWorkflows,
+		sourceWorkflows:    tm.opts.SourceWorkflows,
+		sourceTokens:       tm.opts.SourceTokens,
+		targetTokens:       sink.Tokens,
+		targetWorkflows:    targetWorkflows,
+
+		dryRun:  tm.opts.DryRun,
+		metrics: tm.opts.Metrics,
+		stop:    tm.opts.Stop,
+		poll:    make(chan struct{}, 1),
+		shard:   tm.opts.Shard,
+
+		softDeleteStatus: tm.opts.SoftDeleteStatus,
+
+		softDeleteClearACL: tm.opts.SoftDeleteClearACL,
+
+		conflictPolicy:   tm.opts.ConflictPolicy,
+		unknownEvents:    tm.opts.UnknownEvents,
+		withheld:         tm.opts.Withheld,
+		auditLog:         tm.opts.AuditLog,
+		versionMeta:      tm.opts.ReplicateVersionMeta,
+		versionACL:       tm.opts.RefreshVersionACL,
+		parallelFetch:    tm.opts.ParallelFetch,
+		provenance:       tm.opts.ProvenanceMeta,
+		directives:       tm.opts.ImportDirectives,
+		statusBackfill:   tm.opts.BackfillStatuses,
+		mappingRetention: tm.opts.MappingRetention,
 	}
 
-	return w.Replicate(ctx)
+	// Pending statuses could have been recorded before a restart.
+	w.statusBackfillPending.Store(w.statusBackfill)
+
+	if f := tm.opts.TypeRouting.Filter(target.Name); f != nil {
+		w.eventFilters = append(w.eventFilters, f)
+	}
+
+	if tm.opts.LanguageRouting.Participates(target.Name) {
+		w.languageRouting = tm.opts.LanguageRouting
+	}
+
+	return w, nil
+}
+
+// SendDocument replicates the current version of a document to all enabled
+// targets, in name order. A failure for one target doesn't stop the document
+// from being sent to the rest, and the targets that it was written to keep
+// it. The failures are returned together, each wrapped with the name of its
+// target. Targets that skip the document aren't treated as failures unless
+// all of them skip it. Returns the target version of the document in the
+// first target that it was written to.
+func (tm *TargetManager) SendDocument(
+	ctx context.Context, docUUID uuid.UUID, force bool,
+) (int64, error) {
+	targets, err := postgres.New(tm.db).ListEnabledTargets(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("list enabled targets: %w", err)
+	}
+
+	if len(targets) == 0 {
+		return 0, ErrNoTargets
+	}
+
+	var (
+		version int64
+		sent    bool
+		skipErr error
+		errs    []error
+	)
+
+	for _, t := range targets {
+		logger := tm.logger.With("target", t.Name)
+
+		w, err := tm.newWorker(ctx, logger, t)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("create worker for %q: %w", t.Name, err))
+
+			continue
+		}
+
+		v, err := w.SendDocument(ctx, docUUID, force)
+
+		switch {
+		case errors.Is(err, ErrSkipped):
+			logger.InfoContext(ctx, "document skipped for target",
+				elephantine.LogKeyDocumentUUID, docUUID,
+				elephantine.LogKeyError, err)
+
+			if skipErr == nil {
+				skipErr = fmt.Errorf("send to %q: %w", t.Name, err)
+			}
+		case err != nil:
+			logger.ErrorContext(ctx, "failed to send document to target",
+				elephantine.LogKeyDocumentUUID, docUUID,
+				elephantine.LogKeyError, err)
+
+			errs = append(errs, fmt.Errorf("send to %q: %w", t.Name, err))
+		case !sent:
+			version = v
+			sent = true
+		}
+	}
+
+	if len(errs) > 0 {
+		return version, errors.Join(errs...)
+	}
+
+	if !sent {
+		return 0, skipErr
+	}
+
+	return version, nil
+}
+
+// ResyncDocument re-ingests the current state of a document to the named
+// target, see Worker.ResyncDocument().
+func (tm *TargetManager) ResyncDocument(
+	ctx context.Context, name string, docUUID uuid.UUID, releaseQuarantine bool,
+) (int64, bool, error) {
+	target, err := postgres.New(tm.db).GetTarget(ctx, name)
+	if err != nil {
+		return 0, false, fmt.Errorf("load target config: %w", err)
+	}
+
+	w, err := tm.newWorker(ctx, tm.logger.With("target", name), target)
+	if err != nil {
+		return 0, false, fmt.Errorf("create worker: %w", err)
+	}
+
+	return w.ResyncDocument(ctx, docUUID, releaseQuarantine)
 }
 
 func (tm *TargetManager) stopWorker(name string) {
@@ -294,6 +830,52 @@ func (tm *TargetManager) GetWorkerState(name string) replicant.TargetState {
 	return replicant.TargetState_TARGET_STATE_RUNNING
 }
 
+// ActiveWorker returns the worker for the named target if it's replicating in
+// this process.
+func (tm *TargetManager) ActiveWorker(name string) (*Worker, bool) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	tw, exists := tm.workers[name]
+	if !exists || tw.worker == nil {
+		return nil, false
+	}
+
+	return tw.worker, true
+}
+
+// TargetUUID returns the UUID that the source document has in the targets.
+func (tm *TargetManager) TargetUUID(docUUID uuid.UUID) uuid.UUID {
+	return tm.opts.UUIDMapping.Map(docUUID)
+}
+
+// Shard returns the name of the source shard that the manager follows, empty
+// for unsharded sources.
+func (tm *TargetManager) Shard() string {
+	return tm.opts.Shard
+}
+
+// logStateKey returns the log state key of a target for the source shard.
+func (tm *TargetManager) logStateKey(target string) string {
+	return shardKey(logStateKey(target), tm.opts.Shard)
+}
+
+// LastEventID returns the ID of the last event in the source eventlog.
+func (tm *TargetManager) LastEventID(ctx context.Context) (int64, error) {
+	res, err := tm.source.Eventlog(ctx, &repository.GetEventlogRequest{
+		After: -1,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("read last event: %w", err)
+	}
+
+	if len(res.Items) == 0 {
+		return 0, nil
+	}
+
+	return res.Items[0].Id, nil
+}
+
 func attachmentRefsFromProto(
 	attachments []*replicant.AttachmentForType,
 ) []AttachmentRef {
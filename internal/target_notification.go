@@ -5,6 +5,12 @@ package internal
 type TargetNotification struct {
 	Name   string `json:"name"`
 	Action string `json:"action"`
+	// Position and CaughtUp are the log state that a reset target should
+	// continue from.
+	Position int64 `json:"position,omitempty"`
+	CaughtUp bool  `json:"caught_up,omitempty"`
+	// Shard is the source shard that a reset applies to.
+	Shard string `json:"shard,omitempty"`
 }
 
 const (
@@ -12,6 +18,10 @@ const (
 	TargetActionRemove    = "remove"
 	TargetActionStart     = "start"
 	TargetActionStop      = "stop"
+	TargetActionReset     = "reset"
+	TargetActionPause     = "pause"
+	TargetActionResume    = "resume"
+	TargetActionPoll      = "poll"
 
 	TargetNotifyChannel = "replicant_target"
 )
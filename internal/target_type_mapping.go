@@ -0,0 +1,59 @@
+package internal
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+)
+
+// TargetTypeMappings are type mappings that only apply to specific targets,
+// by target name. The mappings of a target are applied on top of the type
+// mappings that apply to all targets.
+type TargetTypeMappings map[string]map[string]string
+
+// For returns the type mapping of the target, with the mappings of the target
+// taking precedence over the global mappings.
+func (m TargetTypeMappings) For(target string, global map[string]string) map[string]string {
+	own := m[target]
+	if len(own) == 0 {
+		return global
+	}
+
+	mapping := make(map[string]string, len(global)+len(own))
+
+	maps.Copy(mapping, global)
+	maps.Copy(mapping, own)
+
+	return mapping
+}
+
+// ParseTargetTypeMappings parses target type mappings in the format
+// "[target]:[source type]=[target type]".
+func ParseTargetTypeMappings(specs []string) (TargetTypeMappings, error) {
+	mappings := make(TargetTypeMappings)
+
+	for _, spec := range specs {
+		target, mapping, ok := strings.Cut(spec, ":")
+		if !ok || target == "" {
+			return nil, fmt.Errorf("invalid target type mapping %q", spec)
+		}
+
+		source, targetType, ok := strings.Cut(mapping, "=")
+		if !ok || source == "" || targetType == "" {
+			return nil, fmt.Errorf("invalid target type mapping %q", spec)
+		}
+
+		if mappings[target] == nil {
+			mappings[target] = make(map[string]string)
+		}
+
+		if _, exists := mappings[target][source]; exists {
+			return nil, fmt.Errorf("duplicate type mapping for %q in target %q",
+				source, target)
+		}
+
+		mappings[target][source] = targetType
+	}
+
+	return mappings, nil
+}
@@ -0,0 +1,52 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/ttab/elephant-replicant/internal"
+)
+
+func TestTargetTypeMappings(t *testing.T) {
+	mappings, err := internal.ParseTargetTypeMappings([]string{
+		"archive:core/article=archive/article",
+		"archive:core/image=archive/image",
+	})
+	if err != nil {
+		t.Fatalf("parse target type mappings: %v", err)
+	}
+
+	global := map[string]string{
+		"core/article": "example/article",
+		"core/event":   "example/event",
+	}
+
+	archive := mappings.For("archive", global)
+
+	if archive["core/article"] != "archive/article" ||
+		archive["core/image"] != "archive/image" ||
+		archive["core/event"] != "example/event" {
+		t.Errorf("expected the target mappings on top of the global ones, got %v", archive)
+	}
+
+	if other := mappings.For("production", global); other["core/article"] != "example/article" {
+		t.Errorf("expected other targets to use the global mappings, got %v", other)
+	}
+
+	for _, spec := range []string{
+		"core/article=archive/article",
+		"archive:core/article",
+		"archive:=archive/article",
+	} {
+		_, err := internal.ParseTargetTypeMappings([]string{spec})
+		if err == nil {
+			t.Errorf("expected %q to be rejected", spec)
+		}
+	}
+
+	_, err = internal.ParseTargetTypeMappings([]string{
+		"archive:core/article=a", "archive:core/article=b",
+	})
+	if err == nil {
+		t.Error("expected duplicate mappings to be rejected")
+	}
+}
@@ -0,0 +1,99 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// TokenRefresher is implemented by token sources that can be forced to fetch
+// a new token, f.ex. after a request was rejected as unauthenticated.
+type TokenRefresher interface {
+	Invalidate()
+}
+
+// RefreshingTokenSource caches tokens from a token source, and fetches a new
+// token before the current one expires. Tokens without an expiry time are
+// reused until they are invalidated.
+type RefreshingTokenSource struct {
+	newSource func() (oauth2.TokenSource, error)
+	margin    time.Duration
+	now       func() time.Time
+
+	mu    sync.Mutex
+	token *oauth2.Token
+}
+
+// NewRefreshingTokenSource creates a token source that refreshes the token
+// when it expires within the margin. A new source is created with newSource
+// for every token fetch, so that we never get a token cached by the source
+// itself.
+func NewRefreshingTokenSource(
+	newSource func() (oauth2.TokenSource, error), margin time.Duration,
+) *RefreshingTokenSource {
+	return &RefreshingTokenSource{
+		newSource: newSource,
+		margin:    margin,
+		now:       time.Now,
+	}
+}
+
+// Token implements oauth2.TokenSource.
+func (ts *RefreshingTokenSource) Token() (*oauth2.Token, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if ts.usable(ts.token) {
+		return ts.token, nil
+	}
+
+	src, err := ts.newSource()
+	if err != nil {
+		return nil, fmt.Errorf("create token source: %w", err)
+	}
+
+	token, err := src.Token()
+	if err != nil {
+		return nil, fmt.Errorf("fetch token: %w", err)
+	}
+
+	ts.token = token
+
+	return token, nil
+}
+
+// Invalidate implements TokenRefresher.
+func (ts *RefreshingTokenSource) Invalidate() {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	ts.token = nil
+}
+
+// NewTokenClient creates an HTTP client that authenticates its requests with
+// tokens from the token source. Unlike oauth2.NewClient() the source isn't
+// wrapped in a reusing token source that caches the token until it expires,
+// so invalidated tokens and the refresh margin take effect right away.
+func NewTokenClient(tokens oauth2.TokenSource) *http.Client {
+	return &http.Client{
+		Transport: &oauth2.Transport{
+			Source: tokens,
+			Base:   http.DefaultTransport,
+		},
+	}
+}
+
+func (ts *RefreshingTokenSource) usable(token *oauth2.Token) bool {
+	if token == nil || token.AccessToken == "" {
+		return false
+	}
+
+	if token.Expiry.IsZero() {
+		return true
+	}
+
+	return ts.now().Add(ts.margin).Before(token.Expiry)
+}
@@ -0,0 +1,115 @@
+package internal_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ttab/elephant-replicant/internal"
+	"golang.org/x/oauth2"
+)
+
+func TestRefreshingTokenSource(t *testing.T) {
+	var (
+		fetched int
+		expiry  = time.Now().Add(time.Hour)
+	)
+
+	ts := internal.NewRefreshingTokenSource(func() (oauth2.TokenSource, error) {
+		fetched++
+
+		return oauth2.StaticTokenSource(&oauth2.Token{
+			AccessToken: "token",
+			Expiry:      expiry,
+		}), nil
+	}, time.Minute)
+
+	for range 3 {
+		_, err := ts.Token()
+		if err != nil {
+			t.Fatalf("get token: %v", err)
+		}
+	}
+
+	if fetched != 1 {
+		t.Fatalf("expected the token to be reused, fetched %d times", fetched)
+	}
+
+	ts.Invalidate()
+
+	_, err := ts.Token()
+	if err != nil {
+		t.Fatalf("get token: %v", err)
+	}
+
+	if fetched != 2 {
+		t.Fatalf("expected a new token after invalidation, fetched %d times", fetched)
+	}
+
+	// Tokens that expire within the margin are refreshed.
+	expiry = time.Now().Add(30 * time.Second)
+
+	ts.Invalidate()
+
+	for range 2 {
+		_, err := ts.Token()
+		if err != nil {
+			t.Fatalf("get token: %v", err)
+		}
+	}
+
+	if fetched != 4 {
+		t.Fatalf("expected expiring tokens to be refreshed, fetched %d times", fetched)
+	}
+}
+
+func TestTokenClientUsesInvalidatedTokens(t *testing.T) {
+	var (
+		fetched int
+		seen    []string
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			seen = append(seen, r.Header.Get("Authorization"))
+		}))
+	defer srv.Close()
+
+	ts := internal.NewRefreshingTokenSource(func() (oauth2.TokenSource, error) {
+		fetched++
+
+		return oauth2.StaticTokenSource(&oauth2.Token{
+			AccessToken: fmt.Sprintf("token-%d", fetched),
+			TokenType:   "Bearer",
+			Expiry:      time.Now().Add(time.Hour),
+		}), nil
+	}, time.Minute)
+
+	client := internal.NewTokenClient(ts)
+
+	get := func() {
+		t.Helper()
+
+		res, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("make request: %v", err)
+		}
+
+		_ = res.Body.Close()
+	}
+
+	get()
+	get()
+
+	ts.Invalidate()
+
+	get()
+
+	want := []string{"Bearer token-1", "Bearer token-1", "Bearer token-2"}
+
+	if fmt.Sprint(seen) != fmt.Sprint(want) {
+		t.Fatalf("expected the authorization headers %v, got %v", want, seen)
+	}
+}
@@ -0,0 +1,70 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const tracerName = "github.com/ttab/elephant-replicant"
+
+// newTracerProvider creates a tracer provider that exports spans to an
+// OTLP/HTTP endpoint. A no-op provider is returned if no endpoint has been
+// configured. The returned function flushes and stops the exporter.
+func newTracerProvider(
+	ctx context.Context, endpoint string,
+) (trace.TracerProvider, func(context.Context) error, error) {
+	if endpoint == "" {
+		return noop.NewTracerProvider(), func(_ context.Context) error {
+			return nil
+		}, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx,
+		otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, nil, fmt.Errorf("create trace exporter: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", "elephant-replicant"),
+		)),
+	)
+
+	return provider, provider.Shutdown, nil
+}
+
+func eventAttributes(
+	id int64, event string, docUUID string,
+) trace.SpanStartEventOption {
+	return trace.WithAttributes(
+		attribute.Int64("event.id", id),
+		attribute.String("event.type", event),
+		attribute.String("document.uuid", docUUID),
+	)
+}
+
+// endSpan records the outcome of the operation and ends the span. Skipped
+// events and conflicts are expected and aren't reported as errors.
+func endSpan(span trace.Span, err error) {
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrSkipped), errors.Is(err, ErrConflict):
+		span.SetAttributes(attribute.String("outcome", err.Error()))
+	default:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	rpc_newsdoc "github.com/ttab/elephant-api/newsdoc"
+)
+
+// DocumentTransformer makes custom changes to documents before they are
+// written to the target.
+type DocumentTransformer interface {
+	Transform(ctx context.Context, doc *rpc_newsdoc.Document) error
+}
+
+// TransformPipeline applies transformers to documents in order. Transformers
+// see the document after blocks have been stripped, but before its type and
+// UUID have been mapped.
+type TransformPipeline []DocumentTransformer
+
+// Transform applies all transformers in order, and stops at the first error.
+func (p TransformPipeline) Transform(
+	ctx context.Context, doc *rpc_newsdoc.Document,
+) error {
+	for i, t := range p {
+		err := t.Transform(ctx, doc)
+		if err != nil {
+			return fmt.Errorf("transformer %d (%T): %w", i, t, err)
+		}
+	}
+
+	return nil
+}
+
+// LinkURIPrefixRewrite replaces the prefix of link URIs, f.ex. to point links
+// to media at a public CDN.
+type LinkURIPrefixRewrite struct {
+	// Rel restricts the rewrite to links with the relation, applies to all
+	// links if empty.
+	Rel  string
+	From string
+	To   string
+}
+
+// Transform rewrites the URIs of all matching links in the document,
+// including links of nested blocks.
+func (r LinkURIPrefixRewrite) Transform(
+	_ context.Context, doc *rpc_newsdoc.Document,
+) error {
+	r.rewrite(doc.Meta, false)
+	r.rewrite(doc.Links, true)
+	r.rewrite(doc.Content, false)
+
+	return nil
+}
+
+func (r LinkURIPrefixRewrite) rewrite(blocks []*rpc_newsdoc.Block, links bool) {
+	for _, b := range blocks {
+		if links && (r.Rel == "" || b.Rel == r.Rel) {
+			rest, ok := strings.CutPrefix(b.Uri, r.From)
+			if ok {
+				b.Uri = r.To + rest
+			}
+		}
+
+		r.rewrite(b.Meta, false)
+		r.rewrite(b.Links, true)
+		r.rewrite(b.Content, false)
+	}
+}
+
+// ParseLinkURIRewrites parses link URI prefix rewrites in the format
+// "[from]=[to]". The rewrites are applied to links of all relations.
+func ParseLinkURIRewrites(specs []string) (TransformPipeline, error) {
+	var p TransformPipeline
+
+	for _, s := range specs {
+		from, to, ok := strings.Cut(s, "=")
+		if !ok || from == "" {
+			return nil, fmt.Errorf("invalid link URI rewrite %q", s)
+		}
+
+		p = append(p, LinkURIPrefixRewrite{
+			From: from,
+			To:   to,
+		})
+	}
+
+	return p, nil
+}
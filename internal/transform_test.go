@@ -0,0 +1,120 @@
+package internal_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	rpc_newsdoc "github.com/ttab/elephant-api/newsdoc"
+	"github.com/ttab/elephant-replicant/internal"
+)
+
+type titleSuffix string
+
+func (s titleSuffix) Transform(
+	_ context.Context, doc *rpc_newsdoc.Document,
+) error {
+	doc.Title += string(s)
+
+	return nil
+}
+
+type failingTransformer struct{}
+
+func (failingTransformer) Transform(
+	_ context.Context, _ *rpc_newsdoc.Document,
+) error {
+	return errors.New("failed")
+}
+
+func TestTransformPipelineOrder(t *testing.T) {
+	p := internal.TransformPipeline{
+		titleSuffix("-a"),
+		titleSuffix("-b"),
+	}
+
+	doc := &rpc_newsdoc.Document{Title: "doc"}
+
+	err := p.Transform(t.Context(), doc)
+	if err != nil {
+		t.Fatalf("transform: %v", err)
+	}
+
+	if doc.Title != "doc-a-b" {
+		t.Errorf("got title %q, want %q", doc.Title, "doc-a-b")
+	}
+}
+
+func TestTransformPipelineStopsOnError(t *testing.T) {
+	p := internal.TransformPipeline{
+		failingTransformer{},
+		titleSuffix("-a"),
+	}
+
+	doc := &rpc_newsdoc.Document{Title: "doc"}
+
+	err := p.Transform(t.Context(), doc)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if doc.Title != "doc" {
+		t.Errorf("expected later transformers to be skipped, got title %q",
+			doc.Title)
+	}
+}
+
+func TestLinkURIPrefixRewrite(t *testing.T) {
+	p, err := internal.ParseLinkURIRewrites([]string{
+		"https://media.internal/=https://cdn.example.com/",
+	})
+	if err != nil {
+		t.Fatalf("parse rewrites: %v", err)
+	}
+
+	doc := &rpc_newsdoc.Document{
+		Links: []*rpc_newsdoc.Block{
+			{Rel: "image", Uri: "https://media.internal/a.jpg"},
+			{Rel: "see-also", Uri: "https://example.com/b"},
+		},
+		Content: []*rpc_newsdoc.Block{
+			{
+				Type: "core/image",
+				Uri:  "https://media.internal/c.jpg",
+				Links: []*rpc_newsdoc.Block{
+					{Rel: "self", Uri: "https://media.internal/c.jpg"},
+				},
+			},
+		},
+	}
+
+	err = p.Transform(t.Context(), doc)
+	if err != nil {
+		t.Fatalf("transform: %v", err)
+	}
+
+	if got := doc.Links[0].Uri; got != "https://cdn.example.com/a.jpg" {
+		t.Errorf("got link URI %q", got)
+	}
+
+	if got := doc.Links[1].Uri; got != "https://example.com/b" {
+		t.Errorf("expected non-matching link to be kept, got %q", got)
+	}
+
+	if got := doc.Content[0].Links[0].Uri; got != "https://cdn.example.com/c.jpg" {
+		t.Errorf("got nested link URI %q", got)
+	}
+
+	if got := doc.Content[0].Uri; got != "https://media.internal/c.jpg" {
+		t.Errorf("expected content block URI to be kept, got %q", got)
+	}
+}
+
+func TestParseLinkURIRewritesInvalid(t *testing.T) {
+	for _, spec := range []string{"", "https://example.com/", "=https://cdn/"} {
+		_, err := internal.ParseLinkURIRewrites([]string{spec})
+		if err == nil {
+			t.Errorf("expected an error for %q", spec)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package internal
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephantine"
+	"github.com/twitchtv/twirp"
+)
+
+// ErrTargetUnavailable is used to mark errors from target requests that failed
+// because the target repository couldn't be reached.
+var ErrTargetUnavailable = errors.New("target unavailable")
+
+// targetError marks the error with ErrTargetUnavailable if it's the result of
+// a transient failure to reach the target.
+func targetError(err error) error {
+	var opErr *net.OpError
+
+	if elephantine.IsTwirpErrorCode(err, twirp.Unavailable) ||
+		errors.As(err, &opErr) {
+		return fmt.Errorf("%w: %w", ErrTargetUnavailable, err)
+	}
+
+	return err
+}
+
+// refreshTokens invalidates the source and target access tokens so that new
+// ones are fetched for the next request. Returns false if there are no tokens
+// to refresh.
+func (w *Worker) refreshTokens(
+	ctx context.Context, evt *repository.EventlogItem, authErr error,
+) bool {
+	if w.sourceTokens == nil && w.targetTokens == nil {
+		return false
+	}
+
+	w.logger.WarnContext(ctx, "request was unauthenticated, retrying with new access tokens",
+		elephantine.LogKeyEventID, evt.Id,
+		elephantine.LogKeyDocumentUUID, evt.Uuid,
+		elephantine.LogKeyError, authErr,
+	)
+
+	if w.sourceTokens != nil {
+		w.sourceTokens.Invalidate()
+	}
+
+	if w.targetTokens != nil {
+		w.targetTokens.Invalidate()
+	}
+
+	return true
+}
+
+// handleEventWithRetry handles the event, and keeps retrying it with backoff
+// for as long as it fails with retryable errors, f.ex. because the target is
+// unavailable. Events that fail because the target can't be reached are
+// retried until the target is back, other retryable errors are retried at most
+// errorRetries times. Other errors are returned as-is.
+func (w *Worker) handleEventWithRetry(
+	ctx context.Context, evt *repository.EventlogItem, caughtUp bool,
+) error {
+	var (
+		refreshed  bool
+		errRetries int
+	)
+
+	maxRetries := cmp.Or(w.errorRetries, defaultErrorRetries)
+
+	for retry := 1; ; retry++ {
+		// Pause while the circuit breaker of the target is open
+		// instead of failing the event right away.
+		err := w.breaker.Wait(ctx, w.stop)
+		if err != nil {
+			return err
+		}
+
+		err = w.handleEvent(ctx, evt, caughtUp)
+
+		// Retry once with new access tokens if the event failed
+		// because a token had expired or been revoked.
+		if !refreshed && elephantine.IsTwirpErrorCode(err, twirp.Unauthenticated) &&
+			w.refreshTokens(ctx, evt, err) {
+			refreshed = true
+
+			continue
+		}
+
+		if w.errorClasses.Classify(err) != ErrorRetryable || w.unavailableBackoff.BaseDelay <= 0 {
+			return err
+		}
+
+		if !errors.Is(err, ErrTargetUnavailable) {
+			errRetries++
+
+			if errRetries > maxRetries {
+				return fmt.Errorf("giving up after %d retries: %w", maxRetries, err)
+			}
+		}
+
+		delay := w.unavailableBackoff.Delay(retry)
+
+		w.logger.WarnContext(ctx, "transient failure, retrying event",
+			elephantine.LogKeyEventID, evt.Id,
+			elephantine.LogKeyDocumentUUID, evt.Uuid,
+			"retry", retry,
+			"delay", delay,
+			elephantine.LogKeyError, err,
+		)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err() //nolint: wrapcheck
+		case <-w.stop:
+			return errStopped
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephantine"
+)
+
+// UnknownEventPolicy controls what happens to eventlog events of types that
+// the replicant doesn't handle, f.ex. events for document type definition
+// changes emitted by newer versions of the repository.
+type UnknownEventPolicy string
+
+const (
+	// UnknownEventsSkip skips unknown events.
+	UnknownEventsSkip UnknownEventPolicy = "skip"
+	// UnknownEventsWarn skips unknown events and logs a warning with the
+	// details of the event.
+	UnknownEventsWarn UnknownEventPolicy = "warn"
+	// UnknownEventsHalt stops replication at the unknown event, so that
+	// the replicant can be upgraded before any later events are handled.
+	UnknownEventsHalt UnknownEventPolicy = "halt"
+)
+
+// ErrUnknownEvent is returned for events of unknown types when replication
+// should halt.
+var ErrUnknownEvent = errors.New("unknown event type")
+
+// ParseUnknownEventPolicy parses an unknown event policy, an empty value is
+// treated as UnknownEventsWarn.
+func ParseUnknownEventPolicy(s string) (UnknownEventPolicy, error) {
+	switch p := UnknownEventPolicy(s); p {
+	case "":
+		return UnknownEventsWarn, nil
+	case UnknownEventsSkip, UnknownEventsWarn, UnknownEventsHalt:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown event policy %q", s)
+	}
+}
+
+// IsKnownEvent returns true if the replicant knows how to handle events of the
+// type.
+func IsKnownEvent(event string) bool {
+	switch event {
+	case TypeDocumentVersion, TypeNewStatus, TypeACLUpdate,
+		TypeDeleteDocument, TypeRestoreFinished, TypeWorkflow:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *Worker) handleUnknownEvent(
+	ctx context.Context, evt *repository.EventlogItem,
+) error {
+	switch w.unknownEvents {
+	case UnknownEventsHalt:
+		return fmt.Errorf("%w %q", ErrUnknownEvent, evt.Event)
+	case UnknownEventsWarn, "":
+		w.logger.WarnContext(ctx,
+			"skipping event of unknown type, the source might have changed its document types",
+			elephantine.LogKeyEventID, evt.Id,
+			elephantine.LogKeyEventType, evt.Event,
+			elephantine.LogKeyDocumentUUID, evt.Uuid,
+			elephantine.LogKeyDocumentType, evt.Type,
+			"updater", evt.UpdaterUri,
+			"timestamp", evt.Timestamp,
+		)
+	}
+
+	return fmt.Errorf("unknown event type %q: %w", evt.Event, ErrSkipped)
+}
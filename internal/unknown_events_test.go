@@ -0,0 +1,42 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/ttab/elephant-replicant/internal"
+)
+
+func TestParseUnknownEventPolicy(t *testing.T) {
+	cases := map[string]internal.UnknownEventPolicy{
+		"":     internal.UnknownEventsWarn,
+		"skip": internal.UnknownEventsSkip,
+		"warn": internal.UnknownEventsWarn,
+		"halt": internal.UnknownEventsHalt,
+	}
+
+	for s, want := range cases {
+		got, err := internal.ParseUnknownEventPolicy(s)
+		if err != nil {
+			t.Fatalf("parse %q: %v", s, err)
+		}
+
+		if got != want {
+			t.Errorf("got %q for %q, want %q", got, s, want)
+		}
+	}
+
+	_, err := internal.ParseUnknownEventPolicy("ignore")
+	if err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+}
+
+func TestIsKnownEvent(t *testing.T) {
+	if !internal.IsKnownEvent(internal.TypeDocumentVersion) {
+		t.Error("expected document events to be known")
+	}
+
+	if internal.IsKnownEvent("type_definition") {
+		t.Error("didn't expect type definition events to be known")
+	}
+}
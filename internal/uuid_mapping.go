@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"github.com/google/uuid"
+	"github.com/ttab/elephant-api/newsdoc"
+)
+
+// UUIDMapping derives the UUIDs that documents get in the target from the
+// source UUIDs. The zero value keeps the source UUIDs.
+type UUIDMapping struct {
+	// Namespace is used to derive target UUIDs as UUIDv5 from the source
+	// UUIDs.
+	Namespace uuid.UUID
+	// RewriteReferences enables rewriting of block UUIDs that reference
+	// other replicated documents.
+	RewriteReferences bool
+}
+
+// Map returns the target UUID for a source UUID.
+func (m UUIDMapping) Map(id uuid.UUID) uuid.UUID {
+	if m.Namespace == uuid.Nil {
+		return id
+	}
+
+	return uuid.NewSHA1(m.Namespace, []byte(id.String()))
+}
+
+// ReferencedUUIDs returns the UUIDs of all blocks in the document that are
+// candidates for reference rewriting.
+func (m UUIDMapping) ReferencedUUIDs(doc *newsdoc.Document) []uuid.UUID {
+	if m.Namespace == uuid.Nil || !m.RewriteReferences {
+		return nil
+	}
+
+	var ids []uuid.UUID
+
+	walkDocumentBlocks(doc, func(b *newsdoc.Block) {
+		id, err := uuid.Parse(b.Uuid)
+		if err != nil {
+			return
+		}
+
+		ids = append(ids, id)
+	})
+
+	return ids
+}
+
+// Rewrite replaces the UUIDs of blocks that reference documents in
+// the replicated set with their target UUIDs.
+func (m UUIDMapping) Rewrite(
+	doc *newsdoc.Document, replicated map[uuid.UUID]bool,
+) {
+	if m.Namespace == uuid.Nil || !m.RewriteReferences {
+		return
+	}
+
+	walkDocumentBlocks(doc, func(b *newsdoc.Block) {
+		id, err := uuid.Parse(b.Uuid)
+		if err != nil || !replicated[id] {
+			return
+		}
+
+		b.Uuid = m.Map(id).String()
+	})
+}
+
+func walkDocumentBlocks(doc *newsdoc.Document, fn func(b *newsdoc.Block)) {
+	walkBlocks(doc.Meta, fn)
+	walkBlocks(doc.Links, fn)
+	walkBlocks(doc.Content, fn)
+}
+
+func walkBlocks(blocks []*newsdoc.Block, fn func(b *newsdoc.Block)) {
+	for _, b := range blocks {
+		fn(b)
+
+		walkBlocks(b.Meta, fn)
+		walkBlocks(b.Links, fn)
+		walkBlocks(b.Content, fn)
+	}
+}
@@ -0,0 +1,57 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/ttab/elephant-api/newsdoc"
+	"github.com/ttab/elephant-replicant/internal"
+)
+
+func TestUUIDMappingRewrite(t *testing.T) {
+	mapping := internal.UUIDMapping{
+		Namespace:         uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8"),
+		RewriteReferences: true,
+	}
+
+	replicatedRef := uuid.MustParse("f3a9b670-3c1b-4b8e-9a43-2d2e4486c2c4")
+	externalRef := uuid.MustParse("0730efa9-43f2-468d-979a-aaffc74d7582")
+
+	doc := newsdoc.Document{
+		Links: []*newsdoc.Block{
+			{Rel: "section", Uuid: externalRef.String()},
+			{
+				Rel:  "article",
+				Uuid: replicatedRef.String(),
+				Links: []*newsdoc.Block{
+					{Rel: "nested", Uuid: replicatedRef.String()},
+				},
+			},
+		},
+	}
+
+	refs := mapping.ReferencedUUIDs(&doc)
+	if len(refs) != 3 {
+		t.Fatalf("got %d references, want 3", len(refs))
+	}
+
+	mapping.Rewrite(&doc, map[uuid.UUID]bool{replicatedRef: true})
+
+	want := mapping.Map(replicatedRef).String()
+
+	if doc.Links[0].Uuid != externalRef.String() {
+		t.Errorf("expected reference to unreplicated document to be kept")
+	}
+
+	if doc.Links[1].Uuid != want || doc.Links[1].Links[0].Uuid != want {
+		t.Errorf("expected references to replicated document to be rewritten to %s", want)
+	}
+}
+
+func TestUUIDMappingZeroKeepsUUIDs(t *testing.T) {
+	id := uuid.MustParse("f3a9b670-3c1b-4b8e-9a43-2d2e4486c2c4")
+
+	if got := (internal.UUIDMapping{}).Map(id); got != id {
+		t.Errorf("got %s, want the source UUID", got)
+	}
+}
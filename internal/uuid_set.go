@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/ttab/elephant-api/repository"
+)
+
+// UUIDSet is a set of document UUIDs with constant time membership checks,
+// used to only replicate an explicit list of documents.
+type UUIDSet map[uuid.UUID]struct{}
+
+// NewUUIDSet creates a set of the given UUIDs.
+func NewUUIDSet(ids ...uuid.UUID) UUIDSet {
+	s := make(UUIDSet, len(ids))
+
+	for _, id := range ids {
+		s[id] = struct{}{}
+	}
+
+	return s
+}
+
+// ParseUUIDSet parses a list of UUIDs into a set.
+func ParseUUIDSet(values []string) (UUIDSet, error) {
+	s := make(UUIDSet, len(values))
+
+	for _, v := range values {
+		id, err := uuid.Parse(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("invalid UUID %q: %w", v, err)
+		}
+
+		s[id] = struct{}{}
+	}
+
+	return s, nil
+}
+
+// ReadUUIDSet reads a set of UUIDs with one UUID per line. Empty lines and
+// lines starting with "#" are ignored.
+func ReadUUIDSet(r io.Reader) (UUIDSet, error) {
+	s := make(UUIDSet)
+
+	scanner := bufio.NewScanner(r)
+
+	var line int
+
+	for scanner.Scan() {
+		line++
+
+		v := strings.TrimSpace(scanner.Text())
+		if v == "" || strings.HasPrefix(v, "#") {
+			continue
+		}
+
+		id, err := uuid.Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid UUID on line %d: %w", line, err)
+		}
+
+		s[id] = struct{}{}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read UUIDs: %w", err)
+	}
+
+	return s, nil
+}
+
+// Contains returns true if the UUID is in the set.
+func (s UUIDSet) Contains(id uuid.UUID) bool {
+	_, ok := s[id]
+
+	return ok
+}
+
+// Included returns true if the event refers to a document in the set. Events
+// for meta documents are included if their main document is in the set. A nil
+// set includes all documents.
+func (s UUIDSet) Included(evt *repository.EventlogItem) bool {
+	if s == nil {
+		return true
+	}
+
+	if id, err := uuid.Parse(evt.Uuid); err == nil && s.Contains(id) {
+		return true
+	}
+
+	if evt.MainDocument == "" {
+		return false
+	}
+
+	main, err := uuid.Parse(evt.MainDocument)
+
+	return err == nil && s.Contains(main)
+}
+
+// Fingerprint returns a short digest of the set that changes when the set
+// changes, so that large sets can be compared without being stored. Returns
+// an empty string for a nil set.
+func (s UUIDSet) Fingerprint() string {
+	if s == nil {
+		return ""
+	}
+
+	ids := make([]uuid.UUID, 0, len(s))
+
+	for id := range s {
+		ids = append(ids, id)
+	}
+
+	slices.SortFunc(ids, func(a, b uuid.UUID) int {
+		return bytes.Compare(a[:], b[:])
+	})
+
+	h := sha256.New()
+
+	for _, id := range ids {
+		h.Write(id[:])
+	}
+
+	return fmt.Sprintf("%d:%s", len(ids), hex.EncodeToString(h.Sum(nil)[:8]))
+}
@@ -0,0 +1,83 @@
+package internal_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/internal"
+)
+
+func TestUUIDSetIncluded(t *testing.T) {
+	included := uuid.MustParse("0e7e5f38-3c5c-4bd4-a4a2-1fb1d4039b23")
+	other := uuid.MustParse("5b2a53e6-7c9d-4a8f-8d7e-0df3a55f1b5e")
+
+	set := internal.NewUUIDSet(included)
+
+	if !set.Included(&repository.EventlogItem{Uuid: included.String()}) {
+		t.Error("expected document in the set to be included")
+	}
+
+	if set.Included(&repository.EventlogItem{Uuid: other.String()}) {
+		t.Error("expected document outside the set to be excluded")
+	}
+
+	meta := &repository.EventlogItem{
+		Uuid:         other.String(),
+		MainDocument: included.String(),
+	}
+	if !set.Included(meta) {
+		t.Error("expected meta document of an included document to be included")
+	}
+
+	var all internal.UUIDSet
+
+	if !all.Included(&repository.EventlogItem{Uuid: other.String()}) {
+		t.Error("expected a nil set to include all documents")
+	}
+
+	if internal.NewUUIDSet().Included(&repository.EventlogItem{Uuid: other.String()}) {
+		t.Error("expected an empty set to exclude all documents")
+	}
+}
+
+func TestReadUUIDSet(t *testing.T) {
+	set, err := internal.ReadUUIDSet(strings.NewReader(`
+# Curated demo documents
+0e7e5f38-3c5c-4bd4-a4a2-1fb1d4039b23
+
+  5b2a53e6-7c9d-4a8f-8d7e-0df3a55f1b5e
+`))
+	if err != nil {
+		t.Fatalf("read set: %v", err)
+	}
+
+	if len(set) != 2 {
+		t.Errorf("expected 2 UUIDs, got %d", len(set))
+	}
+
+	_, err = internal.ReadUUIDSet(strings.NewReader("not-a-uuid\n"))
+	if err == nil {
+		t.Error("expected an error for an invalid UUID")
+	}
+}
+
+func TestUUIDSetFingerprint(t *testing.T) {
+	a := uuid.MustParse("0e7e5f38-3c5c-4bd4-a4a2-1fb1d4039b23")
+	b := uuid.MustParse("5b2a53e6-7c9d-4a8f-8d7e-0df3a55f1b5e")
+
+	var unset internal.UUIDSet
+
+	if unset.Fingerprint() != "" {
+		t.Error("expected an empty fingerprint for a nil set")
+	}
+
+	if internal.NewUUIDSet(a, b).Fingerprint() != internal.NewUUIDSet(b, a).Fingerprint() {
+		t.Error("expected the fingerprint to be independent of order")
+	}
+
+	if internal.NewUUIDSet(a).Fingerprint() == internal.NewUUIDSet(a, b).Fingerprint() {
+		t.Error("expected the fingerprint to change with the set")
+	}
+}
@@ -0,0 +1,265 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/ttab/elephant-api/replicant"
+)
+
+// Validate checks the parameters and returns all configuration errors that it
+// finds, so that they can be fixed at once instead of failing one at a time.
+func (p Parameters) Validate() error {
+	var errs []error
+
+	if p.Logger == nil {
+		errs = append(errs, errors.New("a logger is required"))
+	}
+
+	if p.Database == nil {
+		errs = append(errs, errors.New("a database pool is required"))
+	}
+
+	if p.Documents == nil && len(p.SourceShards) == 0 {
+		errs = append(errs, errors.New("a source documents client is required"))
+	}
+
+	if p.Server == nil {
+		errs = append(errs, errors.New("an API server is required"))
+	}
+
+	if p.MappingRetention <= 0 {
+		errs = append(errs, errors.New("mapping retention must be positive"))
+	}
+
+	if p.MappingCleanupInterval <= 0 {
+		errs = append(errs, errors.New("mapping cleanup interval must be positive"))
+	}
+
+	if p.TimerJitter < 0 || p.TimerJitter >= 1 {
+		errs = append(errs, errors.New("timer jitter must be at least zero and less than one"))
+	}
+
+	if p.MultipartUploads.Threshold > 0 && p.MultipartUploads.PartSize <= 0 {
+		errs = append(errs, errors.New("multipart upload part size must be positive"))
+	}
+
+	if p.Verification.Interval > 0 && p.Verification.SampleSize <= 0 {
+		errs = append(errs, errors.New("verification sample size must be positive"))
+	}
+
+	if p.ReplicateWorkflows && p.SourceWorkflows == nil {
+		errs = append(errs, errors.New(
+			"a source workflows client is required to replicate workflows"))
+	}
+
+	if p.CircuitBreaker.Failures > 0 && p.CircuitBreaker.CoolDown <= 0 {
+		errs = append(errs, errors.New(
+			"the circuit breaker cool-down must be positive"))
+	}
+
+	if p.Oversize.Policy == OversizeReduce && len(p.Oversize.Reduce.Rules) == 0 {
+		errs = append(errs, errors.New(
+			"the reduce oversize policy requires reduction rules"))
+	}
+
+	if p.Verification.Concurrency < 0 || p.Verification.PerSecond < 0 {
+		errs = append(errs, errors.New(
+			"the verification concurrency and rate can't be negative"))
+	}
+
+	if p.Verification.FullScan && p.Verification.SampleSize <= 0 {
+		errs = append(errs, errors.New(
+			"a full verification scan requires a positive sample size"))
+	}
+
+	if p.SoftDeleteClearACL && p.SoftDeleteStatus == "" {
+		errs = append(errs, errors.New(
+			"clearing the ACL of soft deleted documents requires a soft delete status"))
+	}
+
+	if p.AttachmentMemoryLimit < 0 {
+		errs = append(errs, errors.New("attachment memory limit must not be negative"))
+	}
+
+	if p.AttachmentCompression != "" {
+		_, err := ParseAttachmentCompression(string(p.AttachmentCompression))
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(p.Shadow.Targets) > 0 {
+		_, err := ParseShadowMode(string(p.Shadow.Mode))
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	shardNames := make(map[string]bool, len(p.SourceShards))
+
+	for _, shard := range p.SourceShards {
+		err := validateShardName(shard.Name)
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		if shardNames[shard.Name] {
+			errs = append(errs, fmt.Errorf("duplicate source shard %q", shard.Name))
+		}
+
+		if shard.Documents == nil {
+			errs = append(errs, fmt.Errorf(
+				"source shard %q requires a documents client", shard.Name))
+		}
+
+		shardNames[shard.Name] = true
+	}
+
+	if p.AttachmentHTTP.Request < 0 || p.AttachmentHTTP.Dial < 0 ||
+		p.AttachmentHTTP.ResponseHeader < 0 {
+		errs = append(errs, errors.New("the attachment timeouts can't be negative"))
+	}
+
+	if p.AttachmentHTTP.MaxRedirects < 0 {
+		errs = append(errs, errors.New("the attachment redirect limit can't be negative"))
+	}
+
+	if p.MetricsDocTypeLimit < 0 {
+		errs = append(errs, errors.New("the metrics document type limit can't be negative"))
+	}
+
+	if p.TokenRefreshMargin < 0 {
+		errs = append(errs, errors.New("the token refresh margin can't be negative"))
+	}
+
+	if p.StateBatching.Events < 0 || p.StateBatching.Interval < 0 {
+		errs = append(errs, errors.New("state batching can't be negative"))
+	}
+
+	if p.Follower.BatchSize < 0 {
+		errs = append(errs, errors.New("follower batch size cannot be negative"))
+	}
+
+	if (p.Follower.MinWait > 0 || p.Follower.MaxWait > 0) &&
+		p.Follower.MaxWait <= p.Follower.MinWait {
+		errs = append(errs, errors.New(
+			"the follower max wait must be longer than the min wait"))
+	}
+
+	err := validateSectionFilters(p.RequireSections, true)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("required sections: %w", err))
+	}
+
+	err = p.AttachmentContentTypeOverrides.Validate()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	for source, target := range p.TypeMapping {
+		if source == "" || target == "" {
+			errs = append(errs, fmt.Errorf(
+				"invalid type mapping %q=%q", source, target))
+		}
+	}
+
+	for name, mapping := range p.TargetTypeMappings {
+		for source, target := range mapping {
+			if name == "" || source == "" || target == "" {
+				errs = append(errs, fmt.Errorf(
+					"invalid type mapping %q=%q for target %q",
+					source, target, name))
+			}
+		}
+	}
+
+	for _, rules := range []map[string]string{
+		p.ACLMapping.Exact, p.ACLMapping.Prefixes,
+	} {
+		for source, target := range rules {
+			if source == "" || target == "" {
+				errs = append(errs, fmt.Errorf(
+					"invalid ACL mapping %q=%q", source, target))
+			}
+		}
+	}
+
+	if !p.ACLTemplate.IsZero() && !p.ACLMapping.IsZero() {
+		errs = append(errs, errors.New(
+			"an ACL template can't be combined with an ACL mapping"))
+	}
+
+	for _, entry := range p.ACLTemplate {
+		if entry.GetUri() == "" || len(entry.GetPermissions()) == 0 {
+			errs = append(errs, fmt.Errorf(
+				"invalid ACL template entry for %q", entry.GetUri()))
+		}
+	}
+
+	if p.DefaultTarget != nil {
+		err := p.DefaultTarget.validate()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("default target: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (dt *DefaultTargetConfig) validate() error {
+	var errs []error
+
+	u, err := url.Parse(dt.RepositoryURL)
+
+	switch {
+	case err != nil:
+		errs = append(errs, fmt.Errorf("invalid repository URL: %w", err))
+	case u.Scheme == "" || u.Host == "" && u.Opaque == "":
+		errs = append(errs, fmt.Errorf(
+			"invalid repository URL %q", dt.RepositoryURL))
+	}
+
+	if dt.StartFrom < 0 {
+		errs = append(errs, errors.New("start event cannot be negative"))
+	}
+
+	err = validateSectionFilters(dt.IgnoreSections, false)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("ignored sections: %w", err))
+	}
+
+	for _, a := range dt.IncludeAttachments {
+		if a.DocType == "" || a.Name == "" {
+			errs = append(errs, fmt.Errorf(
+				"invalid attachment reference %q", a.Name+"."+a.DocType))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateSectionFilters parses the section filters and checks that they can
+// be used as required or ignored sections.
+func validateSectionFilters(specs []string, require bool) error {
+	sections, err := ParseSectionFilters(specs)
+	if err != nil {
+		return err
+	}
+
+	if require {
+		emptyFilter, err := NewContentFilterFromSyncConfig(&replicant.SyncConfig{})
+		if err != nil {
+			return fmt.Errorf("create content filter: %w", err)
+		}
+
+		return emptyFilter.RequireSections(sections)
+	}
+
+	_, err = NewContentFilterFromSyncConfig(&replicant.SyncConfig{
+		IgnoreSections: sections,
+	})
+
+	return err
+}
@@ -0,0 +1,58 @@
+package internal_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ttab/elephant-replicant/internal"
+)
+
+func TestParametersValidateAggregatesErrors(t *testing.T) {
+	p := internal.Parameters{
+		MappingRetention:       time.Hour,
+		MappingCleanupInterval: time.Minute,
+		RequireSections:        []string{"core/article"},
+		TypeMapping:            map[string]string{"core/article": ""},
+		AttachmentHTTP:         internal.HTTPTimeouts{Dial: -time.Second},
+		ACLMapping: internal.ACLMapping{
+			Prefixes: map[string]string{"": "core://unit/stage-"},
+		},
+		DefaultTarget: &internal.DefaultTargetConfig{
+			RepositoryURL:  "repository.example.com",
+			StartFrom:      -1,
+			IgnoreSections: []string{"core/article:section~("},
+			IncludeAttachments: []internal.AttachmentRef{
+				{Name: "image"},
+			},
+		},
+	}
+
+	err := p.Validate()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	for _, want := range []string{
+		"a logger is required",
+		"a database pool is required",
+		"a source documents client is required",
+		"an API server is required",
+		"required sections",
+		"invalid type mapping",
+		"invalid ACL mapping",
+		"invalid repository URL",
+		"start event cannot be negative",
+		"ignored sections",
+		"invalid attachment reference",
+		"attachment timeouts can't be negative",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected the error to contain %q, got: %v", want, err)
+		}
+	}
+
+	if strings.Contains(err.Error(), "mapping retention") {
+		t.Errorf("didn't expect a mapping retention error, got: %v", err)
+	}
+}
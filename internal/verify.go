@@ -0,0 +1,399 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/postgres"
+	"github.com/ttab/elephantine"
+	"github.com/ttab/elephantine/pg"
+	"github.com/twitchtv/twirp"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
+)
+
+// Kinds of drift between the target and the version mappings.
+const (
+	driftMissing = "missing"
+	driftVersion = "version"
+	driftDeleted = "deleted"
+)
+
+// VerificationConfig controls the periodic verification of replicated
+// documents.
+type VerificationConfig struct {
+	// Interval between verification runs, zero disables verification.
+	Interval time.Duration
+	// SampleSize is the number of documents that are verified per target
+	// and run.
+	SampleSize int32
+	// FullScan verifies all replicated documents in UUID order instead of
+	// random samples, SampleSize documents at a time. The position of the
+	// scan is stored so that a scan spans multiple runs, and restarts.
+	FullScan bool
+	// Concurrency is the number of documents that are verified in
+	// parallel, defaults to one.
+	Concurrency int
+	// PerSecond limits the number of documents that are verified per
+	// second and target, zero disables the limit.
+	PerSecond float64
+}
+
+// VerifyCursor is the stored position of a full verification scan.
+type VerifyCursor struct {
+	// After is the UUID of the last verified document.
+	After   uuid.UUID
+	Started time.Time
+	Scanned int64
+	Drifted int64
+}
+
+// Advance moves the cursor past a page of verified documents. A page that is
+// shorter than the limit is the end of the scan, in which case the returned
+// cursor starts over and done is true.
+func (c VerifyCursor) Advance(
+	last uuid.UUID, scanned int, drifted int, limit int32,
+) (_ VerifyCursor, done bool) {
+	c.Scanned += int64(scanned)
+	c.Drifted += int64(drifted)
+
+	if scanned < int(limit) {
+		return VerifyCursor{}, true
+	}
+
+	c.After = last
+
+	return c, false
+}
+
+// verifyCursorKey is the state key of the full scan cursor of a target. The
+// replicated documents of a target are shared by all source shards, so the
+// cursor isn't sharded.
+func verifyCursorKey(target string) string {
+	return target + ":verify_cursor"
+}
+
+// verifyLockName is the name of the job lock that the verification of a target
+// runs in. Like the cursor it isn't sharded.
+func verifyLockName(target string) string {
+	return "replicant-verify:" + target
+}
+
+// verification periodically checks a sample of the replicated documents in
+// all enabled targets. Every target is verified in its own job lock, so that
+// only one instance at a time verifies a target and moves its scan cursor.
+// New targets are picked up at every interval.
+func verification(
+	ctx context.Context, logger *slog.Logger, manager *TargetManager,
+	conf VerificationConfig, jitter Jitter,
+) error {
+	if conf.Interval <= 0 {
+		return nil
+	}
+
+	var (
+		mu      sync.Mutex
+		running = make(map[string]bool)
+		wg      sync.WaitGroup
+	)
+
+	defer wg.Wait()
+
+	for {
+		targets, err := postgres.New(manager.db).ListEnabledTargets(ctx)
+		if err != nil && ctx.Err() == nil {
+			logger.ErrorContext(ctx, "failed to list targets for verification",
+				elephantine.LogKeyError, err)
+		}
+
+		for _, t := range targets {
+			mu.Lock()
+
+			if running[t.Name] {
+				mu.Unlock()
+
+				continue
+			}
+
+			running[t.Name] = true
+
+			mu.Unlock()
+
+			wg.Go(func() {
+				manager.runVerification(ctx, t.Name, conf, jitter)
+
+				mu.Lock()
+				delete(running, t.Name)
+				mu.Unlock()
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err() //nolint: wrapcheck
+		case <-time.After(jitter.Apply(conf.Interval)):
+		}
+	}
+}
+
+// runVerification verifies the target every interval for as long as this
+// process holds the verification job lock of the target. Returns when the
+// target has been removed or disabled.
+func (tm *TargetManager) runVerification(
+	ctx context.Context, name string, conf VerificationConfig, jitter Jitter,
+) {
+	logger := tm.logger.With("target", name)
+
+	targetCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	err := pg.RunInJobLock(
+		targetCtx, tm.db, logger,
+		verifyLockName(name), verifyLockName(name),
+		pg.JobLockOptions{},
+		func(ctx context.Context) error {
+			for {
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-time.After(jitter.Apply(conf.Interval)):
+				}
+
+				target, err := postgres.New(tm.db).GetTarget(ctx, name)
+
+				switch {
+				case errors.Is(err, pgx.ErrNoRows) || (err == nil && !target.Enabled):
+					// Cancel the target context so that the
+					// job lock doesn't restart the verification.
+					cancel()
+
+					return nil
+				case err != nil:
+					return fmt.Errorf("load target config: %w", err)
+				}
+
+				w, err := tm.newWorker(ctx, logger, target)
+				if err != nil {
+					return err
+				}
+
+				err = w.verify(ctx, conf)
+				if err != nil {
+					logger.ErrorContext(ctx, "failed to verify target",
+						elephantine.LogKeyError, err)
+				}
+			}
+		},
+	)
+	if err != nil && targetCtx.Err() == nil {
+		logger.Error("verification exited with error",
+			elephantine.LogKeyError, err,
+		)
+	}
+}
+
+// verify compares the current version of a sample of documents in the target
+// with the version that we last wrote. Documents are also checked against the
+// source unless UUID remapping is enabled, as we can't get the source UUID
+// from a target UUID.
+func (w *Worker) verify(ctx context.Context, conf VerificationConfig) error {
+	q := postgres.New(w.db)
+
+	var (
+		docs   []postgres.ListDocumentsRow
+		cursor VerifyCursor
+	)
+
+	if conf.FullScan {
+		err := LoadState(ctx, q, verifyCursorKey(w.name), &cursor)
+		if err != nil {
+			return fmt.Errorf("load verification cursor: %w", err)
+		}
+
+		if cursor.Started.IsZero() {
+			cursor.Started = time.Now()
+		}
+
+		docs, err = q.ListDocuments(ctx, postgres.ListDocumentsParams{
+			TargetName: w.name,
+			After:      cursor.After,
+			RowLimit:   conf.SampleSize,
+		})
+		if err != nil {
+			return fmt.Errorf("list documents: %w", err)
+		}
+	} else {
+		// Seek from a random UUID instead of sorting the whole
+		// table randomly, wrapping around at the end.
+		sample, err := q.SampleDocuments(ctx, postgres.SampleDocumentsParams{
+			TargetName: w.name,
+			Start:      uuid.New(),
+			SampleSize: conf.SampleSize,
+		})
+		if err != nil {
+			return fmt.Errorf("sample documents: %w", err)
+		}
+
+		for _, doc := range sample {
+			docs = append(docs, postgres.ListDocumentsRow(doc))
+		}
+	}
+
+	drifted, err := w.verifyDocuments(ctx, docs, conf)
+	if err != nil {
+		return err
+	}
+
+	w.logger.InfoContext(ctx, "verified replicated documents",
+		"checked", len(docs),
+		"drifted", drifted,
+	)
+
+	if !conf.FullScan {
+		return nil
+	}
+
+	var last uuid.UUID
+
+	if len(docs) > 0 {
+		last = docs[len(docs)-1].ID
+	}
+
+	next, done := cursor.Advance(last, len(docs), drifted, conf.SampleSize)
+	if done {
+		w.metrics.verificationScanCompleted(w.name)
+
+		w.logger.InfoContext(ctx, "completed verification scan",
+			"started", cursor.Started,
+			"checked", cursor.Scanned+int64(len(docs)),
+			"drifted", cursor.Drifted+int64(drifted),
+		)
+	}
+
+	err = StoreState(ctx, q, verifyCursorKey(w.name), next)
+	if err != nil {
+		return fmt.Errorf("store verification cursor: %w", err)
+	}
+
+	return nil
+}
+
+// verifyDocuments verifies the documents using a bounded pool, and returns
+// the number of documents that have drifted.
+func (w *Worker) verifyDocuments(
+	ctx context.Context, docs []postgres.ListDocumentsRow, conf VerificationConfig,
+) (int, error) {
+	checkSource := w.uuidMapping.Namespace == uuid.Nil
+
+	var limiter *rate.Limiter
+
+	if conf.PerSecond > 0 {
+		limiter = rate.NewLimiter(rate.Limit(conf.PerSecond), 1)
+	}
+
+	var drifted atomic.Int64
+
+	grp, gCtx := errgroup.WithContext(ctx)
+
+	grp.SetLimit(max(conf.Concurrency, 1))
+
+	for _, doc := range docs {
+		if limiter != nil {
+			err := limiter.Wait(gCtx)
+			if err != nil {
+				break
+			}
+		}
+
+		grp.Go(func() error {
+			kind, err := w.verifyDocument(gCtx, doc, checkSource)
+			if err != nil {
+				return fmt.Errorf("verify document %s: %w", doc.ID, err)
+			}
+
+			w.metrics.documentVerified(w.name)
+
+			if kind == "" {
+				return nil
+			}
+
+			drifted.Add(1)
+
+			w.metrics.driftDetected(w.name, kind)
+
+			return nil
+		})
+	}
+
+	err := grp.Wait()
+	if err != nil {
+		return 0, err //nolint: wrapcheck
+	}
+
+	if ctx.Err() != nil {
+		return 0, ctx.Err() //nolint: wrapcheck
+	}
+
+	return int(drifted.Load()), nil
+}
+
+func (w *Worker) verifyDocument(
+	ctx context.Context, doc postgres.ListDocumentsRow, checkSource bool,
+) (string, error) {
+	targetRes, err := w.target.GetMeta(ctx, &repository.GetMetaRequest{
+		Uuid: doc.ID.String(),
+	})
+
+	switch {
+	case elephantine.IsTwirpErrorCode(err, twirp.NotFound):
+		w.logger.WarnContext(ctx, "replicated document is missing in target",
+			elephantine.LogKeyDocumentUUID, doc.ID,
+			"expected_version", doc.TargetVersion,
+		)
+
+		return driftMissing, nil
+	case err != nil:
+		return "", fmt.Errorf("get target meta: %w", err)
+	}
+
+	actual := targetRes.Meta.CurrentVersion
+
+	if actual != doc.TargetVersion {
+		w.logger.WarnContext(ctx, "target version differs from the last replicated version",
+			elephantine.LogKeyDocumentUUID, doc.ID,
+			"expected_version", doc.TargetVersion,
+			"actual_version", actual,
+		)
+
+		return driftVersion, nil
+	}
+
+	if !checkSource {
+		return "", nil
+	}
+
+	_, err = w.source.GetMeta(ctx, &repository.GetMetaRequest{
+		Uuid: doc.ID.String(),
+	})
+
+	switch {
+	case elephantine.IsTwirpErrorCode(err, twirp.NotFound):
+		w.logger.WarnContext(ctx, "replicated document has been deleted in source",
+			elephantine.LogKeyDocumentUUID, doc.ID,
+		)
+
+		return driftDeleted, nil
+	case err != nil:
+		return "", fmt.Errorf("get source meta: %w", err)
+	}
+
+	return "", nil
+}
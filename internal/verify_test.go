@@ -0,0 +1,30 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/ttab/elephant-replicant/internal"
+)
+
+func TestVerifyCursorAdvance(t *testing.T) {
+	last := uuid.New()
+
+	cursor, done := internal.VerifyCursor{}.Advance(last, 10, 2, 10)
+	if done {
+		t.Fatal("expected a full page not to end the scan")
+	}
+
+	if cursor.After != last || cursor.Scanned != 10 || cursor.Drifted != 2 {
+		t.Errorf("unexpected cursor after a full page: %+v", cursor)
+	}
+
+	cursor, done = cursor.Advance(uuid.New(), 3, 0, 10)
+	if !done {
+		t.Fatal("expected a short page to end the scan")
+	}
+
+	if cursor != (internal.VerifyCursor{}) {
+		t.Errorf("expected the scan to start over, got %+v", cursor)
+	}
+}
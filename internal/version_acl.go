@@ -0,0 +1,47 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephantine"
+	"github.com/twitchtv/twirp"
+)
+
+// sourceACL reads the current ACL of a document in the source, mapped for the
+// target. The source isn't read if an ACL template is used.
+func (w *Worker) sourceACL(
+	ctx context.Context, docUUID string,
+) ([]*repository.ACLEntry, error) {
+	if !w.aclTemplate.IsZero() {
+		return w.aclTemplate.Entries(), nil
+	}
+
+	fetchCtx, span := w.tracer.Start(ctx, "get source acl")
+
+	res, err := w.source.GetMeta(fetchCtx, &repository.GetMetaRequest{
+		Uuid: docUUID,
+	})
+
+	endSpan(span, err)
+
+	if elephantine.IsTwirpErrorCode(err, twirp.NotFound) {
+		return nil, fmt.Errorf("document not found for ACL read: %w", ErrSkipped)
+	} else if err != nil {
+		return nil, fmt.Errorf("get source meta for ACL: %w", err)
+	}
+
+	return w.targetACL(res.Meta.Acl), nil
+}
+
+// targetACL returns the ACL that a document with the given source ACL should
+// have in the target, the ACL template if set, and the mapped source ACL
+// otherwise.
+func (w *Worker) targetACL(acl []*repository.ACLEntry) []*repository.ACLEntry {
+	if !w.aclTemplate.IsZero() {
+		return w.aclTemplate.Entries()
+	}
+
+	return w.aclMapping.Apply(acl)
+}
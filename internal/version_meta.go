@@ -0,0 +1,41 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"maps"
+
+	"github.com/ttab/elephant-api/repository"
+)
+
+// sourceVersionMeta reads the meta data of a document version in the source,
+// f.ex. the commit message or cause of the change. Returns nil if the version
+// doesn't have any meta data.
+func (w *Worker) sourceVersionMeta(
+	ctx context.Context, docUUID string, version int64,
+) (map[string]string, error) {
+	fetchCtx, span := w.tracer.Start(ctx, "get source version meta")
+
+	res, err := w.source.GetHistory(fetchCtx, &repository.GetHistoryRequest{
+		Uuid:   docUUID,
+		Before: version + 1,
+	})
+
+	endSpan(span, err)
+
+	if err != nil {
+		return nil, fmt.Errorf("get source document history: %w", err)
+	}
+
+	var meta map[string]string
+
+	for _, v := range res.Versions {
+		if v.Version == version && len(v.Meta) > 0 {
+			meta = maps.Clone(v.Meta)
+
+			break
+		}
+	}
+
+	return meta, nil
+}
@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ttab/elephant-api/repository"
+)
+
+// WithheldPolicy controls how documents that are withheld in the source, under
+// embargo until the scheduler publishes them, are replicated.
+type WithheldPolicy string
+
+const (
+	// WithheldScheduler replicates the "withheld" status and leaves the
+	// release to the scheduler of the target. The "usable" statuses set by
+	// the source scheduler aren't replicated.
+	WithheldScheduler WithheldPolicy = "scheduler"
+	// WithheldRelease replicates the "withheld" status, and the "usable"
+	// status set by the source scheduler when the embargo lifts, for
+	// targets that don't run a scheduler.
+	WithheldRelease WithheldPolicy = "release"
+	// WithheldHold doesn't replicate documents while they're withheld,
+	// their current state is replicated once they're released.
+	WithheldHold WithheldPolicy = "hold"
+)
+
+const (
+	statusWithheld = "withheld"
+	statusUsable   = "usable"
+)
+
+// ParseWithheldPolicy parses a withheld document policy, an empty value is
+// treated as WithheldScheduler.
+func ParseWithheldPolicy(s string) (WithheldPolicy, error) {
+	switch p := WithheldPolicy(s); p {
+	case "":
+		return WithheldScheduler, nil
+	case WithheldScheduler, WithheldRelease, WithheldHold:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown withheld policy %q", s)
+	}
+}
+
+// replicatesSchedulerUsable returns true if the "usable" statuses set by the
+// source scheduler are replicated.
+func (p WithheldPolicy) replicatesSchedulerUsable() bool {
+	return p == WithheldRelease || p == WithheldHold
+}
+
+// EmbargoState describes the embargo of a document based on its status heads.
+type EmbargoState struct {
+	// Withheld is true if the document is withheld and hasn't been
+	// released since.
+	Withheld bool
+	// Released is true if the document has been withheld, and has been
+	// made usable since.
+	Released bool
+}
+
+// GetEmbargoState compares the "withheld" and "usable" status heads of a
+// document, the document is withheld until a usable status is set after the
+// withheld status.
+func GetEmbargoState(heads map[string]*repository.Status) (EmbargoState, error) {
+	withheld, ok := heads[statusWithheld]
+	if !ok {
+		return EmbargoState{}, nil
+	}
+
+	usable, ok := heads[statusUsable]
+	if !ok {
+		return EmbargoState{Withheld: true}, nil
+	}
+
+	withheldAt, err := time.Parse(time.RFC3339, withheld.Created)
+	if err != nil {
+		return EmbargoState{}, fmt.Errorf("parse withheld status created time: %w", err)
+	}
+
+	usableAt, err := time.Parse(time.RFC3339, usable.Created)
+	if err != nil {
+		return EmbargoState{}, fmt.Errorf("parse usable status created time: %w", err)
+	}
+
+	if usableAt.Before(withheldAt) {
+		return EmbargoState{Withheld: true}, nil
+	}
+
+	return EmbargoState{Released: true}, nil
+}
@@ -0,0 +1,79 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephant-replicant/internal"
+)
+
+func TestParseWithheldPolicy(t *testing.T) {
+	cases := map[string]internal.WithheldPolicy{
+		"":          internal.WithheldScheduler,
+		"scheduler": internal.WithheldScheduler,
+		"release":   internal.WithheldRelease,
+		"hold":      internal.WithheldHold,
+	}
+
+	for s, want := range cases {
+		got, err := internal.ParseWithheldPolicy(s)
+		if err != nil {
+			t.Fatalf("parse %q: %v", s, err)
+		}
+
+		if got != want {
+			t.Errorf("got %q for %q, want %q", got, s, want)
+		}
+	}
+
+	_, err := internal.ParseWithheldPolicy("skip")
+	if err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+}
+
+func TestGetEmbargoState(t *testing.T) {
+	withheld := &repository.Status{Created: "2026-01-02T10:00:00Z"}
+
+	cases := map[string]struct {
+		heads map[string]*repository.Status
+		want  internal.EmbargoState
+	}{
+		"not withheld": {
+			heads: map[string]*repository.Status{
+				"usable": {Created: "2026-01-01T10:00:00Z"},
+			},
+		},
+		"withheld": {
+			heads: map[string]*repository.Status{
+				"withheld": withheld,
+			},
+			want: internal.EmbargoState{Withheld: true},
+		},
+		"withheld after usable": {
+			heads: map[string]*repository.Status{
+				"withheld": withheld,
+				"usable":   {Created: "2026-01-01T10:00:00Z"},
+			},
+			want: internal.EmbargoState{Withheld: true},
+		},
+		"released": {
+			heads: map[string]*repository.Status{
+				"withheld": withheld,
+				"usable":   {Created: "2026-01-02T12:00:00Z"},
+			},
+			want: internal.EmbargoState{Released: true},
+		},
+	}
+
+	for name, c := range cases {
+		got, err := internal.GetEmbargoState(c.heads)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if got != c.want {
+			t.Errorf("%s: got %+v, want %+v", name, got, c.want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"compress/gzip"
 	"context"
 	"errors"
 	"fmt"
@@ -8,10 +9,13 @@ import (
 	"net/http"
 	"slices"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 	rpc_newsdoc "github.com/ttab/elephant-api/newsdoc"
 	"github.com/ttab/elephant-api/repository"
@@ -20,6 +24,9 @@ import (
 	"github.com/ttab/elephantine/pg"
 	"github.com/ttab/koonkie"
 	"github.com/twitchtv/twirp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
 )
 
 // Worker handles replication for a single target.
@@ -28,110 +35,681 @@ type Worker struct {
 	logger         *slog.Logger
 	db             *pgxpool.Pool
 	source         repository.Documents
-	target         repository.Documents
+	target         ReplicationSink
+	breaker        *CircuitBreaker
+	pause          *PauseGate
 	cFilter        *ContentFilter
 	lf             *koonkie.LogFollower
+	sharedLog      *sharedEventlog
 	acceptErrors   bool
-	ignoreSubs     []string
-	ignoreTypes    []string
+	eventFilters   []EventFilter
+	includeUUIDs   UUIDSet
 	allAttachments bool
 	incAttachments []AttachmentRef
+
+	languageRouting LanguageRouting
+
+	minCreated time.Time
+	oversize   OversizeHandling
+
+	// sourceTokens and targetTokens are used to force new access
+	// tokens after authentication failures, either can be nil.
+	sourceTokens TokenRefresher
+	targetTokens TokenRefresher
+
+	// replay is set when a single event is replayed outside of the
+	// replication loop, the log state is then left untouched.
+	replay *eventReplay
+
+	httpClient        *http.Client
+	attachmentRetry   RetryPolicy
+	verifyAttachments bool
+	maxAttachmentSize int64
+	detachAttachments bool
+	attachmentMemory  *AttachmentMemory
+	multipart         MultipartSink
+	multipartUploads  MultipartUploads
+
+	attachmentCompression AttachmentCompression
+
+	attachmentConcurrency int
+	attachmentTypes       ContentTypeFilter
+	contentTypes          ContentTypeOverrides
+
+	allowNoCurrentVersion bool
+
+	typeMapping  map[string]string
+	fallbackType string
+	aclMapping   ACLMapping
+	aclTemplate  ACLTemplate
+	restriction  ACLRestriction
+	stripper     BlockStripper
+	transformer  TransformPipeline
+	normalizer   CompareNormalization
+	statusFilter StatusFilter
+	config       ConfigSnapshot
+	tracer       trace.Tracer
+	uuidMapping  UUIDMapping
+
+	quarantineThreshold int
+	failures            *eventFailures
+
+	concurrency        int
+	unavailableBackoff Backoff
+	errorClasses       ErrorClassification
+	errorRetries       int
+
+	dryRun bool
+
+	// shard is the name of the source shard that the worker follows,
+	// empty for unsharded sources.
+	shard string
+
+	// stop is closed when the process starts shutting down, checked
+	// between events so that the in-flight event is finished.
+	stop <-chan struct{}
+	// poll interrupts the wait for new events so that the eventlog is
+	// polled again right away.
+	poll chan struct{}
+
+	softDeleteStatus string
+	conflictPolicy   ConflictPolicy
+	unknownEvents    UnknownEventPolicy
+	withheld         WithheldPolicy
+	auditLog         AuditLog
+	versionMeta      bool
+	versionACL       bool
+	parallelFetch    bool
+	provenance       ProvenanceMeta
+	directives       ImportDirectives
+
+	// softDeleteClearACL removes all ACL entries of soft deleted
+	// documents.
+	softDeleteClearACL bool
+
+	// statusBackfill records the status heads that point at older
+	// versions while catching up, and sets them once caught up.
+	statusBackfill        bool
+	statusBackfillPending atomic.Bool
+
+	replicateWorkflows bool
+	sourceWorkflows    repository.Workflows
+	targetWorkflows    WorkflowSink
+	workflowMu         sync.Mutex
+	workflows          map[string]*repository.DocumentWorkflow
+
+	// storedPosition is the last position that was persisted by
+	// handleEvent when handling events serially.
+	storedPosition int64
+	// stateRevision is the revision of the persisted log state, used to
+	// detect other processes writing to the same state.
+	stateRevision int64
+	// stateBatching controls how often handleEvent persists the log
+	// state, unstoredEvents and lastStateStore track the events since
+	// it last was persisted.
+	stateBatching  StateBatching
+	unstoredEvents int
+	lastStateStore time.Time
+
+	metrics         *ReplicationMetrics
+	handledEvents   int
+	lastProgressLog time.Time
+
+	// mappingRetention is how long version mappings are kept, used to
+	// tell pruned mappings from unexpected gaps.
+	mappingRetention time.Duration
+	mappingGaps      logThrottle
+
+	stateMu       sync.Mutex
+	followerState LogState
+}
+
+// FollowerState returns the log follower state as of the last read from the
+// eventlog.
+func (w *Worker) FollowerState() LogState {
+	w.stateMu.Lock()
+	defer w.stateMu.Unlock()
+
+	return w.followerState
 }
 
 // Replicate runs the replication loop for this worker's target.
 func (w *Worker) Replicate(ctx context.Context) error {
 	for {
-		var lastSaved int64
+		if w.stopRequested() {
+			return errStopped
+		}
+
+		err := w.waitWhilePaused(ctx)
+		if err != nil {
+			return err
+		}
 
 		pos, caughtUp := w.lf.GetState()
 
-		items, err := w.lf.GetNext(ctx)
-		if err != nil {
+		if caughtUp && w.statusBackfill && w.statusBackfillPending.Swap(false) {
+			err := w.backfillStatuses(ctx)
+			if err != nil {
+				return err
+			}
+		}
+
+		readCtx, cancelRead := w.readContext(ctx)
+
+		items, err := w.lf.GetNext(readCtx)
+
+		polled := errors.Is(context.Cause(readCtx), errPollRequested)
+
+		cancelRead()
+
+		if err != nil && ctx.Err() == nil && w.stopRequested() {
+			return errStopped
+		} else if err != nil && ctx.Err() == nil && polled {
+			continue
+		} else if err != nil {
 			return fmt.Errorf("read eventlog: %w", err)
 		}
 
-		for _, item := range items {
+		w.updateFollowerState()
+
+		// Nothing is lagging behind when we're caught up and there are
+		// no new events.
+		if len(items) == 0 && caughtUp {
+			w.metrics.replicationLag(w.name, 0)
+		}
+
+		var (
+			lastEventTime time.Time
+			outcomes      []eventOutcome
+			superseded    []bool
+			stopped       bool
+		)
+
+		if !caughtUp {
+			superseded = SupersededEvents(items, w.skippedBeforeSync)
+		}
+
+		if w.concurrent() {
+			outcomes = w.handleConcurrently(ctx, items, superseded, caughtUp)
+		}
+
+	batch:
+		for i, item := range items {
+			// Concurrently handled batches have already been
+			// handled in full at this point.
+			if outcomes == nil && w.stopRequested() {
+				stopped = true
+
+				break
+			}
+
+			prevPos, prevEventTime := pos, lastEventTime
+
 			pos = item.Id
+			lastEventTime = eventTimestamp(item)
 
-			if item.Event == TypeWorkflow {
+			if w.skipWorkflow(item) {
 				continue
 			}
 
-			err := w.handleEvent(ctx, item, caughtUp)
+			start := time.Now()
+			result := resultReplicated
+
+			var (
+				err      error
+				duration time.Duration
+			)
 
 			switch {
-			case errors.Is(err, ErrSkipped):
+			case outcomes != nil:
+				err = outcomes[i].err
+				duration = outcomes[i].duration
+			case superseded != nil && superseded[i]:
+				err = errSuperseded
+			default:
+				err = w.handleEventWithRetry(ctx, item, caughtUp)
+				duration = time.Since(start)
+			}
+
+			switch w.outcomeRules().Disposition(err) {
+			case DispositionNotHandled:
+				// An earlier event for the same document was
+				// quarantined, rewind and handle the rest of the
+				// batch again.
+				pos, lastEventTime = prevPos, prevEventTime
+
+				w.lf.SetState(pos, caughtUp)
+				w.updateFollowerState()
+
+				break batch
+			case DispositionHalt:
+				// Halt at unknown events until the replicant has
+				// been upgraded to handle them. State conflicts
+				// mean that another process is replicating to the
+				// same target, or that the state has been reset,
+				// exit and restart from the persisted state.
+				return fmt.Errorf("handle event %d: %w", item.Id, err)
+			case DispositionSkipped:
+				result = resultSkipped
+
 				w.logger.Debug("skipped import of document",
 					elephantine.LogKeyEventID, item.Id,
 					elephantine.LogKeyEventType, item.Event,
 					elephantine.LogKeyDocumentUUID, item.Uuid,
 					elephantine.LogKeyError, err,
 				)
-			case errors.Is(err, ErrConflict):
-				w.logger.Info("conflict with change in target repo",
+			case DispositionOversized:
+				result = resultSkipped
+
+				rErr := w.recordOversized(ctx, item, err)
+				if rErr != nil {
+					return fmt.Errorf("handle event %d (%s): %w",
+						item.Id, item.Uuid, rErr)
+				}
+			case DispositionConflict:
+				result = resultConflict
+
+				w.reportConflict(ctx, item, err)
+
+				if w.conflictPolicy == ConflictQuarantine {
+					qErr := w.quarantineConflict(ctx, item, err)
+					if qErr != nil {
+						return fmt.Errorf("handle event %d (%s): %w",
+							item.Id, item.Uuid, qErr)
+					}
+				}
+			case DispositionRejected:
+				// Permanent failures, f.ex. a document that the
+				// target rejects, shouldn't halt replication.
+				result = resultSkipped
+
+				w.logger.Error("skipped event that the target rejected",
 					elephantine.LogKeyEventID, item.Id,
 					elephantine.LogKeyEventType, item.Event,
 					elephantine.LogKeyDocumentUUID, item.Uuid,
 					elephantine.LogKeyError, err,
 				)
-			case err != nil && w.acceptErrors:
+
+				dErr := w.deadLetter(ctx, item, caughtUp, err)
+				if dErr != nil {
+					return fmt.Errorf("handle event %d (%s): %w",
+						item.Id, item.Uuid, dErr)
+				}
+			case DispositionAccepted:
+				result = resultError
+
 				w.logger.Error("error from target repo",
 					elephantine.LogKeyEventID, item.Id,
 					elephantine.LogKeyEventType, item.Event,
 					elephantine.LogKeyDocumentUUID, item.Uuid,
 					elephantine.LogKeyError, err,
 				)
-			case err != nil:
-				return fmt.Errorf("handle event %d (%s): %w",
-					item.Id, item.Uuid, err)
-			default:
+			case DispositionFailed:
+				result = resultQuarantined
+
+				quarantined, qErr := w.quarantine(ctx, item, err)
+				if qErr != nil || !quarantined {
+					w.metrics.eventHandled(w.name, item.Event, item.Type,
+						resultError, duration)
+
+					dErr := w.deadLetter(ctx, item, caughtUp, err)
+					if dErr != nil {
+						qErr = errors.Join(qErr, dErr)
+					}
+				}
+
+				if (qErr != nil || !quarantined) && w.concurrent() {
+					// Persist the position of the events that
+					// were handled before the failing one, we
+					// don't want to replay the whole batch.
+					sErr := w.storeState(ctx,
+						prevPos, caughtUp, prevEventTime)
+					if sErr != nil {
+						qErr = errors.Join(qErr, sErr)
+					}
+				}
+
+				if qErr != nil {
+					return errors.Join(
+						fmt.Errorf("handle event %d (%s): %w",
+							item.Id, item.Uuid, err),
+						qErr)
+				}
+
+				if !quarantined {
+					return fmt.Errorf("handle event %d (%s): %w",
+						item.Id, item.Uuid, err)
+				}
+			case DispositionHandled:
 				w.logger.Debug("handled event",
 					elephantine.LogKeyEventID, item.Id,
 					elephantine.LogKeyEventType, item.Event,
 					elephantine.LogKeyDocumentUUID, item.Uuid,
 				)
 
-				lastSaved = pos
 			}
+
+			w.metrics.eventHandled(w.name, item.Event, item.Type,
+				result, duration)
+
+			if !lastEventTime.IsZero() {
+				w.metrics.replicationLag(w.name,
+					time.Since(lastEventTime))
+			}
+
+			w.handledEvents++
 		}
 
-		if lastSaved != pos {
-			err = StoreState(ctx, postgres.New(w.db), w.stateKey(), LogState{
-				Position: pos,
-				CaughtUp: caughtUp,
-			})
+		if !caughtUp {
+			w.logProgress(pos)
+		}
+
+		// Events don't persist the log state themselves when they're
+		// handled concurrently.
+		if w.storedPosition != pos || w.concurrent() {
+			err = w.storeState(ctx, pos, caughtUp, lastEventTime)
 			if err != nil {
-				return fmt.Errorf("persist log state: %w", err)
+				return err
 			}
+
+			w.storedPosition = pos
+		}
+
+		if stopped {
+			return errStopped
+		}
+	}
+}
+
+func (w *Worker) storeState(
+	ctx context.Context, pos int64, caughtUp bool, eventTime time.Time,
+) error {
+	state := LogState{
+		Position:           pos,
+		CaughtUp:           caughtUp,
+		LastEventTimestamp: eventTime,
+		LastUpdated:        time.Now(),
+	}
+
+	rev, err := StoreStateRevision(ctx, postgres.New(w.db), w.stateKey(),
+		state, w.stateRevision)
+	if err != nil {
+		return fmt.Errorf("persist log state: %w", err)
+	}
+
+	w.stateRevision = rev
+	w.unstoredEvents = 0
+	w.lastStateStore = state.LastUpdated
+
+	w.metrics.statePersisted(w.name, state)
+
+	if w.sharedLog != nil {
+		err := w.sharedLog.Commit(ctx)
+		if err != nil {
+			w.logger.WarnContext(ctx, "failed to store the shared follower state",
+				elephantine.LogKeyError, err)
 		}
 	}
+
+	return nil
+}
+
+// progressLogInterval is the minimum time between progress log messages while
+// catching up.
+const progressLogInterval = 30 * time.Second
+
+// logProgress logs the replication progress, throttled to one message per
+// progressLogInterval.
+func (w *Worker) logProgress(pos int64) {
+	now := time.Now()
+
+	if w.lastProgressLog.IsZero() {
+		w.lastProgressLog = now
+
+		return
+	}
+
+	elapsed := now.Sub(w.lastProgressLog)
+	if elapsed < progressLogInterval {
+		return
+	}
+
+	w.logger.Info("catching up",
+		elephantine.LogKeyEventID, pos,
+		"handled_events", w.handledEvents,
+		"events_per_second", float64(w.handledEvents)/elapsed.Seconds(),
+	)
+
+	w.lastProgressLog = now
+	w.handledEvents = 0
+}
+
+func (w *Worker) updateFollowerState() {
+	pos, caughtUp := w.lf.GetState()
+
+	w.stateMu.Lock()
+	w.followerState = LogState{
+		Position: pos,
+		CaughtUp: caughtUp,
+	}
+	w.stateMu.Unlock()
 }
 
 func (w *Worker) stateKey() string {
-	return w.name + ":log_state"
+	return shardKey(logStateKey(w.name), w.shard)
 }
 
 func (w *Worker) handleEvent(
 	ctx context.Context, evt *repository.EventlogItem, caughtUp bool,
 ) (outErr error) {
+	ctx, span := w.tracer.Start(ctx, "handle event",
+		eventAttributes(evt.Id, evt.Event, evt.Uuid))
+
+	// Registered before any rollback so that the span gets the final
+	// outcome.
+	defer func() {
+		endSpan(span, outErr)
+	}()
+
+	// Checked first as unknown events might not refer to a document.
+	if !IsKnownEvent(evt.Event) {
+		return w.handleUnknownEvent(ctx, evt)
+	}
+
+	err := w.filterEvent(evt)
+	if err != nil {
+		return err
+	}
+
 	docUUID := uuid.MustParse(evt.Uuid)
 
-	if slices.Contains(w.ignoreSubs, evt.UpdaterUri) {
-		return fmt.Errorf("ignored sub: %w", ErrSkipped)
+	// When catching up the event is used to sync the current state of the
+	// document, and the statuses are filtered as they're read.
+	if caughtUp && evt.Event == TypeNewStatus && !w.statusFilter.Allowed(evt.Status) {
+		return fmt.Errorf("ignored status %q: %w", evt.Status, ErrSkipped)
 	}
 
-	if slices.Contains(w.ignoreTypes, evt.Type) {
-		return fmt.Errorf("ignored type: %w", ErrSkipped)
+	if evt.Event == TypeWorkflow {
+		return w.handleWorkflowEvent(ctx, evt)
 	}
 
-	if evt.Type == TypeNewStatus && isSchedulerUsable(evt.Status, evt.UpdaterUri) {
-		return fmt.Errorf("scheduler-created usable status: %w", ErrSkipped)
+	err = w.checkQuarantined(ctx, docUUID)
+	if err != nil {
+		return err
 	}
 
-	if evt.Type == TypeDeleteDocument {
+	if evt.MainDocument != "" {
+		return w.handleMetaDocumentEvent(ctx, evt, caughtUp)
+	}
+
+	if evt.Event == TypeDeleteDocument {
 		return w.handleDeleteEvent(ctx, evt, docUUID)
 	}
 
+	checkRes, released, err := w.documentChecks(ctx, evt, docUUID, caughtUp)
+	if err != nil {
+		return err
+	}
+
+	tx, err := w.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+
+	defer pg.Rollback(tx, &outErr)
+
+	q := postgres.New(tx)
+
+	// Restored documents are re-ingested from their current state, the
+	// same way as we do when catching up, as the version mappings were
+	// removed when the document was deleted. Released documents haven't
+	// been replicated while they were withheld.
+	fullSync := !caughtUp || evt.Event == TypeRestoreFinished || released
+
+	res, err := w.replicate(ctx, q, evt, checkRes, !fullSync)
+	if err != nil {
+		return err
+	}
+
+	// The log state is persisted per batch when events are handled
+	// concurrently, as they can finish out of order.
+	var (
+		revision int64
+		state    LogState
+		now      = time.Now()
+		persist  = !w.concurrent() && w.replay == nil &&
+			w.stateBatching.Due(w.unstoredEvents+1, w.lastStateStore, now)
+	)
+
+	if persist {
+		state = LogState{
+			Position:           evt.Id,
+			CaughtUp:           caughtUp,
+			LastEventTimestamp: eventTimestamp(evt),
+			LastUpdated:        now,
+		}
+
+		rev, err := StoreStateRevision(ctx, q, w.stateKey(), state,
+			w.stateRevision)
+		if err != nil {
+			return fmt.Errorf("persist log state: %w", err)
+		}
+
+		revision = rev
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("commit state: %w", err)
+	}
+
+	switch {
+	case w.replay != nil:
+		// Replayed events don't affect the log state.
+	case persist:
+		w.storedPosition = evt.Id
+		w.stateRevision = revision
+		w.unstoredEvents = 0
+		w.lastStateStore = now
+
+		w.metrics.statePersisted(w.name, state)
+	case !w.concurrent():
+		w.unstoredEvents++
+	}
+
+	w.logReplicated(ctx, evt, res, caughtUp)
+
+	return nil
+}
+
+// filterEvent skips events for documents that aren't in the included UUIDs,
+// events that are skipped by the event filters, and scheduler-created usable
+// statuses.
+func (w *Worker) filterEvent(evt *repository.EventlogItem) error {
+	// Combined with the other filters, a document has to be in the set
+	// and pass all of them. Workflow events aren't tied to a document.
+	if evt.Event != TypeWorkflow && !w.includeUUIDs.Included(evt) {
+		return fmt.Errorf("document not in included UUIDs: %w", ErrSkipped)
+	}
+
+	for _, f := range w.eventFilters {
+		skip, reason := f.Skip(evt)
+		if skip {
+			return fmt.Errorf("%s: %w", reason, ErrSkipped)
+		}
+	}
+
+	if evt.Event == TypeNewStatus && w.skipSchedulerUsable(evt.Status, evt.UpdaterUri) {
+		return fmt.Errorf("scheduler-created usable status: %w", ErrSkipped)
+	}
+
+	return nil
+}
+
+// skippedBeforeSync returns true if the event is skipped by handleEvent before
+// the current state of the document is synced.
+func (w *Worker) skippedBeforeSync(evt *repository.EventlogItem) bool {
+	return !IsKnownEvent(evt.Event) || w.filterEvent(evt) != nil
+}
+
+// documentChecks runs the checks that decide if the current state of a document
+// should be replicated, the meta checks, the content filter, and the language
+// routing. Documents that no longer should be in the target are removed from
+// it. Returns the source document if it was read by the checks, and true if a
+// withheld document has been released by the event.
+func (w *Worker) documentChecks(
+	ctx context.Context, evt *repository.EventlogItem, docUUID uuid.UUID,
+	caughtUp bool,
+) (_ *repository.GetDocumentResponse, released bool, _ error) {
+	// The meta checks are done before the document is replicated so that
+	// we don't transfer attachments for documents that will be skipped.
+	if !w.restriction.IsZero() || !w.minCreated.IsZero() || w.withheld == WithheldHold {
+		metaRes, err := w.source.GetMeta(ctx,
+			&repository.GetMetaRequest{
+				Uuid: evt.Uuid,
+			})
+		if elephantine.IsTwirpErrorCode(err, twirp.NotFound) {
+			return nil, false, fmt.Errorf("document not found for meta check: %w", ErrSkipped)
+		} else if err != nil {
+			return nil, false, fmt.Errorf("get source meta for meta check: %w", err)
+		}
+
+		older, err := CreatedBefore(metaRes.Meta.Created, w.minCreated)
+		if err != nil {
+			return nil, false, fmt.Errorf("check document creation time: %w", err)
+		}
+
+		if older {
+			return nil, false, fmt.Errorf("created before %s: %w",
+				w.minCreated.Format(time.RFC3339), ErrSkipped)
+		}
+
+		restricted, reason := w.restriction.Restricted(metaRes.Meta.Acl)
+		if restricted {
+			err := w.removeExcluded(ctx, docUUID, reason)
+			if err != nil {
+				return nil, false, fmt.Errorf("remove restricted document from target: %w", err)
+			}
+
+			return nil, false, fmt.Errorf("ignored because of ACL restriction: %s: %w",
+				reason, ErrSkipped)
+		}
+
+		if w.withheld == WithheldHold {
+			embargo, err := GetEmbargoState(metaRes.Meta.Heads)
+			if err != nil {
+				return nil, false, fmt.Errorf("check embargo: %w", err)
+			}
+
+			if embargo.Withheld {
+				return nil, false, fmt.Errorf("withheld until released: %w", ErrSkipped)
+			}
+
+			released = embargo.Released &&
+				evt.Event == TypeNewStatus && evt.Status == statusUsable
+		}
+	}
+
 	var checkRes *repository.GetDocumentResponse
 
 	if w.cFilter.HasFilters(evt.Type) {
@@ -140,9 +718,9 @@ func (w *Worker) handleEvent(
 				Uuid: evt.Uuid,
 			})
 		if elephantine.IsTwirpErrorCode(err, twirp.NotFound) {
-			return fmt.Errorf("document not found for content filtering: %w", ErrSkipped)
+			return nil, false, fmt.Errorf("document not found for content filtering: %w", ErrSkipped)
 		} else if err != nil {
-			return fmt.Errorf("get document for content based filtering: %w", err)
+			return nil, false, fmt.Errorf("get document for content based filtering: %w", err)
 		}
 
 		checkRes = res
@@ -150,45 +728,80 @@ func (w *Worker) handleEvent(
 		doc := rpc_newsdoc.DocumentFromRPC(res.Document)
 
 		if !w.cFilter.Check(doc) {
-			return fmt.Errorf("ignored because of content filter: %w", ErrSkipped)
+			err := w.removeExcluded(ctx, docUUID, "content filter")
+			if err != nil {
+				return nil, false, fmt.Errorf("remove filtered document from target: %w", err)
+			}
+
+			return nil, false, fmt.Errorf("ignored because of content filter: %w", ErrSkipped)
 		}
 	}
 
-	tx, err := w.db.Begin(ctx)
+	checkRes, err := w.routeByLanguage(ctx, evt, docUUID, caughtUp, checkRes)
 	if err != nil {
-		return fmt.Errorf("begin transaction: %w", err)
+		return nil, false, err
 	}
 
-	defer pg.Rollback(tx, &outErr)
+	return checkRes, released, nil
+}
 
-	q := postgres.New(tx)
+// replicateResult describes a change that was written to the target.
+type replicateResult struct {
+	// TargetVersion is the version of the document in the target.
+	TargetVersion int64
+	// Attachments is the number of attachments that were transferred.
+	Attachments int
+}
+
+// replicate writes the change described by the event to the target and records
+// the resulting version mapping. When we haven't caught up the current state of
+// the document is read from the source instead of relying on the event
+// details.
+func (w *Worker) replicate(
+	ctx context.Context,
+	q *postgres.Queries,
+	evt *repository.EventlogItem,
+	checkRes *repository.GetDocumentResponse,
+	caughtUp bool,
+) (replicateResult, error) {
+	docUUID := uuid.MustParse(evt.Uuid)
+	targetUUID := w.uuidMapping.Map(docUUID)
 
 	var isNew bool
 
 	targetVersion, err := q.GetDocumentVersion(ctx, postgres.GetDocumentVersionParams{
 		TargetName: w.name,
-		ID:         docUUID,
+		ID:         targetUUID,
 	})
 	if errors.Is(err, pgx.ErrNoRows) {
 		isNew = true
 	} else if err != nil {
-		return fmt.Errorf("get current target version: %w", err)
+		return replicateResult{}, fmt.Errorf("get current target version: %w", err)
+	}
+
+	if !isNew && w.replay == nil {
+		applied, err := EventApplied(ctx, q, w.name, targetUUID, evt, caughtUp)
+		if err != nil {
+			return replicateResult{}, err
+		}
+
+		if applied {
+			return replicateResult{}, fmt.Errorf(
+				"event has already been replicated: %w", ErrSkipped)
+		}
 	}
 
 	if isNew {
 		err := w.reconcileTypeDifferences(
-			ctx, docUUID.String(), evt.Type)
+			ctx, targetUUID.String(), w.targetType(evt.Type))
 		if err != nil {
-			return fmt.Errorf("reconcile type differences for new document: %w", err)
+			return replicateResult{}, fmt.Errorf("reconcile type differences for new document: %w", err)
 		}
 	}
 
 	update := repository.UpdateRequest{
-		Uuid: evt.Uuid,
-		ImportDirective: &repository.ImportDirective{
-			OriginallyCreated: evt.Timestamp,
-			OriginalCreator:   evt.UpdaterUri,
-		},
+		Uuid:            targetUUID.String(),
+		ImportDirective: w.importDirective(evt, nil),
 	}
 
 	updateType := evt.Event
@@ -196,37 +809,86 @@ func (w *Worker) handleEvent(
 	if !caughtUp {
 		updateType = TypeDocumentVersion
 
-		metaRes, err := w.source.GetMeta(ctx,
+		// The current version is read together with the meta, it's
+		// used if the meta points at the same version.
+		var prefetched func() *repository.GetDocumentResponse
+
+		if w.parallelFetch && checkRes == nil {
+			prefetched = w.prefetchCurrent(ctx, evt.Uuid)
+		}
+
+		fetchCtx, span := w.tracer.Start(ctx, "get source meta")
+
+		metaRes, err := w.source.GetMeta(fetchCtx,
 			&repository.GetMetaRequest{
 				Uuid: evt.Uuid,
 			})
+
+		endSpan(span, err)
+
 		if elephantine.IsTwirpErrorCode(err, twirp.NotFound) {
-			return fmt.Errorf("document not found for meta read: %w", ErrSkipped)
+			return replicateResult{}, fmt.Errorf("document not found for meta read: %w", ErrSkipped)
 		} else if err != nil {
-			return fmt.Errorf("get source meta: %w", err)
+			return replicateResult{}, fmt.Errorf("get source meta: %w", err)
 		}
 
-		evt.Version = metaRes.Meta.CurrentVersion
+		if metaRes.Meta.GetCurrentVersion() <= 0 {
+			w.metrics.missingCurrentVersion(w.name)
 
-		if isNew {
-			update.Acl = metaRes.Meta.Acl
+			if !w.allowNoCurrentVersion {
+				return replicateResult{}, fmt.Errorf(
+					"source meta has no current version (%d): %w",
+					metaRes.Meta.GetCurrentVersion(), ErrSkipped)
+			}
 
-			update.ImportDirective = &repository.ImportDirective{
-				OriginallyCreated: metaRes.Meta.Created,
-				OriginalCreator:   metaRes.Meta.CreatorUri,
+			w.logger.WarnContext(ctx, "source meta has no current version, reading the document without a version",
+				elephantine.LogKeyEventID, evt.Id,
+				elephantine.LogKeyDocumentUUID, evt.Uuid,
+			)
+		}
+
+		evt.Version = metaRes.Meta.GetCurrentVersion()
+
+		if prefetched != nil {
+			if res := prefetched(); res != nil && res.Version == evt.Version {
+				checkRes = res
 			}
+		}
+
+		if isNew {
+			update.Acl = w.targetACL(metaRes.Meta.Acl)
+
+			update.ImportDirective = w.importDirective(evt, metaRes.Meta)
 
 			for _, info := range metaRes.Meta.Attachments {
+				if slices.Contains(evt.AttachedObjects, info.Name) {
+					continue
+				}
+
 				evt.AttachedObjects = append(evt.AttachedObjects, info.Name)
 			}
 		}
 
+		var pending []PendingStatus
+
 		for status, info := range metaRes.Meta.Heads {
-			if info.Version != metaRes.Meta.CurrentVersion {
+			if w.skipSchedulerUsable(status, info.Creator) {
+				continue
+			}
+
+			if !w.statusFilter.Allowed(status) {
 				continue
 			}
 
-			if isSchedulerUsable(status, info.Creator) {
+			if info.Version != metaRes.Meta.CurrentVersion {
+				if w.statusBackfill {
+					pending = append(pending, PendingStatus{
+						Name:    status,
+						ID:      info.Id,
+						Version: info.Version,
+					})
+				}
+
 				continue
 			}
 
@@ -236,40 +898,110 @@ func (w *Worker) handleEvent(
 					Meta: info.Meta,
 				})
 		}
+
+		if len(pending) > 0 && !w.dryRun {
+			err := w.recordPendingStatuses(ctx, q, evt.Uuid, pending)
+			if err != nil {
+				return replicateResult{}, err
+			}
+		}
 	}
 
 	switch updateType {
 	case TypeDocumentVersion:
-		if checkRes != nil && checkRes.Version == evt.Version {
-			update.Document = checkRes.Document
-		} else {
-			res, err := w.source.Get(ctx,
-				&repository.GetDocumentRequest{
-					Uuid:    evt.Uuid,
-					Version: evt.Version,
-				})
-			if elephantine.IsTwirpErrorCode(err, twirp.NotFound) {
-				return fmt.Errorf("document not found: %w", ErrSkipped)
-			} else if err != nil {
-				return fmt.Errorf("get source document: %w", err)
-			}
+		// New documents that are created by caught up events don't get
+		// an ACL from the meta, but still have to get the template.
+		if isNew && !w.aclTemplate.IsZero() {
+			update.Acl = w.aclTemplate.Entries()
+		}
+
+		// Every fetch sets its own fields of the update, so that they
+		// can run concurrently.
+		fetches := []func(ctx context.Context) error{
+			func(ctx context.Context) error {
+				if checkRes != nil && checkRes.Version == evt.Version {
+					update.Document = checkRes.Document
+
+					return nil
+				}
+
+				res, err := w.sourceDocument(ctx, evt.Uuid, evt.Version)
+				if err != nil {
+					return err
+				}
+
+				update.Document = res.Document
+
+				return nil
+			},
+		}
+
+		if w.versionMeta {
+			fetches = append(fetches, func(ctx context.Context) error {
+				meta, err := w.sourceVersionMeta(ctx, evt.Uuid, evt.Version)
+				if err != nil {
+					return err
+				}
+
+				update.Meta = meta
+
+				return nil
+			})
+		}
+
+		// The ACL is only read from the source meta while catching
+		// up, refresh it so that ACL changes made together with the
+		// version aren't missed.
+		if caughtUp && w.versionACL {
+			fetches = append(fetches, func(ctx context.Context) error {
+				acl, err := w.sourceACL(ctx, evt.Uuid)
+				if err != nil {
+					return err
+				}
+
+				update.Acl = acl
 
-			update.Document = res.Document
+				return nil
+			})
 		}
 
-		err = w.prepareAttachments(ctx, evt, &update)
+		fetches = append(fetches, func(ctx context.Context) error {
+			err := w.prepareAttachments(ctx, evt, &update)
+			if err != nil {
+				return fmt.Errorf("transfer attachments: %w", err)
+			}
+
+			if !w.detachAttachments || isNew {
+				return nil
+			}
+
+			detach, err := w.removedAttachments(ctx, evt, targetUUID,
+				update.AttachObjects)
+			if err != nil {
+				return err
+			}
+
+			update.DetachObjects = detach
+
+			return nil
+		})
+
+		// The update is written once all fetches have completed.
+		err = w.runFetches(ctx, fetches)
 		if err != nil {
-			return fmt.Errorf("transfer attachments: %w", err)
+			return replicateResult{}, err
 		}
 	case TypeNewStatus:
 		mappedVersion, err := q.GetTargetVersion(ctx,
 			postgres.GetTargetVersionParams{
 				TargetName:    w.name,
-				ID:            docUUID,
+				ID:            targetUUID,
 				SourceVersion: evt.Version,
 			})
 		if errors.Is(err, pgx.ErrNoRows) {
-			return ErrSkipped
+			w.mappingGap(ctx, evt)
+
+			return replicateResult{}, ErrSkipped
 		}
 
 		statusRes, err := w.source.GetStatus(ctx, &repository.GetStatusRequest{
@@ -278,9 +1010,9 @@ func (w *Worker) handleEvent(
 			Id:   evt.StatusId,
 		})
 		if elephantine.IsTwirpErrorCode(err, twirp.NotFound) {
-			return fmt.Errorf("document not found: %w", ErrSkipped)
+			return replicateResult{}, fmt.Errorf("document not found: %w", ErrSkipped)
 		} else if err != nil {
-			return fmt.Errorf("get source status: %w", err)
+			return replicateResult{}, fmt.Errorf("get source status: %w", err)
 		}
 
 		update.Status = append(update.Status, &repository.StatusUpdate{
@@ -289,48 +1021,105 @@ func (w *Worker) handleEvent(
 			Meta:    statusRes.Status.Meta,
 		})
 	case TypeACLUpdate:
+		// The target ACL never changes when a template is used.
+		if !w.aclTemplate.IsZero() {
+			return replicateResult{}, fmt.Errorf(
+				"ACL template is used, ACL changes aren't replicated: %w", ErrSkipped)
+		}
+
 		metaRes, err := w.source.GetMeta(ctx,
 			&repository.GetMetaRequest{
 				Uuid: evt.Uuid,
 			})
 		if elephantine.IsTwirpErrorCode(err, twirp.NotFound) {
-			return fmt.Errorf("document not found: %w", ErrSkipped)
+			return replicateResult{}, fmt.Errorf("document not found: %w", ErrSkipped)
 		} else if err != nil {
-			return fmt.Errorf("get source meta: %w", err)
+			return replicateResult{}, fmt.Errorf("get source meta: %w", err)
 		}
 
-		update.Acl = metaRes.Meta.Acl
+		update.Acl = w.targetACL(metaRes.Meta.Acl)
 	default:
-		return fmt.Errorf("unhandled event type %q: %w",
+		return replicateResult{}, fmt.Errorf("unhandled event type %q: %w",
 			updateType, ErrSkipped)
 	}
 
+	// The source language is recorded, not the language that the
+	// document might have been given by transforms.
+	var language string
+
+	if update.Document != nil {
+		language = update.Document.Language
+
+		err := w.mapDocument(ctx, q, update.Document, targetUUID)
+		if err != nil {
+			return replicateResult{}, err
+		}
+
+		update.Meta = w.provenance.Apply(update.Meta, evt, time.Now())
+	}
+
 	if !isNew {
 		update.IfMatch = targetVersion
 	}
 
-	var upRes *repository.UpdateResponse
+	if w.dryRun {
+		w.logDryRunUpdate(ctx, evt, updateType, &update)
 
-	for {
-		res, err := w.target.Update(ctx, &update)
+		if w.replay != nil {
+			w.replay.updates = append(w.replay.updates, &update)
+		}
+
+		return replicateResult{}, nil
+	}
+
+	var upRes *repository.UpdateResponse
+
+	for {
+		updateCtx, span := w.tracer.Start(ctx, "update target")
+
+		res, overwritten, err := w.conflictPolicy.UpdateTarget(
+			updateCtx, w.target, &update)
+
+		endSpan(span, err)
+
+		if overwritten != 0 {
+			w.logger.WarnContext(ctx, "overwrote changes made in target",
+				elephantine.LogKeyEventID, evt.Id,
+				elephantine.LogKeyDocumentUUID, evt.Uuid,
+				"expected_version", overwritten,
+			)
+		}
 
 		switch {
 		case elephantine.IsTwirpErrorCode(err, twirp.FailedPrecondition):
-			return ErrConflict
+			return replicateResult{}, &ConflictError{
+				TargetUUID:      targetUUID,
+				ExpectedVersion: update.IfMatch,
+			}
 		case elephantine.IsTwirpErrorCode(err, twirp.NotFound) && update.Document == nil:
 			fetchRes, err := w.source.Get(ctx,
 				&repository.GetDocumentRequest{
 					Uuid: evt.Uuid,
 				})
 			if err != nil {
-				return fmt.Errorf("fetch document for backfill: %w", err)
+				return replicateResult{}, fmt.Errorf("fetch document for backfill: %w", err)
 			}
 
 			update.Document = fetchRes.Document
 
+			err = w.mapDocument(ctx, q, update.Document, targetUUID)
+			if err != nil {
+				return replicateResult{}, err
+			}
+
+			continue
+		case IsSizeLimitError(err) && w.reduceOversized(ctx, evt, &update):
 			continue
+		case IsSizeLimitError(err):
+			return replicateResult{}, fmt.Errorf("update target: %w: %w",
+				ErrOversized, err)
 		case err != nil:
-			return fmt.Errorf("update target: %w", err)
+			return replicateResult{}, fmt.Errorf("update target: %w", targetError(err))
 		}
 
 		upRes = res
@@ -341,43 +1130,395 @@ func (w *Worker) handleEvent(
 	if updateType == TypeDocumentVersion {
 		err = q.SetDocumentVersion(ctx, postgres.SetDocumentVersionParams{
 			TargetName:    w.name,
-			ID:            docUUID,
+			ID:            targetUUID,
 			TargetVersion: upRes.Version,
 		})
 		if err != nil {
-			return fmt.Errorf("record new target version: %w", err)
+			return replicateResult{}, fmt.Errorf("record new target version: %w", err)
+		}
+
+		err = w.recordLanguage(ctx, q, evt, targetUUID, language)
+		if err != nil {
+			return replicateResult{}, err
 		}
 
 		err = q.AddVersionMapping(ctx, postgres.AddVersionMappingParams{
 			TargetName:    w.name,
-			ID:            docUUID,
+			ID:            targetUUID,
 			SourceVersion: evt.Version,
 			TargetVersion: upRes.Version,
 			Created:       pg.Time(time.Now()),
+			EventID:       pgtype.Int8{Int64: evt.Id, Valid: true},
 		})
 		if err != nil {
-			return fmt.Errorf("record new version mapping: %w", err)
+			return replicateResult{}, fmt.Errorf("record new version mapping: %w", err)
 		}
 	}
 
-	err = StoreState(ctx, q, w.stateKey(), LogState{
-		Position: evt.Id,
-		CaughtUp: caughtUp,
+	if evt.Id != 0 {
+		err = q.SetDocumentEvent(ctx, postgres.SetDocumentEventParams{
+			TargetName: w.name,
+			ID:         targetUUID,
+			LastEvent:  pgtype.Int8{Int64: evt.Id, Valid: true},
+		})
+		if err != nil {
+			return replicateResult{}, fmt.Errorf("record replicated event: %w", err)
+		}
+	}
+
+	return replicateResult{
+		TargetVersion: upRes.Version,
+		Attachments:   len(update.AttachObjects),
+	}, nil
+}
+
+// EventApplied returns true if the event already has been replicated to the
+// target document, so that events that are handled again after a restart
+// don't write the same state to the target again. Version events are also
+// checked against the version mappings when caught up, as documents that
+// were replicated before the last event was recorded don't have one.
+// Synthetic events without an ID are never treated as applied.
+func EventApplied(
+	ctx context.Context, q *postgres.Queries, targetName string,
+	targetUUID uuid.UUID, evt *repository.EventlogItem, caughtUp bool,
+) (bool, error) {
+	if evt.Id == 0 {
+		return false, nil
+	}
+
+	lastEvent, err := q.GetDocumentEvent(ctx, postgres.GetDocumentEventParams{
+		TargetName: targetName,
+		ID:         targetUUID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("get last replicated event: %w", err)
+	}
+
+	if lastEvent.Valid && evt.Id <= lastEvent.Int64 {
+		return true, nil
+	}
+
+	if !caughtUp || evt.Event != TypeDocumentVersion {
+		return false, nil
+	}
+
+	_, err = q.GetTargetVersion(ctx, postgres.GetTargetVersionParams{
+		TargetName:    targetName,
+		ID:            targetUUID,
+		SourceVersion: evt.Version,
 	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("get target version: %w", err)
+	}
+
+	return true, nil
+}
+
+func (w *Worker) logDryRunUpdate(
+	ctx context.Context,
+	evt *repository.EventlogItem,
+	updateType string,
+	update *repository.UpdateRequest,
+) {
+	statuses := make([]string, len(update.Status))
+
+	for i, s := range update.Status {
+		statuses[i] = s.Name
+	}
+
+	var version int64
+
+	if updateType == TypeDocumentVersion {
+		version = evt.Version
+	}
+
+	w.logger.InfoContext(ctx, "dry run: would update document in target",
+		elephantine.LogKeyEventID, evt.Id,
+		elephantine.LogKeyEventType, updateType,
+		elephantine.LogKeyDocumentUUID, update.Uuid,
+		elephantine.LogKeyDocumentType, w.targetType(evt.Type),
+		"source_version", version,
+		"if_match", update.IfMatch,
+		"document", update.Document != nil,
+		"statuses", statuses,
+		"acl_entries", len(update.Acl),
+		"detach_objects", update.DetachObjects,
+	)
+}
+
+// SendDocument replicates the current version of a document to the target
+// outside of the normal event log flow. The document goes through the same
+// checks as when catching up, and sending a document releases it from
+// quarantine. Unless force is set the document will not be written if the
+// current source version already has been replicated. Returns the version
+// of the document in the target.
+func (w *Worker) SendDocument(
+	ctx context.Context, docUUID uuid.UUID, force bool,
+) (_ int64, outErr error) {
+	metaRes, err := w.source.GetMeta(ctx,
+		&repository.GetMetaRequest{
+			Uuid: docUUID.String(),
+		})
+	if elephantine.IsTwirpErrorCode(err, twirp.NotFound) {
+		return 0, fmt.Errorf("document not found: %w", ErrSkipped)
+	} else if err != nil {
+		return 0, fmt.Errorf("get source meta: %w", err)
+	}
+
+	evt := currentVersionEvent(docUUID, metaRes.Meta)
+
+	err = w.filterEvent(evt)
 	if err != nil {
-		return fmt.Errorf("persist log state: %w", err)
+		return 0, err
+	}
+
+	checkRes, _, err := w.documentChecks(ctx, evt, docUUID, false)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := w.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction: %w", err)
+	}
+
+	defer pg.Rollback(tx, &outErr)
+
+	q := postgres.New(tx)
+
+	if !force {
+		mappedVersion, err := q.GetTargetVersion(ctx,
+			postgres.GetTargetVersionParams{
+				TargetName:    w.name,
+				ID:            w.uuidMapping.Map(docUUID),
+				SourceVersion: metaRes.Meta.CurrentVersion,
+			})
+		if err == nil {
+			return mappedVersion, nil
+		} else if !errors.Is(err, pgx.ErrNoRows) {
+			return 0, fmt.Errorf("get target version: %w", err)
+		}
+	}
+
+	// Treat the document as if we're catching up so that the current state
+	// of the document gets replicated.
+	res, err := w.replicate(ctx, q, evt, checkRes, false)
+	if err != nil {
+		return 0, err
+	}
+
+	if !w.dryRun {
+		err = w.clearQuarantine(ctx, q, docUUID)
+		if err != nil {
+			return 0, err
+		}
 	}
 
 	err = tx.Commit(ctx)
 	if err != nil {
-		return fmt.Errorf("commit state: %w", err)
+		return 0, fmt.Errorf("commit state: %w", err)
+	}
+
+	return res.TargetVersion, nil
+}
+
+// ResyncDocument discards what we know about the document in the target and
+// re-ingests its current source state. The document is deleted from the target
+// if it no longer exists in the source, in which case deleted is set to true.
+// The document goes through the same checks as when catching up, and
+// quarantined documents are skipped unless releaseQuarantine is set, in which
+// case the replication errors of the document are removed once it has been
+// resynced. Returns the version of the document in the target.
+func (w *Worker) ResyncDocument(
+	ctx context.Context, docUUID uuid.UUID, releaseQuarantine bool,
+) (_ int64, deleted bool, outErr error) {
+	metaRes, err := w.source.GetMeta(ctx,
+		&repository.GetMetaRequest{
+			Uuid: docUUID.String(),
+		})
+	if elephantine.IsTwirpErrorCode(err, twirp.NotFound) {
+		err := w.removeDocument(ctx, docUUID, nil)
+		if err != nil {
+			return 0, false, err
+		}
+
+		return 0, true, nil
+	} else if err != nil {
+		return 0, false, fmt.Errorf("get source meta: %w", err)
+	}
+
+	evt := currentVersionEvent(docUUID, metaRes.Meta)
+
+	err = w.filterEvent(evt)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if !releaseQuarantine {
+		err := w.checkQuarantined(ctx, docUUID)
+		if err != nil {
+			return 0, false, err
+		}
+	}
+
+	checkRes, _, err := w.documentChecks(ctx, evt, docUUID, false)
+	if err != nil {
+		return 0, false, err
+	}
+
+	tx, err := w.db.Begin(ctx)
+	if err != nil {
+		return 0, false, fmt.Errorf("begin transaction: %w", err)
+	}
+
+	defer pg.Rollback(tx, &outErr)
+
+	q := postgres.New(tx)
+
+	targetUUID := w.uuidMapping.Map(docUUID)
+
+	// Without a recorded target version the document will be treated as
+	// new, and written without an optimistic lock. A dry run only logs
+	// the update, so what we know about the document is kept.
+	if !w.dryRun {
+		err = q.RemoveDocument(ctx, postgres.RemoveDocumentParams{
+			TargetName: w.name,
+			ID:         targetUUID,
+		})
+		if err != nil {
+			return 0, false, fmt.Errorf("remove document target entry: %w", err)
+		}
+
+		err = q.RemoveDocumentVersionMappings(ctx, postgres.RemoveDocumentVersionMappingsParams{
+			TargetName: w.name,
+			ID:         targetUUID,
+		})
+		if err != nil {
+			return 0, false, fmt.Errorf("remove document version mappings: %w", err)
+		}
+	}
+
+	res, err := w.replicate(ctx, q, evt, checkRes, false)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if releaseQuarantine && !w.dryRun {
+		err = w.clearQuarantine(ctx, q, docUUID)
+		if err != nil {
+			return 0, false, err
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, false, fmt.Errorf("commit state: %w", err)
+	}
+
+	return res.TargetVersion, false, nil
+}
+
+// currentVersionEvent creates a synthetic document event for the current
+// version of a document.
+func currentVersionEvent(
+	docUUID uuid.UUID, meta *repository.DocumentMeta,
+) *repository.EventlogItem {
+	return &repository.EventlogItem{
+		Event:      TypeDocumentVersion,
+		Uuid:       docUUID.String(),
+		Type:       meta.Type,
+		Timestamp:  meta.Modified,
+		UpdaterUri: meta.UpdaterUri,
+	}
+}
+
+// mapDocument prepares a source document for being written to the target by
+// stripping blocks, applying transformers, mapping its type and UUID, and
+// rewriting references to other replicated documents if enabled.
+func (w *Worker) mapDocument(
+	ctx context.Context,
+	q *postgres.Queries,
+	doc *rpc_newsdoc.Document,
+	targetUUID uuid.UUID,
+) error {
+	// Documents without a type are rejected by the target, the fallback
+	// type keeps replication going until the source has been fixed.
+	if doc.Type == "" && w.fallbackType != "" {
+		w.logger.WarnContext(ctx, "using fallback type for document without a type",
+			elephantine.LogKeyDocumentUUID, doc.Uuid,
+			"fallback_type", w.fallbackType,
+		)
+
+		doc.Type = w.fallbackType
+
+		w.metrics.fallbackTypeUsed(w.name)
 	}
 
+	if n := w.stripper.Strip(doc); n > 0 {
+		w.logger.DebugContext(ctx, "stripped blocks from document",
+			elephantine.LogKeyDocumentUUID, doc.Uuid,
+			"blocks", n,
+		)
+	}
+
+	err := w.transformer.Transform(ctx, doc)
+	if err != nil {
+		return fmt.Errorf("transform document: %w", err)
+	}
+
+	doc.Type = w.targetType(doc.Type)
+	doc.Uuid = targetUUID.String()
+
+	refs := w.uuidMapping.ReferencedUUIDs(doc)
+	if len(refs) == 0 {
+		return nil
+	}
+
+	targetRefs := make([]uuid.UUID, len(refs))
+	sourceRefs := make(map[uuid.UUID]uuid.UUID, len(refs))
+
+	for i, ref := range refs {
+		targetRefs[i] = w.uuidMapping.Map(ref)
+		sourceRefs[targetRefs[i]] = ref
+	}
+
+	replicatedTargets, err := q.GetReplicatedDocuments(ctx,
+		postgres.GetReplicatedDocumentsParams{
+			TargetName: w.name,
+			Ids:        targetRefs,
+		})
+	if err != nil {
+		return fmt.Errorf("check for replicated references: %w", err)
+	}
+
+	replicated := make(map[uuid.UUID]bool, len(replicatedTargets))
+
+	for _, id := range replicatedTargets {
+		replicated[sourceRefs[id]] = true
+	}
+
+	w.uuidMapping.Rewrite(doc, replicated)
+
 	return nil
 }
 
+// targetType returns the type that documents of the source type should be
+// written as in the target.
+func (w *Worker) targetType(sourceType string) string {
+	t, ok := w.typeMapping[sourceType]
+	if !ok {
+		return sourceType
+	}
+
+	return t
+}
+
 func (w *Worker) reconcileTypeDifferences(
-	ctx context.Context, docUUID string, sourceType string,
+	ctx context.Context, docUUID string, targetType string,
 ) error {
 	docRes, err := w.target.Get(ctx, &repository.GetDocumentRequest{
 		Uuid: docUUID,
@@ -385,10 +1526,21 @@ func (w *Worker) reconcileTypeDifferences(
 	if elephantine.IsTwirpErrorCode(err, twirp.NotFound) {
 		return nil
 	} else if err != nil {
-		return fmt.Errorf("get target document: %w", err)
+		return fmt.Errorf("get target document: %w", targetError(err))
+	}
+
+	if docRes.Document.Type == targetType {
+		return nil
 	}
 
-	if docRes.Document.Type == sourceType {
+	if w.dryRun {
+		w.logger.InfoContext(ctx,
+			"dry run: would delete document in target to reconcile type differences",
+			elephantine.LogKeyDocumentUUID, docUUID,
+			elephantine.LogKeyDocumentType, targetType,
+			"old_type", docRes.Document.Type,
+		)
+
 		return nil
 	}
 
@@ -396,13 +1548,13 @@ func (w *Worker) reconcileTypeDifferences(
 		Uuid: docUUID,
 	})
 	if err != nil {
-		return fmt.Errorf("delete target document: %w", err)
+		return fmt.Errorf("delete target document: %w", targetError(err))
 	}
 
 	w.logger.WarnContext(ctx,
 		"deleted document in target to reconcile type differences",
 		elephantine.LogKeyDocumentUUID, docUUID,
-		elephantine.LogKeyDocumentType, sourceType,
+		elephantine.LogKeyDocumentType, targetType,
 		"old_type", docRes.Document.Type,
 	)
 
@@ -420,98 +1572,313 @@ func (w *Worker) prepareAttachments(
 
 	request.AttachObjects = make(map[string]string)
 
-	for _, name := range evt.AttachedObjects {
+	// Some source events list the same attachment more than once, every
+	// name is only transferred once.
+	names, duplicates := UniqueAttachmentNames(evt.AttachedObjects)
+	if len(duplicates) > 0 {
+		w.logger.WarnContext(ctx, "ignoring duplicate attachment names",
+			elephantine.LogKeyDocumentUUID, evt.Uuid,
+			"attachments", duplicates,
+		)
+	}
+
+	var mu sync.Mutex
+
+	grp, gCtx := errgroup.WithContext(ctx)
+
+	grp.SetLimit(max(w.attachmentConcurrency, 1))
+
+	for _, name := range names {
 		if !w.shouldReplicateAttachment(name, evt.Type) {
 			continue
 		}
 
-		attachments, err := w.source.GetAttachments(ctx, &repository.GetAttachmentsRequest{
-			AttachmentName: name,
-			Documents:      []string{evt.Uuid},
-			DownloadLink:   true,
-		})
-		if err != nil {
-			return fmt.Errorf("get download link for %q: %w", name, err)
-		}
+		grp.Go(func() error {
+			attachments, err := w.source.GetAttachments(gCtx, &repository.GetAttachmentsRequest{
+				AttachmentName: name,
+				Documents:      []string{evt.Uuid},
+				DownloadLink:   true,
+			})
+			if err != nil {
+				return fmt.Errorf("get download link for %q: %w", name, err)
+			}
 
-		if len(attachments.Attachments) == 0 {
-			continue
-		}
+			// Ignore attachments if they have been deleted.
+			if len(attachments.Attachments) == 0 {
+				return nil
+			}
 
-		obj := attachments.Attachments[0]
+			obj := attachments.Attachments[0]
 
-		uploadID, err := w.transferAttachment(ctx, obj)
-		if err != nil {
-			return fmt.Errorf("transfer %q: %w", name, err)
-		}
+			if !w.attachmentTypes.Allowed(obj.ContentType) {
+				w.logger.DebugContext(gCtx,
+					"skipping attachment with disallowed content type",
+					elephantine.LogKeyDocumentUUID, evt.Uuid,
+					"attachment", name,
+					"content_type", obj.ContentType,
+				)
 
-		request.AttachObjects[name] = uploadID
+				return nil
+			}
+
+			if w.dryRun {
+				w.logger.InfoContext(gCtx,
+					"dry run: would transfer attachment",
+					elephantine.LogKeyDocumentUUID, evt.Uuid,
+					"attachment", name,
+					"filename", obj.Filename,
+					"content_type", obj.ContentType,
+				)
+
+				return nil
+			}
+
+			uploadID, err := w.transferAttachment(gCtx, obj)
+			if err != nil {
+				return fmt.Errorf("transfer %q: %w", name, err)
+			}
+
+			w.metrics.attachmentTransferred(w.name)
+
+			mu.Lock()
+			request.AttachObjects[name] = uploadID
+			mu.Unlock()
+
+			return nil
+		})
 	}
 
-	return nil
+	return grp.Wait() //nolint: wrapcheck
 }
 
 func (w *Worker) transferAttachment(
 	ctx context.Context,
 	obj *repository.AttachmentDetails,
 ) (_ string, outErr error) {
+	ctx, span := w.tracer.Start(ctx, "transfer attachment",
+		trace.WithAttributes(
+			attribute.String("attachment.name", obj.Name),
+			attribute.String("attachment.content_type", obj.ContentType),
+		))
+
+	defer func() {
+		endSpan(span, outErr)
+	}()
+
+	var uploadID string
+
+	// The download body is consumed by the upload, so every attempt has to
+	// start over with a fresh download.
+	err := w.attachmentRetry.Do(ctx, w.logger, "transfer attachment",
+		func(ctx context.Context) error {
+			id, err := w.attemptTransfer(ctx, obj)
+			if err != nil {
+				return err
+			}
+
+			uploadID = id
+
+			return nil
+		})
+	if err != nil {
+		return "", err
+	}
+
+	return uploadID, nil
+}
+
+func (w *Worker) attemptTransfer(
+	ctx context.Context,
+	obj *repository.AttachmentDetails,
+) (_ string, outErr error) {
+	start := time.Now()
+	stage := stageDownload
+
+	var (
+		body     *transferReader
+		content  *transferReader
+		uploaded int64
+	)
+
+	defer func() {
+		if body != nil {
+			w.metrics.attachmentBytes(w.name, body.n, uploaded)
+		}
+
+		if outErr != nil {
+			w.metrics.attachmentTransferFailed(w.name, stage)
+
+			return
+		}
+
+		w.metrics.attachmentTransferTime(w.name, time.Since(start))
+	}()
+
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, obj.DownloadLink, nil)
 	if err != nil {
 		return "", fmt.Errorf("create download request: %w", err)
 	}
 
-	res, err := http.DefaultClient.Do(req) //nolint: bodyclose
+	if w.verifyAttachments {
+		req.Header.Set(checksumModeHeader, "ENABLED")
+	}
+
+	// Setting the header ourselves stops the HTTP client from decompressing
+	// the download transparently.
+	if w.attachmentCompression.Enabled() {
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
+
+	res, err := w.httpClient.Do(req) //nolint: bodyclose
 	if err != nil {
-		return "", fmt.Errorf("make download request: %w", err)
+		return "", Retryable(fmt.Errorf("make download request: %w", err))
 	}
 
 	defer elephantine.Close("download body", res.Body, &outErr)
 
 	if res.StatusCode != http.StatusOK {
-		return "", fmt.Errorf(
+		return "", statusError(fmt.Errorf(
 			"failed to download attachment, server responded with: %s",
-			res.Status)
+			res.Status), res.StatusCode)
+	}
+
+	if w.maxAttachmentSize > 0 && res.ContentLength > w.maxAttachmentSize {
+		return "", fmt.Errorf("%w of %d bytes, size is %d bytes",
+			ErrAttachmentTooLarge, w.maxAttachmentSize, res.ContentLength)
+	}
+
+	useMultipart := w.multipart != nil && w.multipartUploads.Use(res.ContentLength)
+
+	encoding, decompress, err := w.attachmentCompression.TransferEncoding(
+		res.Header.Get("Content-Encoding"), !useMultipart)
+	if err != nil {
+		return "", err
+	}
+
+	// The size of decompressed attachments isn't known up front.
+	size := res.ContentLength
+	if decompress {
+		size = -1
+	}
+
+	release, err := w.attachmentMemory.Acquire(ctx,
+		w.attachmentMemory.Reservation(size, w.maxAttachmentSize))
+	if err != nil {
+		return "", err
 	}
 
+	defer release()
+
+	body = newTransferReader(res.Body, w.maxAttachmentSize)
+	content = body
+
+	if decompress {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			if body.err != nil {
+				return "", body.err
+			}
+
+			return "", Retryable(fmt.Errorf("decompress attachment: %w", err))
+		}
+
+		content = newTransferReader(gz, w.maxAttachmentSize)
+	}
+
+	if useMultipart {
+		id, err := w.multipartUpload(ctx, obj, res, body, content, &stage)
+		if err != nil {
+			return "", err
+		}
+
+		uploaded = content.n
+
+		return id, nil
+	}
+
+	stage = stageUpload
+
+	contentType := w.contentTypes.Apply(obj.Filename, obj.ContentType)
+
 	upload, err := w.target.CreateUpload(ctx, &repository.CreateUploadRequest{
 		Name:        obj.Filename,
-		ContentType: obj.ContentType,
+		ContentType: contentType,
+		Meta:        AttachmentMeta(res.Header),
 	})
 	if err != nil {
 		return "", fmt.Errorf("create upload: %w", err)
 	}
 
 	upReq, err := http.NewRequestWithContext(ctx, http.MethodPut,
-		upload.Url, res.Body)
+		upload.Url, content)
 	if err != nil {
 		return "", fmt.Errorf("create upload request: %w", err)
 	}
 
-	upReq.ContentLength = res.ContentLength
-	upReq.Header.Add("Content-Type", obj.ContentType)
+	upReq.ContentLength = size
+	upReq.Header.Add("Content-Type", contentType)
 
-	upRes, err := http.DefaultClient.Do(upReq) //nolint: bodyclose
-	if err != nil {
-		return "", fmt.Errorf("make upload request: %w", err)
+	if encoding != "" {
+		upReq.Header.Add("Content-Encoding", encoding)
+	}
+
+	upRes, err := w.httpClient.Do(upReq) //nolint: bodyclose
+	if readErr := limitErr(body, content); readErr != nil {
+		stage = stageDownload
+
+		return "", readErr
+	} else if err != nil {
+		return "", Retryable(fmt.Errorf("make upload request: %w", err))
 	}
 
 	defer elephantine.Close("upload body", upRes.Body, &outErr)
 
 	if upRes.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to upload attachment, server responded with: %s",
-			res.Status)
+		return "", statusError(fmt.Errorf(
+			"failed to upload attachment, server responded with: %s",
+			upRes.Status), upRes.StatusCode)
+	}
+
+	// The body is streamed from the download, so the uploaded bytes are
+	// the bytes that were read for the upload.
+	uploaded = content.n
+
+	// The data is streamed, so it can only be verified once the upload
+	// is done, but the upload isn't used unless it has been verified.
+	if w.verifyAttachments {
+		err := body.Verify(res)
+		if err != nil {
+			return "", Retryable(fmt.Errorf("verify transfer: %w", err))
+		}
 	}
 
 	return upload.Id, nil
 }
 
+// statusError marks errors caused by server errors as retryable.
+func statusError(err error, statusCode int) error {
+	if statusCode >= http.StatusInternalServerError {
+		return Retryable(err)
+	}
+
+	return err
+}
+
+// shouldReplicateAttachment checks if the attachment should be replicated.
+// Attachment references can use either the source or the target document type.
 func (w *Worker) shouldReplicateAttachment(name string, docType string) bool {
 	if w.allAttachments {
 		return true
 	}
 
+	targetType := w.targetType(docType)
+
 	for _, r := range w.incAttachments {
-		if name == r.Name && docType == r.DocType {
+		if !r.Matches(name) {
+			continue
+		}
+
+		if docType == r.DocType || targetType == r.DocType {
 			return true
 		}
 	}
@@ -520,12 +1887,209 @@ func (w *Worker) shouldReplicateAttachment(name string, docType string) bool {
 }
 
 func isSchedulerUsable(status, creator string) bool {
-	return status == "usable" && creator == "internal://scheduler"
+	return status == statusUsable && creator == "internal://scheduler"
+}
+
+// skipSchedulerUsable returns true for "usable" statuses set by the source
+// scheduler that shouldn't be replicated, as the target runs its own
+// scheduler.
+func (w *Worker) skipSchedulerUsable(status, creator string) bool {
+	return isSchedulerUsable(status, creator) &&
+		!w.withheld.replicatesSchedulerUsable()
 }
 
 func (w *Worker) handleDeleteEvent(
 	ctx context.Context, evt *repository.EventlogItem, docUUID uuid.UUID,
+) error {
+	if w.isSoftDelete(evt) {
+		return w.softDelete(ctx, evt, docUUID)
+	}
+
+	meta := map[string]string{
+		deleteRecordMetaKey: strconv.FormatInt(evt.DeleteRecordId, 10),
+	}
+
+	return w.removeDocument(ctx, docUUID,
+		w.provenance.Apply(meta, evt, time.Now()))
+}
+
+// deleteRecordMetaKey is the delete meta key for the ID of the delete record in
+// the source.
+const deleteRecordMetaKey = "original_delete_record"
+
+// handleMetaDocumentEvent replicates changes to meta documents. Meta documents
+// are written through their main document, and only if the main document has
+// been replicated to the target. Meta document versions aren't recorded in the
+// version mappings as they are independent of the main document versions.
+func (w *Worker) handleMetaDocumentEvent(
+	ctx context.Context, evt *repository.EventlogItem, caughtUp bool,
+) error {
+	mainUUID, err := uuid.Parse(evt.MainDocument)
+	if err != nil {
+		return fmt.Errorf("invalid main document UUID: %w", err)
+	}
+
+	targetMainUUID := w.uuidMapping.Map(mainUUID)
+
+	q := postgres.New(w.db)
+
+	_, err = q.GetDocumentVersion(ctx,
+		postgres.GetDocumentVersionParams{
+			TargetName: w.name,
+			ID:         targetMainUUID,
+		})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("main document hasn't been replicated: %w", ErrSkipped)
+	} else if err != nil {
+		return fmt.Errorf("get main document target version: %w", err)
+	}
+
+	if evt.Event == TypeDeleteDocument {
+		return w.clearMetaDocument(ctx, targetMainUUID.String())
+	}
+
+	// Status and ACL changes are tracked on the main document.
+	if caughtUp && evt.Event != TypeDocumentVersion &&
+		evt.Event != TypeRestoreFinished {
+		return fmt.Errorf("unhandled meta document event type %q: %w",
+			evt.Event, ErrSkipped)
+	}
+
+	res, err := w.source.Get(ctx, &repository.GetDocumentRequest{
+		Uuid:         evt.MainDocument,
+		MetaDocument: repository.GetMetaDoc_META_ONLY,
+	})
+	if elephantine.IsTwirpErrorCode(err, twirp.NotFound) {
+		// The meta document has been removed since the event was
+		// emitted.
+		return w.clearMetaDocument(ctx, targetMainUUID.String())
+	} else if err != nil {
+		return fmt.Errorf("get source meta document: %w", err)
+	}
+
+	if res.Meta == nil || res.Meta.Document == nil {
+		return w.clearMetaDocument(ctx, targetMainUUID.String())
+	}
+
+	update := repository.UpdateRequest{
+		Uuid:               targetMainUUID.String(),
+		Document:           res.Meta.Document,
+		UpdateMetaDocument: true,
+		ImportDirective:    w.importDirective(evt, nil),
+	}
+
+	metaUUID, err := uuid.Parse(update.Document.Uuid)
+	if err != nil {
+		return fmt.Errorf("invalid meta document UUID: %w", err)
+	}
+
+	err = w.mapDocument(ctx, q, update.Document, w.uuidMapping.Map(metaUUID))
+	if err != nil {
+		return err
+	}
+
+	if w.dryRun {
+		w.logDryRunUpdate(ctx, evt, TypeDocumentVersion, &update)
+
+		return nil
+	}
+
+	updateCtx, span := w.tracer.Start(ctx, "update target")
+
+	_, err = w.target.Update(updateCtx, &update)
+
+	endSpan(span, err)
+
+	if elephantine.IsTwirpErrorCode(err, twirp.FailedPrecondition) {
+		return ErrConflict
+	} else if err != nil {
+		return fmt.Errorf("update target meta document: %w", targetError(err))
+	}
+
+	return nil
+}
+
+// clearMetaDocument deletes the meta document of the main document in the
+// target, if it has one. Expects the target UUID of the main document.
+func (w *Worker) clearMetaDocument(ctx context.Context, mainUUID string) error {
+	res, err := w.target.Get(ctx, &repository.GetDocumentRequest{
+		Uuid:         mainUUID,
+		MetaDocument: repository.GetMetaDoc_META_ONLY,
+	})
+	if elephantine.IsTwirpErrorCode(err, twirp.NotFound) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("get target meta document: %w", targetError(err))
+	}
+
+	if res.Meta == nil || res.Meta.Document == nil {
+		return nil
+	}
+
+	if w.dryRun {
+		w.logger.InfoContext(ctx, "dry run: would delete meta document in target",
+			elephantine.LogKeyDocumentUUID, res.Meta.Document.Uuid,
+			"main_document", mainUUID,
+		)
+
+		return nil
+	}
+
+	_, err = w.target.Delete(ctx, &repository.DeleteDocumentRequest{
+		Uuid: res.Meta.Document.Uuid,
+	})
+	if err != nil {
+		return fmt.Errorf("delete target meta document: %w", targetError(err))
+	}
+
+	return nil
+}
+
+// removeExcluded deletes a document that no longer should be replicated from
+// the target, if it has been replicated. The reason is used for logging.
+func (w *Worker) removeExcluded(
+	ctx context.Context, docUUID uuid.UUID, reason string,
+) error {
+	_, err := postgres.New(w.db).GetDocumentVersion(ctx,
+		postgres.GetDocumentVersionParams{
+			TargetName: w.name,
+			ID:         w.uuidMapping.Map(docUUID),
+		})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("get current target version: %w", err)
+	}
+
+	err = w.removeDocument(ctx, docUUID, nil)
+	if err != nil {
+		return err
+	}
+
+	w.logger.InfoContext(ctx,
+		"deleted document in target that no longer should be replicated",
+		elephantine.LogKeyDocumentUUID, docUUID,
+		"reason", reason,
+	)
+
+	return nil
+}
+
+// removeDocument deletes the document from the target and removes its version
+// mappings. Expects the source UUID of the document.
+func (w *Worker) removeDocument(
+	ctx context.Context, sourceUUID uuid.UUID, meta map[string]string,
 ) (outErr error) {
+	docUUID := w.uuidMapping.Map(sourceUUID)
+
+	if w.dryRun {
+		w.logger.InfoContext(ctx, "dry run: would delete document in target",
+			elephantine.LogKeyDocumentUUID, docUUID,
+		)
+
+		return nil
+	}
+
 	tx, err := w.db.Begin(ctx)
 	if err != nil {
 		return fmt.Errorf("begin transaction: %w", err)
@@ -552,13 +2116,11 @@ func (w *Worker) handleDeleteEvent(
 	}
 
 	_, err = w.target.Delete(ctx, &repository.DeleteDocumentRequest{
-		Uuid: evt.Uuid,
-		Meta: map[string]string{
-			"original_delete_record": strconv.FormatInt(evt.DeleteRecordId, 10),
-		},
+		Uuid: docUUID.String(),
+		Meta: meta,
 	})
 	if err != nil {
-		return fmt.Errorf("delete document: %w", err)
+		return fmt.Errorf("delete document: %w", targetError(err))
 	}
 
 	err = tx.Commit(ctx)
@@ -568,3 +2130,32 @@ func (w *Worker) handleDeleteEvent(
 
 	return nil
 }
+
+// purgeMappingsBefore removes the version mappings that were recorded for
+// events before the given event.
+func (w *Worker) purgeMappingsBefore(ctx context.Context, eventID int64) error {
+	if w.dryRun {
+		w.logger.InfoContext(ctx,
+			"dry run: would remove version mappings before start event",
+			elephantine.LogKeyEventID, eventID)
+
+		return nil
+	}
+
+	q := postgres.New(w.db)
+
+	removed, err := q.RemoveMappingsBeforeEvent(ctx,
+		postgres.RemoveMappingsBeforeEventParams{
+			TargetName: w.name,
+			EventID:    eventID,
+		})
+	if err != nil {
+		return fmt.Errorf("remove version mappings before start event: %w", err)
+	}
+
+	w.logger.InfoContext(ctx, "removed version mappings before start event",
+		elephantine.LogKeyEventID, eventID,
+		"removed", removed)
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ttab/elephant-api/repository"
+	"github.com/ttab/elephantine"
+	"github.com/twitchtv/twirp"
+	"google.golang.org/protobuf/proto"
+)
+
+// skipWorkflow returns true if the event is a workflow event that shouldn't be
+// handled. Workflows describe effects rather than changes, so they are only
+// replicated when enabled, and if the sink supports them.
+func (w *Worker) skipWorkflow(evt *repository.EventlogItem) bool {
+	return evt.Event == TypeWorkflow &&
+		(!w.replicateWorkflows || w.targetWorkflows == nil)
+}
+
+// handleWorkflowEvent makes sure that the target has the same workflow
+// configuration as the source for the type of the document. The workflow
+// state of a document can't be written directly, it's derived from its
+// statuses, so the target will get the same workflow state as the source as
+// long as the statuses and the workflow configuration are replicated.
+func (w *Worker) handleWorkflowEvent(
+	ctx context.Context, evt *repository.EventlogItem,
+) error {
+	srcRes, err := w.sourceWorkflows.GetWorkflow(ctx,
+		&repository.GetWorkflowRequest{
+			Type: evt.Type,
+		})
+	if elephantine.IsTwirpErrorCode(err, twirp.NotFound) {
+		return fmt.Errorf("type has no workflow in source: %w", ErrSkipped)
+	} else if err != nil {
+		return fmt.Errorf("get source workflow: %w", err)
+	}
+
+	if w.workflowReplicated(evt.Type, srcRes.Workflow) {
+		return fmt.Errorf("workflow already replicated: %w", ErrSkipped)
+	}
+
+	targetType := w.targetType(evt.Type)
+
+	targetRes, err := w.targetWorkflows.GetWorkflow(ctx,
+		&repository.GetWorkflowRequest{
+			Type: targetType,
+		})
+
+	switch {
+	case elephantine.IsTwirpErrorCode(err, twirp.NotFound):
+	case err != nil:
+		return fmt.Errorf("get target workflow: %w", err)
+	case proto.Equal(targetRes.Workflow, srcRes.Workflow):
+		w.setWorkflowReplicated(evt.Type, srcRes.Workflow)
+
+		return fmt.Errorf("workflow already in sync: %w", ErrSkipped)
+	}
+
+	if w.dryRun {
+		w.logger.InfoContext(ctx, "dry run: would set workflow",
+			elephantine.LogKeyEventID, evt.Id,
+			elephantine.LogKeyDocumentUUID, evt.Uuid,
+			"type", targetType,
+		)
+
+		return nil
+	}
+
+	_, err = w.targetWorkflows.SetWorkflow(ctx, &repository.SetWorkflowRequest{
+		Type:     targetType,
+		Workflow: srcRes.Workflow,
+	})
+	if err != nil {
+		return fmt.Errorf("set target workflow: %w", err)
+	}
+
+	w.setWorkflowReplicated(evt.Type, srcRes.Workflow)
+
+	w.logger.InfoContext(ctx, "replicated workflow",
+		elephantine.LogKeyEventID, evt.Id,
+		"type", targetType,
+	)
+
+	return nil
+}
+
+func (w *Worker) workflowReplicated(
+	docType string, wf *repository.DocumentWorkflow,
+) bool {
+	w.workflowMu.Lock()
+	defer w.workflowMu.Unlock()
+
+	replicated, ok := w.workflows[docType]
+
+	return ok && proto.Equal(replicated, wf)
+}
+
+func (w *Worker) setWorkflowReplicated(
+	docType string, wf *repository.DocumentWorkflow,
+) {
+	w.workflowMu.Lock()
+	defer w.workflowMu.Unlock()
+
+	if w.workflows == nil {
+		w.workflows = make(map[string]*repository.DocumentWorkflow)
+	}
+
+	w.workflows[docType] = wf
+}
@@ -13,6 +13,8 @@ type Document struct {
 	ID            uuid.UUID
 	TargetVersion int64
 	TargetName    string
+	Language      pgtype.Text
+	LastEvent     pgtype.Int8
 }
 
 type JobLock struct {
@@ -22,6 +24,40 @@ type JobLock struct {
 	Iteration int64
 }
 
+type ReplicationConflict struct {
+	TargetName      string
+	EventID         int64
+	ID              uuid.UUID
+	EventType       string
+	ExpectedVersion int64
+	TargetVersion   int64
+	Created         pgtype.Timestamptz
+	Shard           string
+}
+
+type ReplicationDeadletter struct {
+	TargetName    string
+	EventID       int64
+	Event         []byte
+	UpdateType    string
+	TargetVersion int64
+	Error         string
+	Created       pgtype.Timestamptz
+	Shard         string
+}
+
+type ReplicationError struct {
+	TargetName string
+	EventID    int64
+	ID         uuid.UUID
+	EventType  string
+	Error      string
+	Attempts   int32
+	Created    pgtype.Timestamptz
+	FirstSeen  pgtype.Timestamptz
+	Shard      string
+}
+
 type ReplicationTarget struct {
 	Name          string
 	RepositoryUrl string
@@ -40,8 +76,9 @@ type SchemaVersion struct {
 }
 
 type State struct {
-	Name  string
-	Value []byte
+	Name     string
+	Value    []byte
+	Revision int64
 }
 
 type VersionMapping struct {
@@ -50,4 +87,5 @@ type VersionMapping struct {
 	TargetVersion int64
 	Created       pgtype.Timestamptz
 	TargetName    string
+	EventID       pgtype.Int8
 }
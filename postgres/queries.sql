@@ -1,13 +1,30 @@
 -- name: SetState :exec
-INSERT INTO state(name, value)
-       VALUES (@name, @value)
+INSERT INTO state(name, value, revision)
+       VALUES (@name, @value, 1)
 ON CONFLICT (name)
-   DO UPDATE SET value = @value;
+   DO UPDATE SET value = @value, revision = state.revision + 1;
+
+-- name: GetMinLogPosition :one
+SELECT COALESCE(min((value->>'Position')::bigint), 0)::bigint
+FROM state
+WHERE name = ANY(@names::text[]);
 
 -- name: GetState :one
 SELECT value FROM state
 WHERE name = @name;
 
+-- name: GetStateWithRevision :one
+SELECT value, revision FROM state
+WHERE name = @name;
+
+-- name: CompareAndSetState :one
+INSERT INTO state(name, value, revision)
+       VALUES (@name, @value, 1)
+ON CONFLICT (name)
+   DO UPDATE SET value = @value, revision = state.revision + 1
+   WHERE state.revision = @expected_revision::bigint
+RETURNING revision;
+
 -- name: SetDocumentVersion :exec
 INSERT INTO document(target_name, id, target_version)
 VALUES(@target_name, @id, @target_version)
@@ -18,12 +35,33 @@ ON CONFLICT (target_name, id) DO UPDATE
 SELECT target_version FROM document
 WHERE target_name = @target_name AND id = @id;
 
+-- name: SetDocumentLanguage :exec
+UPDATE document SET language = @language
+WHERE target_name = @target_name AND id = @id;
+
+-- name: GetDocumentLanguage :one
+SELECT language FROM document
+WHERE target_name = @target_name AND id = @id;
+
+-- name: SetDocumentEvent :exec
+UPDATE document SET last_event = @last_event
+WHERE target_name = @target_name AND id = @id;
+
+-- name: GetDocumentEvent :one
+SELECT last_event FROM document
+WHERE target_name = @target_name AND id = @id;
+
+-- name: ClearDocumentEventsAfter :exec
+UPDATE document SET last_event = NULL
+WHERE target_name = @target_name AND last_event > @event_id::bigint;
+
 -- name: AddVersionMapping :exec
-INSERT INTO version_mapping(target_name, id, source_version, target_version, created)
-VALUES (@target_name, @id, @source_version, @target_version, @created)
+INSERT INTO version_mapping(target_name, id, source_version, target_version, created, event_id)
+VALUES (@target_name, @id, @source_version, @target_version, @created, @event_id)
 ON CONFLICT (target_name, id, source_version) DO UPDATE
    SET target_version = excluded.target_version,
-       created = excluded.created;
+       created = excluded.created,
+       event_id = excluded.event_id;
 
 -- name: GetTargetVersion :one
 SELECT target_version
@@ -34,6 +72,10 @@ WHERE target_name = @target_name AND id = @id AND source_version = @source_versi
 DELETE FROM version_mapping
 WHERE created < @cutoff;
 
+-- name: RemoveMappingsBeforeEvent :execrows
+DELETE FROM version_mapping
+WHERE target_name = @target_name AND event_id < @event_id::bigint;
+
 -- name: RemoveDocument :exec
 DELETE FROM document WHERE target_name = @target_name AND id = @id;
 
@@ -67,6 +109,12 @@ FROM replication_target
 WHERE enabled = true
 ORDER BY name;
 
+-- name: ListAllTargets :many
+SELECT name, repository_url, oidc_config, client_id, client_secret,
+       start_from, config, enabled, created, updated
+FROM replication_target
+ORDER BY name;
+
 -- name: ListTargets :many
 SELECT name, repository_url, enabled
 FROM replication_target
@@ -91,3 +139,132 @@ DELETE FROM version_mapping WHERE target_name = @target_name;
 
 -- name: RemoveTargetState :exec
 DELETE FROM state WHERE name = @name;
+
+-- name: ListStatesWithPrefix :many
+SELECT name, value FROM state
+WHERE starts_with(name, @prefix::text) AND name > @after::text
+ORDER BY name
+LIMIT @row_limit;
+
+-- name: RemoveStatesWithPrefix :exec
+DELETE FROM state WHERE starts_with(name, @prefix::text);
+
+-- name: ListTargetMappings :many
+SELECT id, source_version, target_version, created, event_id
+FROM version_mapping
+WHERE target_name = @target_name
+      AND (id, source_version) > (@after_id::uuid, @after_version::bigint)
+ORDER BY id, source_version
+LIMIT @row_limit;
+
+-- name: HasReplicationData :one
+SELECT EXISTS(SELECT 1 FROM replication_target)
+       OR EXISTS(SELECT 1 FROM document)
+       OR EXISTS(SELECT 1 FROM version_mapping);
+
+-- name: ListVersionMappings :many
+SELECT source_version, target_version, created
+FROM version_mapping
+WHERE target_name = @target_name AND id = @id AND source_version > @after
+ORDER BY source_version
+LIMIT @row_limit;
+
+-- name: AddReplicationError :exec
+INSERT INTO replication_errors(target_name, shard, event_id, id, event_type, error, attempts, created, first_seen)
+VALUES (@target_name, @shard, @event_id, @id, @event_type, @error, @attempts, @created, @created)
+ON CONFLICT (target_name, shard, event_id) DO UPDATE
+   SET error = excluded.error,
+       attempts = excluded.attempts,
+       created = excluded.created;
+
+-- name: ListReplicationErrors :many
+SELECT event_id, id, event_type, error, attempts, created, first_seen
+FROM replication_errors
+WHERE target_name = @target_name AND shard = @shard AND event_id > @after
+ORDER BY event_id
+LIMIT @row_limit;
+
+-- name: DocumentHasErrors :one
+SELECT EXISTS(
+       SELECT 1 FROM replication_errors
+       WHERE target_name = @target_name AND id = @id
+);
+
+-- name: RemoveDocumentErrors :exec
+DELETE FROM replication_errors
+WHERE target_name = @target_name AND id = @id;
+
+-- name: RemoveTargetErrors :exec
+DELETE FROM replication_errors WHERE target_name = @target_name;
+
+-- name: AddDeadLetter :exec
+INSERT INTO replication_deadletter(
+       target_name, shard, event_id, event, update_type, target_version,
+       error, created
+) VALUES (
+       @target_name, @shard, @event_id, @event, @update_type, @target_version,
+       @error, @created
+)
+ON CONFLICT (target_name, shard, event_id) DO UPDATE
+   SET event = excluded.event,
+       update_type = excluded.update_type,
+       target_version = excluded.target_version,
+       error = excluded.error,
+       created = excluded.created;
+
+-- name: RemoveTargetDeadLetters :exec
+DELETE FROM replication_deadletter WHERE target_name = @target_name;
+
+-- name: AddReplicationConflict :exec
+INSERT INTO replication_conflicts(
+       target_name, shard, event_id, id, event_type, expected_version,
+       target_version, created
+) VALUES (
+       @target_name, @shard, @event_id, @id, @event_type, @expected_version,
+       @target_version, @created
+)
+ON CONFLICT (target_name, shard, event_id) DO UPDATE
+   SET expected_version = excluded.expected_version,
+       target_version = excluded.target_version,
+       created = excluded.created;
+
+-- name: ListReplicationConflicts :many
+SELECT event_id, id, event_type, expected_version, target_version, created
+FROM replication_conflicts
+WHERE target_name = @target_name AND shard = @shard
+      AND (@before::bigint = 0 OR event_id < @before::bigint)
+ORDER BY event_id DESC
+LIMIT @row_limit;
+
+-- name: RemoveTargetConflicts :exec
+DELETE FROM replication_conflicts WHERE target_name = @target_name;
+
+-- name: GetReplicatedDocuments :many
+SELECT id FROM document
+WHERE target_name = @target_name AND id = ANY(@ids::uuid[]);
+
+-- name: SampleDocuments :many
+(
+        SELECT id, target_version FROM document
+        WHERE target_name = @target_name AND id >= @start
+        ORDER BY id
+        LIMIT @sample_size
+) UNION ALL (
+        SELECT id, target_version FROM document
+        WHERE target_name = @target_name AND id < @start
+        ORDER BY id
+        LIMIT @sample_size
+)
+LIMIT @sample_size;
+
+-- name: ListDocuments :many
+SELECT id, target_version FROM document
+WHERE target_name = @target_name AND id > @after
+ORDER BY id
+LIMIT @row_limit;
+
+-- name: ExportDocuments :many
+SELECT id, target_version, language FROM document
+WHERE target_name = @target_name AND id > @after
+ORDER BY id
+LIMIT @row_limit;
@@ -12,12 +12,127 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const addDeadLetter = `-- name: AddDeadLetter :exec
+INSERT INTO replication_deadletter(
+       target_name, shard, event_id, event, update_type, target_version,
+       error, created
+) VALUES (
+       $1, $2, $3, $4, $5, $6,
+       $7, $8
+)
+ON CONFLICT (target_name, shard, event_id) DO UPDATE
+   SET event = excluded.event,
+       update_type = excluded.update_type,
+       target_version = excluded.target_version,
+       error = excluded.error,
+       created = excluded.created
+`
+
+type AddDeadLetterParams struct {
+	TargetName    string
+	Shard         string
+	EventID       int64
+	Event         []byte
+	UpdateType    string
+	TargetVersion int64
+	Error         string
+	Created       pgtype.Timestamptz
+}
+
+func (q *Queries) AddDeadLetter(ctx context.Context, arg AddDeadLetterParams) error {
+	_, err := q.db.Exec(ctx, addDeadLetter,
+		arg.TargetName,
+		arg.Shard,
+		arg.EventID,
+		arg.Event,
+		arg.UpdateType,
+		arg.TargetVersion,
+		arg.Error,
+		arg.Created,
+	)
+	return err
+}
+
+const addReplicationConflict = `-- name: AddReplicationConflict :exec
+INSERT INTO replication_conflicts(
+       target_name, shard, event_id, id, event_type, expected_version,
+       target_version, created
+) VALUES (
+       $1, $2, $3, $4, $5, $6,
+       $7, $8
+)
+ON CONFLICT (target_name, shard, event_id) DO UPDATE
+   SET expected_version = excluded.expected_version,
+       target_version = excluded.target_version,
+       created = excluded.created
+`
+
+type AddReplicationConflictParams struct {
+	TargetName      string
+	Shard           string
+	EventID         int64
+	ID              uuid.UUID
+	EventType       string
+	ExpectedVersion int64
+	TargetVersion   int64
+	Created         pgtype.Timestamptz
+}
+
+func (q *Queries) AddReplicationConflict(ctx context.Context, arg AddReplicationConflictParams) error {
+	_, err := q.db.Exec(ctx, addReplicationConflict,
+		arg.TargetName,
+		arg.Shard,
+		arg.EventID,
+		arg.ID,
+		arg.EventType,
+		arg.ExpectedVersion,
+		arg.TargetVersion,
+		arg.Created,
+	)
+	return err
+}
+
+const addReplicationError = `-- name: AddReplicationError :exec
+INSERT INTO replication_errors(target_name, shard, event_id, id, event_type, error, attempts, created, first_seen)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8)
+ON CONFLICT (target_name, shard, event_id) DO UPDATE
+   SET error = excluded.error,
+       attempts = excluded.attempts,
+       created = excluded.created
+`
+
+type AddReplicationErrorParams struct {
+	TargetName string
+	Shard      string
+	EventID    int64
+	ID         uuid.UUID
+	EventType  string
+	Error      string
+	Attempts   int32
+	Created    pgtype.Timestamptz
+}
+
+func (q *Queries) AddReplicationError(ctx context.Context, arg AddReplicationErrorParams) error {
+	_, err := q.db.Exec(ctx, addReplicationError,
+		arg.TargetName,
+		arg.Shard,
+		arg.EventID,
+		arg.ID,
+		arg.EventType,
+		arg.Error,
+		arg.Attempts,
+		arg.Created,
+	)
+	return err
+}
+
 const addVersionMapping = `-- name: AddVersionMapping :exec
-INSERT INTO version_mapping(target_name, id, source_version, target_version, created)
-VALUES ($1, $2, $3, $4, $5)
+INSERT INTO version_mapping(target_name, id, source_version, target_version, created, event_id)
+VALUES ($1, $2, $3, $4, $5, $6)
 ON CONFLICT (target_name, id, source_version) DO UPDATE
    SET target_version = excluded.target_version,
-       created = excluded.created
+       created = excluded.created,
+       event_id = excluded.event_id
 `
 
 type AddVersionMappingParams struct {
@@ -26,6 +141,7 @@ type AddVersionMappingParams struct {
 	SourceVersion int64
 	TargetVersion int64
 	Created       pgtype.Timestamptz
+	EventID       pgtype.Int8
 }
 
 func (q *Queries) AddVersionMapping(ctx context.Context, arg AddVersionMappingParams) error {
@@ -35,10 +151,48 @@ func (q *Queries) AddVersionMapping(ctx context.Context, arg AddVersionMappingPa
 		arg.SourceVersion,
 		arg.TargetVersion,
 		arg.Created,
+		arg.EventID,
 	)
 	return err
 }
 
+const clearDocumentEventsAfter = `-- name: ClearDocumentEventsAfter :exec
+UPDATE document SET last_event = NULL
+WHERE target_name = $1 AND last_event > $2::bigint
+`
+
+type ClearDocumentEventsAfterParams struct {
+	TargetName string
+	EventID    int64
+}
+
+func (q *Queries) ClearDocumentEventsAfter(ctx context.Context, arg ClearDocumentEventsAfterParams) error {
+	_, err := q.db.Exec(ctx, clearDocumentEventsAfter, arg.TargetName, arg.EventID)
+	return err
+}
+
+const compareAndSetState = `-- name: CompareAndSetState :one
+INSERT INTO state(name, value, revision)
+       VALUES ($1, $2, 1)
+ON CONFLICT (name)
+   DO UPDATE SET value = $2, revision = state.revision + 1
+   WHERE state.revision = $3::bigint
+RETURNING revision
+`
+
+type CompareAndSetStateParams struct {
+	Name             string
+	Value            []byte
+	ExpectedRevision int64
+}
+
+func (q *Queries) CompareAndSetState(ctx context.Context, arg CompareAndSetStateParams) (int64, error) {
+	row := q.db.QueryRow(ctx, compareAndSetState, arg.Name, arg.Value, arg.ExpectedRevision)
+	var revision int64
+	err := row.Scan(&revision)
+	return revision, err
+}
+
 const deleteTarget = `-- name: DeleteTarget :exec
 DELETE FROM replication_target WHERE name = $1
 `
@@ -48,6 +202,98 @@ func (q *Queries) DeleteTarget(ctx context.Context, name string) error {
 	return err
 }
 
+const documentHasErrors = `-- name: DocumentHasErrors :one
+SELECT EXISTS(
+       SELECT 1 FROM replication_errors
+       WHERE target_name = $1 AND id = $2
+)
+`
+
+type DocumentHasErrorsParams struct {
+	TargetName string
+	ID         uuid.UUID
+}
+
+func (q *Queries) DocumentHasErrors(ctx context.Context, arg DocumentHasErrorsParams) (bool, error) {
+	row := q.db.QueryRow(ctx, documentHasErrors, arg.TargetName, arg.ID)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const exportDocuments = `-- name: ExportDocuments :many
+SELECT id, target_version, language FROM document
+WHERE target_name = $1 AND id > $2
+ORDER BY id
+LIMIT $3
+`
+
+type ExportDocumentsParams struct {
+	TargetName string
+	After      uuid.UUID
+	RowLimit   int32
+}
+
+type ExportDocumentsRow struct {
+	ID            uuid.UUID
+	TargetVersion int64
+	Language      pgtype.Text
+}
+
+func (q *Queries) ExportDocuments(ctx context.Context, arg ExportDocumentsParams) ([]ExportDocumentsRow, error) {
+	rows, err := q.db.Query(ctx, exportDocuments, arg.TargetName, arg.After, arg.RowLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ExportDocumentsRow
+	for rows.Next() {
+		var i ExportDocumentsRow
+		if err := rows.Scan(&i.ID, &i.TargetVersion, &i.Language); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getDocumentEvent = `-- name: GetDocumentEvent :one
+SELECT last_event FROM document
+WHERE target_name = $1 AND id = $2
+`
+
+type GetDocumentEventParams struct {
+	TargetName string
+	ID         uuid.UUID
+}
+
+func (q *Queries) GetDocumentEvent(ctx context.Context, arg GetDocumentEventParams) (pgtype.Int8, error) {
+	row := q.db.QueryRow(ctx, getDocumentEvent, arg.TargetName, arg.ID)
+	var last_event pgtype.Int8
+	err := row.Scan(&last_event)
+	return last_event, err
+}
+
+const getDocumentLanguage = `-- name: GetDocumentLanguage :one
+SELECT language FROM document
+WHERE target_name = $1 AND id = $2
+`
+
+type GetDocumentLanguageParams struct {
+	TargetName string
+	ID         uuid.UUID
+}
+
+func (q *Queries) GetDocumentLanguage(ctx context.Context, arg GetDocumentLanguageParams) (pgtype.Text, error) {
+	row := q.db.QueryRow(ctx, getDocumentLanguage, arg.TargetName, arg.ID)
+	var language pgtype.Text
+	err := row.Scan(&language)
+	return language, err
+}
+
 const getDocumentVersion = `-- name: GetDocumentVersion :one
 SELECT target_version FROM document
 WHERE target_name = $1 AND id = $2
@@ -65,6 +311,49 @@ func (q *Queries) GetDocumentVersion(ctx context.Context, arg GetDocumentVersion
 	return target_version, err
 }
 
+const getMinLogPosition = `-- name: GetMinLogPosition :one
+SELECT COALESCE(min((value->>'Position')::bigint), 0)::bigint
+FROM state
+WHERE name = ANY($1::text[])
+`
+
+func (q *Queries) GetMinLogPosition(ctx context.Context, names []string) (int64, error) {
+	row := q.db.QueryRow(ctx, getMinLogPosition, names)
+	var column_1 int64
+	err := row.Scan(&column_1)
+	return column_1, err
+}
+
+const getReplicatedDocuments = `-- name: GetReplicatedDocuments :many
+SELECT id FROM document
+WHERE target_name = $1 AND id = ANY($2::uuid[])
+`
+
+type GetReplicatedDocumentsParams struct {
+	TargetName string
+	Ids        []uuid.UUID
+}
+
+func (q *Queries) GetReplicatedDocuments(ctx context.Context, arg GetReplicatedDocumentsParams) ([]uuid.UUID, error) {
+	rows, err := q.db.Query(ctx, getReplicatedDocuments, arg.TargetName, arg.Ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getState = `-- name: GetState :one
 SELECT value FROM state
 WHERE name = $1
@@ -77,6 +366,23 @@ func (q *Queries) GetState(ctx context.Context, name string) ([]byte, error) {
 	return value, err
 }
 
+const getStateWithRevision = `-- name: GetStateWithRevision :one
+SELECT value, revision FROM state
+WHERE name = $1
+`
+
+type GetStateWithRevisionRow struct {
+	Value    []byte
+	Revision int64
+}
+
+func (q *Queries) GetStateWithRevision(ctx context.Context, name string) (GetStateWithRevisionRow, error) {
+	row := q.db.QueryRow(ctx, getStateWithRevision, name)
+	var i GetStateWithRevisionRow
+	err := row.Scan(&i.Value, &i.Revision)
+	return i, err
+}
+
 const getTarget = `-- name: GetTarget :one
 SELECT name, repository_url, oidc_config, client_id, client_secret,
        start_from, config, enabled, created, updated
@@ -121,6 +427,95 @@ func (q *Queries) GetTargetVersion(ctx context.Context, arg GetTargetVersionPara
 	return target_version, err
 }
 
+const hasReplicationData = `-- name: HasReplicationData :one
+SELECT EXISTS(SELECT 1 FROM replication_target)
+       OR EXISTS(SELECT 1 FROM document)
+       OR EXISTS(SELECT 1 FROM version_mapping)
+`
+
+func (q *Queries) HasReplicationData(ctx context.Context) (bool, error) {
+	row := q.db.QueryRow(ctx, hasReplicationData)
+	var column_1 bool
+	err := row.Scan(&column_1)
+	return column_1, err
+}
+
+const listAllTargets = `-- name: ListAllTargets :many
+SELECT name, repository_url, oidc_config, client_id, client_secret,
+       start_from, config, enabled, created, updated
+FROM replication_target
+ORDER BY name
+`
+
+func (q *Queries) ListAllTargets(ctx context.Context) ([]ReplicationTarget, error) {
+	rows, err := q.db.Query(ctx, listAllTargets)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ReplicationTarget
+	for rows.Next() {
+		var i ReplicationTarget
+		if err := rows.Scan(
+			&i.Name,
+			&i.RepositoryUrl,
+			&i.OidcConfig,
+			&i.ClientID,
+			&i.ClientSecret,
+			&i.StartFrom,
+			&i.Config,
+			&i.Enabled,
+			&i.Created,
+			&i.Updated,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDocuments = `-- name: ListDocuments :many
+SELECT id, target_version FROM document
+WHERE target_name = $1 AND id > $2
+ORDER BY id
+LIMIT $3
+`
+
+type ListDocumentsParams struct {
+	TargetName string
+	After      uuid.UUID
+	RowLimit   int32
+}
+
+type ListDocumentsRow struct {
+	ID            uuid.UUID
+	TargetVersion int64
+}
+
+func (q *Queries) ListDocuments(ctx context.Context, arg ListDocumentsParams) ([]ListDocumentsRow, error) {
+	rows, err := q.db.Query(ctx, listDocuments, arg.TargetName, arg.After, arg.RowLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListDocumentsRow
+	for rows.Next() {
+		var i ListDocumentsRow
+		if err := rows.Scan(&i.ID, &i.TargetVersion); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listEnabledTargets = `-- name: ListEnabledTargets :many
 SELECT name, repository_url, oidc_config, client_id, client_secret,
        start_from, config, enabled, created, updated
@@ -160,6 +555,214 @@ func (q *Queries) ListEnabledTargets(ctx context.Context) ([]ReplicationTarget,
 	return items, nil
 }
 
+const listReplicationConflicts = `-- name: ListReplicationConflicts :many
+SELECT event_id, id, event_type, expected_version, target_version, created
+FROM replication_conflicts
+WHERE target_name = $1 AND shard = $2
+      AND ($3::bigint = 0 OR event_id < $3::bigint)
+ORDER BY event_id DESC
+LIMIT $4
+`
+
+type ListReplicationConflictsParams struct {
+	TargetName string
+	Shard      string
+	Before     int64
+	RowLimit   int32
+}
+
+type ListReplicationConflictsRow struct {
+	EventID         int64
+	ID              uuid.UUID
+	EventType       string
+	ExpectedVersion int64
+	TargetVersion   int64
+	Created         pgtype.Timestamptz
+}
+
+func (q *Queries) ListReplicationConflicts(ctx context.Context, arg ListReplicationConflictsParams) ([]ListReplicationConflictsRow, error) {
+	rows, err := q.db.Query(ctx, listReplicationConflicts,
+		arg.TargetName,
+		arg.Shard,
+		arg.Before,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListReplicationConflictsRow
+	for rows.Next() {
+		var i ListReplicationConflictsRow
+		if err := rows.Scan(
+			&i.EventID,
+			&i.ID,
+			&i.EventType,
+			&i.ExpectedVersion,
+			&i.TargetVersion,
+			&i.Created,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listReplicationErrors = `-- name: ListReplicationErrors :many
+SELECT event_id, id, event_type, error, attempts, created, first_seen
+FROM replication_errors
+WHERE target_name = $1 AND shard = $2 AND event_id > $3
+ORDER BY event_id
+LIMIT $4
+`
+
+type ListReplicationErrorsParams struct {
+	TargetName string
+	Shard      string
+	After      int64
+	RowLimit   int32
+}
+
+type ListReplicationErrorsRow struct {
+	EventID   int64
+	ID        uuid.UUID
+	EventType string
+	Error     string
+	Attempts  int32
+	Created   pgtype.Timestamptz
+	FirstSeen pgtype.Timestamptz
+}
+
+func (q *Queries) ListReplicationErrors(ctx context.Context, arg ListReplicationErrorsParams) ([]ListReplicationErrorsRow, error) {
+	rows, err := q.db.Query(ctx, listReplicationErrors,
+		arg.TargetName,
+		arg.Shard,
+		arg.After,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListReplicationErrorsRow
+	for rows.Next() {
+		var i ListReplicationErrorsRow
+		if err := rows.Scan(
+			&i.EventID,
+			&i.ID,
+			&i.EventType,
+			&i.Error,
+			&i.Attempts,
+			&i.Created,
+			&i.FirstSeen,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listStatesWithPrefix = `-- name: ListStatesWithPrefix :many
+SELECT name, value FROM state
+WHERE starts_with(name, $1::text) AND name > $2::text
+ORDER BY name
+LIMIT $3
+`
+
+type ListStatesWithPrefixParams struct {
+	Prefix   string
+	After    string
+	RowLimit int32
+}
+
+type ListStatesWithPrefixRow struct {
+	Name  string
+	Value []byte
+}
+
+func (q *Queries) ListStatesWithPrefix(ctx context.Context, arg ListStatesWithPrefixParams) ([]ListStatesWithPrefixRow, error) {
+	rows, err := q.db.Query(ctx, listStatesWithPrefix, arg.Prefix, arg.After, arg.RowLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListStatesWithPrefixRow
+	for rows.Next() {
+		var i ListStatesWithPrefixRow
+		if err := rows.Scan(&i.Name, &i.Value); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTargetMappings = `-- name: ListTargetMappings :many
+SELECT id, source_version, target_version, created, event_id
+FROM version_mapping
+WHERE target_name = $1
+      AND (id, source_version) > ($2::uuid, $3::bigint)
+ORDER BY id, source_version
+LIMIT $4
+`
+
+type ListTargetMappingsParams struct {
+	TargetName   string
+	AfterID      uuid.UUID
+	AfterVersion int64
+	RowLimit     int32
+}
+
+type ListTargetMappingsRow struct {
+	ID            uuid.UUID
+	SourceVersion int64
+	TargetVersion int64
+	Created       pgtype.Timestamptz
+	EventID       pgtype.Int8
+}
+
+func (q *Queries) ListTargetMappings(ctx context.Context, arg ListTargetMappingsParams) ([]ListTargetMappingsRow, error) {
+	rows, err := q.db.Query(ctx, listTargetMappings,
+		arg.TargetName,
+		arg.AfterID,
+		arg.AfterVersion,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListTargetMappingsRow
+	for rows.Next() {
+		var i ListTargetMappingsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.SourceVersion,
+			&i.TargetVersion,
+			&i.Created,
+			&i.EventID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listTargets = `-- name: ListTargets :many
 SELECT name, repository_url, enabled
 FROM replication_target
@@ -192,6 +795,52 @@ func (q *Queries) ListTargets(ctx context.Context) ([]ListTargetsRow, error) {
 	return items, nil
 }
 
+const listVersionMappings = `-- name: ListVersionMappings :many
+SELECT source_version, target_version, created
+FROM version_mapping
+WHERE target_name = $1 AND id = $2 AND source_version > $3
+ORDER BY source_version
+LIMIT $4
+`
+
+type ListVersionMappingsParams struct {
+	TargetName string
+	ID         uuid.UUID
+	After      int64
+	RowLimit   int32
+}
+
+type ListVersionMappingsRow struct {
+	SourceVersion int64
+	TargetVersion int64
+	Created       pgtype.Timestamptz
+}
+
+func (q *Queries) ListVersionMappings(ctx context.Context, arg ListVersionMappingsParams) ([]ListVersionMappingsRow, error) {
+	rows, err := q.db.Query(ctx, listVersionMappings,
+		arg.TargetName,
+		arg.ID,
+		arg.After,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListVersionMappingsRow
+	for rows.Next() {
+		var i ListVersionMappingsRow
+		if err := rows.Scan(&i.SourceVersion, &i.TargetVersion, &i.Created); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const removeDocument = `-- name: RemoveDocument :exec
 DELETE FROM document WHERE target_name = $1 AND id = $2
 `
@@ -206,6 +855,21 @@ func (q *Queries) RemoveDocument(ctx context.Context, arg RemoveDocumentParams)
 	return err
 }
 
+const removeDocumentErrors = `-- name: RemoveDocumentErrors :exec
+DELETE FROM replication_errors
+WHERE target_name = $1 AND id = $2
+`
+
+type RemoveDocumentErrorsParams struct {
+	TargetName string
+	ID         uuid.UUID
+}
+
+func (q *Queries) RemoveDocumentErrors(ctx context.Context, arg RemoveDocumentErrorsParams) error {
+	_, err := q.db.Exec(ctx, removeDocumentErrors, arg.TargetName, arg.ID)
+	return err
+}
+
 const removeDocumentVersionMappings = `-- name: RemoveDocumentVersionMappings :exec
 DELETE FROM version_mapping
 WHERE target_name = $1 AND id = $2
@@ -221,6 +885,24 @@ func (q *Queries) RemoveDocumentVersionMappings(ctx context.Context, arg RemoveD
 	return err
 }
 
+const removeMappingsBeforeEvent = `-- name: RemoveMappingsBeforeEvent :execrows
+DELETE FROM version_mapping
+WHERE target_name = $1 AND event_id < $2::bigint
+`
+
+type RemoveMappingsBeforeEventParams struct {
+	TargetName string
+	EventID    int64
+}
+
+func (q *Queries) RemoveMappingsBeforeEvent(ctx context.Context, arg RemoveMappingsBeforeEventParams) (int64, error) {
+	result, err := q.db.Exec(ctx, removeMappingsBeforeEvent, arg.TargetName, arg.EventID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const removeOldMappings = `-- name: RemoveOldMappings :exec
 DELETE FROM version_mapping
 WHERE created < $1
@@ -231,6 +913,24 @@ func (q *Queries) RemoveOldMappings(ctx context.Context, cutoff pgtype.Timestamp
 	return err
 }
 
+const removeStatesWithPrefix = `-- name: RemoveStatesWithPrefix :exec
+DELETE FROM state WHERE starts_with(name, $1::text)
+`
+
+func (q *Queries) RemoveStatesWithPrefix(ctx context.Context, prefix string) error {
+	_, err := q.db.Exec(ctx, removeStatesWithPrefix, prefix)
+	return err
+}
+
+const removeTargetConflicts = `-- name: RemoveTargetConflicts :exec
+DELETE FROM replication_conflicts WHERE target_name = $1
+`
+
+func (q *Queries) RemoveTargetConflicts(ctx context.Context, targetName string) error {
+	_, err := q.db.Exec(ctx, removeTargetConflicts, targetName)
+	return err
+}
+
 const removeTargetData = `-- name: RemoveTargetData :exec
 DELETE FROM document WHERE target_name = $1
 `
@@ -240,6 +940,24 @@ func (q *Queries) RemoveTargetData(ctx context.Context, targetName string) error
 	return err
 }
 
+const removeTargetDeadLetters = `-- name: RemoveTargetDeadLetters :exec
+DELETE FROM replication_deadletter WHERE target_name = $1
+`
+
+func (q *Queries) RemoveTargetDeadLetters(ctx context.Context, targetName string) error {
+	_, err := q.db.Exec(ctx, removeTargetDeadLetters, targetName)
+	return err
+}
+
+const removeTargetErrors = `-- name: RemoveTargetErrors :exec
+DELETE FROM replication_errors WHERE target_name = $1
+`
+
+func (q *Queries) RemoveTargetErrors(ctx context.Context, targetName string) error {
+	_, err := q.db.Exec(ctx, removeTargetErrors, targetName)
+	return err
+}
+
 const removeTargetMappings = `-- name: RemoveTargetMappings :exec
 DELETE FROM version_mapping WHERE target_name = $1
 `
@@ -258,6 +976,84 @@ func (q *Queries) RemoveTargetState(ctx context.Context, name string) error {
 	return err
 }
 
+const sampleDocuments = `-- name: SampleDocuments :many
+(
+        SELECT id, target_version FROM document
+        WHERE target_name = $1 AND id >= $2
+        ORDER BY id
+        LIMIT $3
+) UNION ALL (
+        SELECT id, target_version FROM document
+        WHERE target_name = $1 AND id < $2
+        ORDER BY id
+        LIMIT $3
+)
+LIMIT $3
+`
+
+type SampleDocumentsParams struct {
+	TargetName string
+	Start      uuid.UUID
+	SampleSize int32
+}
+
+type SampleDocumentsRow struct {
+	ID            uuid.UUID
+	TargetVersion int64
+}
+
+func (q *Queries) SampleDocuments(ctx context.Context, arg SampleDocumentsParams) ([]SampleDocumentsRow, error) {
+	rows, err := q.db.Query(ctx, sampleDocuments, arg.TargetName, arg.Start, arg.SampleSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SampleDocumentsRow
+	for rows.Next() {
+		var i SampleDocumentsRow
+		if err := rows.Scan(&i.ID, &i.TargetVersion); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setDocumentEvent = `-- name: SetDocumentEvent :exec
+UPDATE document SET last_event = $1
+WHERE target_name = $2 AND id = $3
+`
+
+type SetDocumentEventParams struct {
+	LastEvent  pgtype.Int8
+	TargetName string
+	ID         uuid.UUID
+}
+
+func (q *Queries) SetDocumentEvent(ctx context.Context, arg SetDocumentEventParams) error {
+	_, err := q.db.Exec(ctx, setDocumentEvent, arg.LastEvent, arg.TargetName, arg.ID)
+	return err
+}
+
+const setDocumentLanguage = `-- name: SetDocumentLanguage :exec
+UPDATE document SET language = $1
+WHERE target_name = $2 AND id = $3
+`
+
+type SetDocumentLanguageParams struct {
+	Language   pgtype.Text
+	TargetName string
+	ID         uuid.UUID
+}
+
+func (q *Queries) SetDocumentLanguage(ctx context.Context, arg SetDocumentLanguageParams) error {
+	_, err := q.db.Exec(ctx, setDocumentLanguage, arg.Language, arg.TargetName, arg.ID)
+	return err
+}
+
 const setDocumentVersion = `-- name: SetDocumentVersion :exec
 INSERT INTO document(target_name, id, target_version)
 VALUES($1, $2, $3)
@@ -277,10 +1073,10 @@ func (q *Queries) SetDocumentVersion(ctx context.Context, arg SetDocumentVersion
 }
 
 const setState = `-- name: SetState :exec
-INSERT INTO state(name, value)
-       VALUES ($1, $2)
+INSERT INTO state(name, value, revision)
+       VALUES ($1, $2, 1)
 ON CONFLICT (name)
-   DO UPDATE SET value = $2
+   DO UPDATE SET value = $2, revision = state.revision + 1
 `
 
 type SetStateParams struct {
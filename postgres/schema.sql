@@ -29,7 +29,9 @@ SET default_table_access_method = heap;
 CREATE TABLE public.document (
     id uuid NOT NULL,
     target_version bigint NOT NULL,
-    target_name text DEFAULT 'default'::text NOT NULL
+    target_name text DEFAULT 'default'::text NOT NULL,
+    language text,
+    last_event bigint
 );
 
 
@@ -45,6 +47,55 @@ CREATE TABLE public.job_lock (
 );
 
 
+--
+-- Name: replication_conflicts; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE public.replication_conflicts (
+    target_name text NOT NULL,
+    event_id bigint NOT NULL,
+    id uuid NOT NULL,
+    event_type text NOT NULL,
+    expected_version bigint NOT NULL,
+    target_version bigint NOT NULL,
+    created timestamp with time zone NOT NULL,
+    shard text DEFAULT ''::text NOT NULL
+);
+
+
+--
+-- Name: replication_deadletter; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE public.replication_deadletter (
+    target_name text NOT NULL,
+    event_id bigint NOT NULL,
+    event jsonb NOT NULL,
+    update_type text NOT NULL,
+    target_version bigint NOT NULL,
+    error text NOT NULL,
+    created timestamp with time zone NOT NULL,
+    shard text DEFAULT ''::text NOT NULL
+);
+
+
+--
+-- Name: replication_errors; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE public.replication_errors (
+    target_name text NOT NULL,
+    event_id bigint NOT NULL,
+    id uuid NOT NULL,
+    event_type text NOT NULL,
+    error text NOT NULL,
+    attempts integer NOT NULL,
+    created timestamp with time zone NOT NULL,
+    first_seen timestamp with time zone NOT NULL,
+    shard text DEFAULT ''::text NOT NULL
+);
+
+
 --
 -- Name: replication_target; Type: TABLE; Schema: public; Owner: -
 --
@@ -78,7 +129,8 @@ CREATE TABLE public.schema_version (
 
 CREATE TABLE public.state (
     name text NOT NULL,
-    value jsonb NOT NULL
+    value jsonb NOT NULL,
+    revision bigint DEFAULT 0 NOT NULL
 );
 
 
@@ -91,7 +143,8 @@ CREATE TABLE public.version_mapping (
     source_version bigint NOT NULL,
     target_version bigint NOT NULL,
     created timestamp with time zone NOT NULL,
-    target_name text DEFAULT 'default'::text NOT NULL
+    target_name text DEFAULT 'default'::text NOT NULL,
+    event_id bigint
 );
 
 
@@ -111,6 +164,30 @@ ALTER TABLE ONLY public.job_lock
     ADD CONSTRAINT job_lock_pkey PRIMARY KEY (name);
 
 
+--
+-- Name: replication_conflicts replication_conflicts_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY public.replication_conflicts
+    ADD CONSTRAINT replication_conflicts_pkey PRIMARY KEY (target_name, shard, event_id);
+
+
+--
+-- Name: replication_deadletter replication_deadletter_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY public.replication_deadletter
+    ADD CONSTRAINT replication_deadletter_pkey PRIMARY KEY (target_name, shard, event_id);
+
+
+--
+-- Name: replication_errors replication_errors_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY public.replication_errors
+    ADD CONSTRAINT replication_errors_pkey PRIMARY KEY (target_name, shard, event_id);
+
+
 --
 -- Name: replication_target replication_target_pkey; Type: CONSTRAINT; Schema: public; Owner: -
 --
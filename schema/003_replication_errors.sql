@@ -0,0 +1,14 @@
+CREATE TABLE replication_errors (
+       target_name text NOT NULL,
+       event_id    bigint NOT NULL,
+       id          uuid NOT NULL,
+       event_type  text NOT NULL,
+       error       text NOT NULL,
+       attempts    integer NOT NULL,
+       created     timestamptz NOT NULL,
+       PRIMARY KEY (target_name, event_id)
+);
+
+---- create above / drop below ----
+
+DROP TABLE IF EXISTS replication_errors;
@@ -0,0 +1,14 @@
+CREATE TABLE replication_deadletter (
+       target_name    text NOT NULL,
+       event_id       bigint NOT NULL,
+       event          jsonb NOT NULL,
+       update_type    text NOT NULL,
+       target_version bigint NOT NULL,
+       error          text NOT NULL,
+       created        timestamptz NOT NULL,
+       PRIMARY KEY (target_name, event_id)
+);
+
+---- create above / drop below ----
+
+DROP TABLE IF EXISTS replication_deadletter;
@@ -0,0 +1,5 @@
+ALTER TABLE state ADD COLUMN revision bigint NOT NULL DEFAULT 0;
+
+---- create above / drop below ----
+
+ALTER TABLE state DROP COLUMN revision;
@@ -0,0 +1,5 @@
+ALTER TABLE version_mapping ADD COLUMN event_id bigint;
+
+---- create above / drop below ----
+
+ALTER TABLE version_mapping DROP COLUMN event_id;
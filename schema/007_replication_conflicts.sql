@@ -0,0 +1,14 @@
+CREATE TABLE replication_conflicts (
+       target_name      text NOT NULL,
+       event_id         bigint NOT NULL,
+       id               uuid NOT NULL,
+       event_type       text NOT NULL,
+       expected_version bigint NOT NULL,
+       target_version   bigint NOT NULL,
+       created          timestamptz NOT NULL,
+       PRIMARY KEY (target_name, event_id)
+);
+
+---- create above / drop below ----
+
+DROP TABLE IF EXISTS replication_conflicts;
@@ -0,0 +1,9 @@
+ALTER TABLE replication_errors ADD COLUMN first_seen timestamptz;
+
+UPDATE replication_errors SET first_seen = created;
+
+ALTER TABLE replication_errors ALTER COLUMN first_seen SET NOT NULL;
+
+---- create above / drop below ----
+
+ALTER TABLE replication_errors DROP COLUMN first_seen;
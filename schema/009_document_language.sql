@@ -0,0 +1,5 @@
+ALTER TABLE document ADD COLUMN language text;
+
+---- create above / drop below ----
+
+ALTER TABLE document DROP COLUMN language;
@@ -0,0 +1,30 @@
+ALTER TABLE replication_errors ADD COLUMN shard text NOT NULL DEFAULT '';
+ALTER TABLE replication_errors DROP CONSTRAINT replication_errors_pkey;
+ALTER TABLE replication_errors ADD PRIMARY KEY (target_name, shard, event_id);
+
+ALTER TABLE replication_deadletter ADD COLUMN shard text NOT NULL DEFAULT '';
+ALTER TABLE replication_deadletter DROP CONSTRAINT replication_deadletter_pkey;
+ALTER TABLE replication_deadletter ADD PRIMARY KEY (target_name, shard, event_id);
+
+ALTER TABLE replication_conflicts ADD COLUMN shard text NOT NULL DEFAULT '';
+ALTER TABLE replication_conflicts DROP CONSTRAINT replication_conflicts_pkey;
+ALTER TABLE replication_conflicts ADD PRIMARY KEY (target_name, shard, event_id);
+
+---- create above / drop below ----
+
+-- Event IDs of different shards can collide, so only the rows of unsharded
+-- sources are kept.
+DELETE FROM replication_errors WHERE shard != '';
+ALTER TABLE replication_errors DROP CONSTRAINT replication_errors_pkey;
+ALTER TABLE replication_errors ADD PRIMARY KEY (target_name, event_id);
+ALTER TABLE replication_errors DROP COLUMN shard;
+
+DELETE FROM replication_deadletter WHERE shard != '';
+ALTER TABLE replication_deadletter DROP CONSTRAINT replication_deadletter_pkey;
+ALTER TABLE replication_deadletter ADD PRIMARY KEY (target_name, event_id);
+ALTER TABLE replication_deadletter DROP COLUMN shard;
+
+DELETE FROM replication_conflicts WHERE shard != '';
+ALTER TABLE replication_conflicts DROP CONSTRAINT replication_conflicts_pkey;
+ALTER TABLE replication_conflicts ADD PRIMARY KEY (target_name, event_id);
+ALTER TABLE replication_conflicts DROP COLUMN shard;
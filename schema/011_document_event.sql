@@ -0,0 +1,5 @@
+ALTER TABLE document ADD COLUMN last_event bigint;
+
+---- create above / drop below ----
+
+ALTER TABLE document DROP COLUMN last_event;